@@ -36,7 +36,7 @@ unset GOARCH
 
 # Build the server
 echo "Building server..."
-go build -o server cmd/server/main.go
+go build -o server ./cmd/server
 
 echo "Build complete!"
 echo "Run './server' to start the server, then visit http://localhost:8080"
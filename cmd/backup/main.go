@@ -0,0 +1,158 @@
+// Command backup exports a game database to a portable archive and restores
+// archives into any backend:
+//
+//	backup -store file -data-dir data export poker-backup.json.gz
+//	backup -store sqlite -data-dir restored restore poker-backup.json.gz
+//
+// The server's league, league.json in the data directory, goes into the
+// archive with the database and is restored with it. An archive of "-" is
+// standard output or input. Restoring with -store memory reads the archive
+// into an in-memory store and discards it, which checks the archive without
+// writing anywhere.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/db/backend"
+	"go-wasm-poker/pkg/league"
+)
+
+func main() {
+	dataDir := flag.String("data-dir", "data", "directory the game database is kept in")
+	storeName := flag.String("store", "file", "database backend: "+backend.Names)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] export|restore archive\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	command, archive := flag.Arg(0), flag.Arg(1)
+
+	ctx := context.Background()
+	store, err := backend.Open(ctx, *storeName, *dataDir)
+	if errors.Is(err, db.ErrLocked) {
+		log.Fatalf("The database in %s is in use, stop the server before backing it up or restoring into it: %v", *dataDir, err)
+	}
+	if err != nil {
+		log.Fatalf("Failed to open the database in %s: %v", *dataDir, err)
+	}
+	defer store.Close()
+
+	leaguePath := filepath.Join(*dataDir, "league.json")
+	if *storeName == "memory" {
+		leaguePath = ""
+	}
+	var snap *db.Snapshot
+	switch command {
+	case "export":
+		snap, err = export(ctx, store, leaguePath, archive)
+	case "restore":
+		snap, err = restore(ctx, store, leaguePath, archive)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		store.Close()
+		log.Fatalf("Failed to %s %s: %v", command, archive, err)
+	}
+	withLeague := "no league"
+	if snap.League != nil {
+		withLeague = "the league"
+	}
+	log.Printf("%s: %d games, %d profiles, %d history entries, %d ledger transactions and %s as of %s",
+		command, len(snap.Games), len(snap.Profiles), len(snap.History), len(snap.Transactions), withLeague, snap.TakenAt.Format("2006-01-02 15:04:05 MST"))
+}
+
+// export writes a snapshot of store, and of the league at leaguePath if
+// there is one, to the archive at path. A file is written under a temporary
+// name first, so a failed export never leaves a partial archive in its
+// place.
+func export(ctx context.Context, store db.Store, leaguePath, path string) (*db.Snapshot, error) {
+	snap, err := store.Export(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if leaguePath != "" {
+		data, err := os.ReadFile(leaguePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		snap.League = data
+	}
+	if path == "-" {
+		return snap, db.WriteSnapshot(os.Stdout, snap)
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+	if err := db.WriteSnapshot(f, snap); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return snap, os.Rename(tmp, path)
+}
+
+// restore reads the archive at path into store, which must be empty, and
+// writes its league to leaguePath, where there must be none. With an empty
+// leaguePath the league is only checked.
+func restore(ctx context.Context, store db.Store, leaguePath, path string) (*db.Snapshot, error) {
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	snap, err := db.ReadSnapshot(r)
+	if err != nil {
+		return nil, err
+	}
+	if snap.League != nil {
+		if _, err := league.Read(bytes.NewReader(snap.League)); err != nil {
+			return nil, fmt.Errorf("reading the league: %w", err)
+		}
+		if leaguePath != "" {
+			if _, err := os.Stat(leaguePath); err == nil {
+				return nil, fmt.Errorf("%s already exists", leaguePath)
+			}
+		}
+	}
+	if err := db.Restore(ctx, store, snap); err != nil {
+		return nil, err
+	}
+	if snap.League == nil || leaguePath == "" {
+		return snap, nil
+	}
+	tmp := leaguePath + ".tmp"
+	defer os.Remove(tmp)
+	if err := os.WriteFile(tmp, snap.League, 0o644); err != nil {
+		return nil, err
+	}
+	return snap, os.Rename(tmp, leaguePath)
+}
@@ -0,0 +1,31 @@
+// Command examplebot is the reference client for the external bot protocol.
+// It checks when it can, calls small bets and folds to big ones, which is
+// enough to show how a bot reads requests and picks a legal reply.
+package main
+
+import (
+	"log"
+	"os"
+
+	"go-wasm-poker/pkg/botproto"
+)
+
+func main() {
+	err := botproto.Serve(os.Stdin, os.Stdout, func(req *botproto.Request) botproto.Response {
+		me := req.State.Players[req.Seat]
+		toCall := req.State.CurrentBet - me.Bet
+
+		for _, a := range req.Legal {
+			if a.Action == "check" {
+				return botproto.Response{Action: "check"}
+			}
+		}
+		if toCall*4 <= req.State.Pot {
+			return botproto.Response{Action: "call"}
+		}
+		return botproto.Response{Action: "fold"}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"log"
 	"os"
 	"syscall/js"
@@ -12,6 +14,7 @@ import (
 	"go-wasm-poker/pkg/db"
 	"go-wasm-poker/pkg/game"
 	"go-wasm-poker/pkg/ui"
+	"go-wasm-poker/pkg/wire"
 )
 
 func main() {
@@ -29,6 +32,7 @@ func main() {
 		log.Println("Starting new game from JavaScript")
 		return nil
 	}))
+	js.Global().Set("decodeWireMessage", js.FuncOf(decodeWireMessage))
 
 	go func() {
 		w := app.NewWindow(
@@ -43,7 +47,27 @@ func main() {
 	app.Main()
 }
 
-func run(w *app.Window, mockDB *db.MockSpaceTimeDB) error {
+// decodeWireMessage decodes a binary message from the server, passed as a
+// Uint8Array, and returns it as JSON, or null if it is malformed
+func decodeWireMessage(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		return js.Null()
+	}
+	data := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(data, args[0])
+	m, err := wire.Decode(data)
+	if err != nil {
+		log.Printf("Failed to decode message: %v", err)
+		return js.Null()
+	}
+	out, err := json.Marshal(m)
+	if err != nil {
+		return js.Null()
+	}
+	return string(out)
+}
+
+func run(w *app.Window, store db.Store) error {
 	// Create sample players
 	players := []*game.Player{
 		game.NewPlayer("1", "Player 1", 1000, 0),
@@ -54,18 +78,20 @@ func run(w *app.Window, mockDB *db.MockSpaceTimeDB) error {
 
 	// Create game state
 	gameState := game.NewGameState(players, 5, 10)
-	gameState.StartNewHand()
 
-	// Save initial game state to mock database
+	// Save initial game state to mock database, and every hand from then on
 	gameID := "game-1"
-	err := mockDB.SaveGameState(gameID, gameState)
+	err := store.SaveGameState(context.Background(), gameID, gameState)
 	if err != nil {
 		log.Printf("Failed to save game state: %v", err)
 	}
+	db.TrackGame(store, gameID, gameState)
 
 	// Create UI theme and game UI
 	theme := ui.NewTheme()
 	gameUI := ui.NewGameUI(theme, gameState)
+	gameUI.Invalidate = w.Invalidate
+	gameState.StartNewHand()
 
 	// Operations variable
 	var ops op.Ops
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/game"
+	"go-wasm-poker/pkg/history"
+	"go-wasm-poker/pkg/league"
+)
+
+// maxReport is the largest request body a client may post
+const maxReport = 16 << 20
+
+// api serves JSON from the store and the league:
+//
+//	GET /api/players/{id}          the player's profile
+//	GET /api/players/{id}/ratings  the player's latest rating changes
+//	GET /api/games/{id}/history    the game's history
+//	GET /api/history?player=&game=&from=&to=&bb=&min_pot=&rank=&order=&limit=&cursor=
+//	                               a page of hands from every game, newest
+//	                               first unless order is oldest or pot; pass
+//	                               a page's next as cursor for the one after
+//	GET /api/history/summary?...   totals over the hands the same filters
+//	                               select
+//	GET /api/games/{id}/state      the game as a spectator sees it
+//	GET /api/games/{id}/versions   the kept versions of the game, as a
+//	                               spectator sees them
+//	GET /api/games/{id}/events     the spectator view after every save, as
+//	                               server-sent events
+//	GET /api/seasons               the league's seasons
+//	GET /api/seasons/{id}/leaderboard?by=net|points|hands&limit=n
+//	                               a season's leaderboard, by points unless
+//	                               by says otherwise
+//	GET /api/seasons/{id}/snapshot an archived season's final standings
+//
+// and, from clients holding the results token, takes the results of play:
+//
+//	POST /api/hands?game={id}      a file of PokerStars or OpenHH hand
+//	                               histories; every hand that replays
+//	                               cleanly and hasn't been counted yet is
+//	                               added to the game's history and the
+//	                               league
+//	POST /api/tournaments          a finished league.Tournament, as JSON
+type api struct {
+	store      db.Store
+	league     *league.League // nil when the server has no league
+	leaguePath string         // where the league is saved after each result
+	token      string         // the results token, no results taken when empty
+
+	reportMu sync.Mutex // held while adding hands, so a hand posted twice at once is added once
+}
+
+func newAPI(store db.Store, lg *league.League, leaguePath, token string) http.Handler {
+	return &api{store: store, league: lg, leaguePath: leaguePath, token: token}
+}
+
+func (a *api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/"), "/"), "/")
+	if r.Method == http.MethodPost {
+		a.report(w, r, parts)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	if len(parts) == 3 && parts[0] == "games" && parts[2] == "events" {
+		a.events(w, r, parts[1])
+		return
+	}
+	var v any
+	var err error
+	switch {
+	case len(parts) == 2 && parts[0] == "players":
+		v, err = a.store.LoadPlayerProfile(ctx, parts[1])
+	case len(parts) == 3 && parts[0] == "players" && parts[2] == "ratings":
+		p, lerr := a.store.LoadPlayerProfile(ctx, parts[1])
+		if lerr == nil {
+			v = p.RatingHistory
+		}
+		err = lerr
+	case len(parts) >= 1 && len(parts) <= 2 && parts[0] == "history":
+		f, ferr := historyFilter(r)
+		if ferr != nil {
+			http.Error(w, ferr.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(parts) == 2 {
+			if parts[1] != "summary" {
+				http.NotFound(w, r)
+				return
+			}
+			v, err = a.store.SummarizeHistory(ctx, f)
+			break
+		}
+		q := db.HistoryQuery{HistoryFilter: f, Cursor: r.URL.Query().Get("cursor")}
+		q.Limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+		switch order := r.URL.Query().Get("order"); order {
+		case "", "newest":
+		case "oldest":
+			q.Order = db.OldestFirst
+		case "pot":
+			q.Order = db.BiggestPotFirst
+		default:
+			http.Error(w, fmt.Sprintf("unknown order %q", order), http.StatusBadRequest)
+			return
+		}
+		v, err = a.store.QueryHistory(ctx, q)
+		if errors.Is(err, db.ErrBadCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case len(parts) == 3 && parts[0] == "games" && parts[2] == "history":
+		v, err = a.store.GetGameHistory(ctx, parts[1])
+	case len(parts) == 3 && parts[0] == "games" && parts[2] == "state":
+		state, lerr := a.store.LoadGameState(ctx, parts[1])
+		if lerr == nil {
+			// Never send the deck or hidden cards
+			v = state.SpectatorView()
+		}
+		err = lerr
+	case len(parts) == 3 && parts[0] == "games" && parts[2] == "versions":
+		versions, lerr := a.store.GameStateVersions(ctx, parts[1])
+		if lerr == nil {
+			v = versionViews(versions)
+		}
+		err = lerr
+	case a.league != nil && len(parts) == 1 && parts[0] == "seasons":
+		v = a.league.Seasons()
+	case a.league != nil && len(parts) == 3 && parts[0] == "seasons" && parts[2] == "leaderboard":
+		by := league.Metric(r.URL.Query().Get("by"))
+		if by == "" {
+			by = league.ByPoints
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		v, err = a.league.Leaderboard(parts[1], by, limit)
+		if err != nil && !errors.Is(err, league.ErrUnknownSeason) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case a.league != nil && len(parts) == 3 && parts[0] == "seasons" && parts[2] == "snapshot":
+		v, err = a.league.Snapshot(parts[1])
+		if err != nil && !errors.Is(err, league.ErrUnknownSeason) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if errors.Is(err, db.ErrNotFound) || errors.Is(err, league.ErrUnknownSeason) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("API %s: %v", r.URL.Path, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// reportResult is the reply to posted results
+type reportResult struct {
+	Added      int      `json:"added"`
+	Duplicates int      `json:"duplicates,omitempty"` // already counted, so left out
+	Rejected   []string `json:"rejected,omitempty"`
+}
+
+// report takes posted results. Hands are imported as by history.Import, so
+// hands that don't replay are left out and reported. A hand the league has
+// already counted, by table and ID, or a tournament with the ID of one it
+// has, is left out as a duplicate.
+func (a *api) report(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) != 1 || (parts[0] != "hands" && parts[0] != "tournaments") {
+		http.NotFound(w, r)
+		return
+	}
+	if a.token == "" || a.league == nil {
+		http.Error(w, "this server takes no results", http.StatusForbidden)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+a.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, maxReport)
+	var v any
+	if parts[0] == "hands" {
+		gameID := r.URL.Query().Get("game")
+		if gameID == "" {
+			http.Error(w, "hands need a game", http.StatusBadRequest)
+			return
+		}
+		res, err := history.Import(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result := reportResult{}
+		a.reportMu.Lock()
+		for _, h := range res.Hands {
+			if a.league.HasHand(h) {
+				result.Duplicates++
+				continue
+			}
+			if err := db.AddHand(r.Context(), a.store, gameID, h); err != nil {
+				a.reportMu.Unlock()
+				log.Printf("API %s: %v", r.URL.Path, err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			a.league.AddHand(h)
+			result.Added++
+		}
+		a.reportMu.Unlock()
+		for _, err := range res.Rejected {
+			result.Rejected = append(result.Rejected, err.Error())
+		}
+		v = result
+	} else {
+		var t league.Tournament
+		if err := json.NewDecoder(body).Decode(&t); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err := a.league.AddTournament(t)
+		switch {
+		case errors.Is(err, league.ErrCounted):
+			v = reportResult{Duplicates: 1}
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			v = reportResult{Added: 1}
+		}
+	}
+	if err := a.league.Save(a.leaguePath); err != nil {
+		log.Printf("Failed to save the league: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// historyFilter reads a history filter from a request's query. Times are
+// RFC 3339 and rank is a hand such as "flush" or "full_house".
+func historyFilter(r *http.Request) (db.HistoryFilter, error) {
+	query := r.URL.Query()
+	f := db.HistoryFilter{GameID: query.Get("game"), PlayerID: query.Get("player")}
+	for _, t := range []struct {
+		name string
+		to   *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if s := query.Get(t.name); s != "" {
+			parsed, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return f, fmt.Errorf("%s: %v", t.name, err)
+			}
+			*t.to = parsed
+		}
+	}
+	for _, n := range []struct {
+		name string
+		to   *int
+	}{{"bb", &f.BigBlind}, {"min_pot", &f.MinPot}} {
+		if s := query.Get(n.name); s != "" {
+			parsed, err := strconv.Atoi(s)
+			if err != nil {
+				return f, fmt.Errorf("%s: %v", n.name, err)
+			}
+			*n.to = parsed
+		}
+	}
+	if s := query.Get("rank"); s != "" {
+		name := strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(s))
+		for rank := game.HighCard; rank <= game.RoyalFlush; rank++ {
+			if strings.ToLower(rank.String()) == name {
+				min := rank
+				f.MinRank = &min
+				break
+			}
+		}
+		if f.MinRank == nil {
+			return f, fmt.Errorf("unknown hand rank %q", s)
+		}
+	}
+	return f, nil
+}
+
+// versionView is a kept version of a game without its hidden cards
+type versionView struct {
+	Version int64      `json:"version"`
+	SavedAt time.Time  `json:"saved_at"`
+	View    *game.View `json:"view"`
+}
+
+func versionViews(versions []*db.GameStateVersion) []versionView {
+	views := make([]versionView, len(versions))
+	for i, v := range versions {
+		views[i] = versionView{Version: v.Version, SavedAt: v.SavedAt, View: v.State.SpectatorView()}
+	}
+	return views
+}
+
+// events streams a game's spectator view each time it is saved, starting
+// with the current one if there is one. A client that falls behind skips to
+// the latest view.
+func (a *api) events(w http.ResponseWriter, r *http.Request, gameID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ctx := r.Context()
+	sub, err := a.store.Subscribe(ctx, db.Query{Kind: db.KindGameState, ID: gameID}, &db.SubscribeOptions{Buffer: 4, Overflow: db.OverflowDropOldest})
+	if err != nil {
+		log.Printf("API %s: %v", r.URL.Path, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	send := func(state *game.GameState) bool {
+		data, err := json.Marshal(state.SpectatorView())
+		if err != nil {
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: state\ndata: %s\n\n", data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	if state, err := a.store.LoadGameState(ctx, gameID); err == nil {
+		if !send(state) {
+			return
+		}
+	} else {
+		flusher.Flush()
+	}
+	for ch := range sub.C {
+		if ch.State != nil && !send(ch.State) {
+			return
+		}
+	}
+}
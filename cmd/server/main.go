@@ -1,27 +1,114 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
+
+	"go-wasm-poker/pkg/db/backend"
+	"go-wasm-poker/pkg/league"
+	"go-wasm-poker/pkg/retention"
 )
 
 func main() {
+	dataDir := flag.String("data-dir", "data", "directory the game database is kept in")
+	storeName := flag.String("store", "file", "database backend: "+backend.Names)
+	gameTTL := flag.Int("game-ttl-minutes", 0, "expire games nobody has saved for this many minutes, 0 to keep them")
+	archiveAfter := flag.Int("archive-after-days", 0, "move hands older than this many days to cold storage, 0 to keep them")
+	purgeAfter := flag.Int("purge-after-days", 0, "delete hands older than this many days, 0 to keep them")
+	coldDir := flag.String("cold-storage", "", "directory archived hands are written to, data-dir/archive when empty")
+	resultsToken := flag.String("results-token", os.Getenv("POKER_RESULTS_TOKEN"), "bearer token clients post hands and tournament results with, none accepted when empty")
+	flag.Parse()
+
+	store, err := backend.Open(context.Background(), *storeName, *dataDir)
+	if err != nil {
+		log.Fatalf("Failed to open the database in %s: %v", *dataDir, err)
+	}
+	defer store.Close()
+	log.Printf("Using the %s database in %s", *storeName, *dataDir)
+	leaguePath := filepath.Join(*dataDir, "league.json")
+	lg, err := openLeague(leaguePath)
+	if err != nil {
+		log.Fatalf("Failed to load the league: %v", err)
+	}
+	go keepLeague(context.Background(), lg, leaguePath, time.Minute)
+	if *gameTTL > 0 || *archiveAfter > 0 || *purgeAfter > 0 {
+		if *coldDir == "" {
+			*coldDir = filepath.Join(*dataDir, "archive")
+		}
+		day := 24 * time.Hour
+		j, err := retention.New(store, retention.Policy{
+			GameTTL:      time.Duration(*gameTTL) * time.Minute,
+			ArchiveAfter: time.Duration(*archiveAfter) * day,
+			PurgeAfter:   time.Duration(*purgeAfter) * day,
+		}, *coldDir)
+		if err != nil {
+			log.Fatalf("Invalid retention policy: %v", err)
+		}
+		go j.Loop(context.Background(), time.Minute)
+	}
+
 	// Serve static files from the web directory
 	fs := http.FileServer(http.Dir("web"))
-	
+
+	http.Handle("/api/", newAPI(store, lg, leaguePath, *resultsToken))
+
 	// Handle all requests
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// For wasm files, set the correct MIME type
 		if strings.HasSuffix(r.URL.Path, ".wasm") {
 			w.Header().Set("Content-Type", "application/wasm")
 		}
-		
+
 		// Serve the file
 		fs.ServeHTTP(w, r)
 	})
-	
+
 	// Start the server
 	log.Println("Starting server on :8080...")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
+
+// openLeague loads the league kept at path, and starts a new one with the
+// default points when there is none
+func openLeague(path string) (*league.League, error) {
+	lg, err := league.Load(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return league.New(nil), nil
+	}
+	return lg, err
+}
+
+// keepLeague runs the league's weekly seasons until ctx is done: every
+// interval it adds the current week's season, archives the seasons that
+// have ended and saves the league to path
+func keepLeague(ctx context.Context, lg *league.League, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		week := league.Weekly(now)
+		if _, _, err := lg.Season(week.ID); errors.Is(err, league.ErrUnknownSeason) {
+			if err := lg.AddSeason(week); err != nil {
+				log.Printf("Failed to add season %s: %v", week.ID, err)
+			}
+		}
+		for _, snap := range lg.ArchiveEnded(now) {
+			log.Printf("Archived season %s with %d players", snap.Season.ID, len(snap.Standings))
+		}
+		if err := lg.Save(path); err != nil {
+			log.Printf("Failed to save the league: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go-wasm-poker/pkg/bot"
+	"go-wasm-poker/pkg/cfr"
+	"go-wasm-poker/pkg/history"
+	"go-wasm-poker/pkg/sim"
+	"go-wasm-poker/pkg/stats"
+)
+
+// botFlags collects repeated -bot flags
+type botFlags []string
+
+func (b *botFlags) String() string { return strings.Join(*b, ", ") }
+
+func (b *botFlags) Set(v string) error {
+	*b = append(*b, v)
+	return nil
+}
+
+func main() {
+	var bots botFlags
+	flag.Var(&bots, "bot", "bot to seat, as [name=]kind[:arg] with kind call, random, cfr:<strategy file> or exec:<command line>; repeat for each seat")
+	hands := flag.Int("hands", 100000, "number of hands to play")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed for the deals")
+	duplicate := flag.Bool("duplicate", false, "replay every deal with the bots rotated through the seats")
+	workers := flag.Int("workers", 0, "parallel workers, 0 for one per CPU")
+	smallBlind := flag.Int("sb", 1, "small blind")
+	bigBlind := flag.Int("bb", 2, "big blind")
+	stack := flag.Int("stack", 200, "starting stack of every hand")
+	timeLimit := flag.Duration("time-limit", time.Second, "time limit per action for exec bots")
+	format := flag.String("format", "csv", "output format: csv or json")
+	out := flag.String("out", "", "output file, standard output when empty")
+	historyFile := flag.String("history", "", "file to write every hand to")
+	historyFormat := flag.String("history-format", "pokerstars", "hand history format: pokerstars or openhh")
+	statsFile := flag.String("stats", "", "file to write each bot's playing statistics to, as CSV")
+	flag.Parse()
+
+	if len(bots) < 2 {
+		log.Fatal("At least two -bot flags are required")
+	}
+	entrants := make([]sim.Entrant, 0, len(bots))
+	for i, spec := range bots {
+		e, err := newEntrant(spec, i, *seed, *timeLimit)
+		if err != nil {
+			log.Fatalf("Invalid bot %q: %v", spec, err)
+		}
+		// Names identify players in results and hand histories
+		base := e.Name
+		for n := 2; nameTaken(entrants, e.Name); n++ {
+			e.Name = fmt.Sprintf("%s-%d", base, n)
+		}
+		entrants = append(entrants, e)
+	}
+
+	cfg := sim.Config{
+		Hands:      *hands,
+		Seed:       *seed,
+		Duplicate:  *duplicate,
+		Workers:    *workers,
+		SmallBlind: *smallBlind,
+		BigBlind:   *bigBlind,
+		Stack:      *stack,
+	}
+	if *historyFile != "" {
+		f, err := os.Create(*historyFile)
+		if err != nil {
+			log.Fatalf("Failed to create history file: %v", err)
+		}
+		defer f.Close()
+		cfg.History = f
+		switch *historyFormat {
+		case "pokerstars":
+		case "openhh":
+			cfg.HistoryFormat = history.WriteOpenHH
+		default:
+			log.Fatalf("Unknown history format %q", *historyFormat)
+		}
+	}
+	var tracker *stats.Tracker
+	if *statsFile != "" {
+		tracker = stats.NewTracker(nil)
+		cfg.OnHand = tracker.Observe
+	}
+	start := time.Now()
+	results, err := sim.Run(cfg, entrants)
+	if err != nil {
+		log.Fatalf("Simulation failed: %v", err)
+	}
+	log.Printf("Played %d hands in %s", results[0].Hands, time.Since(start).Round(time.Millisecond))
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Failed to create output file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "csv":
+		err = writeCSV(w, results)
+	case "json":
+		err = writeJSON(w, cfg, results)
+	default:
+		log.Fatalf("Unknown format %q", *format)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write results: %v", err)
+	}
+	if tracker != nil {
+		if err := writeStatsFile(*statsFile, tracker, entrants); err != nil {
+			log.Fatalf("Failed to write statistics: %v", err)
+		}
+	}
+}
+
+func nameTaken(entrants []sim.Entrant, name string) bool {
+	for _, e := range entrants {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newEntrant parses the index'th -bot flag
+func newEntrant(spec string, index int, seed int64, timeLimit time.Duration) (sim.Entrant, error) {
+	name, kind := "", spec
+	if i := strings.Index(spec, "="); i >= 0 {
+		name, kind = spec[:i], spec[i+1:]
+	}
+	kind, arg, _ := strings.Cut(kind, ":")
+	if name == "" {
+		name = kind
+	}
+
+	// Every worker gets its own instance with its own seed, and entrants of
+	// the same kind get different ones
+	var instances int64
+	nextSeed := func() int64 {
+		return seed ^ int64(index+1)<<32 ^ atomic.AddInt64(&instances, 1)
+	}
+
+	switch kind {
+	case "call":
+		return sim.Entrant{Name: name, New: func() (bot.Bot, error) {
+			return bot.CallBot{}, nil
+		}}, nil
+	case "random":
+		return sim.Entrant{Name: name, New: func() (bot.Bot, error) {
+			return bot.NewRandomBot(nextSeed()), nil
+		}}, nil
+	case "cfr":
+		cp, err := cfr.LoadCheckpoint(arg)
+		if err != nil {
+			return sim.Entrant{}, err
+		}
+		if cp.Holdem == nil {
+			return sim.Entrant{}, fmt.Errorf("%s is not a hold'em strategy", arg)
+		}
+		strategy := cp.Strategy()
+		return sim.Entrant{Name: name, New: func() (bot.Bot, error) {
+			return cfr.NewBot(name, strategy, cfr.NewHoldem(*cp.Holdem), nextSeed()), nil
+		}}, nil
+	case "exec":
+		fields := strings.Fields(arg)
+		if len(fields) == 0 {
+			return sim.Entrant{}, fmt.Errorf("missing command")
+		}
+		return sim.Entrant{Name: name, New: func() (bot.Bot, error) {
+			return bot.StartExternal(name, timeLimit, fields[0], fields[1:]...)
+		}}, nil
+	}
+	return sim.Entrant{}, fmt.Errorf("unknown kind %q", kind)
+}
+
+func writeCSV(w io.Writer, results []sim.Result) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "hands", "net_chips", "bb_per_100", "ci95_low", "ci95_high"})
+	for _, r := range results {
+		cw.Write([]string{
+			r.Name,
+			strconv.Itoa(r.Hands),
+			strconv.FormatInt(r.Net, 10),
+			strconv.FormatFloat(r.BBPer100, 'f', 3, 64),
+			strconv.FormatFloat(r.CILow, 'f', 3, 64),
+			strconv.FormatFloat(r.CIHigh, 'f', 3, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeJSON(w io.Writer, cfg sim.Config, results []sim.Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Hands     int          `json:"hands"`
+		Seed      int64        `json:"seed"`
+		Duplicate bool         `json:"duplicate"`
+		BigBlind  int          `json:"big_blind"`
+		Results   []sim.Result `json:"results"`
+	}{cfg.Hands, cfg.Seed, cfg.Duplicate, cfg.BigBlind, results})
+}
+
+// writeStatsFile writes each bot's statistics. The simulator's player IDs
+// are entrant indexes.
+func writeStatsFile(path string, tracker *stats.Tracker, entrants []sim.Entrant) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cw := csv.NewWriter(f)
+	cw.Write([]string{"name", "hands", "vpip", "pfr", "three_bet", "af", "wtsd", "wsd", "net_chips", "biggest_pot"})
+	percent := func(v float64) string { return strconv.FormatFloat(v, 'f', 1, 64) }
+	for i, e := range entrants {
+		c := tracker.Player(strconv.Itoa(i))
+		cw.Write([]string{
+			e.Name,
+			strconv.Itoa(c.Hands),
+			percent(c.VPIP()),
+			percent(c.PFR()),
+			percent(c.ThreeBet()),
+			strconv.FormatFloat(c.AF(), 'f', 2, 64),
+			percent(c.WTSD()),
+			percent(c.WSD()),
+			strconv.Itoa(c.Net),
+			strconv.Itoa(c.BiggestPot),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
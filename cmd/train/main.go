@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"go-wasm-poker/pkg/cfr"
+)
+
+func main() {
+	gameName := flag.String("game", "holdem", "game to train: kuhn, leduc or holdem")
+	iterations := flag.Int("iterations", 100000, "number of MCCFR iterations to run")
+	every := flag.Int("checkpoint-every", 10000, "iterations between checkpoints")
+	out := flag.String("out", "strategy.json", "checkpoint file to write")
+	resume := flag.String("resume", "", "checkpoint file to resume from")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed")
+	stack := flag.Int("stack", 200, "hold'em starting stack in chips")
+	buckets := flag.Int("buckets", 8, "hold'em card buckets per street")
+	samples := flag.Int("samples", 64, "hold'em rollouts per equity estimate")
+	flag.Parse()
+
+	if *every <= 0 {
+		*every = *iterations
+	}
+
+	var g cfr.Game
+	switch *gameName {
+	case "kuhn":
+		g = cfr.Kuhn{}
+	case "leduc":
+		g = cfr.Leduc{}
+	case "holdem":
+		cfg := cfr.DefaultHoldemConfig()
+		cfg.Stack = *stack
+		cfg.Buckets = *buckets
+		cfg.Samples = *samples
+		g = cfr.NewHoldem(cfg)
+	default:
+		log.Fatalf("Unknown game %q", *gameName)
+	}
+
+	trainer := cfr.NewTrainer(g, *seed)
+	if *resume != "" {
+		cp, err := cfr.LoadCheckpoint(*resume)
+		if err != nil {
+			log.Fatalf("Failed to load checkpoint: %v", err)
+		}
+		if cp.Holdem != nil {
+			// The abstraction is the checkpoint's, so flags that would
+			// change it can't be honored
+			saved := map[string]int{"stack": cp.Holdem.Stack, "buckets": cp.Holdem.Buckets, "samples": cp.Holdem.Samples}
+			given := map[string]int{"stack": *stack, "buckets": *buckets, "samples": *samples}
+			flag.Visit(func(f *flag.Flag) {
+				if v, ok := saved[f.Name]; ok && given[f.Name] != v {
+					log.Fatalf("-%s %d conflicts with %d in the checkpoint being resumed", f.Name, given[f.Name], v)
+				}
+			})
+			g = cfr.NewHoldem(*cp.Holdem)
+		}
+		trainer, err = cfr.ResumeTrainer(g, cp, *seed)
+		if err != nil {
+			log.Fatalf("Failed to resume training: %v", err)
+		}
+		log.Printf("Resuming %s from iteration %d", g.Name(), trainer.Iterations)
+	}
+
+	start := time.Now()
+	for done := 0; done < *iterations; {
+		batch := *every
+		if remaining := *iterations - done; batch > remaining {
+			batch = remaining
+		}
+		trainer.Train(batch)
+		done += batch
+
+		if err := trainer.Save(*out); err != nil {
+			log.Fatalf("Failed to save checkpoint: %v", err)
+		}
+		log.Printf("Iteration %d: %d information sets, %s elapsed", trainer.Iterations, len(trainer.Nodes), time.Since(start).Round(time.Second))
+
+		if exploitability, err := cfr.Exploitability(g, trainer.Strategy()); err == nil {
+			log.Printf("Exploitability: %.5f chips per hand", exploitability)
+		}
+	}
+	log.Printf("Strategy written to %s", *out)
+}
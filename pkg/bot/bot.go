@@ -0,0 +1,40 @@
+package bot
+
+import "go-wasm-poker/pkg/game"
+
+// Bot decides actions for a seat at the table
+type Bot interface {
+	// Name returns the bot's display name
+	Name() string
+	// Act returns the action and amount to pass to GameState.ProcessAction
+	// for the player at seat, which is the current player
+	Act(state *game.GameState, seat int) (game.PlayerAction, int)
+}
+
+// IsLegal returns whether action and amount are accepted by ProcessAction for
+// the current player
+func IsLegal(state *game.GameState, action game.PlayerAction, amount int) bool {
+	for _, a := range state.LegalActions() {
+		if a.Action != action {
+			continue
+		}
+		switch action {
+		case game.Bet, game.Raise:
+			return amount >= a.Min && amount <= a.Max
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// Fallback returns the most passive legal action, checking when possible and
+// folding otherwise. Bots use it when they have no better answer.
+func Fallback(state *game.GameState) (game.PlayerAction, int) {
+	for _, a := range state.LegalActions() {
+		if a.Action == game.Check {
+			return game.Check, 0
+		}
+	}
+	return game.Fold, 0
+}
@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"go-wasm-poker/pkg/botproto"
+	"go-wasm-poker/pkg/game"
+)
+
+// ExternalBot runs a bot as a separate process speaking the botproto
+// protocol over its standard input and output. A bot that doesn't answer
+// within the time limit, or answers with anything but a legal action, folds.
+type ExternalBot struct {
+	name      string
+	timeLimit time.Duration
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	replies   chan []byte
+
+	mu     sync.Mutex
+	nextID int
+}
+
+// StartExternal starts command as a bot process
+func StartExternal(name string, timeLimit time.Duration, command string, args ...string) (*ExternalBot, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	b := &ExternalBot{
+		name:      name,
+		timeLimit: timeLimit,
+		cmd:       cmd,
+		stdin:     stdin,
+		replies:   make(chan []byte, 1),
+	}
+	go b.readReplies(stdout)
+	return b, nil
+}
+
+// maxReply is the longest reply line read from a bot process
+const maxReply = 1 << 20
+
+// readReplies forwards each line the process writes until it exits. A line
+// longer than maxReply is dropped, so the request it answers times out,
+// rather than ending the bot.
+func (b *ExternalBot) readReplies(stdout io.Reader) {
+	r := bufio.NewReader(stdout)
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		switch {
+		case tooLong:
+		case len(line)+len(chunk) > maxReply:
+			log.Printf("Bot %s: dropping a reply longer than %d bytes", b.name, maxReply)
+			line, tooLong = nil, true
+		default:
+			line = append(line, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if !tooLong && len(line) > 0 {
+			b.replies <- bytes.TrimRight(line, "\r\n")
+		}
+		line, tooLong = nil, false
+		if err != nil {
+			break
+		}
+	}
+	close(b.replies)
+}
+
+// Name returns the bot's display name
+func (b *ExternalBot) Name() string {
+	return b.name
+}
+
+// Act sends the redacted state to the process and waits for its action
+func (b *ExternalBot) Act(state *game.GameState, seat int) (game.PlayerAction, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	id := b.nextID
+	data, err := json.Marshal(botproto.NewRequest(id, state, seat, b.timeLimit))
+	if err != nil {
+		log.Printf("Bot %s: encoding request: %v", b.name, err)
+		return game.Fold, 0
+	}
+	if _, err := b.stdin.Write(append(data, '\n')); err != nil {
+		log.Printf("Bot %s: sending request: %v", b.name, err)
+		return game.Fold, 0
+	}
+
+	deadline := time.NewTimer(b.timeLimit)
+	defer deadline.Stop()
+	for {
+		select {
+		case line, ok := <-b.replies:
+			if !ok {
+				log.Printf("Bot %s: process exited, folding", b.name)
+				return game.Fold, 0
+			}
+			var resp botproto.Response
+			if err := json.Unmarshal(line, &resp); err != nil {
+				log.Printf("Bot %s: invalid reply %q, folding", b.name, line)
+				return game.Fold, 0
+			}
+			if resp.ID != id {
+				continue // a late answer to a request that already timed out
+			}
+			action, err := botproto.ParseAction(resp.Action)
+			if err != nil || !IsLegal(state, action, resp.Amount) {
+				log.Printf("Bot %s: illegal action %s %d, folding", b.name, resp.Action, resp.Amount)
+				return game.Fold, 0
+			}
+			return action, resp.Amount
+		case <-deadline.C:
+			log.Printf("Bot %s: no reply within %v, folding", b.name, b.timeLimit)
+			return game.Fold, 0
+		}
+	}
+}
+
+// Close shuts the bot down by closing its input, killing the process if it
+// hasn't exited within a second
+func (b *ExternalBot) Close() error {
+	b.stdin.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- b.cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		b.cmd.Process.Kill()
+		return <-done
+	}
+}
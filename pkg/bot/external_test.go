@@ -0,0 +1,20 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadReplies(t *testing.T) {
+	long := `{"id":1,"action":"call","note":"` + strings.Repeat("x", maxReply) + `"}`
+	b := &ExternalBot{name: "test", replies: make(chan []byte, 4)}
+	b.readReplies(strings.NewReader(long + "\n" + `{"id":2,"action":"fold"}` + "\r\n" + `{"id":3,"action":"check"}`))
+	var got []string
+	for line := range b.replies {
+		got = append(got, string(line))
+	}
+	want := []string{`{"id":2,"action":"fold"}`, `{"id":3,"action":"check"}`}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("read %q, want %q", got, want)
+	}
+}
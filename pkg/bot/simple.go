@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"math/rand"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// CallBot checks or calls every bet and never raises
+type CallBot struct{}
+
+// Name returns the bot's display name
+func (CallBot) Name() string { return "call" }
+
+// Act checks when possible and calls otherwise
+func (CallBot) Act(state *game.GameState, seat int) (game.PlayerAction, int) {
+	for _, a := range state.LegalActions() {
+		switch a.Action {
+		case game.Check:
+			return game.Check, 0
+		case game.Call:
+			return game.Call, 0
+		}
+	}
+	return Fallback(state)
+}
+
+// RandomBot picks uniformly among the legal actions, with a uniform amount
+// for bets and raises. It is not safe for concurrent use.
+type RandomBot struct {
+	rand *rand.Rand
+}
+
+// NewRandomBot creates a random bot
+func NewRandomBot(seed int64) *RandomBot {
+	return &RandomBot{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Name returns the bot's display name
+func (b *RandomBot) Name() string { return "random" }
+
+// Act picks a random legal action
+func (b *RandomBot) Act(state *game.GameState, seat int) (game.PlayerAction, int) {
+	actions := state.LegalActions()
+	if len(actions) == 0 {
+		return Fallback(state)
+	}
+	a := actions[b.rand.Intn(len(actions))]
+	amount := a.Min
+	if a.Max > a.Min {
+		amount += b.rand.Intn(a.Max - a.Min + 1)
+	}
+	return a.Action, amount
+}
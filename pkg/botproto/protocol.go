@@ -0,0 +1,192 @@
+// Package botproto implements the line-delimited JSON protocol used to run
+// bots as external processes. The engine writes requests to the bot's
+// standard input and reads responses from its standard output, one JSON
+// object per line. See docs/bot-protocol.md for the full specification.
+package botproto
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// Version is the protocol version sent in every request
+const Version = 1
+
+// TypeAct is the request type that asks the bot for an action
+const TypeAct = "act"
+
+// Request is a message from the engine to a bot
+type Request struct {
+	Type        string        `json:"type"`
+	Version     int           `json:"version"`
+	ID          int           `json:"id"`
+	TimeLimitMs int64         `json:"time_limit_ms"`
+	Seat        int           `json:"seat"`
+	State       *TableState   `json:"state"`
+	Legal       []LegalAction `json:"legal"`
+}
+
+// Response is a bot's reply to an act request
+type Response struct {
+	ID     int    `json:"id"`
+	Action string `json:"action"`
+	Amount int    `json:"amount,omitempty"`
+}
+
+// LegalAction is an action the bot may reply with. Amounts follow
+// GameState.ProcessAction: the total for a bet, the increment over the call
+// for a raise.
+type LegalAction struct {
+	Action string `json:"action"`
+	Min    int    `json:"min,omitempty"`
+	Max    int    `json:"max,omitempty"`
+}
+
+// TableState is the part of the game state a seat is allowed to see
+type TableState struct {
+	Phase      string      `json:"phase"`
+	Board      []string    `json:"board"`
+	Pot        int         `json:"pot"`
+	CurrentBet int         `json:"current_bet"`
+	MinRaise   int         `json:"min_raise"`
+	SmallBlind int         `json:"small_blind"`
+	BigBlind   int         `json:"big_blind"`
+	DealerPos  int         `json:"dealer_pos"`
+	CurrentPos int         `json:"current_pos"`
+	Players    []SeatState `json:"players"`
+}
+
+// SeatState describes one player. Cards are only filled in for the seat the
+// request is addressed to and for cards shown at showdown.
+type SeatState struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Chips    int      `json:"chips"`
+	Bet      int      `json:"bet"`
+	TotalBet int      `json:"total_bet"`
+	Status   string   `json:"status"`
+	Cards    []string `json:"cards,omitempty"`
+}
+
+var actionNames = map[game.PlayerAction]string{
+	game.Fold:  "fold",
+	game.Check: "check",
+	game.Call:  "call",
+	game.Bet:   "bet",
+	game.Raise: "raise",
+	game.AllIn: "allin",
+}
+
+var statusNames = map[game.PlayerStatus]string{
+	game.Active:      "active",
+	game.Folded:      "folded",
+	game.AllInStatus: "allin",
+	game.Out:         "out",
+}
+
+// ActionName returns the protocol name of an action
+func ActionName(a game.PlayerAction) string {
+	return actionNames[a]
+}
+
+// ParseAction returns the action with the given protocol name
+func ParseAction(name string) (game.PlayerAction, error) {
+	for action, n := range actionNames {
+		if n == name {
+			return action, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown action %q", name)
+}
+
+// NewRequest builds an act request for the current player at seat
+func NewRequest(id int, state *game.GameState, seat int, timeLimit time.Duration) *Request {
+	// Bots are only ever sent the seat's view of the table
+	view := state.ViewSeat(seat)
+	req := &Request{
+		Type:        TypeAct,
+		Version:     Version,
+		ID:          id,
+		TimeLimitMs: timeLimit.Milliseconds(),
+		Seat:        seat,
+		State:       newTableState(view),
+	}
+	for _, a := range view.Legal {
+		legal := LegalAction{Action: ActionName(a.Action)}
+		if a.Action == game.Bet || a.Action == game.Raise {
+			legal.Min, legal.Max = a.Min, a.Max
+		}
+		req.Legal = append(req.Legal, legal)
+	}
+	return req
+}
+
+func newTableState(v *game.View) *TableState {
+	ts := &TableState{
+		Phase:      v.Phase.String(),
+		Board:      cardCodes(v.Board),
+		Pot:        v.Pot,
+		CurrentBet: v.CurrentBet,
+		MinRaise:   v.MinRaise,
+		SmallBlind: v.SmallBlind,
+		BigBlind:   v.BigBlind,
+		DealerPos:  v.DealerPos,
+		CurrentPos: v.CurrentPos,
+	}
+	for _, p := range v.Players {
+		s := SeatState{
+			ID:       p.ID,
+			Name:     p.Name,
+			Chips:    p.Chips,
+			Bet:      p.Bet,
+			TotalBet: p.TotalBet,
+			Status:   statusNames[p.Status],
+		}
+		if len(p.Cards) > 0 {
+			s.Cards = cardCodes(p.Cards)
+		}
+		ts.Players = append(ts.Players, s)
+	}
+	return ts
+}
+
+func cardCodes(cards []game.Card) []string {
+	codes := make([]string, 0, len(cards))
+	for _, c := range cards {
+		codes = append(codes, c.Code())
+	}
+	return codes
+}
+
+// Handler decides the response to an act request
+type Handler func(req *Request) Response
+
+// Serve runs a bot: it reads requests from r, answers act requests with h
+// and writes the responses to w. Requests of other types are ignored so that
+// bots keep working when the engine adds new ones. Serve returns when r is
+// closed, which is how the engine shuts a bot down.
+func Serve(r io.Reader, w io.Writer, h Handler) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return fmt.Errorf("decoding request: %w", err)
+		}
+		if req.Type != TypeAct {
+			continue
+		}
+		resp := h(&req)
+		resp.ID = req.ID
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
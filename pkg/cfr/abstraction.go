@@ -0,0 +1,195 @@
+package cfr
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// Bucketer groups hands of similar strength into buckets. A hand's strength
+// is its equity against one random opponent hand, estimated by Monte Carlo
+// rollouts of the remaining board.
+type Bucketer struct {
+	Buckets int // number of buckets per street
+	Samples int // rollouts per equity estimate
+
+	mu      sync.Mutex
+	preflop map[string]float64
+}
+
+// NewBucketer creates a bucketer
+func NewBucketer(buckets, samples int) *Bucketer {
+	return &Bucketer{
+		Buckets: buckets,
+		Samples: samples,
+		preflop: make(map[string]float64),
+	}
+}
+
+// Bucket returns the bucket of a hand, from 0 (weakest) to Buckets-1
+func (b *Bucketer) Bucket(hole, board []game.Card) int {
+	bucket := int(b.Equity(hole, board) * float64(b.Buckets))
+	if bucket >= b.Buckets {
+		bucket = b.Buckets - 1
+	}
+	return bucket
+}
+
+// Equity estimates the share of the pot hole wins against a random hand. The
+// rollouts are seeded from the cards, so the same cards always give the same
+// estimate. Preflop estimates are cached per starting hand class.
+func (b *Bucketer) Equity(hole, board []game.Card) float64 {
+	if len(board) > 0 {
+		return b.rollout(hole, board)
+	}
+	class := handClass(hole)
+	b.mu.Lock()
+	equity, ok := b.preflop[class]
+	b.mu.Unlock()
+	if !ok {
+		equity = b.rollout(hole, board)
+		b.mu.Lock()
+		b.preflop[class] = equity
+		b.mu.Unlock()
+	}
+	return equity
+}
+
+func (b *Bucketer) rollout(hole, board []game.Card) float64 {
+	known := make([]game.Card, 0, len(hole)+len(board))
+	known = append(known, hole...)
+	known = append(known, board...)
+	deck := remainingCards(known)
+	r := rand.New(rand.NewSource(cardsSeed(known)))
+
+	need := 2 + 5 - len(board)
+	mine := make([]game.Card, 0, 7)
+	theirs := make([]game.Card, 0, 7)
+	won := 0.0
+	for i := 0; i < b.Samples; i++ {
+		// Partial Fisher-Yates: the first need cards of deck are the sample
+		for j := 0; j < need; j++ {
+			k := j + r.Intn(len(deck)-j)
+			deck[j], deck[k] = deck[k], deck[j]
+		}
+		runout := deck[2:need]
+
+		mine = append(append(append(mine[:0], hole...), board...), runout...)
+		theirs = append(append(append(theirs[:0], deck[:2]...), board...), runout...)
+		switch game.CompareHands(game.EvaluateHand(mine), game.EvaluateHand(theirs)) {
+		case 1:
+			won++
+		case 0:
+			won += 0.5
+		}
+	}
+	return won / float64(b.Samples)
+}
+
+// handClass names a starting hand by its ranks and whether it is suited,
+// such as "14-13s" for ace-king suited
+func handClass(hole []game.Card) string {
+	hi, lo := hole[0], hole[1]
+	if lo.Rank > hi.Rank {
+		hi, lo = lo, hi
+	}
+	suited := "o"
+	if hi.Suit == lo.Suit {
+		suited = "s"
+	}
+	return fmt.Sprintf("%d-%d%s", hi.Rank, lo.Rank, suited)
+}
+
+func remainingCards(known []game.Card) []game.Card {
+	deck := game.NewDeck().Cards
+	remaining := deck[:0]
+	for _, c := range deck {
+		used := false
+		for _, k := range known {
+			if c == k {
+				used = true
+				break
+			}
+		}
+		if !used {
+			remaining = append(remaining, c)
+		}
+	}
+	return remaining
+}
+
+func cardsSeed(cards []game.Card) int64 {
+	seed := int64(17)
+	for _, c := range cards {
+		seed = seed*59 + int64(c.Rank)*4 + int64(c.Suit)
+	}
+	return seed
+}
+
+// abstractAction is one of the moves of the bet abstraction. Fold and call
+// come first, then one bet or raise per configured pot fraction, then all-in.
+type abstractAction struct {
+	fold     bool
+	call     bool
+	allIn    bool
+	fraction float64
+}
+
+func abstractActions(betSizes []float64) []abstractAction {
+	actions := []abstractAction{{fold: true}, {call: true}}
+	for _, f := range betSizes {
+		actions = append(actions, abstractAction{fraction: f})
+	}
+	return append(actions, abstractAction{allIn: true})
+}
+
+// raiseSize returns the chips to add on top of a call for a pot-fraction bet,
+// where pot already includes the call
+func (a abstractAction) raiseSize(pot int) int {
+	return int(math.Round(a.fraction * float64(pot)))
+}
+
+// infoSetKey builds a hold'em information set key from features that can be
+// read off both the abstract game and a live GameState: the street, the
+// hand's bucket, whether the player has the button, and the pot, the amount
+// to call and the remaining stack measured in big blinds and pot ratios.
+func infoSetKey(street, bucket int, button bool, pot, toCall, stack, bigBlind int) string {
+	pos := 0
+	if button {
+		pos = 1
+	}
+
+	potClass := 0
+	if bbs := float64(pot) / float64(bigBlind); bbs > 1 {
+		potClass = int(math.Log2(bbs))
+	}
+
+	callClass := 0
+	if toCall > 0 {
+		switch ratio := float64(toCall) / float64(pot); {
+		case ratio <= 0.25:
+			callClass = 1
+		case ratio <= 0.6:
+			callClass = 2
+		case ratio <= 1.1:
+			callClass = 3
+		default:
+			callClass = 4
+		}
+	}
+
+	sprClass := 0
+	switch spr := float64(stack) / float64(pot); {
+	case spr >= 8:
+		sprClass = 3
+	case spr >= 3:
+		sprClass = 2
+	case spr >= 1:
+		sprClass = 1
+	}
+
+	return fmt.Sprintf("%d:%d:%d:p%d:c%d:s%d", street, bucket, pos, potClass, callClass, sprClass)
+}
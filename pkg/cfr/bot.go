@@ -0,0 +1,114 @@
+package cfr
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"go-wasm-poker/pkg/bot"
+	"go-wasm-poker/pkg/game"
+)
+
+// Bot plays a trained hold'em strategy at a GameState table. It maps the
+// table to an information set of the abstract game, samples an abstract
+// action from the strategy and translates it back into a legal action.
+// It is built for heads-up play; at bigger tables the dealer is treated as
+// the button and everyone else as the big blind.
+type Bot struct {
+	name     string
+	strategy Strategy
+	holdem   *Holdem
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewBot creates a bot that plays strategy in the given abstraction
+func NewBot(name string, strategy Strategy, holdem *Holdem, seed int64) *Bot {
+	return &Bot{
+		name:     name,
+		strategy: strategy,
+		holdem:   holdem,
+		rand:     rand.New(rand.NewSource(seed)),
+	}
+}
+
+// LoadBot creates a bot from a hold'em checkpoint written by the trainer
+func LoadBot(name, path string, seed int64) (*Bot, error) {
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Holdem == nil {
+		return nil, fmt.Errorf("checkpoint %s is for %s, not hold'em", path, cp.Game)
+	}
+	return NewBot(name, cp.Strategy(), NewHoldem(*cp.Holdem), seed), nil
+}
+
+// Name returns the bot's display name
+func (b *Bot) Name() string {
+	return b.name
+}
+
+// Act picks an action for the player at seat
+func (b *Bot) Act(state *game.GameState, seat int) (game.PlayerAction, int) {
+	if state.CurrentPhase > game.River {
+		return bot.Fallback(state)
+	}
+	player := state.Players[seat]
+	toCall := state.CurrentBet - player.Bet
+	key := infoSetKey(
+		int(state.CurrentPhase),
+		b.holdem.bucketer.Bucket(player.Cards, state.CommunityCards),
+		seat == state.DealerPos,
+		state.Pot,
+		toCall,
+		player.Chips,
+		state.BigBlind,
+	)
+	probs := b.strategy.Probabilities(key, len(b.holdem.actions))
+
+	b.mu.Lock()
+	choice := sample(probs, b.rand)
+	b.mu.Unlock()
+
+	action, amount := b.translate(state, player, b.holdem.actions[choice])
+	if !bot.IsLegal(state, action, amount) {
+		return bot.Fallback(state)
+	}
+	return action, amount
+}
+
+// translate turns an abstract action into a GameState action
+func (b *Bot) translate(state *game.GameState, player *game.Player, act abstractAction) (game.PlayerAction, int) {
+	toCall := state.CurrentBet - player.Bet
+	switch {
+	case act.fold && toCall > 0:
+		return game.Fold, 0
+	case act.fold, act.call:
+		if toCall <= 0 {
+			return game.Check, 0
+		}
+		return game.Call, 0
+	case act.allIn:
+		return game.AllIn, 0
+	}
+
+	raise := act.raiseSize(state.Pot + toCall)
+	if state.CurrentBet == 0 {
+		if raise < state.BigBlind {
+			raise = state.BigBlind
+		}
+		if raise >= player.Chips {
+			return game.AllIn, 0
+		}
+		return game.Bet, raise
+	}
+	if raise < state.MinRaise {
+		raise = state.MinRaise
+	}
+	if toCall+raise >= player.Chips {
+		return game.AllIn, 0
+	}
+	return game.Raise, raise
+}
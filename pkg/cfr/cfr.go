@@ -0,0 +1,287 @@
+// Package cfr trains poker strategies with Monte Carlo counterfactual regret
+// minimization (MCCFR) and plays them back through a bot.
+package cfr
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// Game is a two-player zero-sum game in extensive form
+type Game interface {
+	// Name identifies the game in checkpoints
+	Name() string
+	// Root returns the initial state, usually a chance node that deals cards
+	Root() State
+}
+
+// State is a node in a game tree. States are immutable: Next and
+// SampleChance return new states and leave the receiver unchanged.
+type State interface {
+	IsTerminal() bool
+	// Utility returns the payoff for player at a terminal state
+	Utility(player int) float64
+	IsChance() bool
+	// SampleChance picks one outcome of a chance node
+	SampleChance(r *rand.Rand) State
+	// Player returns the player to act at a decision node, 0 or 1
+	Player() int
+	// InfoSet returns the key of the acting player's information set
+	InfoSet() string
+	// NumActions returns how many actions are available at a decision node.
+	// It must be the same for every state in an information set.
+	NumActions() int
+	Next(action int) State
+}
+
+// ChanceOutcome is one outcome of a chance node
+type ChanceOutcome struct {
+	Probability float64
+	State       State
+}
+
+// Enumerable is implemented by states whose chance outcomes can be listed
+// exactly. Exploitability can only be computed for such games.
+type Enumerable interface {
+	ChanceOutcomes() []ChanceOutcome
+}
+
+// Strategy maps information set keys to action probabilities
+type Strategy map[string][]float64
+
+// Probabilities returns the action distribution for an information set,
+// falling back to uniform play when the set was never trained
+func (s Strategy) Probabilities(infoSet string, numActions int) []float64 {
+	if probs, ok := s[infoSet]; ok && len(probs) == numActions {
+		return probs
+	}
+	return uniform(numActions)
+}
+
+// Node holds the accumulated regrets and strategy of one information set
+type Node struct {
+	RegretSum   []float64 `json:"regret_sum"`
+	StrategySum []float64 `json:"strategy_sum"`
+}
+
+func newNode(numActions int) *Node {
+	return &Node{
+		RegretSum:   make([]float64, numActions),
+		StrategySum: make([]float64, numActions),
+	}
+}
+
+// currentStrategy returns the regret-matching strategy for the next iteration
+func (n *Node) currentStrategy() []float64 {
+	strategy := make([]float64, len(n.RegretSum))
+	total := 0.0
+	for i, r := range n.RegretSum {
+		if r > 0 {
+			strategy[i] = r
+			total += r
+		}
+	}
+	if total <= 0 {
+		return uniform(len(strategy))
+	}
+	for i := range strategy {
+		strategy[i] /= total
+	}
+	return strategy
+}
+
+// AverageStrategy returns the average strategy over all iterations, which is
+// the one that converges to equilibrium
+func (n *Node) AverageStrategy() []float64 {
+	total := 0.0
+	for _, s := range n.StrategySum {
+		total += s
+	}
+	if total <= 0 {
+		return uniform(len(n.StrategySum))
+	}
+	avg := make([]float64, len(n.StrategySum))
+	for i, s := range n.StrategySum {
+		avg[i] = s / total
+	}
+	return avg
+}
+
+// Checkpoint is the on-disk form of a trainer. It doubles as the strategy
+// file read by the bot.
+type Checkpoint struct {
+	Game       string           `json:"game"`
+	Iterations int              `json:"iterations"`
+	Holdem     *HoldemConfig    `json:"holdem,omitempty"`
+	Nodes      map[string]*Node `json:"nodes"`
+}
+
+// Strategy returns the average strategy stored in the checkpoint
+func (c *Checkpoint) Strategy() Strategy {
+	strategy := make(Strategy, len(c.Nodes))
+	for key, node := range c.Nodes {
+		strategy[key] = node.AverageStrategy()
+	}
+	return strategy
+}
+
+// LoadCheckpoint reads a checkpoint written by Trainer.Save
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("reading checkpoint %s: %w", path, err)
+	}
+	if cp.Nodes == nil {
+		cp.Nodes = make(map[string]*Node)
+	}
+	return &cp, nil
+}
+
+// Trainer runs external-sampling MCCFR on a game
+type Trainer struct {
+	Game       Game
+	Iterations int
+	Nodes      map[string]*Node
+	rand       *rand.Rand
+}
+
+// NewTrainer creates a trainer with no accumulated regrets
+func NewTrainer(g Game, seed int64) *Trainer {
+	return &Trainer{
+		Game:  g,
+		Nodes: make(map[string]*Node),
+		rand:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// ResumeTrainer creates a trainer that continues from a checkpoint
+func ResumeTrainer(g Game, cp *Checkpoint, seed int64) (*Trainer, error) {
+	if cp.Game != g.Name() {
+		return nil, fmt.Errorf("checkpoint is for game %q, not %q", cp.Game, g.Name())
+	}
+	t := NewTrainer(g, seed)
+	t.Iterations = cp.Iterations
+	t.Nodes = cp.Nodes
+	return t, nil
+}
+
+// Train runs the given number of iterations. Each iteration traverses the
+// tree once for each player.
+func (t *Trainer) Train(iterations int) {
+	for i := 0; i < iterations; i++ {
+		for player := 0; player < 2; player++ {
+			t.walk(t.Game.Root(), player)
+		}
+		t.Iterations++
+	}
+}
+
+// walk samples chance and opponent actions and explores every action of the
+// traversing player, returning the sampled counterfactual value of s
+func (t *Trainer) walk(s State, traverser int) float64 {
+	if s.IsTerminal() {
+		return s.Utility(traverser)
+	}
+	if s.IsChance() {
+		return t.walk(s.SampleChance(t.rand), traverser)
+	}
+
+	node := t.node(s.InfoSet(), s.NumActions())
+	strategy := node.currentStrategy()
+
+	if s.Player() != traverser {
+		for i, p := range strategy {
+			node.StrategySum[i] += p
+		}
+		return t.walk(s.Next(sample(strategy, t.rand)), traverser)
+	}
+
+	utils := make([]float64, len(strategy))
+	value := 0.0
+	for a := range strategy {
+		utils[a] = t.walk(s.Next(a), traverser)
+		value += strategy[a] * utils[a]
+	}
+	for a := range strategy {
+		node.RegretSum[a] += utils[a] - value
+	}
+	return value
+}
+
+func (t *Trainer) node(infoSet string, numActions int) *Node {
+	node, ok := t.Nodes[infoSet]
+	if !ok {
+		node = newNode(numActions)
+		t.Nodes[infoSet] = node
+	}
+	return node
+}
+
+// Strategy returns the current average strategy
+func (t *Trainer) Strategy() Strategy {
+	return t.Checkpoint().Strategy()
+}
+
+// Checkpoint captures the trainer state for saving
+func (t *Trainer) Checkpoint() *Checkpoint {
+	cp := &Checkpoint{
+		Game:       t.Game.Name(),
+		Iterations: t.Iterations,
+		Nodes:      t.Nodes,
+	}
+	if h, ok := t.Game.(*Holdem); ok {
+		cfg := h.Config
+		cp.Holdem = &cfg
+	}
+	return cp
+}
+
+// Save writes a checkpoint to path. The file is written next to its final
+// location and renamed into place so an interrupted save never leaves a
+// truncated checkpoint behind.
+func (t *Trainer) Save(path string) error {
+	data, err := json.Marshal(t.Checkpoint())
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func uniform(n int) []float64 {
+	probs := make([]float64, n)
+	for i := range probs {
+		probs[i] = 1 / float64(n)
+	}
+	return probs
+}
+
+// sample draws an index from a probability distribution
+func sample(probs []float64, r *rand.Rand) int {
+	x := r.Float64()
+	for i, p := range probs {
+		x -= p
+		if x < 0 {
+			return i
+		}
+	}
+	return len(probs) - 1
+}
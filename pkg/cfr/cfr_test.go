@@ -0,0 +1,96 @@
+package cfr
+
+import (
+	"math"
+	"testing"
+)
+
+// kuhnEquilibrium is the Nash equilibrium of Kuhn poker in which the first
+// player never bets, from Kuhn's solution. Actions are pass then bet.
+var kuhnEquilibrium = Strategy{
+	"J:":   {1, 0},
+	"Q:":   {1, 0},
+	"K:":   {1, 0},
+	"J:pb": {1, 0},
+	"Q:pb": {2.0 / 3, 1.0 / 3},
+	"K:pb": {0, 1},
+	"J:p":  {2.0 / 3, 1.0 / 3},
+	"Q:p":  {1, 0},
+	"K:p":  {0, 1},
+	"J:b":  {1, 0},
+	"Q:b":  {2.0 / 3, 1.0 / 3},
+	"K:b":  {0, 1},
+}
+
+func TestKuhnExploitability(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy Strategy
+		want     float64
+	}{
+		{"equilibrium", kuhnEquilibrium, 0},
+		// Against a uniform random player the best responses win 11/24
+		{"uniform", Strategy{}, 11.0 / 24},
+	}
+	for _, tt := range tests {
+		got, err := Exploitability(Kuhn{}, tt.strategy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: exploitability %.6f, want %.6f", tt.name, got, tt.want)
+		}
+	}
+
+	// The first player loses 1/18 a hand at equilibrium
+	value, err := BestResponseValue(Kuhn{}, kuhnEquilibrium, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(value+1.0/18) > 1e-9 {
+		t.Errorf("first player's best response wins %.6f, want %.6f", value, -1.0/18)
+	}
+}
+
+func TestTrainingConverges(t *testing.T) {
+	tests := []struct {
+		game       Game
+		iterations int
+		max        float64
+	}{
+		{Kuhn{}, 20000, 0.01},
+		{Leduc{}, 20000, 0.15},
+	}
+	for _, tt := range tests {
+		uniform, err := Exploitability(tt.game, Strategy{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		trainer := NewTrainer(tt.game, 1)
+		trainer.Train(tt.iterations)
+		got, err := Exploitability(tt.game, trainer.Strategy())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got > tt.max || got >= uniform {
+			t.Errorf("%s: exploitability %.4f after %d iterations, want at most %.4f (uniform is %.4f)",
+				tt.game.Name(), got, tt.iterations, tt.max, uniform)
+		}
+	}
+}
+
+func TestResumeTrainer(t *testing.T) {
+	trainer := NewTrainer(Kuhn{}, 1)
+	trainer.Train(100)
+	if _, err := ResumeTrainer(Leduc{}, trainer.Checkpoint(), 1); err == nil {
+		t.Error("resumed a Kuhn checkpoint as Leduc")
+	}
+	resumed, err := ResumeTrainer(Kuhn{}, trainer.Checkpoint(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed.Train(100)
+	if resumed.Iterations != 200 {
+		t.Errorf("resumed trainer at %d iterations, want 200", resumed.Iterations)
+	}
+}
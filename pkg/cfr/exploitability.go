@@ -0,0 +1,139 @@
+package cfr
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrNotEnumerable is returned when exploitability is requested for a game
+// whose chance nodes cannot be enumerated
+var ErrNotEnumerable = errors.New("game chance outcomes cannot be enumerated")
+
+// Exploitability returns how much a best-responding opponent wins against
+// strategy, averaged over both seats. It is zero exactly at a Nash
+// equilibrium. The game tree is walked in full, so this is only practical
+// for small games such as Kuhn and Leduc poker.
+func Exploitability(g Game, strategy Strategy) (float64, error) {
+	total := 0.0
+	for player := 0; player < 2; player++ {
+		value, err := BestResponseValue(g, strategy, player)
+		if err != nil {
+			return 0, err
+		}
+		total += value
+	}
+	return total / 2, nil
+}
+
+// BestResponseValue returns the expected payoff for player when they play a
+// best response and the opponent plays strategy
+func BestResponseValue(g Game, strategy Strategy, player int) (float64, error) {
+	br := &bestResponse{
+		player:   player,
+		strategy: strategy,
+		infoSets: make(map[string][]reachState),
+		best:     make(map[string]int),
+	}
+	if err := br.collect(g.Root(), 1); err != nil {
+		return 0, err
+	}
+	return br.value(g.Root()), nil
+}
+
+// reachState is a history in one of the best responder's information sets,
+// weighted by the chance and opponent probability of reaching it
+type reachState struct {
+	state State
+	reach float64
+}
+
+type bestResponse struct {
+	player   int
+	strategy Strategy
+	infoSets map[string][]reachState
+	best     map[string]int
+}
+
+// collect groups every reachable history of the best responder by
+// information set
+func (br *bestResponse) collect(s State, reach float64) error {
+	switch {
+	case s.IsTerminal():
+		return nil
+	case s.IsChance():
+		e, ok := s.(Enumerable)
+		if !ok {
+			return ErrNotEnumerable
+		}
+		for _, o := range e.ChanceOutcomes() {
+			if err := br.collect(o.State, reach*o.Probability); err != nil {
+				return err
+			}
+		}
+		return nil
+	case s.Player() == br.player:
+		key := s.InfoSet()
+		br.infoSets[key] = append(br.infoSets[key], reachState{state: s, reach: reach})
+		for a := 0; a < s.NumActions(); a++ {
+			if err := br.collect(s.Next(a), reach); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		probs := br.strategy.Probabilities(s.InfoSet(), s.NumActions())
+		for a, p := range probs {
+			if p > 0 {
+				if err := br.collect(s.Next(a), reach*p); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// value returns the best responder's expected payoff from s
+func (br *bestResponse) value(s State) float64 {
+	switch {
+	case s.IsTerminal():
+		return s.Utility(br.player)
+	case s.IsChance():
+		v := 0.0
+		for _, o := range s.(Enumerable).ChanceOutcomes() {
+			v += o.Probability * br.value(o.State)
+		}
+		return v
+	case s.Player() == br.player:
+		return br.value(s.Next(br.bestAction(s.InfoSet(), s.NumActions())))
+	default:
+		v := 0.0
+		probs := br.strategy.Probabilities(s.InfoSet(), s.NumActions())
+		for a, p := range probs {
+			if p > 0 {
+				v += p * br.value(s.Next(a))
+			}
+		}
+		return v
+	}
+}
+
+// bestAction picks the action that maximizes the reach-weighted value over
+// every history in the information set
+func (br *bestResponse) bestAction(infoSet string, numActions int) int {
+	if a, ok := br.best[infoSet]; ok {
+		return a
+	}
+	best, bestValue := 0, math.Inf(-1)
+	for a := 0; a < numActions; a++ {
+		v := 0.0
+		for _, h := range br.infoSets[infoSet] {
+			v += h.reach * br.value(h.state.Next(a))
+		}
+		if v > bestValue {
+			best, bestValue = a, v
+		}
+	}
+	br.best[infoSet] = best
+	return best
+}
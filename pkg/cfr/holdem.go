@@ -0,0 +1,236 @@
+package cfr
+
+import (
+	"math/rand"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// HoldemConfig describes the abstraction of heads-up no-limit hold'em that
+// the trainer solves. It is stored in checkpoints so that a bot can rebuild
+// the same abstraction when it plays.
+type HoldemConfig struct {
+	Stack      int       `json:"stack"`       // starting stack of both players, in chips
+	SmallBlind int       `json:"small_blind"` // small blind, in chips
+	BigBlind   int       `json:"big_blind"`   // big blind, in chips
+	BetSizes   []float64 `json:"bet_sizes"`   // bet and raise sizes as pot fractions
+	MaxRaises  int       `json:"max_raises"`  // bets and raises allowed per street
+	Buckets    int       `json:"buckets"`     // card buckets per street
+	Samples    int       `json:"samples"`     // rollouts per equity estimate
+}
+
+// DefaultHoldemConfig returns a 100 big blind game with half-pot and pot
+// sized bets and eight buckets per street
+func DefaultHoldemConfig() HoldemConfig {
+	return HoldemConfig{
+		Stack:      200,
+		SmallBlind: 1,
+		BigBlind:   2,
+		BetSizes:   []float64{0.5, 1},
+		MaxRaises:  3,
+		Buckets:    8,
+		Samples:    64,
+	}
+}
+
+// Holdem is an abstracted heads-up no-limit hold'em game. Hands are dealt
+// with game.Deck and compared with game.EvaluateHand, cards are grouped by a
+// Bucketer and bets are limited to the configured pot fractions and all-in.
+// Player 0 has the button: they post the small blind and act first preflop
+// and last after the flop.
+type Holdem struct {
+	Config   HoldemConfig
+	bucketer *Bucketer
+	actions  []abstractAction
+}
+
+// NewHoldem creates an abstracted hold'em game
+func NewHoldem(cfg HoldemConfig) *Holdem {
+	return &Holdem{
+		Config:   cfg,
+		bucketer: NewBucketer(cfg.Buckets, cfg.Samples),
+		actions:  abstractActions(cfg.BetSizes),
+	}
+}
+
+// Name returns the game name
+func (h *Holdem) Name() string { return "holdem" }
+
+// Root returns the deal, with the blinds posted
+func (h *Holdem) Root() State {
+	s := &holdemState{game: h, folded: -1}
+	s.put(0, h.Config.SmallBlind)
+	s.put(1, h.Config.BigBlind)
+	return s
+}
+
+// holdemDeal holds the cards of one sampled hand, and the buckets of both
+// players on every street
+type holdemDeal struct {
+	hole    [2][]game.Card
+	board   []game.Card
+	buckets [2][4]int
+	winner  int // -1 for a split pot
+}
+
+type holdemState struct {
+	game    *Holdem
+	deal    *holdemDeal
+	street  int
+	contrib [2]int // chips put in during the hand
+	bet     [2]int // chips put in during the current street
+	toAct   int
+	raises  int
+	acted   int
+	folded  int
+	done    bool
+}
+
+func (s *holdemState) put(player, amount int) {
+	s.bet[player] += amount
+	s.contrib[player] += amount
+}
+
+func (s *holdemState) stack(player int) int {
+	return s.game.Config.Stack - s.contrib[player]
+}
+
+func (s *holdemState) IsTerminal() bool { return s.folded >= 0 || s.done }
+
+func (s *holdemState) Utility(player int) float64 {
+	opp := 1 - player
+	if s.folded >= 0 {
+		if s.folded == player {
+			return -float64(s.contrib[player])
+		}
+		return float64(s.contrib[opp])
+	}
+	// Chips beyond what the shorter contribution covers are returned
+	won := s.contrib[0]
+	if s.contrib[1] < won {
+		won = s.contrib[1]
+	}
+	switch s.deal.winner {
+	case player:
+		return float64(won)
+	case opp:
+		return -float64(won)
+	}
+	return 0
+}
+
+func (s *holdemState) IsChance() bool { return s.deal == nil }
+
+func (s *holdemState) SampleChance(r *rand.Rand) State {
+	deck := game.NewDeck()
+	r.Shuffle(len(deck.Cards), func(i, j int) {
+		deck.Cards[i], deck.Cards[j] = deck.Cards[j], deck.Cards[i]
+	})
+
+	deal := &holdemDeal{board: deck.Draw(5), winner: -1}
+	deal.hole[0] = deck.Draw(2)
+	deal.hole[1] = deck.Draw(2)
+	var evals [2]game.HandEvaluation
+	for p := 0; p < 2; p++ {
+		for street, n := range []int{0, 3, 4, 5} {
+			deal.buckets[p][street] = s.game.bucketer.Bucket(deal.hole[p], deal.board[:n])
+		}
+		cards := append(append([]game.Card{}, deal.hole[p]...), deal.board...)
+		evals[p] = game.EvaluateHand(cards)
+	}
+	switch game.CompareHands(evals[0], evals[1]) {
+	case 1:
+		deal.winner = 0
+	case -1:
+		deal.winner = 1
+	}
+
+	next := *s
+	next.deal = deal
+	return &next
+}
+
+func (s *holdemState) Player() int { return s.toAct }
+
+func (s *holdemState) InfoSet() string {
+	me := s.toAct
+	return infoSetKey(
+		s.street,
+		s.deal.buckets[me][s.street],
+		me == 0,
+		s.contrib[0]+s.contrib[1],
+		s.bet[1-me]-s.bet[me],
+		s.stack(me),
+		s.game.Config.BigBlind,
+	)
+}
+
+func (s *holdemState) NumActions() int { return len(s.game.actions) }
+
+// Next applies an abstract action. Every action exists at every decision so
+// that information sets have a fixed size; moves that are not possible are
+// played as the nearest legal one, a fold with nothing to call becomes a
+// check and a raise that cannot be made becomes a call.
+func (s *holdemState) Next(action int) State {
+	next := *s
+	me, opp := s.toAct, 1-s.toAct
+	toCall := s.bet[opp] - s.bet[me]
+	stack := s.stack(me)
+	act := s.game.actions[action]
+
+	if act.fold && toCall <= 0 {
+		act = abstractAction{call: true}
+	}
+	if !act.fold && !act.call && (s.raises >= s.game.Config.MaxRaises || stack <= toCall || s.stack(opp) == 0) {
+		act = abstractAction{call: true}
+	}
+
+	next.acted++
+	closed := false
+	switch {
+	case act.fold:
+		next.folded = me
+		return &next
+	case act.call:
+		amount := toCall
+		if amount > stack {
+			amount = stack
+		}
+		next.put(me, amount)
+		closed = (next.acted >= 2 && next.bet[0] == next.bet[1]) || amount < toCall
+	default:
+		amount := stack
+		if !act.allIn {
+			raise := act.raiseSize(s.contrib[0] + s.contrib[1] + toCall)
+			if raise < s.game.Config.BigBlind {
+				raise = s.game.Config.BigBlind
+			}
+			if toCall+raise < stack {
+				amount = toCall + raise
+			}
+		}
+		next.put(me, amount)
+		next.raises++
+	}
+
+	if closed {
+		next.endStreet()
+	} else {
+		next.toAct = opp
+	}
+	return &next
+}
+
+// endStreet moves to the next street, or to showdown after the river or
+// when a player is all-in
+func (s *holdemState) endStreet() {
+	if s.street == 3 || s.stack(0) == 0 || s.stack(1) == 0 {
+		s.done = true
+		return
+	}
+	s.street++
+	s.bet = [2]int{}
+	s.raises = 0
+	s.acted = 0
+	s.toAct = 1
+}
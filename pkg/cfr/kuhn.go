@@ -0,0 +1,92 @@
+package cfr
+
+import "math/rand"
+
+// Kuhn is Kuhn poker: a three-card deck, one card each, a one-chip ante and
+// a single one-chip bet. Its equilibrium is known, which makes it a useful
+// check on the trainer.
+type Kuhn struct{}
+
+// Name returns the game name
+func (Kuhn) Name() string { return "kuhn" }
+
+// Root returns the deal
+func (Kuhn) Root() State { return kuhnState{} }
+
+var kuhnCards = [3]string{"J", "Q", "K"}
+
+// kuhnState histories are strings of 'p' (pass) and 'b' (bet)
+type kuhnState struct {
+	dealt   bool
+	cards   [2]int
+	history string
+}
+
+func (s kuhnState) IsTerminal() bool {
+	switch s.history {
+	case "pp", "bp", "bb", "pbp", "pbb":
+		return true
+	}
+	return false
+}
+
+func (s kuhnState) Utility(player int) float64 {
+	var payoff float64 // for player 0
+	switch s.history {
+	case "bp":
+		payoff = 1
+	case "pbp":
+		payoff = -1
+	case "pp":
+		payoff = s.showdown(1)
+	case "bb", "pbb":
+		payoff = s.showdown(2)
+	}
+	if player == 1 {
+		return -payoff
+	}
+	return payoff
+}
+
+func (s kuhnState) showdown(stake float64) float64 {
+	if s.cards[0] > s.cards[1] {
+		return stake
+	}
+	return -stake
+}
+
+func (s kuhnState) IsChance() bool { return !s.dealt }
+
+func (s kuhnState) SampleChance(r *rand.Rand) State {
+	outcomes := s.ChanceOutcomes()
+	return outcomes[r.Intn(len(outcomes))].State
+}
+
+func (s kuhnState) ChanceOutcomes() []ChanceOutcome {
+	outcomes := make([]ChanceOutcome, 0, 6)
+	for a := 0; a < 3; a++ {
+		for b := 0; b < 3; b++ {
+			if a != b {
+				outcomes = append(outcomes, ChanceOutcome{
+					Probability: 1.0 / 6,
+					State:       kuhnState{dealt: true, cards: [2]int{a, b}},
+				})
+			}
+		}
+	}
+	return outcomes
+}
+
+func (s kuhnState) Player() int { return len(s.history) % 2 }
+
+func (s kuhnState) InfoSet() string {
+	return kuhnCards[s.cards[s.Player()]] + ":" + s.history
+}
+
+func (s kuhnState) NumActions() int { return 2 }
+
+func (s kuhnState) Next(action int) State {
+	next := s
+	next.history += string("pb"[action])
+	return next
+}
@@ -0,0 +1,170 @@
+package cfr
+
+import "math/rand"
+
+// Leduc is Leduc hold'em: a six-card deck of two suits of J, Q and K, one
+// private card each and one board card. There are two betting rounds with
+// bets of two and then four chips and at most two raises per round. A
+// private card that pairs the board wins, otherwise the higher card does.
+type Leduc struct{}
+
+// Name returns the game name
+func (Leduc) Name() string { return "leduc" }
+
+// Root returns the deal
+func (Leduc) Root() State {
+	return leducState{board: -1, folded: -1, contrib: [2]int{1, 1}}
+}
+
+const leducMaxRaises = 2
+
+// leducState histories use 'k' check, 'b' bet, 'c' call, 'r' raise and 'f'
+// fold, with '/' between rounds. Cards are numbered 0-5 and card/2 is the rank.
+type leducState struct {
+	dealt        bool
+	cards        [2]int
+	board        int
+	pendingBoard bool
+	round        int
+	history      string
+	contrib      [2]int
+	toAct        int
+	raises       int
+	acted        int
+	folded       int
+	done         bool
+}
+
+func (s leducState) IsTerminal() bool { return s.folded >= 0 || s.done }
+
+func (s leducState) Utility(player int) float64 {
+	opp := 1 - player
+	if s.folded >= 0 {
+		if s.folded == player {
+			return -float64(s.contrib[player])
+		}
+		return float64(s.contrib[opp])
+	}
+	mine, theirs := s.strength(player), s.strength(opp)
+	switch {
+	case mine > theirs:
+		return float64(s.contrib[opp])
+	case mine < theirs:
+		return -float64(s.contrib[player])
+	}
+	return 0
+}
+
+// strength ranks a player's showdown hand, with a pair above any high card
+func (s leducState) strength(player int) int {
+	rank := s.cards[player] / 2
+	if rank == s.board/2 {
+		return 10 + rank
+	}
+	return rank
+}
+
+func (s leducState) IsChance() bool { return !s.dealt || s.pendingBoard }
+
+func (s leducState) SampleChance(r *rand.Rand) State {
+	outcomes := s.ChanceOutcomes()
+	return outcomes[r.Intn(len(outcomes))].State
+}
+
+func (s leducState) ChanceOutcomes() []ChanceOutcome {
+	var outcomes []ChanceOutcome
+	if !s.dealt {
+		for a := 0; a < 6; a++ {
+			for b := 0; b < 6; b++ {
+				if a != b {
+					next := s
+					next.dealt = true
+					next.cards = [2]int{a, b}
+					outcomes = append(outcomes, ChanceOutcome{Probability: 1.0 / 30, State: next})
+				}
+			}
+		}
+		return outcomes
+	}
+	for c := 0; c < 6; c++ {
+		if c != s.cards[0] && c != s.cards[1] {
+			next := s
+			next.board = c
+			next.pendingBoard = false
+			outcomes = append(outcomes, ChanceOutcome{Probability: 1.0 / 4, State: next})
+		}
+	}
+	return outcomes
+}
+
+func (s leducState) Player() int { return s.toAct }
+
+func (s leducState) InfoSet() string {
+	key := kuhnCards[s.cards[s.toAct]/2]
+	if s.board >= 0 {
+		key += kuhnCards[s.board/2]
+	}
+	return key + ":" + s.history
+}
+
+func (s leducState) facingBet() bool {
+	return s.contrib[1-s.toAct] > s.contrib[s.toAct]
+}
+
+// actions lists the legal moves: check or bet when nothing is owed, fold,
+// call or raise when facing a bet
+func (s leducState) actions() string {
+	if !s.facingBet() {
+		return "kb"
+	}
+	if s.raises < leducMaxRaises {
+		return "fcr"
+	}
+	return "fc"
+}
+
+func (s leducState) NumActions() int { return len(s.actions()) }
+
+func (s leducState) Next(action int) State {
+	next := s
+	me, opp := s.toAct, 1-s.toAct
+	betSize := 2
+	if s.round == 1 {
+		betSize = 4
+	}
+
+	move := s.actions()[action]
+	next.history += string(move)
+	next.acted++
+	switch move {
+	case 'f':
+		next.folded = me
+		return next
+	case 'k':
+		if next.acted == 2 {
+			return next.closeRound()
+		}
+	case 'c':
+		next.contrib[me] = s.contrib[opp]
+		return next.closeRound()
+	case 'b', 'r':
+		next.contrib[me] = s.contrib[opp] + betSize
+		next.raises++
+	}
+	next.toAct = opp
+	return next
+}
+
+func (s leducState) closeRound() leducState {
+	if s.round == 1 {
+		s.done = true
+		return s
+	}
+	s.round = 1
+	s.pendingBoard = true
+	s.history += "/"
+	s.toAct = 0
+	s.raises = 0
+	s.acted = 0
+	return s
+}
@@ -0,0 +1,37 @@
+// Package backend opens a db.Store by name, for the commands that let the
+// user pick one. It is kept out of package db so that the WASM client
+// doesn't pull in the SQLite driver.
+package backend
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/db/sqlstore"
+)
+
+// Names lists the backends Open knows, for flag help
+const Names = "file, sqlite or memory"
+
+// Open opens the named backend in dir: a FileStore, the SQLite database
+// poker.db, or an empty in-memory store that ignores dir. The file and
+// SQLite stores lock what they open, so while one process has a store
+// open, opening it anywhere else fails with db.ErrLocked. The SQLite
+// schema is migrated as it opens.
+func Open(ctx context.Context, name, dir string) (db.Store, error) {
+	switch name {
+	case "file":
+		return db.OpenFileStore(dir)
+	case "sqlite":
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		return sqlstore.Open(ctx, filepath.Join(dir, "poker.db"))
+	case "memory":
+		return db.NewMockSpaceTimeDB(), nil
+	}
+	return nil, fmt.Errorf("unknown store %q, want %s", name, Names)
+}
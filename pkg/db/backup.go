@@ -0,0 +1,134 @@
+package db
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// SnapshotFormat is the version of the archive written by WriteSnapshot.
+// Format 2 added League.
+const SnapshotFormat = 2
+
+// Snapshot is everything in a store at one point in time, as returned by
+// Store.Export. Records are in a fixed order, so exporting the same data
+// twice gives the same snapshot.
+type Snapshot struct {
+	Format       int                 `json:"format"`
+	TakenAt      time.Time           `json:"taken_at"`
+	Games        []*GameSnapshot     `json:"games"`    // by ID
+	Profiles     []*PlayerProfile    `json:"profiles"` // by ID
+	History      []*GameHistoryEntry `json:"history"`  // of every game, by entry ID
+	Transactions []*Transaction      `json:"transactions"`
+	// League is the server's league file, which is kept beside the store
+	// rather than in it. Export leaves it empty and Restore ignores it; the
+	// backup command fills it in and writes it back.
+	League json.RawMessage `json:"league,omitempty"`
+}
+
+// GameSnapshot is a game's kept state versions, oldest first
+type GameSnapshot struct {
+	ID       string              `json:"id"`
+	Versions []*GameStateVersion `json:"versions"`
+}
+
+// Empty reports whether the snapshot holds no records
+func (s *Snapshot) Empty() bool {
+	return len(s.Games) == 0 && len(s.Profiles) == 0 && len(s.History) == 0 && len(s.Transactions) == 0
+}
+
+// ErrNotEmpty is returned when restoring into a store that already holds
+// records
+var ErrNotEmpty = errors.New("store is not empty")
+
+// ErrSnapshotFormat is returned when reading an archive written by a newer
+// version
+var ErrSnapshotFormat = errors.New("unsupported snapshot format")
+
+// newSnapshot returns an empty snapshot taken now
+func newSnapshot() *Snapshot {
+	return &Snapshot{Format: SnapshotFormat, TakenAt: time.Now().UTC()}
+}
+
+// sortSnapshot puts the records of a snapshot filled from maps in order
+func sortSnapshot(s *Snapshot) {
+	sort.Slice(s.Games, func(i, j int) bool { return s.Games[i].ID < s.Games[j].ID })
+	sort.Slice(s.Profiles, func(i, j int) bool { return s.Profiles[i].ID < s.Profiles[j].ID })
+	sort.Slice(s.History, func(i, j int) bool { return s.History[i].ID < s.History[j].ID })
+}
+
+// WriteSnapshot writes a snapshot to w as gzipped JSON. Game states are in
+// the game's own versioned schema, so the archive can be read by any later
+// version.
+func WriteSnapshot(w io.Writer, s *Snapshot) error {
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(s); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var s Snapshot
+	if err := json.NewDecoder(zr).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Format < 1 || s.Format > SnapshotFormat {
+		return nil, fmt.Errorf("%w %d", ErrSnapshotFormat, s.Format)
+	}
+	return &s, nil
+}
+
+// Restore writes a snapshot into an empty store of any backend, through
+// the Store methods. Games get their kept versions saved in order, so
+// their version numbers start again from 1 and their save times are the
+// time of the restore. History entries get new IDs in the same order, and
+// ledger transactions keep theirs. Restore fails with ErrNotEmpty if store
+// holds any records; if it fails part way, discard the store.
+func Restore(ctx context.Context, store Store, s *Snapshot) error {
+	existing, err := store.Export(ctx)
+	if err != nil {
+		return err
+	}
+	if !existing.Empty() {
+		return ErrNotEmpty
+	}
+	for _, g := range s.Games {
+		for _, v := range g.Versions {
+			if err := store.SaveGameState(ctx, g.ID, v.State); err != nil {
+				return fmt.Errorf("game %s version %d: %w", g.ID, v.Version, err)
+			}
+		}
+	}
+	for _, p := range s.Profiles {
+		if err := store.SavePlayerProfile(ctx, p); err != nil {
+			return fmt.Errorf("profile %s: %w", p.ID, err)
+		}
+	}
+	for _, e := range s.History {
+		if err := store.AddGameHistoryEntry(ctx, e.GameID, e); err != nil {
+			return fmt.Errorf("history entry %d: %w", e.ID, err)
+		}
+	}
+	for _, tx := range s.Transactions {
+		id, err := store.AppendTransaction(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("transaction %d: %w", tx.ID, err)
+		}
+		if id != tx.ID {
+			return fmt.Errorf("transaction %d was restored as %d", tx.ID, id)
+		}
+	}
+	return nil
+}
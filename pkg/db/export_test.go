@@ -0,0 +1,10 @@
+package db
+
+import "os"
+
+// SetSyncLog replaces the function a file store syncs its log with
+func SetSyncLog(s *FileStore, sync func(*os.File) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.syncLog = sync
+}
@@ -0,0 +1,844 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// logName is the name of a FileStore's log in its directory
+const logName = "store.log"
+
+// lockName is the file a FileStore locks to keep its directory to itself
+const lockName = "LOCK"
+
+// maxRecord is the largest record a FileStore reads back, so that a corrupt
+// length can't make it allocate without bound
+const maxRecord = 64 << 20
+
+// compactMin is the log size below which a FileStore doesn't bother
+// compacting
+const compactMin = 1 << 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// recordStart is how the JSON of every record begins, see fileRecord
+var recordStart = []byte(`{"op":`)
+
+// ErrLocked is returned when opening a store another process, or another
+// store in this one, has open
+var ErrLocked = errors.New("store is locked by another process")
+
+// ErrCorruptLog is returned when opening a FileStore whose log has a bad
+// record with valid records after it, which a crash can't cause
+var ErrCorruptLog = errors.New("file store log is corrupt")
+
+// FileStore is a Store kept in an append-only log in a directory, so data
+// survives restarts. Every change is appended as one checksummed record and
+// synced to disk before the call returns. A record cut short by a crash is
+// dropped when the log is reopened; a bad record anywhere else makes
+// OpenFileStore fail with ErrCorruptLog and leaves the log alone. The last
+// MaxStateVersions versions of each game's state are kept. Once more than
+// half of the log is records that have been replaced or dropped, it is
+// compacted by writing the live records to a new file and renaming it into
+// place.
+//
+// Only one FileStore may have a directory open at a time. OpenFileStore
+// locks the directory's LOCK file and fails with ErrLocked while another
+// process, or another FileStore, holds it.
+type FileStore struct {
+	dir  string
+	lock *os.File // holds the directory lock until Close
+
+	mu       sync.RWMutex
+	file     *os.File
+	size     int64 // bytes in the log
+	live     int64 // bytes of the records that are still current
+	games    map[string][]*fileVersion
+	profiles map[string]*PlayerProfile
+	profSize map[string]int64
+	history  map[string][]*GameHistoryEntry
+	histSize map[int64]int64 // by entry ID
+	lastID   int64           // of the last history entry
+	ledger   []*Transaction
+	broker   Broker
+	// syncLog is (*os.File).Sync, replaced by tests
+	syncLog func(*os.File) error
+}
+
+var _ Store = (*FileStore)(nil)
+
+// fileVersion is a kept version of a game's state
+type fileVersion struct {
+	version int64
+	savedAt time.Time
+	state   json.RawMessage
+	size    int64 // bytes of its record
+}
+
+// fileRecord is one change in the log
+type fileRecord struct {
+	Op      string            `json:"op"`
+	ID      string            `json:"id,omitempty"`
+	Version int64             `json:"version,omitempty"`
+	SavedAt *time.Time        `json:"saved_at,omitempty"`
+	State   json.RawMessage   `json:"state,omitempty"`
+	Profile *PlayerProfile    `json:"profile,omitempty"`
+	Entry   *GameHistoryEntry `json:"entry,omitempty"`
+	Tx      *Transaction      `json:"tx,omitempty"`
+	IDs     []int64           `json:"ids,omitempty"` // of deleted history entries
+}
+
+// Record operations
+const (
+	opGameState = "game_state"
+	opProfile   = "profile"
+	opHistory   = "history"
+	opTx        = "tx"
+	// Deletions are tombstones, left out when the log is compacted
+	opExpireGame    = "expire_game"
+	opDeleteHistory = "delete_history"
+)
+
+// OpenFileStore opens the store in dir, creating the directory if needed
+func OpenFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	lock, err := LockFile(filepath.Join(dir, lockName))
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{
+		dir:      dir,
+		lock:     lock,
+		syncLog:  (*os.File).Sync,
+		games:    make(map[string][]*fileVersion),
+		profiles: make(map[string]*PlayerProfile),
+		profSize: make(map[string]int64),
+		history:  make(map[string][]*GameHistoryEntry),
+		histSize: make(map[int64]int64),
+	}
+	// A leftover compaction file was never renamed into place, so the log
+	// itself is still complete
+	os.Remove(filepath.Join(dir, logName+".compact"))
+
+	f, err := os.OpenFile(filepath.Join(dir, logName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+	fail := func(err error) (*FileStore, error) {
+		f.Close()
+		lock.Close()
+		return nil, err
+	}
+	good, err := s.replay(f)
+	if err != nil {
+		return fail(err)
+	}
+	if info, err := f.Stat(); err == nil && info.Size() > good {
+		log.Printf("File store %s: dropping %d bytes of an incomplete last record", dir, info.Size()-good)
+		if err := f.Truncate(good); err != nil {
+			return fail(err)
+		}
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	s.file, s.size = f, good
+	return s, nil
+}
+
+// replay applies every complete record in the log and returns the offset
+// just past the last one. A bad record is taken for the last one cut short
+// by a crash only if no valid record follows it; otherwise replay fails
+// with ErrCorruptLog rather than have the records after it dropped.
+func (s *FileStore) replay(f *os.File) (int64, error) {
+	r := bufio.NewReader(f)
+	var offset int64
+	header := make([]byte, 8)
+	// short reports a read that ran out of log part way through a record
+	short := func(err error) bool {
+		return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	for {
+		if _, err := io.ReadFull(r, header); errors.Is(err, io.EOF) {
+			return offset, nil
+		} else if short(err) {
+			return offset, s.torn(f, offset, "header cut short")
+		} else if err != nil {
+			return offset, err
+		}
+		n := binary.LittleEndian.Uint32(header)
+		if n > maxRecord {
+			return offset, s.torn(f, offset, fmt.Sprintf("length %d", n))
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); short(err) {
+			return offset, s.torn(f, offset, "cut short")
+		} else if err != nil {
+			return offset, err
+		}
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:]) {
+			return offset, s.torn(f, offset, "checksum mismatch")
+		}
+		var rec fileRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return offset, fmt.Errorf("file store record at %d: %w", offset, err)
+		}
+		size := int64(len(header)) + int64(n)
+		if err := s.apply(&rec, size); err != nil {
+			return offset, fmt.Errorf("file store record at %d: %w", offset, err)
+		}
+		offset += size
+	}
+}
+
+// torn decides what to do about the bad record at offset: nil when it is
+// the last thing in the log, so that it can be dropped, and ErrCorruptLog
+// when a valid record starts anywhere after it
+func (s *FileStore) torn(f *os.File, offset int64, bad string) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	rest := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(rest, offset); err != nil {
+		return err
+	}
+	for i := 1; i+8 <= len(rest); i++ {
+		n := int(binary.LittleEndian.Uint32(rest[i:]))
+		end := i + 8 + n
+		if n > maxRecord || end > len(rest) || !bytes.HasPrefix(rest[i+8:end], recordStart) {
+			continue
+		}
+		if crc32.Checksum(rest[i+8:end], crcTable) == binary.LittleEndian.Uint32(rest[i+4:]) {
+			return fmt.Errorf("%w: %s: bad record at %d (%s) with a valid record at %d after it",
+				ErrCorruptLog, filepath.Join(s.dir, logName), offset, bad, offset+int64(i))
+		}
+	}
+	return nil
+}
+
+// apply updates the in-memory copy for a record of the given size
+func (s *FileStore) apply(rec *fileRecord, size int64) error {
+	switch rec.Op {
+	case opGameState:
+		versions := s.games[rec.ID]
+		v := &fileVersion{version: rec.Version, state: rec.State, size: size}
+		if rec.SavedAt != nil {
+			v.savedAt = *rec.SavedAt
+		}
+		if v.version == 0 {
+			// Logs written before versions were kept number them in order
+			v.version = s.version(rec.ID) + 1
+		}
+		s.live += size
+		versions = append(versions, v)
+		if extra := len(versions) - MaxStateVersions; extra > 0 {
+			for _, old := range versions[:extra] {
+				s.live -= old.size
+			}
+			versions = append([]*fileVersion(nil), versions[extra:]...)
+		}
+		s.games[rec.ID] = versions
+	case opProfile:
+		if rec.Profile == nil {
+			return errors.New("profile record without a profile")
+		}
+		id := rec.Profile.ID
+		s.live += size - s.profSize[id]
+		s.profiles[id], s.profSize[id] = rec.Profile, size
+	case opHistory:
+		if rec.Entry == nil {
+			return errors.New("history record without an entry")
+		}
+		if rec.Entry.ID == 0 {
+			// Logs written before entries had IDs number them in order
+			rec.Entry.ID = s.lastID + 1
+		}
+		rec.Entry.GameID = rec.ID
+		if rec.Entry.ID > s.lastID {
+			s.lastID = rec.Entry.ID
+		}
+		s.live += size
+		s.history[rec.ID] = append(s.history[rec.ID], rec.Entry)
+		s.histSize[rec.Entry.ID] = size
+	case opExpireGame:
+		for _, v := range s.games[rec.ID] {
+			s.live -= v.size
+		}
+		delete(s.games, rec.ID)
+	case opDeleteHistory:
+		for _, e := range removeEntries(s.history, rec.IDs) {
+			s.live -= s.histSize[e.ID]
+			delete(s.histSize, e.ID)
+		}
+		for _, id := range rec.IDs {
+			// IDs are never reused, even when the last entry is deleted
+			if id > s.lastID {
+				s.lastID = id
+			}
+		}
+	case opTx:
+		if rec.Tx == nil {
+			return errors.New("transaction record without a transaction")
+		}
+		if want := int64(len(s.ledger)) + 1; rec.Tx.ID != want {
+			return fmt.Errorf("transaction %d out of order, want %d", rec.Tx.ID, want)
+		}
+		s.live += size
+		s.ledger = append(s.ledger, rec.Tx)
+	default:
+		return fmt.Errorf("unknown operation %q", rec.Op)
+	}
+	return nil
+}
+
+// version returns the current version of a game's state, 0 if it has none.
+// The caller holds mu.
+func (s *FileStore) version(gameID string) int64 {
+	versions := s.games[gameID]
+	if len(versions) == 0 {
+		return 0
+	}
+	return versions[len(versions)-1].version
+}
+
+// encodeRecord frames a record as its length, checksum and JSON
+func encodeRecord(rec *fileRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(buf, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(payload, crcTable))
+	return append(buf, payload...), nil
+}
+
+// write appends a record, syncs it and applies it. The caller holds mu.
+func (s *FileStore) write(rec *fileRecord) error {
+	if s.file == nil {
+		return errors.New("file store is closed")
+	}
+	buf, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(buf); err != nil {
+		s.cut()
+		return err
+	}
+	if err := s.syncLog(s.file); err != nil {
+		// The record may have reached the disk anyway, and must not come
+		// back when the log is next read
+		s.cut()
+		return err
+	}
+	s.size += int64(len(buf))
+	if err := s.apply(rec, int64(len(buf))); err != nil {
+		return err
+	}
+	if s.size > compactMin && s.size > 2*s.live {
+		if err := s.compact(); err != nil {
+			log.Printf("File store %s: compaction failed: %v", s.dir, err)
+		}
+	}
+	return nil
+}
+
+// cut cuts off whatever part of a failed record was written, so the next
+// record starts clean. The caller holds mu.
+func (s *FileStore) cut() {
+	if err := s.file.Truncate(s.size); err != nil {
+		log.Printf("File store %s: dropping a failed record: %v", s.dir, err)
+	}
+	s.file.Seek(s.size, io.SeekStart)
+}
+
+// Compact rewrites the log with only the records that are still current
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return errors.New("file store is closed")
+	}
+	return s.compact()
+}
+
+// compact rewrites the log. The caller holds mu.
+func (s *FileStore) compact() error {
+	path := filepath.Join(s.dir, logName)
+	tmpPath := path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	w := bufio.NewWriter(tmp)
+	var size int64
+	put := func(rec *fileRecord) (int64, error) {
+		buf, err := encodeRecord(rec)
+		if err != nil {
+			return 0, err
+		}
+		size += int64(len(buf))
+		_, err = w.Write(buf)
+		return int64(len(buf)), err
+	}
+	// Rewritten records may differ in size from the originals, which are
+	// only replaced once the new log is in place
+	versionSize := make(map[*fileVersion]int64)
+	profSize := make(map[string]int64)
+	histSize := make(map[int64]int64)
+	err = func() error {
+		for id, versions := range s.games {
+			for _, v := range versions {
+				savedAt := v.savedAt
+				n, err := put(&fileRecord{Op: opGameState, ID: id, Version: v.version, SavedAt: &savedAt, State: v.state})
+				if err != nil {
+					return err
+				}
+				versionSize[v] = n
+			}
+		}
+		for id, p := range s.profiles {
+			n, err := put(&fileRecord{Op: opProfile, Profile: p})
+			if err != nil {
+				return err
+			}
+			profSize[id] = n
+		}
+		var maxID int64
+		for id, entries := range s.history {
+			for _, e := range entries {
+				n, err := put(&fileRecord{Op: opHistory, ID: id, Entry: e})
+				if err != nil {
+					return err
+				}
+				histSize[e.ID] = n
+				if e.ID > maxID {
+					maxID = e.ID
+				}
+			}
+		}
+		if s.lastID > maxID {
+			// Keep the last ID of deleted entries so it isn't reused
+			if _, err := put(&fileRecord{Op: opDeleteHistory, IDs: []int64{s.lastID}}); err != nil {
+				return err
+			}
+		}
+		for _, tx := range s.ledger {
+			if _, err := put(&fileRecord{Op: opTx, Tx: tx}); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return tmp.Sync()
+	}()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	syncDir(s.dir)
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		// The compacted log is in place but can't be appended to
+		s.file.Close()
+		s.file = nil
+		return err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	s.file.Close()
+	s.file, s.size, s.live = f, size, size
+	for v, n := range versionSize {
+		v.size = n
+	}
+	s.profSize = profSize
+	s.histSize = histSize
+	return nil
+}
+
+// syncDir makes a rename in dir durable where the platform allows it
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// SaveGameState saves a game's current state
+func (s *FileStore) SaveGameState(ctx context.Context, gameID string, state *game.GameState) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.saveState(gameID, state, data, anyVersion)
+	return err
+}
+
+// SaveGameStateIfVersion saves a game's state if it is still at the
+// expected version
+func (s *FileStore) SaveGameStateIfVersion(ctx context.Context, gameID string, state *game.GameState, expected int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if expected < 0 {
+		return 0, errNegativeVersion
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveState(gameID, state, data, expected)
+}
+
+// saveState appends a version of a game's state if the current version is
+// expected or expected is anyVersion. The caller holds mu.
+func (s *FileStore) saveState(gameID string, state *game.GameState, data json.RawMessage, expected int64) (int64, error) {
+	current := s.version(gameID)
+	if expected != anyVersion && expected != current {
+		return 0, &ConflictError{ID: gameID, Expected: expected, Actual: current}
+	}
+	op := Insert
+	if current > 0 {
+		op = Update
+	}
+	now := time.Now().UTC()
+	if err := s.write(&fileRecord{Op: opGameState, ID: gameID, Version: current + 1, SavedAt: &now, State: data}); err != nil {
+		return 0, err
+	}
+	s.broker.Publish(Change{Op: op, Kind: KindGameState, ID: gameID, Version: current + 1, State: state})
+	return current + 1, nil
+}
+
+// LoadGameState returns a game's last saved state
+func (s *FileStore) LoadGameState(ctx context.Context, gameID string) (*game.GameState, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	state, _, err := s.LoadGameStateVersion(ctx, gameID)
+	return state, err
+}
+
+// LoadGameStateVersion returns a game's last saved state and its version
+func (s *FileStore) LoadGameStateVersion(ctx context.Context, gameID string) (*game.GameState, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	s.mu.RLock()
+	versions := s.games[gameID]
+	s.mu.RUnlock()
+	if len(versions) == 0 {
+		return nil, 0, notFound(KindGameState, gameID)
+	}
+	v := versions[len(versions)-1]
+	var state game.GameState
+	if err := json.Unmarshal(v.state, &state); err != nil {
+		return nil, 0, err
+	}
+	return &state, v.version, nil
+}
+
+// GameStateVersions returns the kept versions of a game's state, oldest
+// first
+func (s *FileStore) GameStateVersions(ctx context.Context, gameID string) ([]*GameStateVersion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	versions := s.games[gameID]
+	s.mu.RUnlock()
+	if len(versions) == 0 {
+		return nil, notFound(KindGameState, gameID)
+	}
+	out := make([]*GameStateVersion, len(versions))
+	for i, v := range versions {
+		var state game.GameState
+		if err := json.Unmarshal(v.state, &state); err != nil {
+			return nil, err
+		}
+		out[i] = &GameStateVersion{Version: v.version, SavedAt: v.savedAt, State: &state}
+	}
+	return out, nil
+}
+
+// SavePlayerProfile saves a profile
+func (s *FileStore) SavePlayerProfile(ctx context.Context, profile *PlayerProfile) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op := Insert
+	if _, ok := s.profiles[profile.ID]; ok {
+		op = Update
+	}
+	if err := s.write(&fileRecord{Op: opProfile, Profile: copyProfile(profile)}); err != nil {
+		return err
+	}
+	s.broker.Publish(Change{Op: op, Kind: KindPlayerProfile, ID: profile.ID, Profile: profile})
+	return nil
+}
+
+// LoadPlayerProfile returns a player's profile
+func (s *FileStore) LoadPlayerProfile(ctx context.Context, playerID string) (*PlayerProfile, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.profiles[playerID]
+	if !ok {
+		return nil, notFound(KindPlayerProfile, playerID)
+	}
+	return copyProfile(p), nil
+}
+
+// UpdatePlayerProfile applies update to a player's profile and saves it
+// under the store's lock
+func (s *FileStore) UpdatePlayerProfile(ctx context.Context, playerID string, update func(*PlayerProfile) error) (*PlayerProfile, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, p := Insert, &PlayerProfile{ID: playerID}
+	if old, ok := s.profiles[playerID]; ok {
+		op, p = Update, copyProfile(old)
+	}
+	if err := update(p); err != nil {
+		return nil, err
+	}
+	p.ID = playerID
+	if err := s.write(&fileRecord{Op: opProfile, Profile: copyProfile(p)}); err != nil {
+		return nil, err
+	}
+	s.broker.Publish(Change{Op: op, Kind: KindPlayerProfile, ID: playerID, Profile: copyProfile(p)})
+	return p, nil
+}
+
+// AddGameHistoryEntry appends an entry to a game's history
+func (s *FileStore) AddGameHistoryEntry(ctx context.Context, gameID string, entry *GameHistoryEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := copyEntry(entry)
+	stored.ID, stored.GameID = s.lastID+1, gameID
+	if err := s.write(&fileRecord{Op: opHistory, ID: gameID, Entry: stored}); err != nil {
+		return err
+	}
+	s.broker.Publish(Change{Op: Insert, Kind: KindGameHistory, ID: gameID, Entry: stored})
+	return nil
+}
+
+// GetGameHistory returns a game's history, oldest entry first
+func (s *FileStore) GetGameHistory(ctx context.Context, gameID string) ([]*GameHistoryEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	history, ok := s.history[gameID]
+	if !ok {
+		return nil, notFound(KindGameHistory, gameID)
+	}
+	entries := make([]*GameHistoryEntry, len(history))
+	for i, e := range history {
+		entries[i] = copyEntry(e)
+	}
+	return entries, nil
+}
+
+// DeleteHistory removes history entries by ID
+func (s *FileStore) DeleteHistory(ctx context.Context, ids []int64) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byID := make(map[int64]*GameHistoryEntry)
+	for _, entries := range s.history {
+		for _, e := range entries {
+			byID[e.ID] = e
+		}
+	}
+	var found []int64
+	var removed []*GameHistoryEntry
+	for _, id := range ids {
+		if e := byID[id]; e != nil {
+			found = append(found, id)
+			removed = append(removed, e)
+			delete(byID, id)
+		}
+	}
+	if len(found) == 0 {
+		return 0, nil
+	}
+	if err := s.write(&fileRecord{Op: opDeleteHistory, IDs: found}); err != nil {
+		return 0, err
+	}
+	for _, e := range removed {
+		s.broker.Publish(Change{Op: Delete, Kind: KindGameHistory, ID: e.GameID, Entry: e})
+	}
+	return len(removed), nil
+}
+
+// ExpireGameStates removes the games not saved since before
+func (s *FileStore) ExpireGameStates(ctx context.Context, before time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expired := []string{}
+	for id, versions := range s.games {
+		if len(versions) > 0 && versions[len(versions)-1].savedAt.Before(before) {
+			expired = append(expired, id)
+		}
+	}
+	sort.Strings(expired)
+	for i, id := range expired {
+		if err := s.write(&fileRecord{Op: opExpireGame, ID: id}); err != nil {
+			return expired[:i], err
+		}
+		s.broker.Publish(Change{Op: Delete, Kind: KindGameState, ID: id})
+	}
+	return expired, nil
+}
+
+// QueryHistory returns a page of history entries across games
+func (s *FileStore) QueryHistory(ctx context.Context, q HistoryQuery) (*HistoryPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return queryHistory(s.history, &q)
+}
+
+// SummarizeHistory aggregates history entries across games
+func (s *FileStore) SummarizeHistory(ctx context.Context, f HistoryFilter) (*HistorySummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return summarizeHistory(s.history, &f), nil
+}
+
+// AppendTransaction adds a transaction to the ledger
+func (s *FileStore) AppendTransaction(ctx context.Context, tx *Transaction) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := ValidateTransaction(tx); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := copyTransaction(tx)
+	stored.ID = int64(len(s.ledger)) + 1
+	if err := s.write(&fileRecord{Op: opTx, Tx: stored}); err != nil {
+		return 0, err
+	}
+	s.broker.Publish(Change{Op: Insert, Kind: KindTransaction, Transaction: stored})
+	return stored.ID, nil
+}
+
+// Transactions returns ledger transactions in order
+func (s *FileStore) Transactions(ctx context.Context, after int64, limit int) ([]*Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return selectTransactions(s.ledger, after, limit), nil
+}
+
+// Export copies every record
+func (s *FileStore) Export(ctx context.Context) (*Snapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snap := newSnapshot()
+	for id, versions := range s.games {
+		g := &GameSnapshot{ID: id}
+		for _, v := range versions {
+			var state game.GameState
+			if err := json.Unmarshal(v.state, &state); err != nil {
+				return nil, fmt.Errorf("game %s version %d: %w", id, v.version, err)
+			}
+			g.Versions = append(g.Versions, &GameStateVersion{Version: v.version, SavedAt: v.savedAt, State: &state})
+		}
+		snap.Games = append(snap.Games, g)
+	}
+	for _, p := range s.profiles {
+		snap.Profiles = append(snap.Profiles, copyProfile(p))
+	}
+	for _, entries := range s.history {
+		for _, e := range entries {
+			snap.History = append(snap.History, copyEntry(e))
+		}
+	}
+	snap.Transactions = selectTransactions(s.ledger, 0, 0)
+	sortSnapshot(snap)
+	return snap, nil
+}
+
+// Subscribe delivers later changes to the records q selects
+func (s *FileStore) Subscribe(ctx context.Context, q Query, opts *SubscribeOptions) (*Subscription, error) {
+	return s.broker.Subscribe(ctx, q, opts)
+}
+
+// Close closes the log and ends every subscription
+func (s *FileStore) Close() error {
+	s.broker.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	s.lock.Close()
+	return err
+}
@@ -0,0 +1,189 @@
+package db_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-wasm-poker/pkg/db"
+)
+
+// writeProfiles fills a new store in dir with n profiles and returns the
+// size of the log after each one
+func writeProfiles(t *testing.T, dir string, n int) []int64 {
+	t.Helper()
+	s, err := db.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var sizes []int64
+	for i := 0; i < n; i++ {
+		p := &db.PlayerProfile{ID: fmt.Sprintf("p%d", i), Name: fmt.Sprintf("Player %d", i)}
+		if err := s.SavePlayerProfile(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(filepath.Join(dir, "store.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, info.Size())
+	}
+	return sizes
+}
+
+// profiles returns how many of the profiles writeProfiles wrote a store has
+func profiles(t *testing.T, s db.Store, n int) int {
+	t.Helper()
+	found := 0
+	for i := 0; i < n; i++ {
+		if _, err := s.LoadPlayerProfile(context.Background(), fmt.Sprintf("p%d", i)); err == nil {
+			found++
+		}
+	}
+	return found
+}
+
+func TestFileStoreDamagedLog(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(log []byte, sizes []int64) []byte
+		kept   int  // profiles left, when the store opens
+		fails  bool // with ErrCorruptLog, leaving the log alone
+	}{
+		{
+			name:   "a header cut short at the end is dropped",
+			damage: func(log []byte, _ []int64) []byte { return append(log, 7, 0, 0) },
+			kept:   3,
+		},
+		{
+			name:   "a record cut short at the end is dropped",
+			damage: func(log []byte, sizes []int64) []byte { return log[:sizes[2]-5] },
+			kept:   2,
+		},
+		{
+			name: "a bad checksum on the last record drops it",
+			damage: func(log []byte, sizes []int64) []byte {
+				log[sizes[1]+10] ^= 0xff
+				return log
+			},
+			kept: 2,
+		},
+		{
+			name: "a bad checksum with records after it is corruption",
+			damage: func(log []byte, _ []int64) []byte {
+				log[10] ^= 0xff
+				return log
+			},
+			fails: true,
+		},
+		{
+			name: "a bad length with records after it is corruption",
+			damage: func(log []byte, sizes []int64) []byte {
+				log[sizes[0]+3] = 0x7f
+				return log
+			},
+			fails: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "store.log")
+			sizes := writeProfiles(t, dir, 3)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			damaged := tt.damage(data, sizes)
+			if err := os.WriteFile(path, damaged, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := db.OpenFileStore(dir)
+			if tt.fails {
+				if !errors.Is(err, db.ErrCorruptLog) {
+					t.Fatalf("opened with %v, want ErrCorruptLog", err)
+				}
+				if after, _ := os.ReadFile(path); !bytes.Equal(after, damaged) {
+					t.Error("the corrupt log was changed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if got := profiles(t, s, 3); got != tt.kept {
+				t.Errorf("%d profiles kept, want %d", got, tt.kept)
+			}
+			// The store appends after what it kept
+			if err := s.SavePlayerProfile(context.Background(), &db.PlayerProfile{ID: "p9"}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestFileStoreLock(t *testing.T) {
+	dir := t.TempDir()
+	s, err := db.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.OpenFileStore(dir); !errors.Is(err, db.ErrLocked) {
+		t.Fatalf("opened a locked directory with %v, want ErrLocked", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = db.OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("reopening after Close: %v", err)
+	}
+	s.Close()
+}
+
+func TestFileStoreSyncFailure(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	sizes := writeProfiles(t, dir, 1)
+	s, err := db.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	errSync := errors.New("disk went away")
+	db.SetSyncLog(s, func(*os.File) error { return errSync })
+	if err := s.SavePlayerProfile(ctx, &db.PlayerProfile{ID: "p1"}); !errors.Is(err, errSync) {
+		t.Fatalf("saving with a failing sync returned %v", err)
+	}
+	if _, err := s.LoadPlayerProfile(ctx, "p1"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("loading the failed profile returned %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "store.log")); err != nil || info.Size() != sizes[0] {
+		t.Errorf("log is %v bytes after the failed write, want %d", info.Size(), sizes[0])
+	}
+
+	db.SetSyncLog(s, (*os.File).Sync)
+	if err := s.SavePlayerProfile(ctx, &db.PlayerProfile{ID: "p2"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	// The failed record is gone and the one after it follows the last
+	// good one
+	s, err = db.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]bool{"p0": true, "p1": false, "p2": true} {
+		if _, err := s.LoadPlayerProfile(ctx, id); (err == nil) != want {
+			t.Errorf("after reopening, loading %s returned %v", id, err)
+		}
+	}
+}
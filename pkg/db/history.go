@@ -0,0 +1,279 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// HistoryFilter selects history entries across games. Zero fields don't
+// filter.
+type HistoryFilter struct {
+	GameID   string
+	PlayerID string    // hands the player was dealt into
+	From     time.Time // hands played at or after From
+	To       time.Time // and before To
+	BigBlind int       // hands at these stakes
+	MinPot   int
+	// MinRank, when set, selects hands that went to showdown and were won
+	// with at least this hand
+	MinRank *game.HandRank
+}
+
+// Matches reports whether the filter selects an entry
+func (f *HistoryFilter) Matches(e *GameHistoryEntry) bool {
+	switch {
+	case f.GameID != "" && e.GameID != f.GameID:
+		return false
+	case !f.From.IsZero() && e.Timestamp.Before(f.From):
+		return false
+	case !f.To.IsZero() && !e.Timestamp.Before(f.To):
+		return false
+	case f.BigBlind != 0 && e.BigBlind != f.BigBlind:
+		return false
+	case e.PotSize < f.MinPot:
+		return false
+	case f.MinRank != nil && (!e.Showdown || e.HandRank < *f.MinRank):
+		return false
+	}
+	if f.PlayerID == "" {
+		return true
+	}
+	for _, p := range e.Players {
+		if p == f.PlayerID {
+			return true
+		}
+	}
+	return false
+}
+
+// HistoryOrder is the order a history query returns entries in
+type HistoryOrder int
+
+const (
+	NewestFirst HistoryOrder = iota
+	OldestFirst
+	BiggestPotFirst
+)
+
+// DefaultHistoryLimit and MaxHistoryLimit bound the entries a history query
+// returns at once
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 500
+)
+
+// HistoryQuery asks for one page of the entries a filter selects. Leave
+// Cursor empty for the first page and pass the last page's Next for the
+// following one, with the same filter and order.
+type HistoryQuery struct {
+	HistoryFilter
+	Order  HistoryOrder
+	Limit  int // DefaultHistoryLimit when zero, at most MaxHistoryLimit
+	Cursor string
+}
+
+// HistoryPage is a page of query results. Next is empty on the last page.
+type HistoryPage struct {
+	Entries []*GameHistoryEntry `json:"entries"`
+	Next    string              `json:"next,omitempty"`
+}
+
+// HistorySummary aggregates the entries a filter selects
+type HistorySummary struct {
+	Hands      int       `json:"hands"`
+	Games      int       `json:"games"`
+	Showdowns  int       `json:"showdowns"`
+	Won        int       `json:"won"` // hands the filter's player won, when it has one
+	TotalPot   int       `json:"total_pot"`
+	BiggestPot int       `json:"biggest_pot"`
+	AveragePot float64   `json:"average_pot"`
+	First      time.Time `json:"first"` // when the earliest hand was played
+	Last       time.Time `json:"last"`
+}
+
+// ErrBadCursor is returned for a cursor that didn't come from a query with
+// the same order
+var ErrBadCursor = errors.New("invalid history cursor")
+
+// HistoryCursor is the position after an entry in a query's order. Stores
+// encode it into a page's Next.
+type HistoryCursor struct {
+	Order HistoryOrder `json:"o"`
+	Time  time.Time    `json:"t"`
+	Pot   int          `json:"p"`
+	ID    int64        `json:"id"`
+}
+
+// CursorAfter returns the cursor for the position after an entry
+func CursorAfter(order HistoryOrder, e *GameHistoryEntry) string {
+	data, _ := json.Marshal(HistoryCursor{Order: order, Time: e.Timestamp.UTC(), Pot: e.PotSize, ID: e.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a query's cursor, returning nil for the first page
+func (q *HistoryQuery) ParseCursor() (*HistoryCursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+	var c HistoryCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Order != q.Order {
+		return nil, ErrBadCursor
+	}
+	return &c, nil
+}
+
+// PageLimit returns the number of entries a page holds
+func (q *HistoryQuery) PageLimit() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultHistoryLimit
+	case q.Limit > MaxHistoryLimit:
+		return MaxHistoryLimit
+	}
+	return q.Limit
+}
+
+// Validate checks a query before it runs
+func (q *HistoryQuery) Validate() error {
+	switch q.Order {
+	case NewestFirst, OldestFirst, BiggestPotFirst:
+	default:
+		return fmt.Errorf("unknown history order %d", q.Order)
+	}
+	_, err := q.ParseCursor()
+	return err
+}
+
+// before reports whether a comes before b in an order. Entry IDs break
+// ties, so the order is total.
+func before(order HistoryOrder, a, b *GameHistoryEntry) bool {
+	switch order {
+	case OldestFirst:
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		return a.ID < b.ID
+	case BiggestPotFirst:
+		if a.PotSize != b.PotSize {
+			return a.PotSize > b.PotSize
+		}
+		return a.ID > b.ID
+	}
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.After(b.Timestamp)
+	}
+	return a.ID > b.ID
+}
+
+// queryHistory runs a query over the histories of an in-memory store
+func queryHistory(histories map[string][]*GameHistoryEntry, q *HistoryQuery) (*HistoryPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	cursor, _ := q.ParseCursor()
+	var after *GameHistoryEntry
+	if cursor != nil {
+		after = &GameHistoryEntry{Timestamp: cursor.Time, PotSize: cursor.Pot, ID: cursor.ID}
+	}
+	var matches []*GameHistoryEntry
+	for _, entries := range histories {
+		for _, e := range entries {
+			if q.Matches(e) && (after == nil || before(q.Order, after, e)) {
+				matches = append(matches, e)
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return before(q.Order, matches[i], matches[j]) })
+
+	page := &HistoryPage{Entries: []*GameHistoryEntry{}}
+	limit := q.PageLimit()
+	if len(matches) > limit {
+		matches = matches[:limit]
+		page.Next = CursorAfter(q.Order, matches[limit-1])
+	}
+	for _, e := range matches {
+		page.Entries = append(page.Entries, copyEntry(e))
+	}
+	return page, nil
+}
+
+// Add counts an entry in the summary. The filter's player, if any, is
+// passed to count wins.
+func (s *HistorySummary) Add(e *GameHistoryEntry, playerID string) {
+	s.Hands++
+	if e.Showdown {
+		s.Showdowns++
+	}
+	if playerID != "" && e.Winner == playerID {
+		s.Won++
+	}
+	s.TotalPot += e.PotSize
+	if e.PotSize > s.BiggestPot {
+		s.BiggestPot = e.PotSize
+	}
+	if s.First.IsZero() || e.Timestamp.Before(s.First) {
+		s.First = e.Timestamp
+	}
+	if e.Timestamp.After(s.Last) {
+		s.Last = e.Timestamp
+	}
+	s.AveragePot = float64(s.TotalPot) / float64(s.Hands)
+}
+
+// summarizeHistory aggregates the histories of an in-memory store
+func summarizeHistory(histories map[string][]*GameHistoryEntry, f *HistoryFilter) *HistorySummary {
+	s := &HistorySummary{}
+	for _, entries := range histories {
+		counted := false
+		for _, e := range entries {
+			if !f.Matches(e) {
+				continue
+			}
+			s.Add(e, f.PlayerID)
+			if !counted {
+				s.Games++
+				counted = true
+			}
+		}
+	}
+	return s
+}
+
+// removeEntries removes the entries with the given IDs from the histories
+// of an in-memory store and returns them. A game whose history is left
+// empty is removed.
+func removeEntries(histories map[string][]*GameHistoryEntry, ids []int64) []*GameHistoryEntry {
+	remove := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+	var removed []*GameHistoryEntry
+	for gameID, entries := range histories {
+		kept := entries[:0:0]
+		for _, e := range entries {
+			if remove[e.ID] {
+				removed = append(removed, e)
+			} else {
+				kept = append(kept, e)
+			}
+		}
+		switch {
+		case len(kept) == 0:
+			delete(histories, gameID)
+		case len(kept) < len(entries):
+			histories[gameID] = kept
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].ID < removed[j].ID })
+	return removed
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Transaction is an immutable double-entry ledger transaction: chips moving
+// between accounts. Its entries add up to zero, so no chips are made or
+// lost, and an account's balance is the sum of its entries over every
+// transaction.
+type Transaction struct {
+	ID      int64     `json:"id"` // assigned by the store, one more than the last
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"` // such as a buy-in or a pot
+	Memo    string    `json:"memo,omitempty"`
+	Entries []Entry   `json:"entries"`
+}
+
+// Entry adds Amount, which may be negative, to an account's balance
+type Entry struct {
+	Account string `json:"account"`
+	Amount  int    `json:"amount"`
+}
+
+// ErrUnbalanced is returned for a transaction whose entries don't add up to
+// zero
+var ErrUnbalanced = errors.New("transaction does not balance")
+
+// ValidateTransaction checks a transaction before it is appended. Stores
+// call it; a transaction it rejects is never stored.
+func ValidateTransaction(tx *Transaction) error {
+	if tx.Kind == "" {
+		return errors.New("transaction has no kind")
+	}
+	if len(tx.Entries) < 2 {
+		return fmt.Errorf("%s transaction needs at least two entries", tx.Kind)
+	}
+	sum := 0
+	for _, e := range tx.Entries {
+		if e.Account == "" {
+			return fmt.Errorf("%s transaction has an entry without an account", tx.Kind)
+		}
+		sum += e.Amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("%w: %s entries add up to %d", ErrUnbalanced, tx.Kind, sum)
+	}
+	return nil
+}
+
+// copyTransaction returns a copy of a transaction that doesn't share its
+// entries
+func copyTransaction(tx *Transaction) *Transaction {
+	c := *tx
+	c.Entries = append([]Entry(nil), tx.Entries...)
+	return &c
+}
+
+// selectTransactions returns copies of up to limit of the transactions
+// after the given ID, all of them when limit is 0. txs is ordered by ID
+// from 1 with none missing.
+func selectTransactions(txs []*Transaction, after int64, limit int) []*Transaction {
+	if after < 0 {
+		after = 0
+	}
+	if after > int64(len(txs)) {
+		after = int64(len(txs))
+	}
+	txs = txs[after:]
+	if limit > 0 && len(txs) > limit {
+		txs = txs[:limit]
+	}
+	out := make([]*Transaction, len(txs))
+	for i, tx := range txs {
+		out[i] = copyTransaction(tx)
+	}
+	return out
+}
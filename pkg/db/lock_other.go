@@ -0,0 +1,11 @@
+//go:build !unix
+
+package db
+
+import "os"
+
+// LockFile only creates the file at path. There is no flock on this
+// platform, so keeping a store to one process is up to the caller.
+func LockFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+}
@@ -1,9 +1,10 @@
 package db
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
@@ -12,13 +13,20 @@ import (
 
 // MockSpaceTimeDB is a mock implementation of SpaceTimeDB for the poker game
 // This serves as a placeholder until an official Go client for SpaceTimeDB becomes available
+// It keeps everything in memory and implements Store.
 type MockSpaceTimeDB struct {
 	gameStates     map[string]*game.GameState
+	stateVersions  map[string][]*GameStateVersion
 	playerProfiles map[string]*PlayerProfile
 	gameHistory    map[string][]*GameHistoryEntry
+	lastEntryID    int64
+	transactions   []*Transaction
 	mu             sync.RWMutex
+	broker         Broker
 }
 
+var _ Store = (*MockSpaceTimeDB)(nil)
+
 // PlayerProfile represents a player's profile in the database
 type PlayerProfile struct {
 	ID            string    `json:"id"`
@@ -28,79 +36,222 @@ type PlayerProfile struct {
 	GamesWon      int       `json:"games_won"`
 	BiggestPot    int       `json:"biggest_pot"`
 	LastLoginTime time.Time `json:"last_login_time"`
+	// Rating is the player's skill rating after RatedGames rated events,
+	// and meaningless while that is zero. RatingHistory holds the latest
+	// changes, oldest first.
+	Rating        float64        `json:"rating"`
+	RatedGames    int            `json:"rated_games"`
+	RatingHistory []RatingChange `json:"rating_history,omitempty"`
+}
+
+// RatingChange is how one rated event, a tournament or a cash session,
+// changed a player's rating
+type RatingChange struct {
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+	Place   int       `json:"place"`   // 1 for first, shared by tied players
+	Players int       `json:"players"` // players in the event
+	Before  float64   `json:"before"`
+	After   float64   `json:"after"`
 }
 
 // GameHistoryEntry represents a single game history entry
 type GameHistoryEntry struct {
+	// ID is assigned by the store when the entry is added and grows across
+	// every game's history
+	ID          int64     `json:"id,omitempty"`
 	GameID      string    `json:"game_id"`
 	Timestamp   time.Time `json:"timestamp"`
 	Players     []string  `json:"players"`
 	Winner      string    `json:"winner"`
 	PotSize     int       `json:"pot_size"`
 	HandSummary string    `json:"hand_summary"`
+	SmallBlind  int       `json:"small_blind,omitempty"`
+	BigBlind    int       `json:"big_blind,omitempty"`
+	// Showdown is set when the hand went to showdown, and HandRank is then
+	// the winner's hand
+	Showdown bool          `json:"showdown,omitempty"`
+	HandRank game.HandRank `json:"hand_rank,omitempty"`
 }
 
 // NewMockSpaceTimeDB creates a new mock SpaceTimeDB
 func NewMockSpaceTimeDB() *MockSpaceTimeDB {
 	return &MockSpaceTimeDB{
 		gameStates:     make(map[string]*game.GameState),
+		stateVersions:  make(map[string][]*GameStateVersion),
 		playerProfiles: make(map[string]*PlayerProfile),
 		gameHistory:    make(map[string][]*GameHistoryEntry),
 	}
 }
 
 // SaveGameState saves the current game state
-func (db *MockSpaceTimeDB) SaveGameState(gameID string, state *game.GameState) error {
+func (db *MockSpaceTimeDB) SaveGameState(ctx context.Context, gameID string, state *game.GameState) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	db.mu.Lock()
 	defer db.mu.Unlock()
 	
 	// In a real implementation, we would serialize the game state
-	// and send it to SpaceTimeDB
-	db.gameStates[gameID] = state
-	
-	log.Printf("Game state saved for game %s", gameID)
-	return nil
+	// and send it to SpaceTimeDB.
+	_, err := db.saveState(gameID, state, anyVersion)
+	return err
+}
+
+// SaveGameStateIfVersion saves the game state if it is still at the
+// expected version
+func (db *MockSpaceTimeDB) SaveGameStateIfVersion(ctx context.Context, gameID string, state *game.GameState, expected int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if expected < 0 {
+		return 0, errNegativeVersion
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.saveState(gameID, state, expected)
+}
+
+// saveState adds a version of a game's state if the current version is
+// expected or expected is anyVersion. The caller holds mu.
+func (db *MockSpaceTimeDB) saveState(gameID string, state *game.GameState, expected int64) (int64, error) {
+	versions := db.stateVersions[gameID]
+	var current int64
+	if n := len(versions); n > 0 {
+		current = versions[n-1].Version
+	}
+	if expected != anyVersion && expected != current {
+		return 0, &ConflictError{ID: gameID, Expected: expected, Actual: current}
+	}
+	op := Insert
+	if current > 0 {
+		op = Update
+	}
+	// Store a copy so that later changes to the live table don't change
+	// what was saved
+	v := &GameStateVersion{Version: current + 1, SavedAt: time.Now(), State: state.Clone()}
+	versions = append(versions, v)
+	if len(versions) > MaxStateVersions {
+		versions = append([]*GameStateVersion(nil), versions[len(versions)-MaxStateVersions:]...)
+	}
+	db.stateVersions[gameID] = versions
+	db.gameStates[gameID] = v.State
+	db.broker.Publish(Change{Op: op, Kind: KindGameState, ID: gameID, Version: v.Version, State: state})
+
+	log.Printf("Game state saved for game %s at version %d", gameID, v.Version)
+	return v.Version, nil
 }
 
 // LoadGameState loads a game state
-func (db *MockSpaceTimeDB) LoadGameState(gameID string) (*game.GameState, error) {
+func (db *MockSpaceTimeDB) LoadGameState(ctx context.Context, gameID string) (*game.GameState, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 	
 	state, exists := db.gameStates[gameID]
 	if !exists {
-		return nil, errors.New("game state not found")
+		return nil, notFound(KindGameState, gameID)
 	}
 	
-	return state, nil
+	return state.Clone(), nil
+}
+
+// LoadGameStateVersion loads a game state and its version
+func (db *MockSpaceTimeDB) LoadGameStateVersion(ctx context.Context, gameID string) (*game.GameState, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	versions := db.stateVersions[gameID]
+	if len(versions) == 0 {
+		return nil, 0, notFound(KindGameState, gameID)
+	}
+	v := versions[len(versions)-1]
+	return v.State.Clone(), v.Version, nil
+}
+
+// GameStateVersions returns the kept versions of a game state, oldest first
+func (db *MockSpaceTimeDB) GameStateVersions(ctx context.Context, gameID string) ([]*GameStateVersion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	versions := db.stateVersions[gameID]
+	if len(versions) == 0 {
+		return nil, notFound(KindGameState, gameID)
+	}
+	return copyVersions(versions), nil
 }
 
 // SavePlayerProfile saves a player profile
-func (db *MockSpaceTimeDB) SavePlayerProfile(profile *PlayerProfile) error {
+func (db *MockSpaceTimeDB) SavePlayerProfile(ctx context.Context, profile *PlayerProfile) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	db.mu.Lock()
 	defer db.mu.Unlock()
 	
-	db.playerProfiles[profile.ID] = profile
+	op := Insert
+	if _, exists := db.playerProfiles[profile.ID]; exists {
+		op = Update
+	}
+	db.playerProfiles[profile.ID] = copyProfile(profile)
+	db.broker.Publish(Change{Op: op, Kind: KindPlayerProfile, ID: profile.ID, Profile: profile})
 	
 	log.Printf("Player profile saved for player %s", profile.ID)
 	return nil
 }
 
 // LoadPlayerProfile loads a player profile
-func (db *MockSpaceTimeDB) LoadPlayerProfile(playerID string) (*PlayerProfile, error) {
+func (db *MockSpaceTimeDB) LoadPlayerProfile(ctx context.Context, playerID string) (*PlayerProfile, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 	
 	profile, exists := db.playerProfiles[playerID]
 	if !exists {
-		return nil, errors.New("player profile not found")
+		return nil, notFound(KindPlayerProfile, playerID)
 	}
 	
+	return copyProfile(profile), nil
+}
+
+// UpdatePlayerProfile updates a player profile in place
+func (db *MockSpaceTimeDB) UpdatePlayerProfile(ctx context.Context, playerID string, update func(*PlayerProfile) error) (*PlayerProfile, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	op, profile := Insert, &PlayerProfile{ID: playerID}
+	if p, exists := db.playerProfiles[playerID]; exists {
+		op, profile = Update, copyProfile(p)
+	}
+	if err := update(profile); err != nil {
+		return nil, err
+	}
+	profile.ID = playerID
+	db.playerProfiles[playerID] = copyProfile(profile)
+	db.broker.Publish(Change{Op: op, Kind: KindPlayerProfile, ID: playerID, Profile: copyProfile(profile)})
+
+	log.Printf("Player profile updated for player %s", playerID)
 	return profile, nil
 }
 
 // AddGameHistoryEntry adds a game history entry
-func (db *MockSpaceTimeDB) AddGameHistoryEntry(gameID string, entry *GameHistoryEntry) error {
+func (db *MockSpaceTimeDB) AddGameHistoryEntry(ctx context.Context, gameID string, entry *GameHistoryEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	db.mu.Lock()
 	defer db.mu.Unlock()
 	
@@ -108,26 +259,154 @@ func (db *MockSpaceTimeDB) AddGameHistoryEntry(gameID string, entry *GameHistory
 		db.gameHistory[gameID] = make([]*GameHistoryEntry, 0)
 	}
 	
-	db.gameHistory[gameID] = append(db.gameHistory[gameID], entry)
+	db.lastEntryID++
+	stored := copyEntry(entry)
+	stored.ID, stored.GameID = db.lastEntryID, gameID
+	db.gameHistory[gameID] = append(db.gameHistory[gameID], stored)
+	db.broker.Publish(Change{Op: Insert, Kind: KindGameHistory, ID: gameID, Entry: stored})
 	
 	log.Printf("Game history entry added for game %s", gameID)
 	return nil
 }
 
 // GetGameHistory gets the game history for a game
-func (db *MockSpaceTimeDB) GetGameHistory(gameID string) ([]*GameHistoryEntry, error) {
+func (db *MockSpaceTimeDB) GetGameHistory(ctx context.Context, gameID string) ([]*GameHistoryEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 	
 	history, exists := db.gameHistory[gameID]
 	if !exists {
-		return nil, errors.New("game history not found")
+		return nil, notFound(KindGameHistory, gameID)
 	}
 	
-	return history, nil
+	entries := make([]*GameHistoryEntry, len(history))
+	for i, e := range history {
+		entries[i] = copyEntry(e)
+	}
+	return entries, nil
+}
+
+// DeleteHistory removes history entries by ID
+func (db *MockSpaceTimeDB) DeleteHistory(ctx context.Context, ids []int64) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	removed := removeEntries(db.gameHistory, ids)
+	for _, e := range removed {
+		db.broker.Publish(Change{Op: Delete, Kind: KindGameHistory, ID: e.GameID, Entry: e})
+	}
+	return len(removed), nil
+}
+
+// ExpireGameStates removes the games not saved since before
+func (db *MockSpaceTimeDB) ExpireGameStates(ctx context.Context, before time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	expired := []string{}
+	for id, versions := range db.stateVersions {
+		if len(versions) > 0 && versions[len(versions)-1].SavedAt.Before(before) {
+			expired = append(expired, id)
+		}
+	}
+	sort.Strings(expired)
+	for _, id := range expired {
+		delete(db.stateVersions, id)
+		delete(db.gameStates, id)
+		db.broker.Publish(Change{Op: Delete, Kind: KindGameState, ID: id})
+	}
+	return expired, nil
+}
+
+// QueryHistory returns a page of history entries across games
+func (db *MockSpaceTimeDB) QueryHistory(ctx context.Context, q HistoryQuery) (*HistoryPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return queryHistory(db.gameHistory, &q)
+}
+
+// SummarizeHistory aggregates history entries across games
+func (db *MockSpaceTimeDB) SummarizeHistory(ctx context.Context, f HistoryFilter) (*HistorySummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return summarizeHistory(db.gameHistory, &f), nil
+}
+
+// AppendTransaction adds a transaction to the ledger
+func (db *MockSpaceTimeDB) AppendTransaction(ctx context.Context, tx *Transaction) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := ValidateTransaction(tx); err != nil {
+		return 0, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored := copyTransaction(tx)
+	stored.ID = int64(len(db.transactions)) + 1
+	db.transactions = append(db.transactions, stored)
+	db.broker.Publish(Change{Op: Insert, Kind: KindTransaction, Transaction: stored})
+
+	return stored.ID, nil
+}
+
+// Transactions returns ledger transactions in order
+func (db *MockSpaceTimeDB) Transactions(ctx context.Context, after int64, limit int) ([]*Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return selectTransactions(db.transactions, after, limit), nil
+}
+
+// Export copies every record
+func (db *MockSpaceTimeDB) Export(ctx context.Context) (*Snapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	snap := newSnapshot()
+	for id, versions := range db.stateVersions {
+		g := &GameSnapshot{ID: id}
+		for _, v := range versions {
+			g.Versions = append(g.Versions, &GameStateVersion{Version: v.Version, SavedAt: v.SavedAt, State: v.State.Clone()})
+		}
+		snap.Games = append(snap.Games, g)
+	}
+	for _, p := range db.playerProfiles {
+		snap.Profiles = append(snap.Profiles, copyProfile(p))
+	}
+	for _, entries := range db.gameHistory {
+		for _, e := range entries {
+			snap.History = append(snap.History, copyEntry(e))
+		}
+	}
+	snap.Transactions = selectTransactions(db.transactions, 0, 0)
+	sortSnapshot(snap)
+	return snap, nil
 }
 
-// SerializeGameState serializes a game state to JSON
+// SerializeGameState serializes a game state to versioned JSON, see
+// game.SchemaVersion
 func (db *MockSpaceTimeDB) SerializeGameState(state *game.GameState) (string, error) {
 	data, err := json.Marshal(state)
 	if err != nil {
@@ -137,7 +416,8 @@ func (db *MockSpaceTimeDB) SerializeGameState(state *game.GameState) (string, er
 	return string(data), nil
 }
 
-// DeserializeGameState deserializes a game state from JSON
+// DeserializeGameState deserializes a game state from JSON, migrating states
+// saved with older schema versions
 func (db *MockSpaceTimeDB) DeserializeGameState(data string) (*game.GameState, error) {
 	var state game.GameState
 	err := json.Unmarshal([]byte(data), &state)
@@ -157,6 +437,17 @@ func (db *MockSpaceTimeDB) Connect() error {
 	return nil
 }
 
+// Subscribe delivers later changes to the records q selects
+func (db *MockSpaceTimeDB) Subscribe(ctx context.Context, q Query, opts *SubscribeOptions) (*Subscription, error) {
+	return db.broker.Subscribe(ctx, q, opts)
+}
+
+// Close implements Store by ending every subscription
+func (db *MockSpaceTimeDB) Close() error {
+	db.broker.Close()
+	return nil
+}
+
 // Disconnect simulates disconnecting from SpaceTimeDB
 func (db *MockSpaceTimeDB) Disconnect() error {
 	log.Println("Disconnecting from SpaceTimeDB (mock)...")
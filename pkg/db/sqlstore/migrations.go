@@ -0,0 +1,193 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is one step of the schema. Migrations are applied in order and
+// never changed once released; a schema change is a new migration.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+var migrations = []migration{
+	{1, "initial schema", `
+CREATE TABLE players (
+	id              TEXT PRIMARY KEY,
+	name            TEXT NOT NULL,
+	total_chips     INTEGER NOT NULL,
+	games_played    INTEGER NOT NULL,
+	games_won       INTEGER NOT NULL,
+	biggest_pot     INTEGER NOT NULL,
+	last_login_time TEXT NOT NULL
+);
+
+-- The last saved state of each table, in the game's JSON schema
+CREATE TABLE tables (
+	id       TEXT PRIMARY KEY,
+	state    TEXT NOT NULL,
+	saved_at TEXT NOT NULL
+);
+
+-- One row per game history entry. Hands added with AddHand also have
+-- their players, actions and payouts.
+CREATE TABLE hands (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	table_id    TEXT NOT NULL,
+	hand_number TEXT,
+	played_at   TEXT NOT NULL,
+	small_blind INTEGER,
+	big_blind   INTEGER,
+	button_seat INTEGER,
+	board       TEXT,
+	winner      TEXT NOT NULL,
+	pot_size    INTEGER NOT NULL,
+	rake        INTEGER NOT NULL DEFAULT 0,
+	summary     TEXT NOT NULL
+);
+CREATE INDEX hands_table ON hands (table_id, id);
+
+CREATE TABLE hand_players (
+	hand_id   INTEGER NOT NULL REFERENCES hands (id) ON DELETE CASCADE,
+	ordinal   INTEGER NOT NULL,
+	player_id TEXT NOT NULL,
+	seat      INTEGER,
+	name      TEXT,
+	stack     INTEGER,
+	cards     TEXT,
+	shown     INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (hand_id, ordinal)
+);
+CREATE INDEX hand_players_player ON hand_players (player_id);
+
+-- Blinds are actions named small_blind and big_blind on the preflop
+CREATE TABLE actions (
+	hand_id   INTEGER NOT NULL REFERENCES hands (id) ON DELETE CASCADE,
+	seq       INTEGER NOT NULL,
+	street    TEXT NOT NULL,
+	seat      INTEGER NOT NULL,
+	player_id TEXT NOT NULL,
+	action    TEXT NOT NULL,
+	amount    INTEGER NOT NULL,
+	bet_to    INTEGER NOT NULL,
+	all_in    INTEGER NOT NULL,
+	PRIMARY KEY (hand_id, seq)
+);
+CREATE INDEX actions_player ON actions (player_id);
+
+-- pot is 0 for the main pot, 1 and up for side pots, -1 for a returned bet
+CREATE TABLE payouts (
+	hand_id   INTEGER NOT NULL REFERENCES hands (id) ON DELETE CASCADE,
+	seq       INTEGER NOT NULL,
+	player_id TEXT NOT NULL,
+	seat      INTEGER NOT NULL,
+	pot       INTEGER NOT NULL,
+	amount    INTEGER NOT NULL,
+	PRIMARY KEY (hand_id, seq)
+);
+CREATE INDEX payouts_player ON payouts (player_id);
+`},
+	{2, "game state versions", `
+ALTER TABLE tables ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- The last saved versions of each table's state, the current one included
+CREATE TABLE table_versions (
+	table_id TEXT NOT NULL,
+	version  INTEGER NOT NULL,
+	state    TEXT NOT NULL,
+	saved_at TEXT NOT NULL,
+	PRIMARY KEY (table_id, version)
+);
+INSERT INTO table_versions (table_id, version, state, saved_at)
+SELECT id, version, state, saved_at FROM tables;
+`},
+	{3, "skill ratings", `
+ALTER TABLE players ADD COLUMN rating REAL NOT NULL DEFAULT 0;
+ALTER TABLE players ADD COLUMN rated_games INTEGER NOT NULL DEFAULT 0;
+
+-- The latest rating changes of each player, oldest first
+CREATE TABLE rating_history (
+	player_id     TEXT NOT NULL REFERENCES players (id) ON DELETE CASCADE,
+	seq           INTEGER NOT NULL,
+	event         TEXT NOT NULL,
+	time          TEXT NOT NULL,
+	place         INTEGER NOT NULL,
+	players       INTEGER NOT NULL,
+	rating_before REAL NOT NULL,
+	rating_after  REAL NOT NULL,
+	PRIMARY KEY (player_id, seq)
+);
+`},
+	{4, "ledger", `
+CREATE TABLE ledger_transactions (
+	id   INTEGER PRIMARY KEY,
+	time TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	memo TEXT NOT NULL
+);
+
+CREATE TABLE ledger_entries (
+	tx_id   INTEGER NOT NULL REFERENCES ledger_transactions (id),
+	seq     INTEGER NOT NULL,
+	account TEXT NOT NULL,
+	amount  INTEGER NOT NULL,
+	PRIMARY KEY (tx_id, seq)
+);
+CREATE INDEX ledger_entries_account ON ledger_entries (account);
+`},
+	{5, "history queries", `
+-- hand_rank is the winner's hand at showdown, unknown for hands added
+-- before this migration
+ALTER TABLE hands ADD COLUMN showdown INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE hands ADD COLUMN hand_rank INTEGER;
+UPDATE hands SET showdown = 1 WHERE summary LIKE '% at showdown';
+CREATE INDEX hands_played ON hands (played_at, id);
+CREATE INDEX hands_pot ON hands (pot_size, id);
+`},
+}
+
+// migrate brings the schema up to date, applying each missing migration in
+// its own transaction
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TEXT NOT NULL
+)`); err != nil {
+		return err
+	}
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	if latest := migrations[len(migrations)-1].version; current > latest {
+		return fmt.Errorf("database schema version %d is newer than this program's %d", current, latest)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.version, m.name, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
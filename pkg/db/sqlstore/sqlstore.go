@@ -0,0 +1,1010 @@
+// Package sqlstore is a db.Store kept in SQLite, using a pure-Go driver so
+// that it builds without cgo. Players, tables and hands are stored in
+// normalized tables, with the actions and payouts of hands added through
+// AddHand, so that hands can be queried with ad-hoc SQL. The schema is
+// described in migrations.go and brought up to date when a store is opened.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/game"
+	"go-wasm-poker/pkg/history"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// timeFormat is how times are stored, so that they sort as text
+const timeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Store is a db.Store in an SQLite database
+type Store struct {
+	db     *sql.DB
+	lock   *os.File   // keeps other stores out of the database, nil in memory
+	mu     sync.Mutex // orders writes, so changes are published in commit order
+	broker db.Broker
+}
+
+var _ db.Store = (*Store)(nil)
+
+// Open opens or creates the database at path and applies any missing
+// schema migrations. A path of ":memory:" opens a private in-memory
+// database. While the store is open it locks path plus ".lock", and opening
+// the same database again fails with db.ErrLocked until it is closed; other
+// SQLite clients, such as reporting tools, aren't kept out.
+func Open(ctx context.Context, path string) (*Store, error) {
+	var lock *os.File
+	if path != ":memory:" {
+		var err error
+		if lock, err = db.LockFile(path + ".lock"); err != nil {
+			return nil, err
+		}
+	}
+	fail := func(err error) (*Store, error) {
+		if lock != nil {
+			lock.Close()
+		}
+		return nil, err
+	}
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	if path != ":memory:" {
+		params.Add("_pragma", "journal_mode(WAL)")
+	}
+	sqlDB, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return fail(err)
+	}
+	// SQLite allows one writer at a time, and every connection to
+	// ":memory:" would be a different database
+	sqlDB.SetMaxOpenConns(1)
+	if err := migrate(ctx, sqlDB); err != nil {
+		sqlDB.Close()
+		return fail(err)
+	}
+	return &Store{db: sqlDB, lock: lock}, nil
+}
+
+// DB returns the underlying database, for reporting queries
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// Subscribe delivers later changes to the records q selects
+func (s *Store) Subscribe(ctx context.Context, q db.Query, opts *db.SubscribeOptions) (*db.Subscription, error) {
+	return s.broker.Subscribe(ctx, q, opts)
+}
+
+// Close closes the database and ends every subscription
+func (s *Store) Close() error {
+	s.broker.Close()
+	err := s.db.Close()
+	if s.lock != nil {
+		s.lock.Close()
+	}
+	return err
+}
+
+// upsert runs a statement that inserts or replaces the row of table with
+// the given ID, reporting whether it is new. then, when not nil, runs in the
+// same transaction afterwards. The caller holds mu.
+func (s *Store) upsert(ctx context.Context, table, id string, then func(*sql.Tx) error, query string, args ...any) (db.ChangeOp, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+table+` WHERE id = ?)`, id).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return 0, err
+	}
+	if then != nil {
+		if err := then(tx); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if exists {
+		return db.Update, nil
+	}
+	return db.Insert, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(timeFormat, s)
+}
+
+// anyVersion is the expected version of an unconditional save
+const anyVersion = -1
+
+// SaveGameState saves a table's current state
+func (s *Store) SaveGameState(ctx context.Context, gameID string, state *game.GameState) error {
+	_, err := s.saveState(ctx, gameID, state, anyVersion)
+	return err
+}
+
+// SaveGameStateIfVersion saves a table's state if it is still at the
+// expected version
+func (s *Store) SaveGameStateIfVersion(ctx context.Context, gameID string, state *game.GameState, expected int64) (int64, error) {
+	if expected < 0 {
+		return 0, errors.New("expected version is negative")
+	}
+	return s.saveState(ctx, gameID, state, expected)
+}
+
+// saveState adds a version of a table's state if the current version is
+// expected or expected is anyVersion
+func (s *Store) saveState(ctx context.Context, gameID string, state *game.GameState, expected int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var current int64
+	err = tx.QueryRowContext(ctx, `SELECT version FROM tables WHERE id = ?`, gameID).Scan(&current)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	if expected != anyVersion && expected != current {
+		return 0, &db.ConflictError{ID: gameID, Expected: expected, Actual: current}
+	}
+	version, savedAt := current+1, formatTime(time.Now())
+	if _, err := tx.ExecContext(ctx, `INSERT INTO tables (id, state, saved_at, version) VALUES (?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET state = excluded.state, saved_at = excluded.saved_at, version = excluded.version`,
+		gameID, string(data), savedAt, version); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO table_versions (table_id, version, state, saved_at) VALUES (?, ?, ?, ?)`,
+		gameID, version, string(data), savedAt); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM table_versions WHERE table_id = ? AND version <= ?`,
+		gameID, version-db.MaxStateVersions); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	op := db.Update
+	if current == 0 {
+		op = db.Insert
+	}
+	s.broker.Publish(db.Change{Op: op, Kind: db.KindGameState, ID: gameID, Version: version, State: state})
+	return version, nil
+}
+
+// LoadGameState returns a table's last saved state
+func (s *Store) LoadGameState(ctx context.Context, gameID string) (*game.GameState, error) {
+	state, _, err := s.LoadGameStateVersion(ctx, gameID)
+	return state, err
+}
+
+// LoadGameStateVersion returns a table's last saved state and its version
+func (s *Store) LoadGameStateVersion(ctx context.Context, gameID string) (*game.GameState, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	var data string
+	var version int64
+	err := s.db.QueryRowContext(ctx, `SELECT state, version FROM tables WHERE id = ?`, gameID).Scan(&data, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, &db.NotFoundError{Kind: db.KindGameState, ID: gameID}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	var state game.GameState
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return nil, 0, err
+	}
+	return &state, version, nil
+}
+
+// GameStateVersions returns the kept versions of a table's state, oldest
+// first
+func (s *Store) GameStateVersions(ctx context.Context, gameID string) ([]*db.GameStateVersion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT version, state, saved_at FROM table_versions WHERE table_id = ? ORDER BY version`, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var versions []*db.GameStateVersion
+	for rows.Next() {
+		var data, savedAt string
+		v := &db.GameStateVersion{State: &game.GameState{}}
+		if err := rows.Scan(&v.Version, &data, &savedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), v.State); err != nil {
+			return nil, err
+		}
+		if v.SavedAt, err = parseTime(savedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, &db.NotFoundError{Kind: db.KindGameState, ID: gameID}
+	}
+	return versions, nil
+}
+
+// SavePlayerProfile saves a profile
+func (s *Store) SavePlayerProfile(ctx context.Context, p *db.PlayerProfile) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.savePlayerProfile(ctx, p)
+}
+
+// savePlayerProfile saves a profile. The caller holds mu.
+func (s *Store) savePlayerProfile(ctx context.Context, p *db.PlayerProfile) error {
+	history := func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM rating_history WHERE player_id = ?`, p.ID); err != nil {
+			return err
+		}
+		for i, r := range p.RatingHistory {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO rating_history
+	(player_id, seq, event, time, place, players, rating_before, rating_after)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				p.ID, i, r.Event, formatTime(r.Time), r.Place, r.Players, r.Before, r.After); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	op, err := s.upsert(ctx, "players", p.ID, history, `INSERT INTO players
+	(id, name, total_chips, games_played, games_won, biggest_pot, last_login_time, rating, rated_games)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET
+	name = excluded.name,
+	total_chips = excluded.total_chips,
+	games_played = excluded.games_played,
+	games_won = excluded.games_won,
+	biggest_pot = excluded.biggest_pot,
+	last_login_time = excluded.last_login_time,
+	rating = excluded.rating,
+	rated_games = excluded.rated_games`,
+		p.ID, p.Name, p.TotalChips, p.GamesPlayed, p.GamesWon, p.BiggestPot, formatTime(p.LastLoginTime), p.Rating, p.RatedGames)
+	if err != nil {
+		return err
+	}
+	s.broker.Publish(db.Change{Op: op, Kind: db.KindPlayerProfile, ID: p.ID, Profile: p})
+	return nil
+}
+
+// UpdatePlayerProfile applies update to a player's profile and saves it.
+// Writes wait until it is done, so nothing else changes the profile between
+// loading and saving it.
+func (s *Store) UpdatePlayerProfile(ctx context.Context, playerID string, update func(*db.PlayerProfile) error) (*db.PlayerProfile, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.LoadPlayerProfile(ctx, playerID)
+	if errors.Is(err, db.ErrNotFound) {
+		p, err = &db.PlayerProfile{ID: playerID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := update(p); err != nil {
+		return nil, err
+	}
+	p.ID = playerID
+	// Subscribers get their own copy
+	saved := *p
+	saved.RatingHistory = append([]db.RatingChange(nil), p.RatingHistory...)
+	if err := s.savePlayerProfile(ctx, &saved); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadPlayerProfile returns a player's profile
+func (s *Store) LoadPlayerProfile(ctx context.Context, playerID string) (*db.PlayerProfile, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p := &db.PlayerProfile{}
+	var login string
+	err := s.db.QueryRowContext(ctx, `SELECT id, name, total_chips, games_played, games_won, biggest_pot, last_login_time, rating, rated_games
+FROM players WHERE id = ?`, playerID).Scan(&p.ID, &p.Name, &p.TotalChips, &p.GamesPlayed, &p.GamesWon, &p.BiggestPot, &login, &p.Rating, &p.RatedGames)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &db.NotFoundError{Kind: db.KindPlayerProfile, ID: playerID}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.LastLoginTime, err = parseTime(login); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT event, time, place, players, rating_before, rating_after
+FROM rating_history WHERE player_id = ? ORDER BY seq`, playerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r db.RatingChange
+		var t string
+		if err := rows.Scan(&r.Event, &t, &r.Place, &r.Players, &r.Before, &r.After); err != nil {
+			return nil, err
+		}
+		if r.Time, err = parseTime(t); err != nil {
+			return nil, err
+		}
+		p.RatingHistory = append(p.RatingHistory, r)
+	}
+	return p, rows.Err()
+}
+
+// AddGameHistoryEntry adds an entry to a table's history as a hand without
+// actions
+func (s *Store) AddGameHistoryEntry(ctx context.Context, gameID string, entry *db.GameHistoryEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `INSERT INTO hands
+	(table_id, played_at, small_blind, big_blind, winner, pot_size, summary, showdown, hand_rank)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		gameID, formatTime(entry.Timestamp), entry.SmallBlind, entry.BigBlind, entry.Winner, entry.PotSize,
+		entry.HandSummary, entry.Showdown, entry.HandRank)
+	if err != nil {
+		return err
+	}
+	handID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for i, id := range entry.Players {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO hand_players (hand_id, ordinal, player_id) VALUES (?, ?, ?)`, handID, i, id); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	stored := *entry
+	stored.ID, stored.GameID = handID, gameID
+	s.broker.Publish(db.Change{Op: db.Insert, Kind: db.KindGameHistory, ID: gameID, Entry: &stored})
+	return nil
+}
+
+// AddHand adds a complete hand to a table's history, with its players,
+// actions and payouts. Its history entry is the one db.HandEntry makes.
+func (s *Store) AddHand(ctx context.Context, gameID string, h *history.Hand) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	entry := db.HandEntry(gameID, h)
+	players := make(map[int]string, len(h.Seats))
+	for i, st := range h.Seats {
+		players[st.Number] = entry.Players[i]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `INSERT INTO hands
+	(table_id, hand_number, played_at, small_blind, big_blind, button_seat, board, winner, pot_size, rake, summary, showdown, hand_rank)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		gameID, h.ID, formatTime(h.Time), h.SmallBlind, h.BigBlind, h.ButtonSeat, cardCodes(h.Board),
+		entry.Winner, entry.PotSize, h.Rake, entry.HandSummary, entry.Showdown, entry.HandRank)
+	if err != nil {
+		return err
+	}
+	handID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for i, st := range h.Seats {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO hand_players (hand_id, ordinal, player_id, seat, name, stack, cards, shown)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, handID, i, entry.Players[i], st.Number, st.Name, st.Stack, cardCodes(st.Cards), st.Shown); err != nil {
+			return err
+		}
+	}
+	seq := 0
+	insertAction := func(street, action string, seat, amount, to int, allIn bool) error {
+		seq++
+		_, err := tx.ExecContext(ctx, `INSERT INTO actions (hand_id, seq, street, seat, player_id, action, amount, bet_to, all_in)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, handID, seq, street, seat, players[seat], action, amount, to, allIn)
+		return err
+	}
+	for _, b := range h.Blinds {
+		action := "small_blind"
+		if b.Big {
+			action = "big_blind"
+		}
+		if err := insertAction(enumName(game.PreFlop), action, b.Seat, b.Amount, b.Amount, false); err != nil {
+			return err
+		}
+	}
+	for _, a := range h.Actions {
+		if err := insertAction(enumName(a.Street), enumName(a.Action), a.Seat, a.Amount, a.To, a.AllIn); err != nil {
+			return err
+		}
+	}
+	for i, p := range h.Payouts {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO payouts (hand_id, seq, player_id, seat, pot, amount) VALUES (?, ?, ?, ?, ?, ?)`,
+			handID, i+1, players[p.Seat], p.Seat, p.Pot, p.Amount); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	entry.ID = handID
+	s.broker.Publish(db.Change{Op: db.Insert, Kind: db.KindGameHistory, ID: gameID, Entry: entry})
+	return nil
+}
+
+// LoadHand returns the complete hand AddHand stored under a history entry
+// ID, or a db.ErrNotFound error when the entry was added without one.
+// MaxSeats isn't stored, so it is the highest seat taken.
+func (s *Store) LoadHand(ctx context.Context, id int64) (*history.Hand, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	h := &history.Hand{}
+	var number, board sql.NullString
+	var played string
+	var smallBlind, bigBlind, button sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT table_id, hand_number, played_at, small_blind, big_blind, button_seat, board, rake
+FROM hands WHERE id = ?`, id).Scan(&h.Table, &number, &played, &smallBlind, &bigBlind, &button, &board, &h.Rake)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !button.Valid) {
+		return nil, &db.NotFoundError{Kind: db.KindGameHistory, ID: fmt.Sprint(id)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	h.ID, h.ButtonSeat = number.String, int(button.Int64)
+	h.SmallBlind, h.BigBlind = int(smallBlind.Int64), int(bigBlind.Int64)
+	if h.Time, err = parseTime(played); err != nil {
+		return nil, err
+	}
+	if h.Board, err = parseCardCodes(board.String); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT player_id, seat, name, stack, cards, shown FROM hand_players
+WHERE hand_id = ? ORDER BY ordinal`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var st history.Seat
+		var cards string
+		if err := rows.Scan(&st.PlayerID, &st.Number, &st.Name, &st.Stack, &cards, &st.Shown); err != nil {
+			return nil, err
+		}
+		if st.Cards, err = parseCardCodes(cards); err != nil {
+			return nil, err
+		}
+		if st.Number > h.MaxSeats {
+			h.MaxSeats = st.Number
+		}
+		h.Seats = append(h.Seats, st)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `SELECT street, seat, action, amount, bet_to, all_in FROM actions
+WHERE hand_id = ? ORDER BY seq`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a history.Action
+		var street, action string
+		if err := rows.Scan(&street, &a.Seat, &action, &a.Amount, &a.To, &a.AllIn); err != nil {
+			return nil, err
+		}
+		if action == "small_blind" || action == "big_blind" {
+			h.Blinds = append(h.Blinds, history.Blind{Seat: a.Seat, Amount: a.Amount, Big: action == "big_blind"})
+			continue
+		}
+		if err := a.Street.UnmarshalText([]byte(street)); err != nil {
+			return nil, err
+		}
+		if err := a.Action.UnmarshalText([]byte(action)); err != nil {
+			return nil, err
+		}
+		h.Actions = append(h.Actions, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `SELECT seat, pot, amount FROM payouts WHERE hand_id = ? ORDER BY seq`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p history.Payout
+		if err := rows.Scan(&p.Seat, &p.Pot, &p.Amount); err != nil {
+			return nil, err
+		}
+		h.Payouts = append(h.Payouts, p)
+	}
+	return h, rows.Err()
+}
+
+// parseCardCodes parses cards written by cardCodes
+func parseCardCodes(codes string) ([]game.Card, error) {
+	var cards []game.Card
+	for i := 0; i+2 <= len(codes); i += 2 {
+		c, err := game.ParseCard(codes[i : i+2])
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, c)
+	}
+	return cards, nil
+}
+
+// enumName returns the JSON name of a game enum, such as "flop" or "raise"
+func enumName(v interface{ MarshalText() ([]byte, error) }) string {
+	text, err := v.MarshalText()
+	if err != nil {
+		return "unknown"
+	}
+	return string(text)
+}
+
+func cardCodes(cards []game.Card) string {
+	var b strings.Builder
+	for _, c := range cards {
+		b.WriteString(c.Code())
+	}
+	return b.String()
+}
+
+// GetGameHistory returns a table's history, oldest entry first
+func (s *Store) GetGameHistory(ctx context.Context, gameID string) ([]*db.GameHistoryEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entries, err := s.selectEntries(ctx, `h.table_id = ?`, []any{gameID}, `h.id`, -1)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, &db.NotFoundError{Kind: db.KindGameHistory, ID: gameID}
+	}
+	return entries, nil
+}
+
+// selectEntries returns up to limit of the entries where selects, or all of
+// them when limit is -1, in the given order of hands h
+func (s *Store) selectEntries(ctx context.Context, where string, args []any, order string, limit int) ([]*db.GameHistoryEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT h.id, h.table_id, h.played_at, h.small_blind, h.big_blind, h.winner, h.pot_size,
+	h.summary, h.showdown, h.hand_rank, hp.player_id
+FROM (SELECT * FROM hands h WHERE `+where+` ORDER BY `+order+` LIMIT ?) h
+LEFT JOIN hand_players hp ON hp.hand_id = h.id
+ORDER BY `+order+`, hp.ordinal`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []*db.GameHistoryEntry
+	lastID := int64(-1)
+	for rows.Next() {
+		var played string
+		var smallBlind, bigBlind, rank sql.NullInt64
+		var player sql.NullString
+		e := &db.GameHistoryEntry{}
+		if err := rows.Scan(&e.ID, &e.GameID, &played, &smallBlind, &bigBlind, &e.Winner, &e.PotSize,
+			&e.HandSummary, &e.Showdown, &rank, &player); err != nil {
+			return nil, err
+		}
+		if e.ID != lastID {
+			if e.Timestamp, err = parseTime(played); err != nil {
+				return nil, err
+			}
+			e.SmallBlind, e.BigBlind = int(smallBlind.Int64), int(bigBlind.Int64)
+			e.HandRank = game.HandRank(rank.Int64)
+			entries = append(entries, e)
+			lastID = e.ID
+		}
+		if player.Valid {
+			last := entries[len(entries)-1]
+			last.Players = append(last.Players, player.String)
+		}
+	}
+	return entries, rows.Err()
+}
+
+// DeleteHistory removes hands by ID, with their players, actions and
+// payouts
+func (s *Store) DeleteHistory(ctx context.Context, ids []int64) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	// Delete in batches, to stay under SQLite's limit on parameters
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > db.MaxHistoryLimit {
+			batch = batch[:db.MaxHistoryLimit]
+		}
+		ids = ids[len(batch):]
+		in := strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+		entries, err := s.selectEntries(ctx, `h.id IN (`+in+`)`, args, `h.id`, -1)
+		if err != nil {
+			return removed, err
+		}
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM hands WHERE id IN (`+in+`)`, args...); err != nil {
+			return removed, err
+		}
+		for _, e := range entries {
+			s.broker.Publish(db.Change{Op: db.Delete, Kind: db.KindGameHistory, ID: e.GameID, Entry: e})
+		}
+		removed += len(entries)
+	}
+	return removed, nil
+}
+
+// ExpireGameStates removes the tables not saved since before, with their
+// kept versions. Their hands stay in the history.
+func (s *Store) ExpireGameStates(ctx context.Context, before time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM tables WHERE saved_at < ? ORDER BY id`, formatTime(before))
+	if err != nil {
+		return nil, err
+	}
+	expired := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		expired = append(expired, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, id := range expired {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM table_versions WHERE table_id = ?`, id); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM tables WHERE id = ?`, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	for _, id := range expired {
+		s.broker.Publish(db.Change{Op: db.Delete, Kind: db.KindGameState, ID: id})
+	}
+	return expired, nil
+}
+
+// historyWhere returns the condition on hands h a filter makes
+func historyWhere(f *db.HistoryFilter) (string, []any) {
+	conds := []string{"1"}
+	var args []any
+	add := func(cond string, a ...any) {
+		conds = append(conds, cond)
+		args = append(args, a...)
+	}
+	if f.GameID != "" {
+		add(`h.table_id = ?`, f.GameID)
+	}
+	if f.PlayerID != "" {
+		add(`EXISTS (SELECT 1 FROM hand_players hp WHERE hp.hand_id = h.id AND hp.player_id = ?)`, f.PlayerID)
+	}
+	if !f.From.IsZero() {
+		add(`h.played_at >= ?`, formatTime(f.From))
+	}
+	if !f.To.IsZero() {
+		add(`h.played_at < ?`, formatTime(f.To))
+	}
+	if f.BigBlind != 0 {
+		add(`h.big_blind = ?`, f.BigBlind)
+	}
+	if f.MinPot != 0 {
+		add(`h.pot_size >= ?`, f.MinPot)
+	}
+	if f.MinRank != nil {
+		add(`h.showdown AND h.hand_rank >= ?`, int(*f.MinRank))
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// historyOrders are the ORDER BY clauses of each history order, and
+// historyAfter the conditions selecting the entries after a cursor
+var (
+	historyOrders = map[db.HistoryOrder]string{
+		db.NewestFirst:     `h.played_at DESC, h.id DESC`,
+		db.OldestFirst:     `h.played_at, h.id`,
+		db.BiggestPotFirst: `h.pot_size DESC, h.id DESC`,
+	}
+	historyAfter = map[db.HistoryOrder]string{
+		db.NewestFirst:     `(h.played_at, h.id) < (?, ?)`,
+		db.OldestFirst:     `(h.played_at, h.id) > (?, ?)`,
+		db.BiggestPotFirst: `(h.pot_size, h.id) < (?, ?)`,
+	}
+)
+
+// QueryHistory returns a page of history entries across tables
+func (s *Store) QueryHistory(ctx context.Context, q db.HistoryQuery) (*db.HistoryPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	where, args := historyWhere(&q.HistoryFilter)
+	if cursor, _ := q.ParseCursor(); cursor != nil {
+		where += ` AND ` + historyAfter[q.Order]
+		if q.Order == db.BiggestPotFirst {
+			args = append(args, cursor.Pot, cursor.ID)
+		} else {
+			args = append(args, formatTime(cursor.Time), cursor.ID)
+		}
+	}
+	// One more than the page holds tells whether there is a next page
+	limit := q.PageLimit()
+	entries, err := s.selectEntries(ctx, where, args, historyOrders[q.Order], limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &db.HistoryPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.Next = db.CursorAfter(q.Order, entries[limit-1])
+	}
+	if page.Entries == nil {
+		page.Entries = []*db.GameHistoryEntry{}
+	}
+	return page, nil
+}
+
+// SummarizeHistory aggregates history entries across tables
+func (s *Store) SummarizeHistory(ctx context.Context, f db.HistoryFilter) (*db.HistorySummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	where, args := historyWhere(&f)
+	sum := &db.HistorySummary{}
+	var first, last sql.NullString
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*), COUNT(DISTINCT h.table_id), COALESCE(SUM(h.showdown), 0),
+	COALESCE(SUM(h.winner = ?), 0), COALESCE(SUM(h.pot_size), 0), COALESCE(MAX(h.pot_size), 0), MIN(h.played_at), MAX(h.played_at)
+FROM hands h WHERE `+where, append([]any{f.PlayerID}, args...)...).Scan(
+		&sum.Hands, &sum.Games, &sum.Showdowns, &sum.Won, &sum.TotalPot, &sum.BiggestPot, &first, &last)
+	if err != nil {
+		return nil, err
+	}
+	if f.PlayerID == "" {
+		sum.Won = 0
+	}
+	if sum.Hands > 0 {
+		sum.AveragePot = float64(sum.TotalPot) / float64(sum.Hands)
+		if sum.First, err = parseTime(first.String); err != nil {
+			return nil, err
+		}
+		if sum.Last, err = parseTime(last.String); err != nil {
+			return nil, err
+		}
+	}
+	return sum, nil
+}
+
+// Export copies every record. Writes wait until it is done, so the
+// records are all from one point in time.
+func (s *Store) Export(ctx context.Context) (*db.Snapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := &db.Snapshot{Format: db.SnapshotFormat, TakenAt: time.Now().UTC()}
+	tables, err := s.ids(ctx, `SELECT DISTINCT table_id FROM table_versions ORDER BY table_id`)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range tables {
+		versions, err := s.GameStateVersions(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", id, err)
+		}
+		snap.Games = append(snap.Games, &db.GameSnapshot{ID: id, Versions: versions})
+	}
+	players, err := s.ids(ctx, `SELECT id FROM players ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range players {
+		p, err := s.LoadPlayerProfile(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("player %s: %w", id, err)
+		}
+		snap.Profiles = append(snap.Profiles, p)
+	}
+	if snap.History, err = s.selectEntries(ctx, `1`, nil, `h.id`, -1); err != nil {
+		return nil, err
+	}
+	if snap.Transactions, err = s.Transactions(ctx, 0, 0); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// ids returns the single text column of a query's rows
+func (s *Store) ids(ctx context.Context, query string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AppendTransaction adds a transaction to the ledger
+func (s *Store) AppendTransaction(ctx context.Context, t *db.Transaction) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := db.ValidateTransaction(t); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var id int64
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) + 1 FROM ledger_transactions`).Scan(&id); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO ledger_transactions (id, time, kind, memo) VALUES (?, ?, ?, ?)`,
+		id, formatTime(t.Time), t.Kind, t.Memo); err != nil {
+		return 0, err
+	}
+	for i, e := range t.Entries {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO ledger_entries (tx_id, seq, account, amount) VALUES (?, ?, ?, ?)`,
+			id, i, e.Account, e.Amount); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	stored := *t
+	stored.ID = id
+	s.broker.Publish(db.Change{Op: db.Insert, Kind: db.KindTransaction, Transaction: &stored})
+	return id, nil
+}
+
+// Transactions returns ledger transactions in order
+func (s *Store) Transactions(ctx context.Context, after int64, limit int) ([]*db.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = -1 // no limit
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id, time, kind, memo FROM ledger_transactions
+WHERE id > ? ORDER BY id LIMIT ?`, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var txs []*db.Transaction
+	byID := make(map[int64]*db.Transaction)
+	for rows.Next() {
+		t := &db.Transaction{}
+		var at string
+		if err := rows.Scan(&t.ID, &at, &t.Kind, &t.Memo); err != nil {
+			return nil, err
+		}
+		if t.Time, err = parseTime(at); err != nil {
+			return nil, err
+		}
+		txs = append(txs, t)
+		byID[t.ID] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return []*db.Transaction{}, nil
+	}
+	entries, err := s.db.QueryContext(ctx, `SELECT tx_id, account, amount FROM ledger_entries
+WHERE tx_id BETWEEN ? AND ? ORDER BY tx_id, seq`, txs[0].ID, txs[len(txs)-1].ID)
+	if err != nil {
+		return nil, err
+	}
+	defer entries.Close()
+	for entries.Next() {
+		var id int64
+		var e db.Entry
+		if err := entries.Scan(&id, &e.Account, &e.Amount); err != nil {
+			return nil, err
+		}
+		byID[id].Entries = append(byID[id].Entries, e)
+	}
+	return txs, entries.Err()
+}
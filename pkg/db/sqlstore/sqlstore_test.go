@@ -0,0 +1,189 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/db/storetest"
+	"go-wasm-poker/pkg/game"
+	"go-wasm-poker/pkg/history"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "poker.db")
+	s, err := Open(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storetest.TestStore(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening runs no migrations twice and keeps working
+	s, err = Open(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := storetest.TestStore(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "poker.db")
+	s, err := Open(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(context.Background(), path); !errors.Is(err, db.ErrLocked) {
+		t.Fatalf("opened a database in use with %v, want db.ErrLocked", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open(context.Background(), path)
+	if err != nil {
+		t.Fatalf("reopening after Close: %v", err)
+	}
+	s.Close()
+}
+
+// playHands plays hands at a seeded table, every player calling and
+// checking down, and returns the hands recorded
+func playHands(t *testing.T, n int) []*history.Hand {
+	t.Helper()
+	var players []*game.Player
+	for i := 0; i < 3; i++ {
+		players = append(players, game.NewPlayer(fmt.Sprintf("p%d", i), fmt.Sprintf("Player %d", i), 500, i))
+	}
+	g := game.NewGameState(players, 5, 10)
+	g.SetSeed(3)
+	rec := history.NewRecorder(nil, "table", 1)
+	var hands []*history.Hand
+	rec.OnHand = func(h *history.Hand) { hands = append(hands, h) }
+	g.Subscribe(rec.Observe)
+	for i := 0; i < n; i++ {
+		g.StartNewHand()
+		for !g.IsHandOver() {
+			legal := g.LegalActions()
+			if !g.ProcessAction(legal[1].Action, legal[1].Min) {
+				t.Fatalf("%v rejected", legal[1].Action)
+			}
+		}
+	}
+	return hands
+}
+
+func TestLoadHand(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	hands := playHands(t, 5)
+	for _, h := range hands {
+		if err := s.AddHand(ctx, "game", h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddGameHistoryEntry(ctx, "game", &db.GameHistoryEntry{Winner: "p0", PotSize: 20}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := s.GetGameHistory(ctx, "game")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, h := range hands {
+		got, err := s.LoadHand(ctx, entries[i].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Time.Equal(h.Time) {
+			t.Errorf("hand %s played at %v, want %v", h.ID, got.Time, h.Time)
+		}
+		want := *h
+		want.Site, want.Table, want.Time = "", "game", got.Time
+		if !reflect.DeepEqual(got, &want) {
+			t.Errorf("hand %s loaded as\n%+v\nwant\n%+v", h.ID, got, &want)
+		}
+	}
+	if _, err := s.LoadHand(ctx, entries[len(hands)].ID); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("loading an entry without a hand gave %v, want db.ErrNotFound", err)
+	}
+}
+
+func TestTrackGame(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	mock := db.NewMockSpaceTimeDB()
+	defer mock.Close()
+
+	var players []*game.Player
+	for i := 0; i < 3; i++ {
+		players = append(players, game.NewPlayer(fmt.Sprintf("p%d", i), fmt.Sprintf("Player %d", i), 500, i))
+	}
+	g := game.NewGameState(players, 5, 10)
+	g.SetSeed(5)
+	stopSQL := db.TrackGame(s, "game", g)
+	stopMock := db.TrackGame(mock, "game", g)
+	for i := 0; i < 4; i++ {
+		g.StartNewHand()
+		for !g.IsHandOver() {
+			legal := g.LegalActions()
+			if !g.ProcessAction(legal[1].Action, legal[1].Min) {
+				t.Fatalf("%v rejected", legal[1].Action)
+			}
+		}
+	}
+	// Stopping waits for the hands still being written
+	stopSQL()
+	stopMock()
+
+	entries, err := s.GetGameHistory(ctx, "game")
+	if err != nil {
+		t.Fatal(err)
+	}
+	summaries, err := mock.GetGameHistory(ctx, "game")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 || len(summaries) != 4 {
+		t.Fatalf("tracked %d hands in SQL and %d in the mock, want 4", len(entries), len(summaries))
+	}
+	for i, e := range entries {
+		h, err := s.LoadHand(ctx, e.ID)
+		if err != nil {
+			t.Fatalf("hand %d: %v", i+1, err)
+		}
+		if h.ID != fmt.Sprint(i+1) || len(h.Seats) != 3 || len(h.Payouts) == 0 {
+			t.Errorf("hand %d loaded as %+v", i+1, h)
+		}
+		sum := summaries[i]
+		if e.Winner != sum.Winner || e.PotSize != sum.PotSize || e.HandSummary != sum.HandSummary {
+			t.Errorf("hand %d: SQL entry %+v, mock entry %+v", i+1, e, sum)
+		}
+	}
+	state, err := s.LoadGameState(ctx, "game")
+	if err != nil {
+		t.Fatalf("loading the tracked state: %v", err)
+	}
+	for i, p := range state.Players {
+		if p.Chips != g.Players[i].Chips {
+			t.Errorf("saved %s with %d chips, the game has %d", p.ID, p.Chips, g.Players[i].Chips)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// Store persists game states, player profiles, game history and the chip
+// ledger. Every backend implements it; storetest.TestStore checks that one
+// behaves like the others. Stores are safe for concurrent use, save and
+// return copies so that callers never share memory with them, and fail with
+// an error matching ErrNotFound when something doesn't exist.
+type Store interface {
+	// SaveGameState saves a game's current state, replacing any earlier one
+	SaveGameState(ctx context.Context, gameID string, state *game.GameState) error
+	// LoadGameState returns a game's last saved state
+	LoadGameState(ctx context.Context, gameID string) (*game.GameState, error)
+	// LoadGameStateVersion returns a game's last saved state and its version
+	LoadGameStateVersion(ctx context.Context, gameID string) (*game.GameState, int64, error)
+	// SaveGameStateIfVersion saves a game's state only if its current
+	// version is expected, or if it has none and expected is 0, and returns
+	// the new version. Otherwise it fails with a *ConflictError.
+	SaveGameStateIfVersion(ctx context.Context, gameID string, state *game.GameState, expected int64) (int64, error)
+	// GameStateVersions returns the last MaxStateVersions versions of a
+	// game's state, oldest first
+	GameStateVersions(ctx context.Context, gameID string) ([]*GameStateVersion, error)
+	// SavePlayerProfile saves a profile, replacing any with the same ID
+	SavePlayerProfile(ctx context.Context, profile *PlayerProfile) error
+	// LoadPlayerProfile returns a player's profile
+	LoadPlayerProfile(ctx context.Context, playerID string) (*PlayerProfile, error)
+	// UpdatePlayerProfile applies update to a player's profile and saves
+	// it, with no other write to the profile in between, and returns the
+	// saved profile. A player without a profile gets a new one with just
+	// the ID. Nothing is saved if update fails, and update must not use
+	// the store.
+	UpdatePlayerProfile(ctx context.Context, playerID string, update func(*PlayerProfile) error) (*PlayerProfile, error)
+	// AddGameHistoryEntry appends an entry to a game's history
+	AddGameHistoryEntry(ctx context.Context, gameID string, entry *GameHistoryEntry) error
+	// GetGameHistory returns a game's history, oldest entry first
+	GetGameHistory(ctx context.Context, gameID string) ([]*GameHistoryEntry, error)
+	// QueryHistory returns a page of the history entries, from every game,
+	// that q's filter selects. It fails with ErrBadCursor if q.Cursor didn't
+	// come from a query with the same order.
+	QueryHistory(ctx context.Context, q HistoryQuery) (*HistoryPage, error)
+	// SummarizeHistory aggregates the history entries f selects
+	SummarizeHistory(ctx context.Context, f HistoryFilter) (*HistorySummary, error)
+	// DeleteHistory removes the history entries with the given IDs and
+	// returns how many it found. Entry IDs are never reused.
+	DeleteHistory(ctx context.Context, ids []int64) (int, error)
+	// ExpireGameStates removes every game whose state was last saved before
+	// before, with all of its kept versions, and returns their IDs in order
+	ExpireGameStates(ctx context.Context, before time.Time) ([]string, error)
+	// AppendTransaction adds a transaction to the ledger and returns its
+	// ID, ignoring tx.ID. It fails with an error matching ErrUnbalanced if
+	// the entries don't add up to zero. Transactions are never changed or
+	// removed.
+	AppendTransaction(ctx context.Context, tx *Transaction) (int64, error)
+	// Transactions returns up to limit ledger transactions with IDs after
+	// after, in order, or all of them when limit is 0
+	Transactions(ctx context.Context, after int64, limit int) ([]*Transaction, error)
+	// Export returns a copy of every record in the store as of one point in
+	// time, see Restore
+	Export(ctx context.Context) (*Snapshot, error)
+	// Subscribe delivers every later change to the records q selects. opts
+	// may be nil.
+	Subscribe(ctx context.Context, q Query, opts *SubscribeOptions) (*Subscription, error)
+	// Close releases the store's resources and ends its subscriptions
+	Close() error
+}
+
+// ErrNotFound matches every NotFoundError, so callers can check for it with
+// errors.Is
+var ErrNotFound = errors.New("not found")
+
+// MaxStateVersions is how many versions of each game's state a store keeps
+const MaxStateVersions = 20
+
+// GameStateVersion is one saved version of a game's state. Every save,
+// conditional or not, adds a version numbered one more than the last,
+// starting at 1.
+type GameStateVersion struct {
+	Version int64           `json:"version"`
+	SavedAt time.Time       `json:"saved_at"`
+	State   *game.GameState `json:"state"`
+}
+
+// ErrConflict matches every ConflictError, so callers can check for it with
+// errors.Is
+var ErrConflict = errors.New("version conflict")
+
+// ConflictError is returned by a conditional save when the game's state has
+// changed since the expected version. Reload it, reapply the change and
+// save again.
+type ConflictError struct {
+	ID       string
+	Expected int64
+	Actual   int64 // 0 when the game has no saved state
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("game state %q is at version %d, not %d", e.ID, e.Actual, e.Expected)
+}
+
+// Is makes errors.Is(err, ErrConflict) true for every ConflictError
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// Kinds of record in a NotFoundError
+const (
+	KindGameState     = "game state"
+	KindPlayerProfile = "player profile"
+	KindGameHistory   = "game history"
+	KindTransaction   = "ledger transaction"
+)
+
+// NotFoundError is returned when a record doesn't exist
+type NotFoundError struct {
+	Kind string // such as KindGameState
+	ID   string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %q not found", e.Kind, e.ID)
+}
+
+// Is makes errors.Is(err, ErrNotFound) true for every NotFoundError
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// notFound returns a NotFoundError
+func notFound(kind, id string) error {
+	return &NotFoundError{Kind: kind, ID: id}
+}
+
+// anyVersion is the expected version of an unconditional save
+const anyVersion = -1
+
+var errNegativeVersion = errors.New("expected version is negative")
+
+// copyVersions returns copies of game state versions
+func copyVersions(versions []*GameStateVersion) []*GameStateVersion {
+	copies := make([]*GameStateVersion, len(versions))
+	for i, v := range versions {
+		copies[i] = &GameStateVersion{Version: v.Version, SavedAt: v.SavedAt, State: v.State.Clone()}
+	}
+	return copies
+}
+
+// copyProfile returns a copy of a profile that doesn't share its rating
+// history
+func copyProfile(p *PlayerProfile) *PlayerProfile {
+	c := *p
+	c.RatingHistory = append([]RatingChange(nil), p.RatingHistory...)
+	return &c
+}
+
+// copyEntry returns a copy of a history entry that doesn't share its players
+func copyEntry(e *GameHistoryEntry) *GameHistoryEntry {
+	c := *e
+	c.Players = append([]string(nil), e.Players...)
+	return &c
+}
@@ -0,0 +1,40 @@
+package db_test
+
+import (
+	"testing"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/db/storetest"
+)
+
+func TestMockStore(t *testing.T) {
+	s := db.NewMockSpaceTimeDB()
+	defer s.Close()
+	if err := storetest.TestStore(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := db.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storetest.TestStore(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Everything written must replay, and the store keep working after it
+	s, err = db.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := storetest.TestStore(s); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,1297 @@
+// Package storetest checks that a db.Store backend behaves like every other
+// one. Like testing/fstest, it reports problems as an error instead of
+// depending on package testing, so it can be run from tests, tools and
+// startup checks alike.
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/game"
+)
+
+// TestStore runs the conformance checks against s and returns every failure
+// joined into one error, or nil if s passes. It only touches records with
+// IDs it makes up, so s may already hold data; expiring games is only
+// checked when s holds no games of its own.
+func TestStore(s db.Store) error {
+	c := &checker{store: s, ctx: context.Background(), prefix: fmt.Sprintf("storetest-%x-", rand.Int63())}
+	c.notFound()
+	c.gameStates()
+	c.versions()
+	c.profiles()
+	c.history()
+	c.queries()
+	c.ledger()
+	c.export()
+	c.retention()
+	c.canceled()
+	c.concurrent()
+	c.subscriptions()
+	return errors.Join(c.errs...)
+}
+
+// checker collects the failures of one run
+type checker struct {
+	store  db.Store
+	ctx    context.Context
+	prefix string
+	errs   []error
+}
+
+func (c *checker) errorf(format string, args ...any) {
+	c.errs = append(c.errs, fmt.Errorf(format, args...))
+}
+
+// id returns an ID that no other run uses
+func (c *checker) id(name string) string {
+	return c.prefix + name
+}
+
+// notFound checks the errors for records that don't exist
+func (c *checker) notFound() {
+	check := func(op, kind, id string, err error) {
+		var nf *db.NotFoundError
+		switch {
+		case err == nil:
+			c.errorf("%s of a missing record succeeded", op)
+		case !errors.Is(err, db.ErrNotFound):
+			c.errorf("%s of a missing record: %v does not match ErrNotFound", op, err)
+		case !errors.As(err, &nf):
+			c.errorf("%s of a missing record: %v is not a *NotFoundError", op, err)
+		case nf.Kind != kind || nf.ID != id:
+			c.errorf("%s of a missing record: got kind %q id %q, want %q and %q", op, nf.Kind, nf.ID, kind, id)
+		}
+	}
+	id := c.id("missing")
+	_, err := c.store.LoadGameState(c.ctx, id)
+	check("LoadGameState", db.KindGameState, id, err)
+	_, err = c.store.LoadPlayerProfile(c.ctx, id)
+	check("LoadPlayerProfile", db.KindPlayerProfile, id, err)
+	_, err = c.store.GetGameHistory(c.ctx, id)
+	check("GetGameHistory", db.KindGameHistory, id, err)
+}
+
+// table returns a seeded table partway through a hand
+func table(seed int64) *game.GameState {
+	cfg := game.TableConfig{SmallBlind: 5, BigBlind: 10, Seed: seed}
+	for i := 0; i < 4; i++ {
+		cfg.Players = append(cfg.Players, game.SeatConfig{ID: fmt.Sprint("p", i), Name: fmt.Sprint("Player ", i), Chips: 1000})
+	}
+	g := game.NewTable(cfg)
+	g.StartNewHand()
+	g.ProcessAction(game.Call, 0)
+	g.ProcessAction(game.Raise, 20)
+	return g
+}
+
+func encode(g *game.GameState) string {
+	data, err := json.Marshal(g)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return string(data)
+}
+
+// gameStates checks saving, loading and replacing game states
+func (c *checker) gameStates() {
+	id := c.id("game")
+	g := table(1)
+	want := encode(g)
+	if err := c.store.SaveGameState(c.ctx, id, g); err != nil {
+		c.errorf("SaveGameState: %v", err)
+		return
+	}
+	// Changing the live table must not change what was saved
+	g.ProcessAction(game.Fold, 0)
+	loaded, err := c.store.LoadGameState(c.ctx, id)
+	if err != nil {
+		c.errorf("LoadGameState: %v", err)
+		return
+	}
+	if got := encode(loaded); got != want {
+		c.errorf("LoadGameState returned\n%s\nwant\n%s", got, want)
+	}
+	// Nor may changing what was loaded
+	loaded.ProcessAction(game.Fold, 0)
+	loaded.Players[0].Chips = -1
+	again, err := c.store.LoadGameState(c.ctx, id)
+	if err != nil {
+		c.errorf("LoadGameState: %v", err)
+	} else if got := encode(again); got != want {
+		c.errorf("changing a loaded state changed the stored one")
+	}
+
+	// The loaded state plays on like the original
+	orig := table(1)
+	orig.ProcessAction(game.Call, 0)
+	again.ProcessAction(game.Call, 0)
+	if encode(orig) != encode(again) {
+		c.errorf("a loaded state plays on differently from the one saved")
+	}
+
+	replacement := table(2)
+	if err := c.store.SaveGameState(c.ctx, id, replacement); err != nil {
+		c.errorf("SaveGameState replacing a state: %v", err)
+	} else if loaded, err := c.store.LoadGameState(c.ctx, id); err != nil {
+		c.errorf("LoadGameState after replacing: %v", err)
+	} else if encode(loaded) != encode(replacement) {
+		c.errorf("LoadGameState after replacing returned the old state")
+	}
+}
+
+// versions checks version numbers, conditional saves and kept versions
+func (c *checker) versions() {
+	id := c.id("versioned")
+	if _, _, err := c.store.LoadGameStateVersion(c.ctx, id); !errors.Is(err, db.ErrNotFound) {
+		c.errorf("LoadGameStateVersion of a missing state returned %v, want ErrNotFound", err)
+	}
+	if _, err := c.store.GameStateVersions(c.ctx, id); !errors.Is(err, db.ErrNotFound) {
+		c.errorf("GameStateVersions of a missing state returned %v, want ErrNotFound", err)
+	}
+	conflict := func(op string, err error, expected, actual int64) {
+		var ce *db.ConflictError
+		switch {
+		case !errors.Is(err, db.ErrConflict):
+			c.errorf("%s returned %v, want ErrConflict", op, err)
+		case !errors.As(err, &ce):
+			c.errorf("%s: %v is not a *ConflictError", op, err)
+		case ce.ID != id || ce.Expected != expected || ce.Actual != actual:
+			c.errorf("%s: got %+v, want expected %d and actual %d", op, *ce, expected, actual)
+		}
+	}
+	conflict("SaveGameStateIfVersion of a missing state at version 1", func() error {
+		_, err := c.store.SaveGameStateIfVersion(c.ctx, id, table(1), 1)
+		return err
+	}(), 1, 0)
+
+	states := []*game.GameState{table(1), table(2), table(3)}
+	if v, err := c.store.SaveGameStateIfVersion(c.ctx, id, states[0], 0); err != nil || v != 1 {
+		c.errorf("first SaveGameStateIfVersion returned version %d and %v, want 1", v, err)
+		return
+	}
+	_, err := c.store.SaveGameStateIfVersion(c.ctx, id, states[1], 0)
+	conflict("SaveGameStateIfVersion of an existing state at version 0", err, 0, 1)
+	if err := c.store.SaveGameState(c.ctx, id, states[1]); err != nil {
+		c.errorf("SaveGameState: %v", err)
+		return
+	}
+	_, err = c.store.SaveGameStateIfVersion(c.ctx, id, states[2], 1)
+	conflict("SaveGameStateIfVersion at a stale version", err, 1, 2)
+	if v, err := c.store.SaveGameStateIfVersion(c.ctx, id, states[2], 2); err != nil || v != 3 {
+		c.errorf("SaveGameStateIfVersion at the current version returned %d and %v, want 3", v, err)
+		return
+	}
+	if g, v, err := c.store.LoadGameStateVersion(c.ctx, id); err != nil || v != 3 || encode(g) != encode(states[2]) {
+		c.errorf("LoadGameStateVersion returned version %d and %v, want the third state at 3", v, err)
+	}
+	versions, err := c.store.GameStateVersions(c.ctx, id)
+	if err != nil || len(versions) != 3 {
+		c.errorf("GameStateVersions returned %d versions and %v, want 3", len(versions), err)
+		return
+	}
+	for i, v := range versions {
+		if v.Version != int64(i+1) || encode(v.State) != encode(states[i]) || v.SavedAt.IsZero() {
+			c.errorf("GameStateVersions entry %d is version %d saved at %v, or has the wrong state", i, v.Version, v.SavedAt)
+		}
+	}
+
+	// Only the last MaxStateVersions are kept
+	for i := 0; i < db.MaxStateVersions; i++ {
+		if err := c.store.SaveGameState(c.ctx, id, states[i%3]); err != nil {
+			c.errorf("SaveGameState: %v", err)
+			return
+		}
+	}
+	last := int64(3 + db.MaxStateVersions)
+	if versions, err := c.store.GameStateVersions(c.ctx, id); err != nil || len(versions) != db.MaxStateVersions ||
+		versions[0].Version != last-db.MaxStateVersions+1 || versions[len(versions)-1].Version != last {
+		c.errorf("after %d saves GameStateVersions kept %d versions and %v, want versions %d to %d",
+			last, len(versions), err, last-db.MaxStateVersions+1, last)
+	}
+
+	// Concurrent read-modify-write loops lose no update
+	const writers, each = 4, 5
+	cid := c.id("versioned-concurrent")
+	if _, err := c.store.SaveGameStateIfVersion(c.ctx, cid, table(1), 0); err != nil {
+		c.errorf("SaveGameStateIfVersion: %v", err)
+		return
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < each; {
+				g, v, err := c.store.LoadGameStateVersion(c.ctx, cid)
+				if err != nil {
+					errs <- err
+					return
+				}
+				g.SmallBlind++
+				_, err = c.store.SaveGameStateIfVersion(c.ctx, cid, g, v)
+				switch {
+				case err == nil:
+					i++
+				case !errors.Is(err, db.ErrConflict):
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		c.errorf("concurrent conditional save: %v", err)
+		return
+	}
+	want := table(1).SmallBlind + writers*each
+	if g, v, err := c.store.LoadGameStateVersion(c.ctx, cid); err != nil || g.SmallBlind != want || v != writers*each+1 {
+		c.errorf("after concurrent conditional saves got version %d and %v, want small blind %d at version %d",
+			v, err, want, writers*each+1)
+	}
+}
+
+// profiles checks saving and loading player profiles
+func (c *checker) profiles() {
+	p := &db.PlayerProfile{
+		ID:            c.id("player"),
+		Name:          "Alice",
+		TotalChips:    1500,
+		GamesPlayed:   12,
+		GamesWon:      3,
+		BiggestPot:    640,
+		LastLoginTime: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Rating:        1523.5,
+		RatedGames:    2,
+		RatingHistory: []db.RatingChange{
+			{Event: "t1", Time: time.Date(2024, 4, 20, 18, 0, 0, 0, time.UTC), Place: 1, Players: 6, Before: 1500, After: 1530.25},
+			{Event: "t2", Time: time.Date(2024, 4, 27, 18, 0, 0, 0, time.UTC), Place: 4, Players: 5, Before: 1530.25, After: 1523.5},
+		},
+	}
+	want := *p
+	want.RatingHistory = append([]db.RatingChange(nil), p.RatingHistory...)
+	if err := c.store.SavePlayerProfile(c.ctx, p); err != nil {
+		c.errorf("SavePlayerProfile: %v", err)
+		return
+	}
+	p.TotalChips = 0
+	p.RatingHistory[0].After = 0
+	got, err := c.store.LoadPlayerProfile(c.ctx, want.ID)
+	if err != nil {
+		c.errorf("LoadPlayerProfile: %v", err)
+		return
+	}
+	if !sameProfile(got, &want) {
+		c.errorf("LoadPlayerProfile returned %+v, want %+v", *got, want)
+	}
+	got.GamesWon = 99
+	got.RatingHistory[1].Place = 99
+	if again, err := c.store.LoadPlayerProfile(c.ctx, want.ID); err != nil {
+		c.errorf("LoadPlayerProfile: %v", err)
+	} else if !sameProfile(again, &want) {
+		c.errorf("changing a loaded profile changed the stored one")
+	}
+
+	want.GamesPlayed++
+	want.RatingHistory = want.RatingHistory[1:]
+	updated := want
+	if err := c.store.SavePlayerProfile(c.ctx, &updated); err != nil {
+		c.errorf("SavePlayerProfile replacing a profile: %v", err)
+	} else if got, err := c.store.LoadPlayerProfile(c.ctx, want.ID); err != nil {
+		c.errorf("LoadPlayerProfile after replacing: %v", err)
+	} else if !sameProfile(got, &want) {
+		c.errorf("LoadPlayerProfile after replacing returned %+v, want %+v", *got, want)
+	}
+
+	// Updating changes only what the update does
+	want.GamesWon++
+	want.RatingHistory = append(want.RatingHistory, db.RatingChange{Event: "t3", Place: 2, Players: 3, Before: 1523.5, After: 1530})
+	got, err = c.store.UpdatePlayerProfile(c.ctx, want.ID, func(p *db.PlayerProfile) error {
+		p.GamesWon++
+		p.RatingHistory = append(p.RatingHistory, db.RatingChange{Event: "t3", Place: 2, Players: 3, Before: 1523.5, After: 1530})
+		return nil
+	})
+	if err != nil {
+		c.errorf("UpdatePlayerProfile: %v", err)
+	} else if !sameProfile(got, &want) {
+		c.errorf("UpdatePlayerProfile returned %+v, want %+v", *got, want)
+	} else if got, err := c.store.LoadPlayerProfile(c.ctx, want.ID); err != nil || !sameProfile(got, &want) {
+		c.errorf("LoadPlayerProfile after updating returned %+v, %v, want %+v", got, err, want)
+	}
+	failed := errors.New("update failed")
+	if _, err := c.store.UpdatePlayerProfile(c.ctx, want.ID, func(p *db.PlayerProfile) error {
+		p.GamesWon = 0
+		return failed
+	}); !errors.Is(err, failed) {
+		c.errorf("UpdatePlayerProfile with a failing update returned %v, want its error", err)
+	} else if got, err := c.store.LoadPlayerProfile(c.ctx, want.ID); err != nil || got.GamesWon != want.GamesWon {
+		c.errorf("a failing update changed the profile to %+v, %v", got, err)
+	}
+
+	// Updating a missing profile creates it
+	id := c.id("new-player")
+	got, err = c.store.UpdatePlayerProfile(c.ctx, id, func(p *db.PlayerProfile) error {
+		if p.ID != id || p.GamesPlayed != 0 {
+			return fmt.Errorf("update of a missing profile given %+v", *p)
+		}
+		p.Name = "Bob"
+		p.GamesPlayed = 1
+		return nil
+	})
+	if err != nil {
+		c.errorf("UpdatePlayerProfile of a missing profile: %v", err)
+	} else if loaded, err := c.store.LoadPlayerProfile(c.ctx, id); err != nil || !sameProfile(loaded, got) || loaded.Name != "Bob" {
+		c.errorf("UpdatePlayerProfile of a missing profile saved %+v, %v", loaded, err)
+	}
+}
+
+func sameProfile(a, b *db.PlayerProfile) bool {
+	x, y := *a, *b
+	if !x.LastLoginTime.Equal(y.LastLoginTime) {
+		return false
+	}
+	if len(x.RatingHistory) != len(y.RatingHistory) {
+		return false
+	}
+	for i := range x.RatingHistory {
+		r, s := x.RatingHistory[i], y.RatingHistory[i]
+		if !r.Time.Equal(s.Time) {
+			return false
+		}
+		r.Time, s.Time = time.Time{}, time.Time{}
+		if r != s {
+			return false
+		}
+	}
+	x.LastLoginTime, y.LastLoginTime = time.Time{}, time.Time{}
+	x.RatingHistory, y.RatingHistory = nil, nil
+	return reflect.DeepEqual(x, y)
+}
+
+func entry(gameID string, n int) *db.GameHistoryEntry {
+	return &db.GameHistoryEntry{
+		GameID:      gameID,
+		Timestamp:   time.Date(2024, 5, 1, 12, n, 0, 0, time.UTC),
+		Players:     []string{"p0", "p1", "p2"},
+		Winner:      fmt.Sprint("p", n%3),
+		PotSize:     10 * (n + 1),
+		HandSummary: fmt.Sprintf("hand %d", n),
+	}
+}
+
+// sameEntry compares entries, ignoring the IDs stores assign
+func sameEntry(a, b *db.GameHistoryEntry) bool {
+	x, y := *a, *b
+	if !x.Timestamp.Equal(y.Timestamp) {
+		return false
+	}
+	x.Timestamp, y.Timestamp = time.Time{}, time.Time{}
+	x.ID, y.ID = 0, 0
+	return reflect.DeepEqual(x, y)
+}
+
+// history checks appending to and reading game histories
+func (c *checker) history() {
+	id, other := c.id("history"), c.id("history-other")
+	var want []*db.GameHistoryEntry
+	for i := 0; i < 5; i++ {
+		e := entry(id, i)
+		want = append(want, entry(id, i))
+		if err := c.store.AddGameHistoryEntry(c.ctx, id, e); err != nil {
+			c.errorf("AddGameHistoryEntry: %v", err)
+			return
+		}
+		e.Players[0] = "changed"
+	}
+	if err := c.store.AddGameHistoryEntry(c.ctx, other, entry(other, 9)); err != nil {
+		c.errorf("AddGameHistoryEntry: %v", err)
+	}
+
+	got, err := c.store.GetGameHistory(c.ctx, id)
+	if err != nil {
+		c.errorf("GetGameHistory: %v", err)
+		return
+	}
+	if len(got) != len(want) {
+		c.errorf("GetGameHistory returned %d entries, want %d", len(got), len(want))
+		return
+	}
+	for i := range got {
+		if !sameEntry(got[i], want[i]) {
+			c.errorf("GetGameHistory entry %d is %+v, want %+v", i, *got[i], *want[i])
+		}
+		if got[i].ID <= 0 || i > 0 && got[i].ID <= got[i-1].ID {
+			c.errorf("GetGameHistory entry %d has ID %d, want more than the last", i, got[i].ID)
+		}
+	}
+	got[0].Players[0] = "changed"
+	got[1].PotSize = -1
+	if again, err := c.store.GetGameHistory(c.ctx, id); err != nil {
+		c.errorf("GetGameHistory: %v", err)
+	} else if len(again) < 2 || !sameEntry(again[0], want[0]) || !sameEntry(again[1], want[1]) {
+		c.errorf("changing loaded history entries changed the stored ones")
+	}
+	if got, err := c.store.GetGameHistory(c.ctx, other); err != nil || len(got) != 1 {
+		c.errorf("GetGameHistory of a second game returned %d entries and %v, want 1", len(got), err)
+	}
+}
+
+// queryEntry returns the nth entry of the queries check. The filter's
+// player is in most hands, which alternate between two games, and some
+// share a time or a pot.
+func queryEntry(games [2]string, player string, n int) *db.GameHistoryEntry {
+	e := &db.GameHistoryEntry{
+		GameID:      games[n%2],
+		Timestamp:   time.Date(2024, 6, 1, 12, n-n/6, 0, 0, time.UTC),
+		Players:     []string{player, "p1"},
+		Winner:      "p1",
+		PotSize:     10 * (n%5 + 1),
+		HandSummary: fmt.Sprintf("hand %d", n),
+		SmallBlind:  1,
+		BigBlind:    2,
+	}
+	if n >= 6 {
+		e.SmallBlind, e.BigBlind = 2, 4
+	}
+	if n%4 == 3 {
+		e.Players = []string{"p1", "p2"}
+	}
+	if n%2 == 0 {
+		e.Winner = player
+	}
+	if n%3 == 0 {
+		e.Showdown, e.HandRank = true, game.HandRank(n)
+	}
+	return e
+}
+
+// queries checks querying and summarizing history across games
+func (c *checker) queries() {
+	games := [2]string{c.id("query-a"), c.id("query-b")}
+	player := c.id("query-player")
+	for n := 0; n < 12; n++ {
+		e := queryEntry(games, player, n)
+		if err := c.store.AddGameHistoryEntry(c.ctx, e.GameID, e); err != nil {
+			c.errorf("AddGameHistoryEntry: %v", err)
+			return
+		}
+	}
+	var all []*db.GameHistoryEntry
+	for _, id := range games {
+		entries, err := c.store.GetGameHistory(c.ctx, id)
+		if err != nil {
+			c.errorf("GetGameHistory: %v", err)
+			return
+		}
+		all = append(all, entries...)
+	}
+
+	// want returns the IDs of the entries keep selects, in an order
+	want := func(order db.HistoryOrder, keep func(n int, e *db.GameHistoryEntry) bool) []int64 {
+		var selected []*db.GameHistoryEntry
+		for _, e := range all {
+			var n int
+			fmt.Sscanf(e.HandSummary, "hand %d", &n)
+			if keep(n, e) && n%4 != 3 {
+				selected = append(selected, e)
+			}
+		}
+		sort.Slice(selected, func(i, j int) bool {
+			a, b := selected[i], selected[j]
+			switch {
+			case order == db.BiggestPotFirst && a.PotSize != b.PotSize:
+				return a.PotSize > b.PotSize
+			case order != db.BiggestPotFirst && !a.Timestamp.Equal(b.Timestamp):
+				return a.Timestamp.After(b.Timestamp) == (order == db.NewestFirst)
+			}
+			return a.ID > b.ID == (order != db.OldestFirst)
+		})
+		ids := make([]int64, len(selected))
+		for i, e := range selected {
+			ids[i] = e.ID
+		}
+		return ids
+	}
+	// query returns the IDs of every entry a query selects, a page at a time
+	query := func(q db.HistoryQuery) ([]int64, error) {
+		ids := []int64{}
+		for pages := 0; pages < 20; pages++ {
+			page, err := c.store.QueryHistory(c.ctx, q)
+			if err != nil {
+				return nil, err
+			}
+			if len(page.Entries) > q.Limit {
+				return nil, fmt.Errorf("page of %d entries with a limit of %d", len(page.Entries), q.Limit)
+			}
+			for _, e := range page.Entries {
+				ids = append(ids, e.ID)
+			}
+			if page.Next == "" {
+				return ids, nil
+			}
+			q.Cursor = page.Next
+		}
+		return nil, errors.New("too many pages")
+	}
+
+	rank := game.ThreeOfAKind
+	cases := []struct {
+		name   string
+		filter db.HistoryFilter
+		keep   func(n int, e *db.GameHistoryEntry) bool
+	}{
+		{"player", db.HistoryFilter{PlayerID: player},
+			func(n int, e *db.GameHistoryEntry) bool { return true }},
+		{"game", db.HistoryFilter{PlayerID: player, GameID: games[1]},
+			func(n int, e *db.GameHistoryEntry) bool { return n%2 == 1 }},
+		{"dates", db.HistoryFilter{PlayerID: player, From: queryEntry(games, player, 3).Timestamp, To: queryEntry(games, player, 8).Timestamp},
+			func(n int, e *db.GameHistoryEntry) bool { return n >= 3 && n < 8 }},
+		{"stakes", db.HistoryFilter{PlayerID: player, BigBlind: 4},
+			func(n int, e *db.GameHistoryEntry) bool { return n >= 6 }},
+		{"pot", db.HistoryFilter{PlayerID: player, MinPot: 30},
+			func(n int, e *db.GameHistoryEntry) bool { return e.PotSize >= 30 }},
+		{"rank", db.HistoryFilter{PlayerID: player, MinRank: &rank},
+			func(n int, e *db.GameHistoryEntry) bool { return n%3 == 0 && n >= int(rank) }},
+	}
+	for _, tc := range cases {
+		for _, order := range []db.HistoryOrder{db.NewestFirst, db.OldestFirst, db.BiggestPotFirst} {
+			got, err := query(db.HistoryQuery{HistoryFilter: tc.filter, Order: order, Limit: 3})
+			if err != nil {
+				c.errorf("QueryHistory by %s in order %d: %v", tc.name, order, err)
+				continue
+			}
+			if w := want(order, tc.keep); !reflect.DeepEqual(got, w) {
+				c.errorf("QueryHistory by %s in order %d returned entries %v, want %v", tc.name, order, got, w)
+			}
+		}
+	}
+
+	page, err := c.store.QueryHistory(c.ctx, db.HistoryQuery{HistoryFilter: db.HistoryFilter{PlayerID: player}, Limit: 1})
+	switch {
+	case err != nil:
+		c.errorf("QueryHistory: %v", err)
+	case len(page.Entries) != 1 || page.Next == "":
+		c.errorf("QueryHistory with a limit of 1 returned %d entries and next %q", len(page.Entries), page.Next)
+	default:
+		if e, w := page.Entries[0], queryEntry(games, player, 10); !sameEntry(e, w) {
+			c.errorf("QueryHistory returned %+v, want %+v", *e, *w)
+		}
+		q := db.HistoryQuery{HistoryFilter: db.HistoryFilter{PlayerID: player}, Order: db.OldestFirst, Cursor: page.Next}
+		if _, err := c.store.QueryHistory(c.ctx, q); !errors.Is(err, db.ErrBadCursor) {
+			c.errorf("QueryHistory with a cursor from another order returned %v, want ErrBadCursor", err)
+		}
+	}
+	if _, err := c.store.QueryHistory(c.ctx, db.HistoryQuery{Cursor: "not a cursor"}); !errors.Is(err, db.ErrBadCursor) {
+		c.errorf("QueryHistory with a bad cursor returned %v, want ErrBadCursor", err)
+	}
+	if page, err := c.store.QueryHistory(c.ctx, db.HistoryQuery{HistoryFilter: db.HistoryFilter{PlayerID: c.id("nobody")}}); err != nil || len(page.Entries) != 0 || page.Next != "" {
+		c.errorf("QueryHistory of a player without hands returned %+v and %v, want an empty page", page, err)
+	}
+
+	sum, err := c.store.SummarizeHistory(c.ctx, db.HistoryFilter{PlayerID: player})
+	if err != nil {
+		c.errorf("SummarizeHistory: %v", err)
+		return
+	}
+	w := db.HistorySummary{Games: 2}
+	for n := 0; n < 12; n++ {
+		if n%4 != 3 {
+			w.Add(queryEntry(games, player, n), player)
+		}
+	}
+	if sum.Hands != w.Hands || sum.Games != w.Games || sum.Showdowns != w.Showdowns || sum.Won != w.Won ||
+		sum.TotalPot != w.TotalPot || sum.BiggestPot != w.BiggestPot || sum.AveragePot != w.AveragePot ||
+		!sum.First.Equal(w.First) || !sum.Last.Equal(w.Last) {
+		c.errorf("SummarizeHistory returned %+v, want %+v", *sum, w)
+	}
+	if sum, err := c.store.SummarizeHistory(c.ctx, db.HistoryFilter{PlayerID: c.id("nobody")}); err != nil || sum.Hands != 0 {
+		c.errorf("SummarizeHistory of a player without hands returned %+v and %v", sum, err)
+	}
+}
+
+// export checks that a store exports its records and that the snapshot
+// survives an archive and restores into another store
+func (c *checker) export() {
+	id := c.id("export")
+	states := []*game.GameState{table(21), table(22)}
+	for _, g := range states {
+		if err := c.store.SaveGameState(c.ctx, id, g); err != nil {
+			c.errorf("SaveGameState: %v", err)
+			return
+		}
+	}
+	profile := &db.PlayerProfile{ID: id, Name: "Exported", TotalChips: 70, LastLoginTime: time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)}
+	if err := c.store.SavePlayerProfile(c.ctx, profile); err != nil {
+		c.errorf("SavePlayerProfile: %v", err)
+		return
+	}
+	if err := c.store.AddGameHistoryEntry(c.ctx, id, entry(id, 4)); err != nil {
+		c.errorf("AddGameHistoryEntry: %v", err)
+		return
+	}
+	txID, err := c.store.AppendTransaction(c.ctx, transfer(id, 8))
+	if err != nil {
+		c.errorf("AppendTransaction: %v", err)
+		return
+	}
+
+	// check reports whether a snapshot holds the records above
+	check := func(name string, snap *db.Snapshot, versions bool) {
+		found := 0
+		for i, g := range snap.Games {
+			if i > 0 && snap.Games[i-1].ID >= g.ID {
+				c.errorf("%s games are not in order of ID", name)
+			}
+			if g.ID != id {
+				continue
+			}
+			found++
+			if len(g.Versions) != len(states) {
+				c.errorf("%s has %d versions of a game, want %d", name, len(g.Versions), len(states))
+				continue
+			}
+			for i, v := range g.Versions {
+				if encode(v.State) != encode(states[i]) {
+					c.errorf("%s game version %d differs from the saved state", name, i+1)
+				}
+				if versions && (v.Version != int64(i)+1 || v.SavedAt.IsZero()) {
+					c.errorf("%s game version %d is numbered %d and saved at %v", name, i+1, v.Version, v.SavedAt)
+				}
+			}
+		}
+		for _, p := range snap.Profiles {
+			if p.ID == id {
+				found++
+				if !sameProfile(p, profile) || !p.LastLoginTime.Equal(profile.LastLoginTime) {
+					c.errorf("%s profile is %+v, want %+v", name, *p, *profile)
+				}
+			}
+		}
+		for i, e := range snap.History {
+			if i > 0 && snap.History[i-1].ID >= e.ID {
+				c.errorf("%s history is not in order of entry ID", name)
+			}
+			if e.GameID == id {
+				found++
+				if !sameEntry(e, entry(id, 4)) {
+					c.errorf("%s history entry is %+v, want %+v", name, *e, *entry(id, 4))
+				}
+			}
+		}
+		for i, tx := range snap.Transactions {
+			if tx.ID != int64(i)+1 {
+				c.errorf("%s transaction %d is numbered %d", name, i+1, tx.ID)
+				break
+			}
+			if tx.ID == txID {
+				found++
+				if w := transfer(id, 8); tx.Memo != w.Memo || !reflect.DeepEqual(tx.Entries, w.Entries) {
+					c.errorf("%s transaction is %+v, want %+v", name, *tx, *w)
+				}
+			}
+		}
+		if found != 4 {
+			c.errorf("%s holds %d of the 4 records exported, want all of them", name, found)
+		}
+	}
+
+	snap, err := c.store.Export(c.ctx)
+	if err != nil {
+		c.errorf("Export: %v", err)
+		return
+	}
+	if snap.Format != db.SnapshotFormat || snap.TakenAt.IsZero() {
+		c.errorf("Export returned format %d taken at %v", snap.Format, snap.TakenAt)
+	}
+	check("Export", snap, true)
+	for _, p := range snap.Profiles {
+		p.Name = "changed"
+	}
+	if p, err := c.store.LoadPlayerProfile(c.ctx, id); err != nil || p.Name != profile.Name {
+		c.errorf("changing an exported profile changed the stored one")
+	}
+	if err := db.Restore(c.ctx, c.store, snap); !errors.Is(err, db.ErrNotEmpty) {
+		c.errorf("Restore into a store with records returned %v, want ErrNotEmpty", err)
+	}
+
+	snap, _ = c.store.Export(c.ctx)
+	var archive bytes.Buffer
+	if err := db.WriteSnapshot(&archive, snap); err != nil {
+		c.errorf("WriteSnapshot: %v", err)
+		return
+	}
+	read, err := db.ReadSnapshot(&archive)
+	if err != nil {
+		c.errorf("ReadSnapshot: %v", err)
+		return
+	}
+	check("a read archive", read, true)
+	restored := db.NewMockSpaceTimeDB()
+	if err := db.Restore(c.ctx, restored, read); err != nil {
+		c.errorf("Restore: %v", err)
+		return
+	}
+	again, err := restored.Export(c.ctx)
+	if err != nil {
+		c.errorf("Export of a restored store: %v", err)
+		return
+	}
+	check("a restored store", again, false)
+	if len(again.Games) != len(snap.Games) || len(again.Profiles) != len(snap.Profiles) ||
+		len(again.History) != len(snap.History) || len(again.Transactions) != len(snap.Transactions) {
+		c.errorf("restored store holds %d games, %d profiles, %d history entries and %d transactions, want %d, %d, %d and %d",
+			len(again.Games), len(again.Profiles), len(again.History), len(again.Transactions),
+			len(snap.Games), len(snap.Profiles), len(snap.History), len(snap.Transactions))
+	}
+}
+
+// retention checks deleting history entries and expiring games
+func (c *checker) retention() {
+	id := c.id("retention")
+	for n := 0; n < 3; n++ {
+		if err := c.store.AddGameHistoryEntry(c.ctx, id, entry(id, n)); err != nil {
+			c.errorf("AddGameHistoryEntry: %v", err)
+			return
+		}
+	}
+	entries, err := c.store.GetGameHistory(c.ctx, id)
+	if err != nil || len(entries) != 3 {
+		c.errorf("GetGameHistory returned %d entries and %v, want 3", len(entries), err)
+		return
+	}
+	sub, err := c.store.Subscribe(c.ctx, db.Query{Kind: db.KindGameHistory, ID: id}, nil)
+	if err != nil {
+		c.errorf("Subscribe: %v", err)
+		return
+	}
+	defer sub.Unsubscribe()
+	if n, err := c.store.DeleteHistory(c.ctx, []int64{entries[0].ID, entries[2].ID, -1}); err != nil || n != 2 {
+		c.errorf("DeleteHistory of 2 entries returned %d and %v", n, err)
+	}
+	for _, w := range []*db.GameHistoryEntry{entries[0], entries[2]} {
+		if ch, ok, why := next(sub); !ok {
+			c.errorf("history deletion under a subscription: %s", why)
+		} else if ch.Op != db.Delete || ch.Entry == nil || ch.Entry.ID != w.ID {
+			c.errorf("history deletion under a subscription delivered %v %+v, want entry %d", ch.Op, ch.Entry, w.ID)
+		}
+	}
+	if got, err := c.store.GetGameHistory(c.ctx, id); err != nil || len(got) != 1 || got[0].ID != entries[1].ID {
+		c.errorf("GetGameHistory after DeleteHistory returned %d entries and %v, want entry %d", len(got), err, entries[1].ID)
+	}
+	page, err := c.store.QueryHistory(c.ctx, db.HistoryQuery{HistoryFilter: db.HistoryFilter{GameID: id}})
+	if err != nil || len(page.Entries) != 1 {
+		c.errorf("QueryHistory after DeleteHistory returned %d entries and %v, want 1", len(page.Entries), err)
+	}
+	if n, err := c.store.DeleteHistory(c.ctx, []int64{entries[1].ID, entries[1].ID}); err != nil || n != 1 {
+		c.errorf("DeleteHistory of the last entry returned %d and %v, want 1", n, err)
+	}
+	if _, err := c.store.GetGameHistory(c.ctx, id); !errors.Is(err, db.ErrNotFound) {
+		c.errorf("GetGameHistory of a game whose entries were all deleted returned %v, want ErrNotFound", err)
+	}
+	if err := c.store.AddGameHistoryEntry(c.ctx, id, entry(id, 3)); err != nil {
+		c.errorf("AddGameHistoryEntry: %v", err)
+	} else if got, err := c.store.GetGameHistory(c.ctx, id); err != nil || len(got) != 1 || got[0].ID <= entries[2].ID {
+		c.errorf("entry added after deletions got %d entries and %v, want a new ID after %d", len(got), err, entries[2].ID)
+	}
+
+	snap, err := c.store.Export(c.ctx)
+	if err != nil {
+		c.errorf("Export: %v", err)
+		return
+	}
+	for _, g := range snap.Games {
+		if !strings.HasPrefix(g.ID, c.prefix) {
+			return
+		}
+	}
+	old, fresh := c.id("retention-old"), c.id("retention-fresh")
+	if err := c.store.SaveGameState(c.ctx, old, table(31)); err != nil {
+		c.errorf("SaveGameState: %v", err)
+		return
+	}
+	if expired, err := c.store.ExpireGameStates(c.ctx, time.Now().Add(-time.Hour)); err != nil || len(expired) != 0 {
+		c.errorf("ExpireGameStates an hour ago returned %v and %v, want none", expired, err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	if err := c.store.SaveGameState(c.ctx, fresh, table(32)); err != nil {
+		c.errorf("SaveGameState: %v", err)
+		return
+	}
+	games, err := c.store.Subscribe(c.ctx, db.Query{Kind: db.KindGameState, ID: old}, nil)
+	if err != nil {
+		c.errorf("Subscribe: %v", err)
+		return
+	}
+	defer games.Unsubscribe()
+	expired, err := c.store.ExpireGameStates(c.ctx, cutoff)
+	if err != nil {
+		c.errorf("ExpireGameStates: %v", err)
+		return
+	}
+	found := false
+	for i, e := range expired {
+		found = found || e == old
+		if e == fresh {
+			c.errorf("ExpireGameStates removed a game saved after the cutoff")
+		}
+		if i > 0 && expired[i-1] >= e {
+			c.errorf("ExpireGameStates returned %v, want them in order", expired)
+		}
+	}
+	if !found {
+		c.errorf("ExpireGameStates returned %v, want %s among them", expired, old)
+	}
+	if ch, ok, why := next(games); !ok {
+		c.errorf("expiry under a subscription: %s", why)
+	} else if ch.Op != db.Delete || ch.ID != old {
+		c.errorf("expiry under a subscription delivered %v of %s", ch.Op, ch.ID)
+	}
+	if _, err := c.store.LoadGameState(c.ctx, old); !errors.Is(err, db.ErrNotFound) {
+		c.errorf("LoadGameState of an expired game returned %v, want ErrNotFound", err)
+	}
+	if _, err := c.store.GameStateVersions(c.ctx, old); !errors.Is(err, db.ErrNotFound) {
+		c.errorf("GameStateVersions of an expired game returned %v, want ErrNotFound", err)
+	}
+	if _, err := c.store.LoadGameState(c.ctx, fresh); err != nil {
+		c.errorf("LoadGameState of a game saved after the cutoff: %v", err)
+	}
+	if v, err := c.store.SaveGameStateIfVersion(c.ctx, old, table(31), 0); err != nil || v != 1 {
+		c.errorf("saving an expired game again returned version %d and %v, want 1", v, err)
+	}
+}
+
+// canceled checks that every call fails with a canceled context
+func (c *checker) canceled() {
+	ctx, cancel := context.WithCancel(c.ctx)
+	cancel()
+	id := c.id("canceled")
+	check := func(op string, err error) {
+		if !errors.Is(err, context.Canceled) {
+			c.errorf("%s with a canceled context returned %v, want context.Canceled", op, err)
+		}
+	}
+	check("SaveGameState", c.store.SaveGameState(ctx, id, table(3)))
+	_, err := c.store.LoadGameState(ctx, id)
+	check("LoadGameState", err)
+	check("SavePlayerProfile", c.store.SavePlayerProfile(ctx, &db.PlayerProfile{ID: id}))
+	_, err = c.store.LoadPlayerProfile(ctx, id)
+	check("LoadPlayerProfile", err)
+	_, err = c.store.UpdatePlayerProfile(ctx, id, func(*db.PlayerProfile) error { return nil })
+	check("UpdatePlayerProfile", err)
+	check("AddGameHistoryEntry", c.store.AddGameHistoryEntry(ctx, id, entry(id, 0)))
+	_, err = c.store.GetGameHistory(ctx, id)
+	check("GetGameHistory", err)
+	_, err = c.store.Subscribe(ctx, db.Query{Kind: db.KindGameState, ID: id}, nil)
+	check("Subscribe", err)
+	_, err = c.store.SaveGameStateIfVersion(ctx, id, table(3), 0)
+	check("SaveGameStateIfVersion", err)
+	_, _, err = c.store.LoadGameStateVersion(ctx, id)
+	check("LoadGameStateVersion", err)
+	_, err = c.store.GameStateVersions(ctx, id)
+	check("GameStateVersions", err)
+	_, err = c.store.AppendTransaction(ctx, transfer(id, 1))
+	check("AppendTransaction", err)
+	_, err = c.store.Transactions(ctx, 0, 0)
+	check("Transactions", err)
+	_, err = c.store.QueryHistory(ctx, db.HistoryQuery{})
+	check("QueryHistory", err)
+	_, err = c.store.SummarizeHistory(ctx, db.HistoryFilter{})
+	check("SummarizeHistory", err)
+	_, err = c.store.Export(ctx)
+	check("Export", err)
+	_, err = c.store.DeleteHistory(ctx, []int64{1})
+	check("DeleteHistory", err)
+	_, err = c.store.ExpireGameStates(ctx, time.Now())
+	check("ExpireGameStates", err)
+
+	// Nothing may have been written
+	if _, err := c.store.LoadGameState(c.ctx, id); !errors.Is(err, db.ErrNotFound) {
+		c.errorf("SaveGameState with a canceled context saved the state")
+	}
+	if _, err := c.store.GetGameHistory(c.ctx, id); !errors.Is(err, db.ErrNotFound) {
+		c.errorf("AddGameHistoryEntry with a canceled context added the entry")
+	}
+}
+
+// transfer returns a transaction moving chips between two accounts named
+// after id
+func transfer(id string, amount int) *db.Transaction {
+	return &db.Transaction{
+		Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Kind: "transfer",
+		Memo: id,
+		Entries: []db.Entry{
+			{Account: id + "/from", Amount: -amount},
+			{Account: id + "/to", Amount: amount},
+		},
+	}
+}
+
+// lastTransaction returns the ID of the ledger's last transaction
+func (c *checker) lastTransaction() (int64, bool) {
+	txs, err := c.store.Transactions(c.ctx, 0, 0)
+	if err != nil {
+		c.errorf("Transactions: %v", err)
+		return 0, false
+	}
+	for i, tx := range txs {
+		if tx.ID != int64(i)+1 {
+			c.errorf("transaction %d has ID %d", i+1, tx.ID)
+			return 0, false
+		}
+	}
+	return int64(len(txs)), true
+}
+
+// ledger checks appending and reading ledger transactions
+func (c *checker) ledger() {
+	id := c.id("ledger")
+	last, ok := c.lastTransaction()
+	if !ok {
+		return
+	}
+	sub, err := c.store.Subscribe(c.ctx, db.Query{Kind: db.KindTransaction}, nil)
+	if err != nil {
+		c.errorf("Subscribe: %v", err)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	for _, bad := range []*db.Transaction{
+		{Kind: "transfer", Entries: []db.Entry{{Account: id + "/from", Amount: -5}, {Account: id + "/to", Amount: 4}}},
+		{Kind: "transfer", Entries: []db.Entry{{Account: id, Amount: 0}}},
+		{Kind: "transfer", Entries: []db.Entry{{Account: "", Amount: -1}, {Account: id, Amount: 1}}},
+		{Entries: transfer(id, 1).Entries},
+	} {
+		if _, err := c.store.AppendTransaction(c.ctx, bad); err == nil {
+			c.errorf("AppendTransaction accepted an invalid transaction %+v", *bad)
+		}
+	}
+	unbalanced := transfer(id, 5)
+	unbalanced.Entries[0].Amount = -4
+	if _, err := c.store.AppendTransaction(c.ctx, unbalanced); !errors.Is(err, db.ErrUnbalanced) {
+		c.errorf("AppendTransaction of an unbalanced transaction returned %v, want ErrUnbalanced", err)
+	}
+
+	const n = 5
+	for i := 1; i <= n; i++ {
+		tx := transfer(id, i)
+		tx.ID = 999
+		got, err := c.store.AppendTransaction(c.ctx, tx)
+		if err != nil {
+			c.errorf("AppendTransaction: %v", err)
+			return
+		}
+		if got != last+int64(i) {
+			c.errorf("AppendTransaction returned ID %d, want %d", got, last+int64(i))
+		}
+		tx.Entries[0].Account = "changed"
+		ch, ok, why := next(sub)
+		switch {
+		case !ok:
+			c.errorf("appending a transaction: %s", why)
+			return
+		case ch.Op != db.Insert || ch.Kind != db.KindTransaction || ch.Transaction == nil:
+			c.errorf("appending a transaction delivered %v of %s", ch.Op, ch.Kind)
+		case ch.Transaction.ID != got || ch.Transaction.Entries[0].Account != id+"/from":
+			c.errorf("appending a transaction delivered %+v", *ch.Transaction)
+		}
+	}
+
+	txs, err := c.store.Transactions(c.ctx, last, 0)
+	if err != nil {
+		c.errorf("Transactions: %v", err)
+		return
+	}
+	if len(txs) != n {
+		c.errorf("Transactions after %d returned %d transactions, want %d", last, len(txs), n)
+		return
+	}
+	for i, tx := range txs {
+		want := transfer(id, i+1)
+		want.ID = last + int64(i) + 1
+		if !tx.Time.Equal(want.Time) {
+			c.errorf("transaction %d has time %v, want %v", want.ID, tx.Time, want.Time)
+		}
+		tx.Time = want.Time
+		if !reflect.DeepEqual(tx, want) {
+			c.errorf("transaction %d is %+v, want %+v", want.ID, *tx, *want)
+		}
+	}
+	txs[0].Entries[0].Amount = 1000
+	page, err := c.store.Transactions(c.ctx, last+1, 2)
+	if err != nil {
+		c.errorf("Transactions: %v", err)
+		return
+	}
+	if len(page) != 2 || page[0].ID != last+2 || page[1].ID != last+3 {
+		c.errorf("Transactions after %d, limit 2, returned %d transactions", last+1, len(page))
+	}
+	if again, err := c.store.Transactions(c.ctx, last, 1); err != nil || len(again) != 1 || again[0].Entries[0].Amount != -1 {
+		c.errorf("changing a returned transaction changed the stored one")
+	}
+	if none, err := c.store.Transactions(c.ctx, last+n, 0); err != nil || len(none) != 0 {
+		c.errorf("Transactions after the last returned %d transactions and %v", len(none), err)
+	}
+
+	// Concurrent appends get distinct IDs with none skipped
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.store.AppendTransaction(c.ctx, transfer(id, 1)); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		c.errorf("concurrent AppendTransaction: %v", err)
+	}
+	if got, ok := c.lastTransaction(); ok && got != last+n+writers {
+		c.errorf("after concurrent appends the last transaction is %d, want %d", got, last+n+writers)
+	}
+}
+
+// concurrent checks that concurrent appends, saves and updates are all kept
+func (c *checker) concurrent() {
+	const writers, each = 8, 10
+	id := c.id("concurrent")
+	shared := c.id("concurrent-shared")
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*each*3)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				if err := c.store.AddGameHistoryEntry(c.ctx, id, entry(id, w*each+i)); err != nil {
+					errs <- err
+				}
+				p := &db.PlayerProfile{ID: c.id(fmt.Sprint("concurrent-", w)), GamesPlayed: i}
+				if err := c.store.SavePlayerProfile(c.ctx, p); err != nil {
+					errs <- err
+				}
+				if _, err := c.store.UpdatePlayerProfile(c.ctx, shared, func(p *db.PlayerProfile) error {
+					p.GamesPlayed++
+					return nil
+				}); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		c.errorf("concurrent write: %v", err)
+		return
+	}
+	got, err := c.store.GetGameHistory(c.ctx, id)
+	if err != nil {
+		c.errorf("GetGameHistory after concurrent appends: %v", err)
+		return
+	}
+	if len(got) != writers*each {
+		c.errorf("concurrent appends kept %d entries, want %d", len(got), writers*each)
+	}
+	for w := 0; w < writers; w++ {
+		p, err := c.store.LoadPlayerProfile(c.ctx, c.id(fmt.Sprint("concurrent-", w)))
+		if err != nil || p.GamesPlayed != each-1 {
+			c.errorf("profile saved concurrently by writer %d: got %v, %v", w, p, err)
+		}
+	}
+	if p, err := c.store.LoadPlayerProfile(c.ctx, shared); err != nil || p.GamesPlayed != writers*each {
+		c.errorf("profile updated concurrently: got %v, %v, want %d games played", p, err, writers*each)
+	}
+}
+
+// wait is how long a subscription check waits for a change to arrive
+const wait = 5 * time.Second
+
+// next returns the next change on a subscription, or false if it was
+// closed or nothing arrived in time
+func next(sub *db.Subscription) (db.Change, bool, string) {
+	select {
+	case ch, ok := <-sub.C:
+		if !ok {
+			return ch, false, "the subscription closed"
+		}
+		return ch, true, ""
+	case <-time.After(wait):
+		return db.Change{}, false, "no change arrived"
+	}
+}
+
+// closed reports whether a subscription's channel is closed once any
+// buffered changes are drained
+func closed(sub *db.Subscription) bool {
+	timeout := time.After(wait)
+	for {
+		select {
+		case _, ok := <-sub.C:
+			if !ok {
+				return true
+			}
+		case <-timeout:
+			return false
+		}
+	}
+}
+
+// subscriptions checks change notifications, unsubscribing and overflow
+func (c *checker) subscriptions() {
+	id, other := c.id("watched"), c.id("unwatched")
+	sub, err := c.store.Subscribe(c.ctx, db.Query{Kind: db.KindGameState, ID: id}, nil)
+	if err != nil {
+		c.errorf("Subscribe: %v", err)
+		return
+	}
+	g := table(4)
+	want := encode(g)
+	for i, op := range []db.ChangeOp{db.Insert, db.Update} {
+		if err := c.store.SaveGameState(c.ctx, other, g); err != nil {
+			c.errorf("SaveGameState: %v", err)
+		}
+		if err := c.store.SaveGameState(c.ctx, id, g); err != nil {
+			c.errorf("SaveGameState: %v", err)
+			return
+		}
+		ch, ok, why := next(sub)
+		switch {
+		case !ok:
+			c.errorf("save %d of a watched game state: %s", i, why)
+			return
+		case ch.Op != op || ch.Kind != db.KindGameState || ch.ID != id:
+			c.errorf("save %d of a watched game state: got %v of %s %q, want %v of %q", i, ch.Op, ch.Kind, ch.ID, op, id)
+		case ch.State == nil || encode(ch.State) != want:
+			c.errorf("save %d of a watched game state delivered a different state", i)
+		case ch.State == g:
+			c.errorf("a change shares the saved state")
+		}
+	}
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	if !closed(sub) || sub.Err() != nil {
+		c.errorf("after Unsubscribe the channel is not closed or Err is %v", sub.Err())
+	}
+	if err := c.store.SaveGameState(c.ctx, id, g); err != nil {
+		c.errorf("SaveGameState after Unsubscribe: %v", err)
+	}
+
+	// Every record of a kind
+	profiles, err := c.store.Subscribe(c.ctx, db.Query{Kind: db.KindPlayerProfile}, nil)
+	if err != nil {
+		c.errorf("Subscribe: %v", err)
+		return
+	}
+	pid := c.id("watched-player")
+	if err := c.store.SavePlayerProfile(c.ctx, &db.PlayerProfile{ID: pid, Name: "Watched"}); err != nil {
+		c.errorf("SavePlayerProfile: %v", err)
+	}
+	// Other runs may be saving profiles too
+	for {
+		ch, ok, why := next(profiles)
+		if !ok {
+			c.errorf("save of a profile under a kind-wide subscription: %s", why)
+			break
+		}
+		if ch.ID == pid {
+			if ch.Op != db.Insert || ch.Profile == nil || ch.Profile.Name != "Watched" {
+				c.errorf("save of a profile delivered %v %+v", ch.Op, ch.Profile)
+			}
+			break
+		}
+	}
+	profiles.Unsubscribe()
+
+	hid := c.id("watched-history")
+	history, err := c.store.Subscribe(c.ctx, db.Query{Kind: db.KindGameHistory, ID: hid}, nil)
+	if err != nil {
+		c.errorf("Subscribe: %v", err)
+		return
+	}
+	if err := c.store.AddGameHistoryEntry(c.ctx, hid, entry(hid, 1)); err != nil {
+		c.errorf("AddGameHistoryEntry: %v", err)
+	}
+	if ch, ok, why := next(history); !ok {
+		c.errorf("history entry under a subscription: %s", why)
+	} else if ch.Op != db.Insert || ch.Entry == nil || !sameEntry(ch.Entry, entry(hid, 1)) {
+		c.errorf("history entry under a subscription delivered %v %+v", ch.Op, ch.Entry)
+	}
+	history.Unsubscribe()
+
+	c.overflow(id, g)
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	sub, err = c.store.Subscribe(ctx, db.Query{Kind: db.KindGameState, ID: id}, nil)
+	if err != nil {
+		c.errorf("Subscribe: %v", err)
+		return
+	}
+	cancel()
+	if !closed(sub) || !errors.Is(sub.Err(), context.Canceled) {
+		c.errorf("canceling a subscription's context: Err is %v, want context.Canceled", sub.Err())
+	}
+}
+
+// overflow checks what happens to a subscriber that doesn't keep up
+func (c *checker) overflow(id string, g *game.GameState) {
+	sub, err := c.store.Subscribe(c.ctx, db.Query{Kind: db.KindGameState, ID: id}, &db.SubscribeOptions{Buffer: 1})
+	if err != nil {
+		c.errorf("Subscribe: %v", err)
+		return
+	}
+	for i := 0; i < 3; i++ {
+		if err := c.store.SaveGameState(c.ctx, id, g); err != nil {
+			c.errorf("SaveGameState: %v", err)
+		}
+	}
+	if !closed(sub) || !errors.Is(sub.Err(), db.ErrSlowSubscriber) {
+		c.errorf("overflowing a subscription: Err is %v, want ErrSlowSubscriber", sub.Err())
+	}
+
+	sub, err = c.store.Subscribe(c.ctx, db.Query{Kind: db.KindGameState, ID: id}, &db.SubscribeOptions{Buffer: 1, Overflow: db.OverflowDropOldest})
+	if err != nil {
+		c.errorf("Subscribe: %v", err)
+		return
+	}
+	defer sub.Unsubscribe()
+	g = g.Clone()
+	for i := 0; i < 3; i++ {
+		g.SmallBlind = i + 1
+		if err := c.store.SaveGameState(c.ctx, id, g); err != nil {
+			c.errorf("SaveGameState: %v", err)
+		}
+	}
+	ch, ok, why := next(sub)
+	switch {
+	case !ok:
+		c.errorf("dropping the oldest changes: %s", why)
+	case ch.State == nil || ch.State.SmallBlind != 3:
+		c.errorf("dropping the oldest changes didn't keep the latest")
+	case sub.Dropped() != 2:
+		c.errorf("dropping the oldest changes counted %d dropped, want 2", sub.Dropped())
+	}
+}
@@ -0,0 +1,250 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// ChangeOp says how a record changed
+type ChangeOp int
+
+const (
+	Insert ChangeOp = iota // the record is new
+	Update                 // the record replaced an earlier one
+	Delete                 // the record was removed
+)
+
+func (op ChangeOp) String() string {
+	switch op {
+	case Insert:
+		return "insert"
+	case Update:
+		return "update"
+	case Delete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Query selects the records a subscription is told about
+type Query struct {
+	Kind string // KindGameState, KindPlayerProfile, KindGameHistory or KindTransaction
+	ID   string // the game or player ID, or empty for every record of Kind
+}
+
+func (q Query) matches(c *Change) bool {
+	return q.Kind == c.Kind && (q.ID == "" || q.ID == c.ID)
+}
+
+// Change is a change to a record. State, Profile, Entry or Transaction is
+// set to the record's new value, as Kind says; for a Delete it is the
+// removed value when the store knows it. History entries are only
+// inserted and deleted, transactions only inserted, and a transaction's ID
+// is empty.
+type Change struct {
+	Op          ChangeOp
+	Kind        string
+	ID          string // the game or player ID
+	Version     int64  // the game state's new version
+	State       *game.GameState
+	Profile     *PlayerProfile
+	Entry       *GameHistoryEntry
+	Transaction *Transaction
+}
+
+// copy returns a change that shares no memory with c
+func (c *Change) copy() Change {
+	d := *c
+	if c.State != nil {
+		d.State = c.State.Clone()
+	}
+	if c.Profile != nil {
+		d.Profile = copyProfile(c.Profile)
+	}
+	if c.Entry != nil {
+		d.Entry = copyEntry(c.Entry)
+	}
+	if c.Transaction != nil {
+		d.Transaction = copyTransaction(c.Transaction)
+	}
+	return d
+}
+
+// Overflow is what happens when a subscriber falls behind by more changes
+// than its buffer holds
+type Overflow int
+
+const (
+	// OverflowClose ends the subscription with ErrSlowSubscriber, so a
+	// subscriber never misses a change without knowing it
+	OverflowClose Overflow = iota
+	// OverflowDropOldest discards the oldest buffered change to make room,
+	// counting it in Dropped. It suits subscribers that only want the latest
+	// state.
+	OverflowDropOldest
+)
+
+// DefaultBuffer is the number of changes a subscription buffers when
+// SubscribeOptions doesn't say
+const DefaultBuffer = 64
+
+// SubscribeOptions tunes a subscription. The zero value buffers
+// DefaultBuffer changes and closes the subscription on overflow.
+type SubscribeOptions struct {
+	Buffer   int
+	Overflow Overflow
+}
+
+// ErrSlowSubscriber is a subscription's Err when it was ended for falling
+// behind
+var ErrSlowSubscriber = errors.New("subscriber fell behind")
+
+// ErrStoreClosed is a subscription's Err when its store was closed
+var ErrStoreClosed = errors.New("store closed")
+
+// Subscription delivers the changes a query selects on C, in the order the
+// store made them. C is closed when the subscription ends: after
+// Unsubscribe, when the context passed to Subscribe is done, when the store
+// closes, or on overflow; Err then says why.
+type Subscription struct {
+	C <-chan Change
+
+	c        chan Change
+	query    Query
+	overflow Overflow
+	broker   *Broker
+	stop     func() bool
+
+	// Guarded by broker.mu
+	closed  bool
+	err     error
+	dropped int
+}
+
+// Unsubscribe ends the subscription. It may be called more than once.
+func (s *Subscription) Unsubscribe() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.end(s, nil)
+}
+
+// Err returns why the subscription ended: nil after Unsubscribe, the
+// context's error, ErrStoreClosed or ErrSlowSubscriber. It is nil while the
+// subscription is live.
+func (s *Subscription) Err() error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.err
+}
+
+// Dropped returns how many changes OverflowDropOldest has discarded
+func (s *Subscription) Dropped() int {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.dropped
+}
+
+// Broker fans changes out to subscriptions. Stores embed one and publish
+// every change they make while still holding the lock that orders their
+// writes, so subscribers see changes in commit order. The zero value is
+// ready to use.
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]bool
+	closed bool
+}
+
+// Subscribe starts a subscription. Only changes made after it returns are
+// delivered, so to follow a record, subscribe first and then load it.
+func (b *Broker) Subscribe(ctx context.Context, q Query, opts *SubscribeOptions) (*Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	switch q.Kind {
+	case KindGameState, KindPlayerProfile, KindGameHistory, KindTransaction:
+	default:
+		return nil, errors.New("unknown record kind " + q.Kind)
+	}
+	var o SubscribeOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Buffer <= 0 {
+		o.Buffer = DefaultBuffer
+	}
+	c := make(chan Change, o.Buffer)
+	s := &Subscription{C: c, c: c, query: q, overflow: o.Overflow, broker: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrStoreClosed
+	}
+	if b.subs == nil {
+		b.subs = make(map[*Subscription]bool)
+	}
+	b.subs[s] = true
+	s.stop = context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.end(s, ctx.Err())
+	})
+	return s, nil
+}
+
+// Publish delivers a change to every subscription whose query selects it.
+// It never blocks.
+func (b *Broker) Publish(c Change) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		if !s.query.matches(&c) {
+			continue
+		}
+		d := c.copy()
+		select {
+		case s.c <- d:
+			continue
+		default:
+		}
+		if s.overflow != OverflowDropOldest {
+			b.end(s, ErrSlowSubscriber)
+			continue
+		}
+		// Publish is the only sender and holds mu, so after taking one
+		// change out there is room for this one
+		select {
+		case <-s.c:
+			s.dropped++
+		default:
+		}
+		s.c <- d
+	}
+}
+
+// Close ends every subscription with ErrStoreClosed and refuses new ones
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subs {
+		b.end(s, ErrStoreClosed)
+	}
+}
+
+// end ends a subscription. The caller holds mu.
+func (b *Broker) end(s *Subscription, err error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	delete(b.subs, s)
+	close(s.c)
+	if s.stop != nil {
+		s.stop()
+	}
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"go-wasm-poker/pkg/game"
+	"go-wasm-poker/pkg/history"
+)
+
+// HandAdder is implemented by stores that keep complete hands, such as
+// sqlstore.Store
+type HandAdder interface {
+	AddHand(ctx context.Context, gameID string, h *history.Hand) error
+}
+
+// trackQueue is how many finished hands TrackGame holds while the store
+// catches up, before the game waits for it
+const trackQueue = 64
+
+// TrackGame persists every hand played at a table to a store from its
+// events: the state is saved and the hand added with AddHand when each hand
+// ends. The store is written from a goroutine of its own, so the game only
+// waits for it when trackQueue hands are queued. The returned function
+// stops tracking once the queued hands are written.
+func TrackGame(store Store, gameID string, g *game.GameState) (stop func()) {
+	type finished struct {
+		state *game.GameState
+		hand  *history.Hand
+	}
+	queue := make(chan finished, trackQueue)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ctx := context.Background()
+		for f := range queue {
+			if err := store.SaveGameState(ctx, gameID, f.state); err != nil {
+				log.Printf("Failed to save game state: %v", err)
+			}
+			if err := AddHand(ctx, store, gameID, f.hand); err != nil {
+				log.Printf("Failed to add hand: %v", err)
+			}
+		}
+	}()
+
+	rec := history.NewRecorder(nil, gameID, 1)
+	rec.OnHand = func(h *history.Hand) {
+		// The game goes on while the store writes, so it gets a copy
+		queue <- finished{g.Clone(), h}
+	}
+	unsubscribe := g.Subscribe(rec.Observe)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			unsubscribe()
+			close(queue)
+			<-done
+		})
+	}
+}
+
+// AddHand adds a finished hand to a game's history: complete when the store
+// is a HandAdder, and otherwise as the entry HandEntry summarizes it in
+func AddHand(ctx context.Context, store Store, gameID string, h *history.Hand) error {
+	if a, ok := store.(HandAdder); ok {
+		return a.AddHand(ctx, gameID, h)
+	}
+	return store.AddGameHistoryEntry(ctx, gameID, HandEntry(gameID, h))
+}
+
+// HandEntry summarizes a finished hand as a history entry. Players are
+// identified by ID, or by name for hands imported without IDs.
+func HandEntry(gameID string, h *history.Hand) *GameHistoryEntry {
+	playerID := func(seat int) string {
+		if st := h.Seat(seat); st != nil {
+			if st.PlayerID != "" {
+				return st.PlayerID
+			}
+			return st.Name
+		}
+		return ""
+	}
+	winner, won := 0, 0
+	for _, st := range h.Seats {
+		if w := h.Won(st.Number); w > won {
+			winner, won = st.Number, w
+		}
+	}
+	entry := &GameHistoryEntry{
+		GameID:     gameID,
+		Timestamp:  h.Time,
+		Winner:     playerID(winner),
+		PotSize:    h.TotalPot(),
+		SmallBlind: h.SmallBlind,
+		BigBlind:   h.BigBlind,
+		Showdown:   h.WentToShowdown(),
+	}
+	how := "uncontested"
+	if entry.Showdown {
+		how = "at showdown"
+		if eval, ok := h.Evaluate(winner); ok {
+			entry.HandRank = eval.Rank
+		}
+	}
+	if st := h.Seat(winner); st != nil {
+		entry.HandSummary = fmt.Sprintf("%s won %d %s", st.Name, won, how)
+	}
+	for _, st := range h.Seats {
+		entry.Players = append(entry.Players, playerID(st.Number))
+	}
+	return entry
+}
@@ -3,6 +3,7 @@ package game
 import (
 	"fmt"
 	"math/rand"
+	"strings"
 	"time"
 )
 
@@ -114,7 +115,12 @@ func NewDeck() *Deck {
 
 // Shuffle shuffles the deck
 func (d *Deck) Shuffle() {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	d.ShuffleWith(rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+// ShuffleWith shuffles the deck using r, so that seeded sources give
+// repeatable deals
+func (d *Deck) ShuffleWith(r *rand.Rand) {
 	r.Shuffle(len(d.Cards), func(i, j int) {
 		d.Cards[i], d.Cards[j] = d.Cards[j], d.Cards[i]
 	})
@@ -139,3 +145,34 @@ func (d *Deck) DrawOne() (Card, bool) {
 	d.Cards = d.Cards[1:]
 	return card, true
 }
+
+const (
+	rankCodes = "23456789TJQKA"
+	suitCodes = "shdc"
+)
+
+// Code returns the two-character ASCII form of a card, such as "Ah" or "Td",
+// used in text formats that can't rely on suit symbols
+func (c Card) Code() string {
+	if c.Rank < Two || c.Rank > Ace || c.Suit < Spades || c.Suit > Clubs {
+		return "??"
+	}
+	return string(rankCodes[c.Rank-Two]) + string(suitCodes[c.Suit])
+}
+
+// ParseCard parses a card in the form returned by Code. Case is ignored and
+// "10" is accepted for tens.
+func ParseCard(s string) (Card, error) {
+	if len(s) == 3 && s[:2] == "10" {
+		s = "T" + s[2:]
+	}
+	if len(s) != 2 {
+		return Card{}, fmt.Errorf("invalid card %q", s)
+	}
+	rank := strings.IndexByte(rankCodes, strings.ToUpper(s[:1])[0])
+	suit := strings.IndexByte(suitCodes, strings.ToLower(s[1:])[0])
+	if rank < 0 || suit < 0 {
+		return Card{}, fmt.Errorf("invalid card %q", s)
+	}
+	return Card{Rank: Two + Rank(rank), Suit: Suit(suit)}, nil
+}
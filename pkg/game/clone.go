@@ -0,0 +1,173 @@
+package game
+
+import "math/rand"
+
+// Clone returns a deep copy of the game that shares nothing with it and deals
+// the same cards from here on. Subscribers are not copied.
+func (g *GameState) Clone() *GameState {
+	c := *g
+	c.Players = make([]*Player, len(g.Players))
+	for i, p := range g.Players {
+		c.Players[i] = p.clone()
+	}
+	if g.Deck != nil {
+		c.Deck = &Deck{Cards: append([]Card(nil), g.Deck.Cards...)}
+	}
+	c.CommunityCards = append(make([]Card, 0, 5), g.CommunityCards...)
+	c.Payouts = append([]Payout(nil), g.Payouts...)
+	c.acted = append([]bool(nil), g.acted...)
+	if g.stacked != nil {
+		c.stacked = append([]Card{}, g.stacked...)
+	}
+	if g.src != nil {
+		src := *g.src
+		c.src = &src
+		c.rng = rand.New(c.src)
+	}
+	c.subscribers = nil
+	c.nextSubID = 0
+	return &c
+}
+
+// clone returns a copy of the player that doesn't share its cards
+func (p *Player) clone() *Player {
+	c := *p
+	c.Cards = append(make([]Card, 0, len(p.Cards)), p.Cards...)
+	return &c
+}
+
+// Snapshot is a copy of a game at one moment, see GameState.Snapshot. It
+// can't be changed, so one snapshot can be restored any number of times.
+type Snapshot struct {
+	state   GameState // everything but the players and deck
+	players []Player
+	deck    []Card
+	hasDeck bool
+}
+
+// Snapshot captures the game's current state
+func (g *GameState) Snapshot() *Snapshot {
+	c := g.Clone()
+	s := &Snapshot{players: make([]Player, len(c.Players))}
+	for i, p := range c.Players {
+		s.players[i] = *p
+	}
+	if c.Deck != nil {
+		s.deck, s.hasDeck = c.Deck.Cards, true
+	}
+	c.Players, c.Deck = nil, nil
+	s.state = *c
+	return s
+}
+
+// Restore puts the game back into the state a snapshot captured. Subscribers
+// are kept and sent StateRestored. When the number of players is the same,
+// the existing Player values are updated so that pointers to them stay valid.
+func (g *GameState) Restore(s *Snapshot) {
+	c := s.state
+	restored := c.Clone()
+	restored.Players = g.Players
+	if len(g.Players) != len(s.players) {
+		restored.Players = make([]*Player, len(s.players))
+	}
+	for i := range s.players {
+		p := s.players[i].clone()
+		if restored.Players[i] == nil {
+			restored.Players[i] = p
+		} else {
+			*restored.Players[i] = *p
+		}
+	}
+	if s.hasDeck {
+		restored.Deck = &Deck{Cards: append([]Card(nil), s.deck...)}
+	}
+	restored.subscribers, restored.nextSubID = g.subscribers, g.nextSubID
+	*g = *restored
+	if g.observed() {
+		g.emit(StateRestored{})
+	}
+}
+
+// UndoStack lets the actions taken at a table be undone and redone, for
+// practice mode and trying out other lines. Changes made to the game other
+// than through the stack's methods can't be undone.
+type UndoStack struct {
+	game  *GameState
+	limit int // the most states kept for undoing, 0 for no limit
+	undo  []*Snapshot
+	redo  []*Snapshot
+}
+
+// NewUndoStack creates an undo stack for a game, keeping at most limit
+// states to go back to, or every state if limit is 0
+func NewUndoStack(g *GameState, limit int) *UndoStack {
+	return &UndoStack{game: g, limit: limit}
+}
+
+// Save records the current state as one that Undo returns to, and drops
+// everything that could be redone
+func (u *UndoStack) Save() {
+	u.push(u.game.Snapshot())
+}
+
+// push records a state to undo to
+func (u *UndoStack) push(s *Snapshot) {
+	u.undo = append(u.undo, s)
+	if u.limit > 0 && len(u.undo) > u.limit {
+		u.undo = append(u.undo[:0], u.undo[len(u.undo)-u.limit:]...)
+	}
+	u.redo = nil
+}
+
+// StartNewHand starts a new hand that can be undone
+func (u *UndoStack) StartNewHand() {
+	u.Save()
+	u.game.StartNewHand()
+}
+
+// ProcessAction takes an action that can be undone. Nothing is recorded if
+// the action is rejected.
+func (u *UndoStack) ProcessAction(action PlayerAction, amount int) bool {
+	before := u.game.Snapshot()
+	if !u.game.ProcessAction(action, amount) {
+		return false
+	}
+	u.push(before)
+	return true
+}
+
+// CanUndo returns whether there is a state to go back to
+func (u *UndoStack) CanUndo() bool {
+	return len(u.undo) > 0
+}
+
+// CanRedo returns whether there is an undone state to go forward to
+func (u *UndoStack) CanRedo() bool {
+	return len(u.redo) > 0
+}
+
+// Undo goes back to the state before the last change, returning false if
+// there is none
+func (u *UndoStack) Undo() bool {
+	if len(u.undo) == 0 {
+		return false
+	}
+	s := u.undo[len(u.undo)-1]
+	u.undo = u.undo[:len(u.undo)-1]
+	u.redo = append(u.redo, u.game.Snapshot())
+	u.game.Restore(s)
+	return true
+}
+
+// Redo goes forward to the state the last Undo left, returning false if
+// there is none
+func (u *UndoStack) Redo() bool {
+	if len(u.redo) == 0 {
+		return false
+	}
+	s := u.redo[len(u.redo)-1]
+	u.redo = u.redo[:len(u.redo)-1]
+	u.undo = append(u.undo, u.game.Snapshot())
+	u.game.Restore(s)
+	return true
+}
@@ -0,0 +1,375 @@
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// SchemaVersion is the version of the JSON form of GameState written by
+// MarshalJSON. See docs/gamestate-schema.md.
+const SchemaVersion = 1
+
+// ErrSchemaVersion is returned when decoding a state written by a newer
+// version of the schema, or an older one with no migration
+var ErrSchemaVersion = errors.New("unsupported game state schema version")
+
+// Migration upgrades a decoded game state from one schema version to the
+// next. It changes the object in place; numbers in it are json.Number.
+type Migration func(state map[string]any) error
+
+// migrations maps a schema version to the migration that upgrades it
+var migrations = map[int]Migration{
+	0: migrateV0,
+}
+
+// RegisterMigration sets the migration that upgrades states written with
+// schema version from to version from+1
+func RegisterMigration(from int, m Migration) {
+	migrations[from] = m
+}
+
+var phaseNames = [...]string{"preflop", "flop", "turn", "river", "showdown"}
+
+var statusNames = [...]string{"active", "folded", "allin", "out"}
+
+var actionNames = [...]string{"fold", "check", "call", "bet", "raise", "allin"}
+
+// enumText returns the name of an enum value
+func enumText(names []string, v int, kind string) ([]byte, error) {
+	if v < 0 || v >= len(names) {
+		return nil, fmt.Errorf("invalid %s %d", kind, v)
+	}
+	return []byte(names[v]), nil
+}
+
+// parseEnum returns the value with the given name
+func parseEnum(names []string, text []byte, kind string) (int, error) {
+	for i, name := range names {
+		if string(text) == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown %s %q", kind, text)
+}
+
+// MarshalText encodes the phase by name, such as "flop"
+func (p GamePhase) MarshalText() ([]byte, error) {
+	return enumText(phaseNames[:], int(p), "phase")
+}
+
+// UnmarshalText decodes a phase name
+func (p *GamePhase) UnmarshalText(text []byte) error {
+	v, err := parseEnum(phaseNames[:], text, "phase")
+	*p = GamePhase(v)
+	return err
+}
+
+// MarshalText encodes the status by name, such as "folded"
+func (s PlayerStatus) MarshalText() ([]byte, error) {
+	return enumText(statusNames[:], int(s), "player status")
+}
+
+// UnmarshalText decodes a status name
+func (s *PlayerStatus) UnmarshalText(text []byte) error {
+	v, err := parseEnum(statusNames[:], text, "player status")
+	*s = PlayerStatus(v)
+	return err
+}
+
+// MarshalText encodes the action by name, such as "raise"
+func (a PlayerAction) MarshalText() ([]byte, error) {
+	return enumText(actionNames[:], int(a), "action")
+}
+
+// UnmarshalText decodes an action name
+func (a *PlayerAction) UnmarshalText(text []byte) error {
+	v, err := parseEnum(actionNames[:], text, "action")
+	*a = PlayerAction(v)
+	return err
+}
+
+// MarshalText encodes the card as its code, such as "Ah"
+func (c Card) MarshalText() ([]byte, error) {
+	code := c.Code()
+	if code == "??" {
+		return nil, fmt.Errorf("invalid card rank %d suit %d", c.Rank, c.Suit)
+	}
+	return []byte(code), nil
+}
+
+// UnmarshalText decodes a card code
+func (c *Card) UnmarshalText(text []byte) error {
+	card, err := ParseCard(string(text))
+	if err != nil {
+		return err
+	}
+	*c = card
+	return nil
+}
+
+// stateJSON is the JSON form of a GameState
+type stateJSON struct {
+	Version      int       `json:"version"`
+	Players      []*Player `json:"players"`
+	Deck         *[]Card   `json:"deck"` // null when there is no deck
+	Board        []Card    `json:"board"`
+	Phase        GamePhase `json:"phase"`
+	Pot          int       `json:"pot"`
+	CurrentBet   int       `json:"current_bet"`
+	SmallBlind   int       `json:"small_blind"`
+	BigBlind     int       `json:"big_blind"`
+	DealerPos    int       `json:"dealer_pos"`
+	CurrentPos   int       `json:"current_pos"`
+	LastRaisePos int       `json:"last_raise_pos"`
+	MinRaise     int       `json:"min_raise"`
+	Payouts      []Payout  `json:"payouts"`
+	ToAct        int       `json:"to_act"`
+	Acted        []bool    `json:"acted,omitempty"`
+	RandState    string    `json:"rand_state,omitempty"` // the seeded source's state, in decimal
+	Stacked      *[]Card   `json:"stacked,omitempty"`
+}
+
+// MarshalJSON encodes the whole state, including the deck order, the
+// seeded random source and what is left of the betting round, so that
+// UnmarshalJSON restores a game that plays on exactly as this one would.
+// Subscribers are not encoded.
+func (g *GameState) MarshalJSON() ([]byte, error) {
+	s := stateJSON{
+		Version:      SchemaVersion,
+		Players:      g.Players,
+		Board:        g.CommunityCards,
+		Phase:        g.CurrentPhase,
+		Pot:          g.Pot,
+		CurrentBet:   g.CurrentBet,
+		SmallBlind:   g.SmallBlind,
+		BigBlind:     g.BigBlind,
+		DealerPos:    g.DealerPos,
+		CurrentPos:   g.CurrentPos,
+		LastRaisePos: g.LastRaisePos,
+		MinRaise:     g.MinRaise,
+		Payouts:      g.Payouts,
+		ToAct:        g.toAct,
+		Acted:        g.acted,
+	}
+	if g.Deck != nil {
+		s.Deck = &g.Deck.Cards
+	}
+	if g.src != nil {
+		s.RandState = strconv.FormatUint(g.src.state, 10)
+	}
+	if g.stacked != nil {
+		s.Stacked = &g.stacked
+	}
+	return json.Marshal(s)
+}
+
+// UnmarshalJSON decodes a state written by MarshalJSON, first migrating
+// states written with older schema versions. Subscribers of g are kept.
+func (g *GameState) UnmarshalJSON(data []byte) error {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	if header.Version > SchemaVersion {
+		return fmt.Errorf("%w %d", ErrSchemaVersion, header.Version)
+	}
+	if header.Version < SchemaVersion {
+		migrated, err := migrate(data, header.Version)
+		if err != nil {
+			return err
+		}
+		data = migrated
+	}
+
+	var s stateJSON
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	for i, p := range s.Players {
+		if p == nil {
+			return fmt.Errorf("player %d is null", i)
+		}
+	}
+	state := GameState{
+		Players:        s.Players,
+		CommunityCards: append(make([]Card, 0, 5), s.Board...),
+		CurrentPhase:   s.Phase,
+		Pot:            s.Pot,
+		CurrentBet:     s.CurrentBet,
+		SmallBlind:     s.SmallBlind,
+		BigBlind:       s.BigBlind,
+		DealerPos:      s.DealerPos,
+		CurrentPos:     s.CurrentPos,
+		LastRaisePos:   s.LastRaisePos,
+		MinRaise:       s.MinRaise,
+		Payouts:        s.Payouts,
+		toAct:          s.ToAct,
+		acted:          s.Acted,
+		subscribers:    g.subscribers,
+		nextSubID:      g.nextSubID,
+	}
+	if s.Deck != nil {
+		state.Deck = &Deck{Cards: *s.Deck}
+	}
+	if s.RandState != "" {
+		seed, err := strconv.ParseUint(s.RandState, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid rand_state %q", s.RandState)
+		}
+		state.SetSeed(int64(seed))
+	}
+	if s.Stacked != nil {
+		state.stacked = *s.Stacked
+	}
+	*g = state
+	return nil
+}
+
+// migrate runs the migrations from version up to SchemaVersion
+func migrate(data []byte, version int) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var state map[string]any
+	if err := dec.Decode(&state); err != nil {
+		return nil, err
+	}
+	for v := version; v < SchemaVersion; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return nil, fmt.Errorf("%w %d", ErrSchemaVersion, v)
+		}
+		if err := m(state); err != nil {
+			return nil, fmt.Errorf("migrating game state from version %d: %w", v, err)
+		}
+		state["version"] = v + 1
+	}
+	return json.Marshal(state)
+}
+
+// migrateV0 upgrades the plain json.Marshal output of GameState used before
+// the schema had a version. That form has no unexported state, so a table
+// in the middle of a betting round resumes with every active player still
+// to act, and an unseeded deck.
+func migrateV0(state map[string]any) error {
+	rename := func(m map[string]any, from, to string) {
+		if v, ok := m[from]; ok {
+			m[to] = v
+			delete(m, from)
+		}
+	}
+	number := func(v any) (int64, error) {
+		n, ok := v.(json.Number)
+		if !ok {
+			return 0, fmt.Errorf("%v is not a number", v)
+		}
+		return n.Int64()
+	}
+	cards := func(v any) (any, error) {
+		list, ok := v.([]any)
+		if !ok {
+			return v, nil // null
+		}
+		codes := make([]any, len(list))
+		for i, c := range list {
+			m, ok := c.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("card %v is not an object", c)
+			}
+			rank, err := number(m["Rank"])
+			if err != nil {
+				return nil, err
+			}
+			suit, err := number(m["Suit"])
+			if err != nil {
+				return nil, err
+			}
+			code, err := Card{Rank: Rank(rank), Suit: Suit(suit)}.MarshalText()
+			if err != nil {
+				return nil, err
+			}
+			codes[i] = string(code)
+		}
+		return codes, nil
+	}
+	enum := func(m map[string]any, key string, names []string) error {
+		if _, ok := m[key]; !ok {
+			return nil
+		}
+		v, err := number(m[key])
+		if err != nil || v < 0 || int(v) >= len(names) {
+			return fmt.Errorf("invalid %s %v", key, m[key])
+		}
+		m[key] = names[v]
+		return nil
+	}
+
+	var err error
+	if deck, ok := state["Deck"].(map[string]any); ok {
+		if state["deck"], err = cards(deck["Cards"]); err != nil {
+			return err
+		}
+	} else {
+		state["deck"] = nil
+	}
+	delete(state, "Deck")
+	if state["board"], err = cards(state["CommunityCards"]); err != nil {
+		return err
+	}
+	delete(state, "CommunityCards")
+	rename(state, "CurrentPhase", "phase")
+	if err := enum(state, "phase", phaseNames[:]); err != nil {
+		return err
+	}
+	for _, keys := range [][2]string{
+		{"Pot", "pot"}, {"CurrentBet", "current_bet"}, {"SmallBlind", "small_blind"},
+		{"BigBlind", "big_blind"}, {"DealerPos", "dealer_pos"}, {"CurrentPos", "current_pos"},
+		{"LastRaisePos", "last_raise_pos"}, {"MinRaise", "min_raise"},
+	} {
+		rename(state, keys[0], keys[1])
+	}
+
+	players, _ := state["Players"].([]any)
+	delete(state, "Players")
+	active := 0
+	for _, v := range players {
+		p, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("player %v is not an object", v)
+		}
+		for _, keys := range [][2]string{
+			{"ID", "id"}, {"Name", "name"}, {"Chips", "chips"}, {"Bet", "bet"},
+			{"TotalBet", "total_bet"}, {"Status", "status"}, {"Position", "position"},
+		} {
+			rename(p, keys[0], keys[1])
+		}
+		if err := enum(p, "status", statusNames[:]); err != nil {
+			return err
+		}
+		if p["status"] == statusNames[Active] {
+			active++
+		}
+		if p["cards"], err = cards(p["Cards"]); err != nil {
+			return err
+		}
+		delete(p, "Cards")
+	}
+	state["players"] = players
+
+	payouts, _ := state["Payouts"].([]any)
+	delete(state, "Payouts")
+	for _, v := range payouts {
+		if p, ok := v.(map[string]any); ok {
+			rename(p, "PlayerID", "player_id")
+			rename(p, "Pot", "pot")
+			rename(p, "Amount", "amount")
+		}
+	}
+	state["payouts"] = payouts
+	state["to_act"] = active
+	return nil
+}
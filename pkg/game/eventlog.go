@@ -0,0 +1,237 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrNotSeeded is returned when a hand would be dealt from an unseeded
+	// deck, which can't be replayed
+	ErrNotSeeded = errors.New("table has no seed")
+	// ErrIllegalAction is returned for a logged action the engine rejects
+	ErrIllegalAction = errors.New("illegal action")
+	// ErrDiverged is returned when a replayed state differs from a checkpoint
+	ErrDiverged = errors.New("replay diverged")
+)
+
+// TableConfig describes a table before its first hand, which together with
+// the action log determines every later state
+type TableConfig struct {
+	SmallBlind int          `json:"small_blind"`
+	BigBlind   int          `json:"big_blind"`
+	DealerPos  int          `json:"dealer_pos"` // the button moves on from here when a hand starts
+	Seed       int64        `json:"seed"`
+	Players    []SeatConfig `json:"players"`
+}
+
+// SeatConfig is a player sitting down at a table
+type SeatConfig struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Chips int    `json:"chips"`
+}
+
+// LogKind is the kind of a LogEvent
+type LogKind string
+
+const (
+	LogStartHand LogKind = "start_hand"
+	LogAction    LogKind = "action"
+)
+
+// LogEvent is one entry of a table's action log: a new hand being started or
+// a player's action, with the amount ProcessAction takes
+type LogEvent struct {
+	Kind   LogKind      `json:"kind"`
+	Seat   int          `json:"seat,omitempty"`
+	Action PlayerAction `json:"action"`
+	Amount int          `json:"amount,omitempty"`
+}
+
+// Checkpoint is the state expected after the first After events of a log
+type Checkpoint struct {
+	After int        `json:"after"`
+	State *GameState `json:"state"`
+}
+
+// NewTable creates the table a config describes
+func NewTable(cfg TableConfig) *GameState {
+	players := make([]*Player, len(cfg.Players))
+	for i, p := range cfg.Players {
+		players[i] = NewPlayer(p.ID, p.Name, p.Chips, i)
+	}
+	g := NewGameState(players, cfg.SmallBlind, cfg.BigBlind)
+	g.DealerPos = cfg.DealerPos
+	g.SetSeed(cfg.Seed)
+	return g
+}
+
+// Apply returns the state that follows from applying e to state. state
+// itself is left unchanged.
+func Apply(state *GameState, e LogEvent) (*GameState, error) {
+	next := state.Clone()
+	if err := next.apply(e); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// apply applies a log event in place
+func (g *GameState) apply(e LogEvent) error {
+	switch e.Kind {
+	case LogStartHand:
+		if g.rng == nil && g.stacked == nil {
+			return ErrNotSeeded
+		}
+		g.StartNewHand()
+	case LogAction:
+		if g.IsHandOver() {
+			return fmt.Errorf("%w: no hand in progress", ErrIllegalAction)
+		}
+		if e.Seat != g.CurrentPos {
+			return fmt.Errorf("%w: seat %d acted but seat %d was to act", ErrIllegalAction, e.Seat, g.CurrentPos)
+		}
+		if !g.ProcessAction(e.Action, e.Amount) {
+			return fmt.Errorf("%w: seat %d can't %s %d", ErrIllegalAction, e.Seat, e.Action, e.Amount)
+		}
+	default:
+		return fmt.Errorf("unknown log event %q", e.Kind)
+	}
+	return nil
+}
+
+// Replay rebuilds a table from its config and action log, checking the state
+// against each checkpoint on the way, and returns the final state
+func Replay(cfg TableConfig, events []LogEvent, checkpoints ...Checkpoint) (*GameState, error) {
+	g := NewTable(cfg)
+	check := func(after int) error {
+		for _, c := range checkpoints {
+			if c.After != after {
+				continue
+			}
+			if diff := diffState(c.State, g); diff != "" {
+				return fmt.Errorf("%w after event %d: %s", ErrDiverged, after, diff)
+			}
+		}
+		return nil
+	}
+	if err := check(0); err != nil {
+		return g, err
+	}
+	for i, e := range events {
+		if err := g.apply(e); err != nil {
+			return g, fmt.Errorf("event %d: %w", i+1, err)
+		}
+		if err := check(i + 1); err != nil {
+			return g, err
+		}
+	}
+	return g, nil
+}
+
+// Journal records a table's action log from its events as it is played, so
+// that the table can be rebuilt with Replay. Only hands that are dealt are
+// logged, so a table that is down to one player should not be restarted, and
+// a table that is restored to an earlier state can't be journaled.
+type Journal struct {
+	Config      TableConfig  `json:"config"`
+	Events      []LogEvent   `json:"events"`
+	Checkpoints []Checkpoint `json:"checkpoints,omitempty"`
+}
+
+// NewJournal creates the table a config describes, with a journal recording
+// everything played at it
+func NewJournal(cfg TableConfig) (*GameState, *Journal) {
+	g := NewTable(cfg)
+	j := &Journal{Config: cfg}
+	g.Subscribe(j.observe)
+	return g, j
+}
+
+// observe turns table events back into the calls that caused them
+func (j *Journal) observe(e Event) {
+	switch e := e.(type) {
+	case HandStarted:
+		j.Events = append(j.Events, LogEvent{Kind: LogStartHand})
+	case PlayerActed:
+		le := LogEvent{Kind: LogAction, Seat: e.Seat, Action: e.Action}
+		switch {
+		case e.AllIn && e.Action != Fold && e.Action != Check:
+			le.Action = AllIn
+		case e.Action == Bet:
+			le.Amount = e.BetTo
+		case e.Action == Raise:
+			le.Amount = e.BetTo - e.PrevBet
+		}
+		j.Events = append(j.Events, le)
+	}
+}
+
+// Checkpoint stores a copy of the table's current state, to be checked when
+// the journal is replayed
+func (j *Journal) Checkpoint(g *GameState) {
+	j.Checkpoints = append(j.Checkpoints, Checkpoint{After: len(j.Events), State: g.Clone()})
+}
+
+// Replay rebuilds the table from the journal, see Replay
+func (j *Journal) Replay() (*GameState, error) {
+	return Replay(j.Config, j.Events, j.Checkpoints...)
+}
+
+// diffState describes the first difference between two states that affects
+// how the game continues, or returns "" when there is none
+func diffState(want, got *GameState) string {
+	if len(want.Players) != len(got.Players) {
+		return fmt.Sprintf("%d players, want %d", len(got.Players), len(want.Players))
+	}
+	for i, w := range want.Players {
+		g := got.Players[i]
+		switch {
+		case w.ID != g.ID:
+			return fmt.Sprintf("seat %d is %s, want %s", i, g.ID, w.ID)
+		case w.Chips != g.Chips:
+			return fmt.Sprintf("seat %d has %d chips, want %d", i, g.Chips, w.Chips)
+		case w.Bet != g.Bet || w.TotalBet != g.TotalBet:
+			return fmt.Sprintf("seat %d bet %d/%d, want %d/%d", i, g.Bet, g.TotalBet, w.Bet, w.TotalBet)
+		case w.Status != g.Status:
+			return fmt.Sprintf("seat %d has status %d, want %d", i, g.Status, w.Status)
+		case !sameCards(w.Cards, g.Cards):
+			return fmt.Sprintf("seat %d holds %v, want %v", i, g.Cards, w.Cards)
+		}
+	}
+	switch {
+	case want.CurrentPhase != got.CurrentPhase:
+		return fmt.Sprintf("phase %s, want %s", got.CurrentPhase, want.CurrentPhase)
+	case !sameCards(want.CommunityCards, got.CommunityCards):
+		return fmt.Sprintf("board %v, want %v", got.CommunityCards, want.CommunityCards)
+	case want.Pot != got.Pot:
+		return fmt.Sprintf("pot %d, want %d", got.Pot, want.Pot)
+	case want.CurrentBet != got.CurrentBet || want.MinRaise != got.MinRaise:
+		return fmt.Sprintf("bet %d min raise %d, want %d and %d", got.CurrentBet, got.MinRaise, want.CurrentBet, want.MinRaise)
+	case want.DealerPos != got.DealerPos || want.CurrentPos != got.CurrentPos:
+		return fmt.Sprintf("dealer %d to act %d, want %d and %d", got.DealerPos, got.CurrentPos, want.DealerPos, want.CurrentPos)
+	case want.LastRaisePos != got.LastRaisePos || want.toAct != got.toAct:
+		return fmt.Sprintf("last raise %d with %d to act, want %d and %d", got.LastRaisePos, got.toAct, want.LastRaisePos, want.toAct)
+	case (want.Deck == nil) != (got.Deck == nil) || want.Deck != nil && !sameCards(want.Deck.Cards, got.Deck.Cards):
+		return "the deck differs"
+	case !reflect.DeepEqual(append([]Payout(nil), want.Payouts...), append([]Payout(nil), got.Payouts...)):
+		return fmt.Sprintf("payouts %v, want %v", got.Payouts, want.Payouts)
+	case (want.src == nil) != (got.src == nil) || want.src != nil && *want.src != *got.src:
+		return "the random source differs"
+	}
+	return ""
+}
+
+func sameCards(a, b []Card) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
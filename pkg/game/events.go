@@ -0,0 +1,154 @@
+package game
+
+// Event is something that happened at a table. Subscribers receive events in
+// the order they happen, see Subscribe.
+type Event interface {
+	// Type names the kind of event, such as "hand_started"
+	Type() string
+}
+
+// SeatInfo describes a player dealt into a hand
+type SeatInfo struct {
+	Seat     int
+	PlayerID string
+	Name     string
+	Chips    int // chips before the blinds
+}
+
+// HandStarted is sent once the button has moved, before the blinds
+type HandStarted struct {
+	DealerPos  int
+	SmallBlind int
+	BigBlind   int
+	TableSize  int
+	Seats      []SeatInfo // players dealt in, in seat order
+}
+
+// BlindPosted is sent for the small blind and then the big blind
+type BlindPosted struct {
+	Seat     int
+	PlayerID string
+	Amount   int
+	Big      bool
+	AllIn    bool
+}
+
+// CardsDealt is sent for each player's hole cards. It carries the cards, so
+// subscribers that pass events on to other players must hide them.
+type CardsDealt struct {
+	Seat     int
+	PlayerID string
+	Cards    []Card
+}
+
+// PlayerActed is sent for every accepted action, before the next street is
+// dealt. All-in actions are reported as the bet, raise or call they amount to.
+type PlayerActed struct {
+	Seat     int
+	PlayerID string
+	Phase    GamePhase
+	Action   PlayerAction
+	Amount   int  // chips the player put in with this action
+	BetTo    int  // the player's bet on this street afterwards
+	PrevBet  int  // the bet to match before the action
+	AllIn    bool // the action put the player all-in
+}
+
+// StreetDealt is sent when the flop, turn or river is dealt
+type StreetDealt struct {
+	Phase GamePhase
+	Cards []Card // the cards just dealt
+	Board []Card // all community cards
+}
+
+// PotAwarded is sent for every payout, including a returned uncalled bet,
+// which has Pot set to UncalledBetPot
+type PotAwarded struct {
+	Seat     int
+	PlayerID string
+	Pot      int
+	Amount   int
+}
+
+// HandEnded is sent after all pots have been awarded
+type HandEnded struct {
+	Showdown bool
+	Payouts  []Payout
+}
+
+// StateRestored is sent when the game is put back into an earlier state, see
+// GameState.Restore. Anything built from the events since then is stale.
+type StateRestored struct{}
+
+func (HandStarted) Type() string   { return "hand_started" }
+func (BlindPosted) Type() string   { return "blind_posted" }
+func (CardsDealt) Type() string    { return "cards_dealt" }
+func (PlayerActed) Type() string   { return "player_acted" }
+func (StreetDealt) Type() string   { return "street_dealt" }
+func (PotAwarded) Type() string    { return "pot_awarded" }
+func (HandEnded) Type() string     { return "hand_ended" }
+func (StateRestored) Type() string { return "state_restored" }
+
+// subscription is a registered event handler
+type subscription struct {
+	id int
+	fn func(Event)
+}
+
+// Subscribe registers fn to receive every following event. Events are
+// delivered synchronously from the call that caused them, so fn must not
+// change the game. The returned function unsubscribes.
+func (g *GameState) Subscribe(fn func(Event)) (unsubscribe func()) {
+	g.nextSubID++
+	id := g.nextSubID
+	g.subscribers = append(g.subscribers[:len(g.subscribers):len(g.subscribers)], subscription{id, fn})
+	return func() {
+		subs := make([]subscription, 0, len(g.subscribers))
+		for _, s := range g.subscribers {
+			if s.id != id {
+				subs = append(subs, s)
+			}
+		}
+		g.subscribers = subs
+	}
+}
+
+// observed returns whether anyone is subscribed, so that events are only
+// built when they will be delivered
+func (g *GameState) observed() bool {
+	return len(g.subscribers) > 0
+}
+
+// emit delivers an event to every subscriber
+func (g *GameState) emit(e Event) {
+	// Subscribing and unsubscribing copy the slice, so this is stable even
+	// if a handler unsubscribes
+	for _, s := range g.subscribers {
+		s.fn(e)
+	}
+}
+
+// playerActed describes an action from the player's bet before and after it
+func playerActed(seat int, phase GamePhase, action PlayerAction, prevBet, betBefore int, player *Player) PlayerActed {
+	e := PlayerActed{
+		Seat:     seat,
+		PlayerID: player.ID,
+		Phase:    phase,
+		Action:   action,
+		Amount:   player.Bet - betBefore,
+		BetTo:    player.Bet,
+		PrevBet:  prevBet,
+		AllIn:    player.Status == AllInStatus,
+	}
+	if action == AllIn {
+		switch {
+		case prevBet == 0:
+			e.Action = Bet
+		case player.Bet > prevBet:
+			e.Action = Raise
+		default:
+			e.Action = Call
+		}
+	}
+	return e
+}
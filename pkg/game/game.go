@@ -1,5 +1,10 @@
 package game
 
+import (
+	"math/rand"
+	"sort"
+)
+
 // GamePhase represents the current phase of the game
 type GamePhase int
 
@@ -29,71 +34,142 @@ func (p GamePhase) String() string {
 	}
 }
 
+// UncalledBetPot is the Payout.Pot value used when chips are returned to a
+// player because nobody called their last bet
+const UncalledBetPot = -1
+
+// Payout records chips awarded to a player at the end of a hand
+type Payout struct {
+	PlayerID string `json:"player_id"`
+	Pot      int    `json:"pot"` // 0 for the main pot, 1 and up for side pots
+	Amount   int    `json:"amount"`
+}
+
+// LegalAction describes an action the current player may take. For Bet the
+// bounds are the total bet, for Raise they are the raise on top of the call,
+// matching the amount ProcessAction expects.
+type LegalAction struct {
+	Action PlayerAction `json:"action"`
+	Min    int          `json:"min"`
+	Max    int          `json:"max"`
+}
+
 // GameState represents the current state of the game
 type GameState struct {
-	Players       []*Player
-	Deck          *Deck
+	Players        []*Player
+	Deck           *Deck
 	CommunityCards []Card
-	CurrentPhase  GamePhase
-	Pot           int
-	CurrentBet    int
-	SmallBlind    int
-	BigBlind      int
-	DealerPos     int
-	CurrentPos    int
-	LastRaisePos  int
-	MinRaise      int
+	CurrentPhase   GamePhase
+	Pot            int
+	CurrentBet     int
+	SmallBlind     int
+	BigBlind       int
+	DealerPos      int
+	CurrentPos     int
+	LastRaisePos   int
+	MinRaise       int
+	Payouts        []Payout
+
+	toAct       int            // players who still have to act before the betting round closes
+	acted       []bool         // by seat, who has acted since the last full bet or raise and may not raise again
+	rng         *rand.Rand     // shuffles the deck when set, see SetSeed
+	src         *splitMix64    // rng's source, kept so that copies deal the same cards
+	stacked     []Card         // the next hand's deck, see StackDeck
+	subscribers []subscription // receive events, see Subscribe
+	nextSubID   int
 }
 
 // NewGameState creates a new game state
 func NewGameState(players []*Player, smallBlind, bigBlind int) *GameState {
 	return &GameState{
-		Players:       players,
-		Deck:          NewDeck(),
+		Players:        players,
+		Deck:           NewDeck(),
 		CommunityCards: make([]Card, 0, 5),
-		CurrentPhase:  PreFlop,
-		Pot:           0,
-		CurrentBet:    0,
-		SmallBlind:    smallBlind,
-		BigBlind:      bigBlind,
-		DealerPos:     0,
-		CurrentPos:    0,
-		LastRaisePos:  -1,
-		MinRaise:      bigBlind,
+		CurrentPhase:   PreFlop,
+		Pot:            0,
+		CurrentBet:     0,
+		SmallBlind:     smallBlind,
+		BigBlind:       bigBlind,
+		DealerPos:      0,
+		CurrentPos:     0,
+		LastRaisePos:   -1,
+		MinRaise:       bigBlind,
 	}
 }
 
+// SetSeed makes the decks of the following hands come from a random source
+// seeded with seed, so the same seed deals the same cards
+func (g *GameState) SetSeed(seed int64) {
+	g.src = &splitMix64{state: uint64(seed)}
+	g.rng = rand.New(g.src)
+}
+
+// StackDeck makes the next hand deal cards in the given order instead of
+// from a shuffled deck: hole cards one at a time starting left of the dealer,
+// then a burn card before each street. Used to replay recorded hands.
+func (g *GameState) StackDeck(cards []Card) {
+	g.stacked = append([]Card{}, cards...)
+}
+
 // StartNewHand starts a new hand
 func (g *GameState) StartNewHand() {
 	// Reset game state
-	g.Deck = NewDeck()
-	g.Deck.Shuffle()
 	g.CommunityCards = make([]Card, 0, 5)
 	g.CurrentPhase = PreFlop
 	g.Pot = 0
 	g.CurrentBet = 0
 	g.LastRaisePos = -1
 	g.MinRaise = g.BigBlind
+	g.Payouts = nil
+	g.acted = make([]bool, len(g.Players))
 
 	// Reset players for new hand
 	for _, p := range g.Players {
 		p.ResetForNewHand()
 	}
 
-	// Move dealer button
-	g.DealerPos = (g.DealerPos + 1) % len(g.Players)
-	
-	// Find next active players for small blind, big blind, and first to act
+	// Move dealer button to the next player with chips
+	g.DealerPos = g.findNextActivePosition(g.DealerPos)
+	if g.countActivePlayers() < 2 {
+		return
+	}
+
+	// Shuffle only once the hand is certain to start, so that a seeded
+	// table's deals depend only on the hands played
+	g.Deck = NewDeck()
+	if g.stacked != nil {
+		g.Deck.Cards, g.stacked = g.stacked, nil
+	} else if g.rng != nil {
+		g.Deck.ShuffleWith(g.rng)
+	} else {
+		g.Deck.Shuffle()
+	}
+	if g.observed() {
+		e := HandStarted{DealerPos: g.DealerPos, SmallBlind: g.SmallBlind, BigBlind: g.BigBlind, TableSize: len(g.Players)}
+		for i, p := range g.Players {
+			if p.Status != Out {
+				e.Seats = append(e.Seats, SeatInfo{Seat: i, PlayerID: p.ID, Name: p.Name, Chips: p.Chips})
+			}
+		}
+		g.emit(e)
+	}
+
+	// Find next active players for small blind, big blind, and first to act.
+	// Heads-up the dealer posts the small blind.
 	sbPos := g.findNextActivePosition(g.DealerPos)
-	g.Players[sbPos].PlaceBet(g.SmallBlind)
-	
+	if g.countActivePlayers() == 2 {
+		sbPos = g.DealerPos
+	}
+	g.postBlind(sbPos, g.SmallBlind, false)
+
 	bbPos := g.findNextActivePosition(sbPos)
-	g.Players[bbPos].PlaceBet(g.BigBlind)
+	g.postBlind(bbPos, g.BigBlind, true)
 	g.CurrentBet = g.BigBlind
-	
-	// Deal cards to players
+
+	// Deal cards to players, starting left of the dealer
 	for i := 0; i < 2; i++ {
-		for _, p := range g.Players {
+		for j := 1; j <= len(g.Players); j++ {
+			p := g.Players[(g.DealerPos+j)%len(g.Players)]
 			if p.IsActive() || p.Status == AllInStatus {
 				card, ok := g.Deck.DrawOne()
 				if ok {
@@ -102,16 +178,41 @@ func (g *GameState) StartNewHand() {
 			}
 		}
 	}
-	
+	if g.observed() {
+		for j := 1; j <= len(g.Players); j++ {
+			seat := (g.DealerPos + j) % len(g.Players)
+			if p := g.Players[seat]; len(p.Cards) > 0 {
+				g.emit(CardsDealt{Seat: seat, PlayerID: p.ID, Cards: append([]Card{}, p.Cards...)})
+			}
+		}
+	}
+
 	// Set current position to player after big blind
+	g.toAct = g.countActivePlayers()
 	g.CurrentPos = g.findNextActivePosition(bbPos)
+	if g.bettingRoundComplete() {
+		g.advancePhase()
+	}
+}
+
+// postBlind posts a blind, putting the player all-in if they are short
+func (g *GameState) postBlind(pos, amount int, big bool) {
+	player := g.Players[pos]
+	if amount > player.Chips {
+		amount = player.Chips
+	}
+	player.PlaceBet(amount)
+	g.Pot += amount
+	if g.observed() {
+		g.emit(BlindPosted{Seat: pos, PlayerID: player.ID, Amount: amount, Big: big, AllIn: player.Status == AllInStatus})
+	}
 }
 
 // findNextActivePosition finds the next active player position
 func (g *GameState) findNextActivePosition(pos int) int {
 	count := 0
 	nextPos := (pos + 1) % len(g.Players)
-	
+
 	// If we've checked all positions and found no active players, return the original position
 	for count < len(g.Players) {
 		if g.Players[nextPos].IsActive() {
@@ -120,7 +221,7 @@ func (g *GameState) findNextActivePosition(pos int) int {
 		nextPos = (nextPos + 1) % len(g.Players)
 		count++
 	}
-	
+
 	return pos
 }
 
@@ -129,10 +230,10 @@ func (g *GameState) DealFlop() {
 	if g.CurrentPhase != PreFlop {
 		return
 	}
-	
+
 	// Burn a card
 	_, _ = g.Deck.DrawOne()
-	
+
 	// Deal three cards for the flop
 	for i := 0; i < 3; i++ {
 		card, ok := g.Deck.DrawOne()
@@ -140,11 +241,10 @@ func (g *GameState) DealFlop() {
 			g.CommunityCards = append(g.CommunityCards, card)
 		}
 	}
-	
+
 	g.CurrentPhase = Flop
-	g.CurrentBet = 0
-	g.LastRaisePos = -1
-	g.CurrentPos = g.findNextActivePosition(g.DealerPos)
+	g.streetDealt(3)
+	g.startBettingRound()
 }
 
 // DealTurn deals the turn
@@ -152,20 +252,19 @@ func (g *GameState) DealTurn() {
 	if g.CurrentPhase != Flop {
 		return
 	}
-	
+
 	// Burn a card
 	_, _ = g.Deck.DrawOne()
-	
+
 	// Deal the turn
 	card, ok := g.Deck.DrawOne()
 	if ok {
 		g.CommunityCards = append(g.CommunityCards, card)
 	}
-	
+
 	g.CurrentPhase = Turn
-	g.CurrentBet = 0
-	g.LastRaisePos = -1
-	g.CurrentPos = g.findNextActivePosition(g.DealerPos)
+	g.streetDealt(1)
+	g.startBettingRound()
 }
 
 // DealRiver deals the river
@@ -173,41 +272,87 @@ func (g *GameState) DealRiver() {
 	if g.CurrentPhase != Turn {
 		return
 	}
-	
+
 	// Burn a card
 	_, _ = g.Deck.DrawOne()
-	
+
 	// Deal the river
 	card, ok := g.Deck.DrawOne()
 	if ok {
 		g.CommunityCards = append(g.CommunityCards, card)
 	}
-	
+
 	g.CurrentPhase = River
+	g.streetDealt(1)
+	g.startBettingRound()
+}
+
+// streetDealt sends StreetDealt for the last n community cards
+func (g *GameState) streetDealt(n int) {
+	if !g.observed() {
+		return
+	}
+	board := append([]Card{}, g.CommunityCards...)
+	if n > len(board) {
+		n = len(board)
+	}
+	g.emit(StreetDealt{Phase: g.CurrentPhase, Cards: board[len(board)-n:], Board: board})
+}
+
+// startBettingRound resets the per-round betting state after a street is dealt
+func (g *GameState) startBettingRound() {
+	for _, p := range g.Players {
+		p.Bet = 0
+	}
 	g.CurrentBet = 0
 	g.LastRaisePos = -1
+	g.MinRaise = g.BigBlind
+	g.acted = make([]bool, len(g.Players))
+	g.toAct = g.countActivePlayers()
 	g.CurrentPos = g.findNextActivePosition(g.DealerPos)
 }
 
+// mayRaise reports whether the player at pos may bet or raise, which they
+// may not once they have acted since the last full bet or raise
+func (g *GameState) mayRaise(pos int) bool {
+	return pos >= len(g.acted) || !g.acted[pos]
+}
+
 // ProcessAction processes a player action
 func (g *GameState) ProcessAction(action PlayerAction, amount int) bool {
+	if g.IsHandOver() {
+		return false
+	}
 	player := g.Players[g.CurrentPos]
-	
+	if !player.IsActive() {
+		return false
+	}
+	toCall := g.CurrentBet - player.Bet
+	prevBet, betBefore, phase := g.CurrentBet, player.Bet, g.CurrentPhase
+	// A raise gives everyone else another turn, but only a full one lets
+	// those who have already acted raise again
+	reopened, full := false, false
+
 	switch action {
 	case Fold:
 		player.Fold()
 	case Check:
-		if g.CurrentBet > player.Bet {
+		if toCall > 0 {
 			return false // Can't check if there's a bet
 		}
 	case Call:
-		callAmount := g.CurrentBet - player.Bet
-		if !player.PlaceBet(callAmount) {
-			return false
+		if toCall <= 0 {
+			return false // Nothing to call
 		}
+		// A player who can't cover the bet calls for the rest of their chips
+		callAmount := toCall
+		if callAmount > player.Chips {
+			callAmount = player.Chips
+		}
+		player.PlaceBet(callAmount)
 		g.Pot += callAmount
 	case Bet:
-		if g.CurrentBet > 0 {
+		if g.CurrentBet > 0 || !g.mayRaise(g.CurrentPos) {
 			return false // Can't bet if there's already a bet
 		}
 		if amount < g.BigBlind {
@@ -220,8 +365,15 @@ func (g *GameState) ProcessAction(action PlayerAction, amount int) bool {
 		g.CurrentBet = amount
 		g.LastRaisePos = g.CurrentPos
 		g.MinRaise = amount
+		reopened, full = true, true
 	case Raise:
-		raiseAmount := g.CurrentBet - player.Bet + amount
+		if g.CurrentBet == 0 {
+			return false // Nothing to raise, use Bet
+		}
+		if !g.mayRaise(g.CurrentPos) {
+			return false // Only a full raise reopens the betting
+		}
+		raiseAmount := toCall + amount
 		if amount < g.MinRaise {
 			return false // Raise must be at least the minimum raise
 		}
@@ -232,28 +384,105 @@ func (g *GameState) ProcessAction(action PlayerAction, amount int) bool {
 		g.CurrentBet = player.Bet
 		g.LastRaisePos = g.CurrentPos
 		g.MinRaise = amount
+		reopened, full = true, true
 	case AllIn:
 		allInAmount := player.Chips
+		if allInAmount > toCall && !g.mayRaise(g.CurrentPos) {
+			return false // Only a full raise reopens the betting
+		}
 		player.PlaceBet(allInAmount)
 		g.Pot += allInAmount
 		if player.Bet > g.CurrentBet {
+			raise := player.Bet - g.CurrentBet
+			if raise >= g.MinRaise {
+				g.MinRaise = raise
+				full = true
+			}
 			g.CurrentBet = player.Bet
 			g.LastRaisePos = g.CurrentPos
-			g.MinRaise = g.CurrentBet - (g.CurrentBet - allInAmount)
+			reopened = true
+		}
+	default:
+		return false
+	}
+
+	if g.observed() {
+		g.emit(playerActed(g.CurrentPos, phase, action, prevBet, betBefore, player))
+	}
+
+	if len(g.acted) != len(g.Players) {
+		g.acted = make([]bool, len(g.Players))
+	}
+	if full {
+		for i := range g.acted {
+			g.acted[i] = false
+		}
+	}
+	g.acted[g.CurrentPos] = true
+
+	// A bet or raise gives everyone else still able to act another turn
+	if reopened {
+		g.toAct = g.countActivePlayers()
+		if player.IsActive() {
+			g.toAct--
 		}
+	} else {
+		g.toAct--
 	}
-	
-	// Move to next player
-	g.CurrentPos = g.findNextActivePosition(g.CurrentPos)
-	
-	// Check if betting round is over
-	if g.CurrentPos == g.LastRaisePos || g.countActivePlayers() <= 1 {
+
+	if g.countContenders() <= 1 {
+		g.awardUncontested()
+		return true
+	}
+
+	// Check if betting round is over, otherwise move to next player
+	if g.bettingRoundComplete() {
 		g.advancePhase()
+	} else {
+		g.CurrentPos = g.findNextActivePosition(g.CurrentPos)
 	}
-	
+
 	return true
 }
 
+// LegalActions returns the actions the current player may take
+func (g *GameState) LegalActions() []LegalAction {
+	if g.IsHandOver() {
+		return nil
+	}
+	player := g.Players[g.CurrentPos]
+	if !player.IsActive() {
+		return nil
+	}
+	toCall := g.CurrentBet - player.Bet
+
+	actions := []LegalAction{{Action: Fold}}
+	if toCall <= 0 {
+		actions = append(actions, LegalAction{Action: Check})
+	} else {
+		callAmount := toCall
+		if callAmount > player.Chips {
+			callAmount = player.Chips
+		}
+		actions = append(actions, LegalAction{Action: Call, Min: callAmount, Max: callAmount})
+	}
+	if !g.mayRaise(g.CurrentPos) {
+		// Facing a short all-in after acting, going all-in is only a call
+		if player.Chips <= toCall {
+			actions = append(actions, LegalAction{Action: AllIn, Min: player.Chips, Max: player.Chips})
+		}
+		return actions
+	}
+	if g.CurrentBet == 0 && player.Chips >= g.BigBlind {
+		actions = append(actions, LegalAction{Action: Bet, Min: g.BigBlind, Max: player.Chips})
+	}
+	if g.CurrentBet > 0 && player.Chips-toCall >= g.MinRaise {
+		actions = append(actions, LegalAction{Action: Raise, Min: g.MinRaise, Max: player.Chips - toCall})
+	}
+	actions = append(actions, LegalAction{Action: AllIn, Min: player.Chips, Max: player.Chips})
+	return actions
+}
+
 // countActivePlayers counts the number of active players
 func (g *GameState) countActivePlayers() int {
 	count := 0
@@ -265,25 +494,198 @@ func (g *GameState) countActivePlayers() int {
 	return count
 }
 
-// advancePhase advances the game to the next phase
+// countContenders counts the players who can still win the pot
+func (g *GameState) countContenders() int {
+	count := 0
+	for _, p := range g.Players {
+		if p.CanAct() {
+			count++
+		}
+	}
+	return count
+}
+
+// bettingRoundComplete returns whether no more betting is possible this round
+func (g *GameState) bettingRoundComplete() bool {
+	if g.toAct <= 0 {
+		return true
+	}
+	active, matched := 0, true
+	for _, p := range g.Players {
+		if p.IsActive() {
+			active++
+			if p.Bet < g.CurrentBet {
+				matched = false
+			}
+		}
+	}
+	// A lone player who has nobody left to bet against is done
+	return active == 0 || (active == 1 && matched)
+}
+
+// advancePhase advances the game to the next phase. When at most one player
+// can still bet, the remaining streets are dealt straight to showdown.
 func (g *GameState) advancePhase() {
-	switch g.CurrentPhase {
-	case PreFlop:
-		g.DealFlop()
-	case Flop:
-		g.DealTurn()
-	case Turn:
-		g.DealRiver()
-	case River:
-		g.CurrentPhase = Showdown
-		g.determineWinners()
+	for {
+		switch g.CurrentPhase {
+		case PreFlop:
+			g.DealFlop()
+		case Flop:
+			g.DealTurn()
+		case Turn:
+			g.DealRiver()
+		case River:
+			g.CurrentPhase = Showdown
+			g.determineWinners()
+			return
+		default:
+			return
+		}
+		if !g.bettingRoundComplete() {
+			return
+		}
 	}
 }
 
+// returnUncalledBet gives back the part of the largest contribution that no
+// other player matched
+func (g *GameState) returnUncalledBet() {
+	top, second := -1, 0
+	for i, p := range g.Players {
+		if top < 0 || p.TotalBet > g.Players[top].TotalBet {
+			if top >= 0 {
+				second = g.Players[top].TotalBet
+			}
+			top = i
+		} else if p.TotalBet > second {
+			second = p.TotalBet
+		}
+	}
+	if top < 0 {
+		return
+	}
+	player := g.Players[top]
+	excess := player.TotalBet - second
+	if excess <= 0 {
+		return
+	}
+	player.TotalBet -= excess
+	player.Bet -= excess
+	if player.Bet < 0 {
+		player.Bet = 0
+	}
+	g.Pot -= excess
+	g.award(top, UncalledBetPot, excess)
+}
+
+// award pays chips from a pot to the player in seat
+func (g *GameState) award(seat, pot, amount int) {
+	p := g.Players[seat]
+	p.CollectWinnings(amount)
+	g.Payouts = append(g.Payouts, Payout{PlayerID: p.ID, Pot: pot, Amount: amount})
+	if g.observed() {
+		g.emit(PotAwarded{Seat: seat, PlayerID: p.ID, Pot: pot, Amount: amount})
+	}
+}
+
+// endHand sends HandEnded
+func (g *GameState) endHand(showdown bool) {
+	if g.observed() {
+		g.emit(HandEnded{Showdown: showdown, Payouts: append([]Payout{}, g.Payouts...)})
+	}
+}
+
+// awardUncontested gives the pot to the last player who has not folded
+func (g *GameState) awardUncontested() {
+	g.returnUncalledBet()
+	for i, p := range g.Players {
+		if p.CanAct() {
+			g.award(i, 0, g.Pot)
+			break
+		}
+	}
+	g.endHand(false)
+}
+
 // determineWinners determines the winners of the hand
 func (g *GameState) determineWinners() {
-	// Implementation placeholder for determining winners
-	// This would evaluate each player's hand and distribute the pot
+	g.returnUncalledBet()
+
+	// Evaluate every remaining hand, in seat order from the left of the dealer
+	// so that odd chips from split pots go to the earliest position
+	contenders := make([]*Player, 0, len(g.Players))
+	evals := make(map[*Player]HandEvaluation)
+	seats := make(map[*Player]int)
+	for i := 1; i <= len(g.Players); i++ {
+		seat := (g.DealerPos + i) % len(g.Players)
+		p := g.Players[seat]
+		if !p.CanAct() {
+			continue
+		}
+		seats[p] = seat
+		cards := make([]Card, 0, len(p.Cards)+len(g.CommunityCards))
+		cards = append(cards, p.Cards...)
+		cards = append(cards, g.CommunityCards...)
+		contenders = append(contenders, p)
+		evals[p] = EvaluateHand(cards)
+	}
+
+	// Every distinct all-in amount among the contenders caps a pot
+	levels := make([]int, 0, len(contenders))
+	for _, p := range contenders {
+		levels = append(levels, p.TotalBet)
+	}
+	sort.Ints(levels)
+	for i := len(levels) - 1; i > 0; i-- {
+		if levels[i] == levels[i-1] {
+			levels = append(levels[:i], levels[i+1:]...)
+		}
+	}
+
+	prev := 0
+	for i, level := range levels {
+		amount := 0
+		for _, p := range g.Players {
+			top := level
+			if i == len(levels)-1 {
+				top = p.TotalBet // the last pot also collects any dead money
+			}
+			if contribution := minInt(p.TotalBet, top) - minInt(p.TotalBet, prev); contribution > 0 {
+				amount += contribution
+			}
+		}
+		prev = level
+		if amount == 0 {
+			continue
+		}
+
+		var winners []*Player
+		for _, p := range contenders {
+			if p.TotalBet < level {
+				continue
+			}
+			if len(winners) == 0 {
+				winners = append(winners, p)
+				continue
+			}
+			switch CompareHands(evals[p], evals[winners[0]]) {
+			case 1:
+				winners = []*Player{p}
+			case 0:
+				winners = append(winners, p)
+			}
+		}
+
+		share, odd := amount/len(winners), amount%len(winners)
+		for j, p := range winners {
+			won := share
+			if j < odd {
+				won++
+			}
+			g.award(seats[p], i, won)
+		}
+	}
+	g.endHand(true)
 }
 
 // GetCurrentPlayer returns the current player
@@ -293,5 +695,12 @@ func (g *GameState) GetCurrentPlayer() *Player {
 
 // IsHandOver returns whether the hand is over
 func (g *GameState) IsHandOver() bool {
-	return g.CurrentPhase == Showdown || g.countActivePlayers() <= 1
+	return g.CurrentPhase == Showdown || g.countContenders() <= 1
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
 }
@@ -0,0 +1,305 @@
+package game
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseCards parses space separated card codes
+func parseCards(t *testing.T, codes string) []Card {
+	t.Helper()
+	var cards []Card
+	for _, code := range strings.Fields(codes) {
+		c, err := ParseCard(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cards = append(cards, c)
+	}
+	return cards
+}
+
+// stackedDeck returns the deck that deals holes[i] to seat i when seat 0 is
+// the dealer, then board, with unused cards burnt before each street
+func stackedDeck(t *testing.T, holes []string, board string) []Card {
+	t.Helper()
+	used := map[Card]bool{}
+	hole := make([][]Card, len(holes))
+	for i, h := range holes {
+		hole[i] = parseCards(t, h)
+		for _, c := range hole[i] {
+			used[c] = true
+		}
+	}
+	streets := parseCards(t, board)
+	for _, c := range streets {
+		used[c] = true
+	}
+	var burns []Card
+	for _, c := range NewDeck().Cards {
+		if !used[c] {
+			burns = append(burns, c)
+		}
+	}
+
+	var deck []Card
+	for round := 0; round < 2; round++ {
+		for j := 1; j <= len(holes); j++ {
+			deck = append(deck, hole[j%len(holes)][round])
+		}
+	}
+	deck = append(deck, burns[0])
+	deck = append(deck, streets[:3]...)
+	deck = append(deck, burns[1], streets[3], burns[2], streets[4])
+	return deck
+}
+
+// step is an action the player in seat is expected to be the one to take
+type step struct {
+	seat   int
+	action PlayerAction
+	amount int
+}
+
+// newHand starts a hand with blinds of 5 and 10, seat 0 on the button and
+// the given cards
+func newHand(t *testing.T, stacks []int, holes []string, board string) *GameState {
+	t.Helper()
+	var players []*Player
+	for i, chips := range stacks {
+		players = append(players, NewPlayer(fmt.Sprintf("p%d", i), fmt.Sprintf("Player %d", i), chips, i))
+	}
+	g := NewGameState(players, 5, 10)
+	g.DealerPos = len(players) - 1
+	g.StackDeck(stackedDeck(t, holes, board))
+	g.StartNewHand()
+	if g.DealerPos != 0 {
+		t.Fatalf("button on seat %d", g.DealerPos)
+	}
+	return g
+}
+
+func play(t *testing.T, g *GameState, steps []step) {
+	t.Helper()
+	for i, s := range steps {
+		if g.IsHandOver() {
+			t.Fatalf("step %d: hand already over", i)
+		}
+		if g.CurrentPos != s.seat {
+			t.Fatalf("step %d: seat %d to act, want seat %d", i, g.CurrentPos, s.seat)
+		}
+		if !g.ProcessAction(s.action, s.amount) {
+			t.Fatalf("step %d: seat %d %v %d rejected", i, s.seat, s.action, s.amount)
+		}
+	}
+	if !g.IsHandOver() {
+		t.Fatalf("hand not over after %d steps, seat %d to act in %v", len(steps), g.CurrentPos, g.CurrentPhase)
+	}
+}
+
+// checkDown is every seat checking on the flop, turn and river, in order
+func checkDown(seats ...int) []step {
+	var steps []step
+	for street := 0; street < 3; street++ {
+		for _, s := range seats {
+			steps = append(steps, step{s, Check, 0})
+		}
+	}
+	return steps
+}
+
+func TestHands(t *testing.T) {
+	tests := []struct {
+		name    string
+		stacks  []int
+		holes   []string
+		board   string
+		blinds  []int // each seat's bet once the blinds are in
+		steps   []step
+		payouts []Payout
+		chips   []int
+	}{
+		{
+			name:   "heads-up the button posts the small blind and acts first preflop only",
+			stacks: []int{100, 100},
+			holes:  []string{"Ah Ad", "2c 7d"},
+			board:  "Kc 9h 5s 3d Jc",
+			blinds: []int{5, 10},
+			steps: append([]step{
+				{0, Call, 0},
+				{1, Check, 0},
+			}, checkDown(1, 0)...),
+			payouts: []Payout{{"p0", 0, 20}},
+			chips:   []int{110, 90},
+		},
+		{
+			name:   "the big blind gets to raise when the others just call",
+			stacks: []int{100, 100, 100},
+			holes:  []string{"2c 7d", "3c 8d", "Ah Ad"},
+			board:  "Kc 9h 5s 4d Jc",
+			blinds: []int{0, 5, 10},
+			steps: append([]step{
+				{0, Call, 0},
+				{1, Call, 0},
+				{2, Raise, 10},
+				{0, Call, 0},
+				{1, Fold, 0},
+			}, checkDown(2, 0)...),
+			payouts: []Payout{{"p2", 0, 50}},
+			chips:   []int{80, 90, 130},
+		},
+		{
+			name:   "a raise nobody calls is returned before the pot is awarded",
+			stacks: []int{100, 100},
+			holes:  []string{"2c 7d", "Ah Ad"},
+			board:  "Kc 9h 5s 4d Jc",
+			steps: []step{
+				{0, Raise, 20},
+				{1, Fold, 0},
+			},
+			payouts: []Payout{{"p0", UncalledBetPot, 20}, {"p0", 0, 20}},
+			chips:   []int{110, 90},
+		},
+		{
+			name:   "the part of an all-in a short stack can't call is returned",
+			stacks: []int{300, 100},
+			holes:  []string{"2c 7d", "Ah Ad"},
+			board:  "Kc 9h 5s 4d Jc",
+			steps: []step{
+				{0, AllIn, 0},
+				{1, Call, 0},
+			},
+			payouts: []Payout{{"p0", UncalledBetPot, 200}, {"p1", 0, 200}},
+			chips:   []int{200, 200},
+		},
+		{
+			name:   "side pots go to the best hand among those in them",
+			stacks: []int{50, 100, 200},
+			holes:  []string{"Ah Ad", "Kh Kd", "2c 7d"},
+			board:  "Qc 9h 5s 4d Jc",
+			steps: []step{
+				{0, AllIn, 0},
+				{1, AllIn, 0},
+				{2, Call, 0},
+			},
+			payouts: []Payout{{"p0", 0, 150}, {"p1", 1, 100}},
+			chips:   []int{150, 100, 100},
+		},
+		{
+			name:   "the biggest stack wins the main and side pots",
+			stacks: []int{50, 100, 200},
+			holes:  []string{"Kh Kd", "Qh Qd", "Ah Ad"},
+			board:  "2c 9h 5s 4d Jc",
+			steps: []step{
+				{0, AllIn, 0},
+				{1, AllIn, 0},
+				{2, Call, 0},
+			},
+			payouts: []Payout{{"p2", 0, 150}, {"p2", 1, 100}},
+			chips:   []int{0, 0, 350},
+		},
+		{
+			name:   "a split pot gives the odd chip to the first seat left of the button",
+			stacks: []int{100, 100, 100},
+			holes:  []string{"2c 3d", "4h 5h", "2d 3c"},
+			board:  "As Kd Qh Jc Ts",
+			steps: append([]step{
+				{0, Call, 0},
+				{1, Fold, 0},
+				{2, Check, 0},
+			}, checkDown(2, 0)...),
+			payouts: []Payout{{"p2", 0, 13}, {"p0", 0, 12}},
+			chips:   []int{102, 95, 103},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newHand(t, tt.stacks, tt.holes, tt.board)
+			if tt.blinds != nil {
+				for i, want := range tt.blinds {
+					if got := g.Players[i].Bet; got != want {
+						t.Errorf("seat %d posted %d, want %d", i, got, want)
+					}
+				}
+			}
+			play(t, g, tt.steps)
+			if !reflect.DeepEqual(g.Payouts, tt.payouts) {
+				t.Errorf("payouts %v, want %v", g.Payouts, tt.payouts)
+			}
+			total, want := 0, 0
+			for i, p := range g.Players {
+				total += p.Chips
+				want += tt.stacks[i]
+				if p.Chips != tt.chips[i] {
+					t.Errorf("seat %d has %d chips, want %d", i, p.Chips, tt.chips[i])
+				}
+			}
+			if total != want {
+				t.Errorf("%d chips on the table, started with %d", total, want)
+			}
+		})
+	}
+}
+
+func TestBigBlindOption(t *testing.T) {
+	g := newHand(t, []int{100, 100, 100}, []string{"2c 7d", "3c 8d", "Ah Ad"}, "Kc 9h 5s 4d Jc")
+	g.ProcessAction(Call, 0)
+	g.ProcessAction(Call, 0)
+	if g.CurrentPhase != PreFlop || g.CurrentPos != 2 {
+		t.Fatalf("seat %d to act in %v, want the big blind preflop", g.CurrentPos, g.CurrentPhase)
+	}
+	var legal []PlayerAction
+	for _, a := range g.LegalActions() {
+		legal = append(legal, a.Action)
+	}
+	if want := []PlayerAction{Fold, Check, Raise, AllIn}; !reflect.DeepEqual(legal, want) {
+		t.Errorf("big blind may %v, want %v", legal, want)
+	}
+	g.ProcessAction(Check, 0)
+	if g.CurrentPhase != Flop || g.CurrentPos != 1 {
+		t.Errorf("seat %d to act in %v after the big blind checked, want the small blind on the flop", g.CurrentPos, g.CurrentPhase)
+	}
+}
+
+func TestAllInRaise(t *testing.T) {
+	tests := []struct {
+		name   string
+		button int // the button's stack, all of which it moves in over a raise to 30
+		legal  []PlayerAction
+	}{
+		{"a short all-in raise doesn't reopen the betting", 40, []PlayerAction{Fold, Call}},
+		{"a full all-in raise reopens the betting", 60, []PlayerAction{Fold, Call, Raise, AllIn}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newHand(t, []int{tt.button, 100, 100, 100}, []string{"2c 7d", "3c 8d", "4c 9d", "Ah Ad"}, "Kc 9h 5s 4d Jc")
+			for _, s := range []step{{3, Raise, 20}, {0, AllIn, 0}, {1, Fold, 0}} {
+				if g.CurrentPos != s.seat || !g.ProcessAction(s.action, s.amount) {
+					t.Fatalf("seat %d couldn't %v", s.seat, s.action)
+				}
+			}
+			// The big blind hasn't acted yet, so it may raise either way
+			if !g.mayRaise(2) {
+				t.Errorf("the big blind may not raise")
+			}
+			if !g.ProcessAction(Call, 0) {
+				t.Fatal("the big blind couldn't call")
+			}
+			var legal []PlayerAction
+			for _, a := range g.LegalActions() {
+				legal = append(legal, a.Action)
+			}
+			if g.CurrentPos != 3 || !reflect.DeepEqual(legal, tt.legal) {
+				t.Fatalf("seat %d may %v, want seat 3 to be able to %v", g.CurrentPos, legal, tt.legal)
+			}
+			if reopened := len(tt.legal) > 2; !reopened && (g.ProcessAction(Raise, 20) || g.ProcessAction(AllIn, 0)) {
+				t.Fatal("the raiser raised again after a short all-in")
+			}
+			if !g.ProcessAction(Call, 0) || g.CurrentPhase != Flop {
+				t.Errorf("calling the all-in left seat %d to act in %v", g.CurrentPos, g.CurrentPhase)
+			}
+		})
+	}
+}
@@ -56,105 +56,276 @@ func EvaluateHand(cards []Card) HandEvaluation {
 	if len(cards) < 5 {
 		return HandEvaluation{Rank: HighCard, Cards: cards, Value: 0}
 	}
+	h := analyzeHand(cards)
 
 	// Check for royal flush
-	if royal := checkRoyalFlush(cards); royal.Rank == RoyalFlush {
+	if royal := checkRoyalFlush(h); royal.Rank == RoyalFlush {
 		return royal
 	}
 
 	// Check for straight flush
-	if straightFlush := checkStraightFlush(cards); straightFlush.Rank == StraightFlush {
+	if straightFlush := checkStraightFlush(h); straightFlush.Rank == StraightFlush {
 		return straightFlush
 	}
 
 	// Check for four of a kind
-	if fourOfAKind := checkFourOfAKind(cards); fourOfAKind.Rank == FourOfAKind {
+	if fourOfAKind := checkFourOfAKind(h); fourOfAKind.Rank == FourOfAKind {
 		return fourOfAKind
 	}
 
 	// Check for full house
-	if fullHouse := checkFullHouse(cards); fullHouse.Rank == FullHouse {
+	if fullHouse := checkFullHouse(h); fullHouse.Rank == FullHouse {
 		return fullHouse
 	}
 
 	// Check for flush
-	if flush := checkFlush(cards); flush.Rank == Flush {
+	if flush := checkFlush(h); flush.Rank == Flush {
 		return flush
 	}
 
 	// Check for straight
-	if straight := checkStraight(cards); straight.Rank == Straight {
+	if straight := checkStraight(h.cards); straight.Rank == Straight {
 		return straight
 	}
 
 	// Check for three of a kind
-	if threeOfAKind := checkThreeOfAKind(cards); threeOfAKind.Rank == ThreeOfAKind {
+	if threeOfAKind := checkThreeOfAKind(h); threeOfAKind.Rank == ThreeOfAKind {
 		return threeOfAKind
 	}
 
 	// Check for two pair
-	if twoPair := checkTwoPair(cards); twoPair.Rank == TwoPair {
+	if twoPair := checkTwoPair(h); twoPair.Rank == TwoPair {
 		return twoPair
 	}
 
 	// Check for pair
-	if pair := checkPair(cards); pair.Rank == Pair {
+	if pair := checkPair(h); pair.Rank == Pair {
 		return pair
 	}
 
 	// High card
-	return checkHighCard(cards)
+	return checkHighCard(h)
+}
+
+// handInfo is the analysis of a set of cards that the helpers share, so that
+// the cards are only sorted and counted once
+type handInfo struct {
+	cards  []Card       // ordered from highest to lowest rank
+	counts [Ace + 1]int // cards of each rank
+	groups [5][]Rank    // ranks by how many cards of them there are, highest first
+	flush  []Card       // cards of a suit that appears five or more times, highest first
+}
+
+func analyzeHand(cards []Card) *handInfo {
+	h := &handInfo{cards: sortedByRank(cards)}
+	var suits [Clubs + 1]int
+	for _, c := range h.cards {
+		h.counts[c.Rank]++
+		suits[c.Suit]++
+	}
+	for r := Ace; r >= Two; r-- {
+		if n := h.counts[r]; n > 0 {
+			h.groups[n] = append(h.groups[n], r)
+		}
+	}
+	for suit, n := range suits {
+		if n >= 5 {
+			h.flush = make([]Card, 0, n)
+			for _, c := range h.cards {
+				if c.Suit == Suit(suit) {
+					h.flush = append(h.flush, c)
+				}
+			}
+		}
+	}
+	return h
 }
 
 // Helper functions for hand evaluation
-func checkRoyalFlush(cards []Card) HandEvaluation {
-	// Implementation placeholder
-	return HandEvaluation{Rank: HighCard, Cards: cards, Value: 0}
+//
+// Each helper looks for its category anywhere in the analyzed cards (five to
+// seven of them) and returns HighCard when it is not present. Value packs the
+// ranks that break ties within a category, most significant first, so that two
+// evaluations of the same rank can be compared numerically.
+
+func checkRoyalFlush(h *handInfo) HandEvaluation {
+	if sf := checkStraightFlush(h); sf.Rank == StraightFlush && sf.Cards[0].Rank == Ace {
+		sf.Rank = RoyalFlush
+		return sf
+	}
+	return HandEvaluation{Rank: HighCard, Cards: h.cards, Value: 0}
 }
 
-func checkStraightFlush(cards []Card) HandEvaluation {
-	// Implementation placeholder
-	return HandEvaluation{Rank: HighCard, Cards: cards, Value: 0}
+func checkStraightFlush(h *handInfo) HandEvaluation {
+	if h.flush == nil {
+		return HandEvaluation{Rank: HighCard, Cards: h.cards, Value: 0}
+	}
+	if straight := checkStraight(h.flush); straight.Rank == Straight {
+		straight.Rank = StraightFlush
+		return straight
+	}
+	return HandEvaluation{Rank: HighCard, Cards: h.cards, Value: 0}
 }
 
-func checkFourOfAKind(cards []Card) HandEvaluation {
-	// Implementation placeholder
-	return HandEvaluation{Rank: HighCard, Cards: cards, Value: 0}
+func checkFourOfAKind(h *handInfo) HandEvaluation {
+	if len(h.groups[4]) == 0 {
+		return HandEvaluation{Rank: HighCard, Cards: h.cards, Value: 0}
+	}
+	quads := h.groups[4][0]
+	best := h.pick(4, quads)
+	best = append(best, h.kickers(1, quads)...)
+	return HandEvaluation{Rank: FourOfAKind, Cards: best, Value: packRanks(best[0], best[4])}
 }
 
-func checkFullHouse(cards []Card) HandEvaluation {
-	// Implementation placeholder
-	return HandEvaluation{Rank: HighCard, Cards: cards, Value: 0}
+func checkFullHouse(h *handInfo) HandEvaluation {
+	if len(h.groups[3]) == 0 {
+		return HandEvaluation{Rank: HighCard, Cards: h.cards, Value: 0}
+	}
+	trips := h.groups[3][0]
+	// The pair can come from a second set of trips
+	pair := Rank(0)
+	if len(h.groups[3]) > 1 {
+		pair = h.groups[3][1]
+	}
+	if len(h.groups[2]) > 0 && h.groups[2][0] > pair {
+		pair = h.groups[2][0]
+	}
+	if pair == 0 {
+		return HandEvaluation{Rank: HighCard, Cards: h.cards, Value: 0}
+	}
+	best := h.pick(3, trips)
+	best = append(best, h.pick(2, pair)...)
+	return HandEvaluation{Rank: FullHouse, Cards: best, Value: packRanks(best[0], best[3])}
 }
 
-func checkFlush(cards []Card) HandEvaluation {
-	// Implementation placeholder
-	return HandEvaluation{Rank: HighCard, Cards: cards, Value: 0}
+func checkFlush(h *handInfo) HandEvaluation {
+	if h.flush == nil {
+		return HandEvaluation{Rank: HighCard, Cards: h.cards, Value: 0}
+	}
+	best := append([]Card{}, h.flush[:5]...)
+	return HandEvaluation{Rank: Flush, Cards: best, Value: packRanks(best...)}
 }
 
+// checkStraight takes cards ordered from highest to lowest rank
 func checkStraight(cards []Card) HandEvaluation {
-	// Implementation placeholder
+	var byRank [Ace + 1]int // index into cards plus one
+	for i := len(cards) - 1; i >= 0; i-- {
+		byRank[cards[i].Rank] = i + 1
+	}
+	for high := Ace; high >= Five; high-- {
+		n := 0
+		for r := high; r > high-5; r-- {
+			rank := r
+			if rank < Two {
+				rank = Ace // the wheel, A-2-3-4-5
+			}
+			if byRank[rank] == 0 {
+				break
+			}
+			n++
+		}
+		if n == 5 {
+			best := make([]Card, 0, 5)
+			for r := high; r > high-5; r-- {
+				rank := r
+				if rank < Two {
+					rank = Ace
+				}
+				best = append(best, cards[byRank[rank]-1])
+			}
+			return HandEvaluation{Rank: Straight, Cards: best, Value: int(high)}
+		}
+	}
 	return HandEvaluation{Rank: HighCard, Cards: cards, Value: 0}
 }
 
-func checkThreeOfAKind(cards []Card) HandEvaluation {
-	// Implementation placeholder
-	return HandEvaluation{Rank: HighCard, Cards: cards, Value: 0}
+func checkThreeOfAKind(h *handInfo) HandEvaluation {
+	if len(h.groups[3]) == 0 {
+		return HandEvaluation{Rank: HighCard, Cards: h.cards, Value: 0}
+	}
+	trips := h.groups[3][0]
+	best := h.pick(3, trips)
+	best = append(best, h.kickers(2, trips)...)
+	return HandEvaluation{Rank: ThreeOfAKind, Cards: best, Value: packRanks(best[0], best[3], best[4])}
 }
 
-func checkTwoPair(cards []Card) HandEvaluation {
-	// Implementation placeholder
-	return HandEvaluation{Rank: HighCard, Cards: cards, Value: 0}
+func checkTwoPair(h *handInfo) HandEvaluation {
+	if len(h.groups[2]) < 2 {
+		return HandEvaluation{Rank: HighCard, Cards: h.cards, Value: 0}
+	}
+	high, low := h.groups[2][0], h.groups[2][1]
+	best := h.pick(2, high)
+	best = append(best, h.pick(2, low)...)
+	best = append(best, h.kickers(1, high, low)...)
+	return HandEvaluation{Rank: TwoPair, Cards: best, Value: packRanks(best[0], best[2], best[4])}
 }
 
-func checkPair(cards []Card) HandEvaluation {
-	// Implementation placeholder
-	return HandEvaluation{Rank: HighCard, Cards: cards, Value: 0}
+func checkPair(h *handInfo) HandEvaluation {
+	if len(h.groups[2]) == 0 {
+		return HandEvaluation{Rank: HighCard, Cards: h.cards, Value: 0}
+	}
+	pair := h.groups[2][0]
+	best := h.pick(2, pair)
+	best = append(best, h.kickers(3, pair)...)
+	return HandEvaluation{Rank: Pair, Cards: best, Value: packRanks(best[0], best[2], best[3], best[4])}
 }
 
-func checkHighCard(cards []Card) HandEvaluation {
-	// Implementation placeholder
-	return HandEvaluation{Rank: HighCard, Cards: cards, Value: 0}
+func checkHighCard(h *handInfo) HandEvaluation {
+	best := append([]Card{}, h.cards[:5]...)
+	return HandEvaluation{Rank: HighCard, Cards: best, Value: packRanks(best...)}
+}
+
+// pick returns n cards of the given rank
+func (h *handInfo) pick(n int, rank Rank) []Card {
+	picked := make([]Card, 0, 5)
+	for _, c := range h.cards {
+		if c.Rank == rank && len(picked) < n {
+			picked = append(picked, c)
+		}
+	}
+	return picked
+}
+
+// kickers returns the n highest cards whose rank is not in exclude
+func (h *handInfo) kickers(n int, exclude ...Rank) []Card {
+	kickers := make([]Card, 0, n)
+	for _, c := range h.cards {
+		if len(kickers) == n {
+			break
+		}
+		excluded := false
+		for _, r := range exclude {
+			if c.Rank == r {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kickers = append(kickers, c)
+		}
+	}
+	return kickers
+}
+
+// sortedByRank returns a copy of cards ordered from highest to lowest rank
+func sortedByRank(cards []Card) []Card {
+	sorted := append([]Card{}, cards...)
+	// Insertion sort, hands are at most seven cards
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && sorted[j].Rank > sorted[j-1].Rank; j-- {
+			sorted[j], sorted[j-1] = sorted[j-1], sorted[j]
+		}
+	}
+	return sorted
+}
+
+// packRanks encodes the ranks of cards as base-16 digits
+func packRanks(cards ...Card) int {
+	value := 0
+	for _, c := range cards {
+		value = value<<4 | int(c.Rank)
+	}
+	return value
 }
 
 // CompareHands compares two hand evaluations and returns:
@@ -0,0 +1,39 @@
+package game
+
+import "testing"
+
+func TestEvaluateHand(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		rank HandRank // of a
+		cmp  int      // CompareHands of a and b
+	}{
+		{"the wheel is a straight", "Ah 2c 3d 4s 5h 9c Kd", "Ah Ad 3d 4s 9h Tc Kd", Straight, 1},
+		{"the wheel is the lowest straight", "Ah 2c 3d 4s 5h 9c Kd", "2h 3c 4d 5s 6h 9c Kd", Straight, -1},
+		{"broadway beats the wheel", "Ah Kc Qd Js Th 2c 3d", "Ah 2c 3d 4s 5h 9c Kd", Straight, 1},
+		{"a suited wheel is a straight flush", "Ah 2h 3h 4h 5h 9c Kd", "9h Th Jh Qh Kh 2c 3d", StraightFlush, -1},
+		{"a royal flush beats a straight flush", "Ah Kh Qh Jh Th 2c 3d", "9h Th Jh Qh Kh 2c 3d", RoyalFlush, 1},
+		{"a flush beats a straight in the same cards", "2h 7h 9h Jh Kh 8c Td", "7c 8d 9s Th Jc 2d 3h", Flush, 1},
+		{"a flush plays its five highest cards", "Ah 2h 4h 6h 8h Th 3c", "Ah 2h 4h 6h 9h 3c 5d", Flush, 1},
+		{"a hole card beats a flush on the board", "3c 4c Ah 9h 7h 4h 2h", "Kh 2c Ah 9h 7h 4h 2h", Flush, -1},
+		{"a flush on the board splits", "3c 4d Ah 9h 7h 4h 2h", "5c 6d Ah 9h 7h 4h 2h", Flush, 0},
+		{"a full house beats a flush", "Ah Ad As Kh Kd 2h 3h", "2h 7h 9h Jh Kh 8c Td", FullHouse, 1},
+		{"two pair plays the best kicker", "Ah Ad Kh Kd Qc 2s 2c", "Ah Ad Kh Kd Jc 2s 2c", TwoPair, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := EvaluateHand(parseCards(t, tt.a))
+			b := EvaluateHand(parseCards(t, tt.b))
+			if a.Rank != tt.rank {
+				t.Errorf("%s is %v, want %v", tt.a, a.Rank, tt.rank)
+			}
+			if len(a.Cards) != 5 {
+				t.Errorf("%s plays %d cards", tt.a, len(a.Cards))
+			}
+			if got := CompareHands(a, b); got != tt.cmp {
+				t.Errorf("%s (%v) against %s (%v) compares %d, want %d", tt.a, a.Rank, tt.b, b.Rank, got, tt.cmp)
+			}
+		})
+	}
+}
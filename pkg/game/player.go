@@ -44,13 +44,14 @@ const (
 
 // Player represents a player in the game
 type Player struct {
-	ID       string
-	Name     string
-	Chips    int
-	Cards    []Card
-	Bet      int
-	Status   PlayerStatus
-	Position int
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Chips    int          `json:"chips"`
+	Cards    []Card       `json:"cards"`
+	Bet      int          `json:"bet"`       // Chips put in during the current betting round
+	TotalBet int          `json:"total_bet"` // Chips put in during the whole hand
+	Status   PlayerStatus `json:"status"`
+	Position int          `json:"position"`
 }
 
 // NewPlayer creates a new player
@@ -61,6 +62,7 @@ func NewPlayer(id, name string, chips int, position int) *Player {
 		Chips:    chips,
 		Cards:    make([]Card, 0),
 		Bet:      0,
+		TotalBet: 0,
 		Status:   Active,
 		Position: position,
 	}
@@ -68,10 +70,11 @@ func NewPlayer(id, name string, chips int, position int) *Player {
 
 // PlaceBet places a bet for the player
 func (p *Player) PlaceBet(amount int) bool {
-	if amount > p.Chips {
+	if amount < 0 || amount > p.Chips {
 		return false
 	}
 	p.Bet += amount
+	p.TotalBet += amount
 	p.Chips -= amount
 	if p.Chips == 0 {
 		p.Status = AllInStatus
@@ -93,6 +96,7 @@ func (p *Player) Fold() {
 func (p *Player) ResetForNewHand() {
 	p.Cards = make([]Card, 0)
 	p.Bet = 0
+	p.TotalBet = 0
 	if p.Chips > 0 {
 		p.Status = Active
 	} else {
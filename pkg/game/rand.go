@@ -0,0 +1,26 @@
+package game
+
+// splitMix64 is a small rand.Source64. Unlike the default source it is
+// seeded in constant time, which matters when every hand gets its own seed.
+type splitMix64 struct {
+	state uint64
+}
+
+// Seed resets the source
+func (s *splitMix64) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+// Uint64 returns the next value
+func (s *splitMix64) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Int63 returns the next value as a non-negative int64
+func (s *splitMix64) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
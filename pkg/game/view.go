@@ -0,0 +1,106 @@
+package game
+
+// Spectator is the viewer ID of a view for someone who isn't playing
+const Spectator = ""
+
+// View is what one seat, or a spectator, may see of the table: the board,
+// the stacks and bets, their own hole cards and the cards shown at showdown.
+// It holds no pointers into the game and never includes the deck, so it can
+// be sent over the network as it is.
+type View struct {
+	Viewer     string        `json:"viewer,omitempty"` // the viewing player's ID, Spectator for spectators
+	Seat       int           `json:"seat"`             // the viewer's seat, -1 for spectators
+	Phase      GamePhase     `json:"phase"`
+	Board      []Card        `json:"board"`
+	Pot        int           `json:"pot"`
+	CurrentBet int           `json:"current_bet"`
+	MinRaise   int           `json:"min_raise"`
+	SmallBlind int           `json:"small_blind"`
+	BigBlind   int           `json:"big_blind"`
+	DealerPos  int           `json:"dealer_pos"`
+	CurrentPos int           `json:"current_pos"`
+	HandOver   bool          `json:"hand_over"`
+	Players    []SeatView    `json:"players"`
+	Legal      []LegalAction `json:"legal,omitempty"` // only when the viewer is to act
+	Payouts    []Payout      `json:"payouts,omitempty"`
+}
+
+// SeatView is one player as seen in a View. Cards is empty unless the viewer
+// holds them or they were shown at showdown.
+type SeatView struct {
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Chips    int          `json:"chips"`
+	Bet      int          `json:"bet"`
+	TotalBet int          `json:"total_bet"`
+	Status   PlayerStatus `json:"status"`
+	HasCards bool         `json:"has_cards"` // whether the player holds cards, seen or not
+	Cards    []Card       `json:"cards,omitempty"`
+	Shown    bool         `json:"shown,omitempty"` // the cards were shown at showdown
+}
+
+// View returns what the player with the given ID may see. An ID that isn't
+// seated, such as Spectator, gets the spectator's view.
+func (g *GameState) View(playerID string) *View {
+	if playerID != Spectator {
+		for i, p := range g.Players {
+			if p.ID == playerID {
+				return g.ViewSeat(i)
+			}
+		}
+	}
+	return g.ViewSeat(-1)
+}
+
+// ViewSeat returns what the player at seat may see, or the spectator's view
+// if seat is -1
+func (g *GameState) ViewSeat(seat int) *View {
+	if seat < 0 || seat >= len(g.Players) {
+		seat = -1
+	}
+	v := &View{
+		Seat:       seat,
+		Phase:      g.CurrentPhase,
+		Board:      append([]Card{}, g.CommunityCards...),
+		Pot:        g.Pot,
+		CurrentBet: g.CurrentBet,
+		MinRaise:   g.MinRaise,
+		SmallBlind: g.SmallBlind,
+		BigBlind:   g.BigBlind,
+		DealerPos:  g.DealerPos,
+		CurrentPos: g.CurrentPos,
+		HandOver:   g.IsHandOver(),
+		Payouts:    append([]Payout(nil), g.Payouts...),
+	}
+	if seat >= 0 {
+		v.Viewer = g.Players[seat].ID
+	}
+	showdown := g.CurrentPhase == Showdown
+	for i, p := range g.Players {
+		s := SeatView{
+			ID:       p.ID,
+			Name:     p.Name,
+			Chips:    p.Chips,
+			Bet:      p.Bet,
+			TotalBet: p.TotalBet,
+			Status:   p.Status,
+			HasCards: len(p.Cards) > 0 && p.CanAct(),
+		}
+		switch {
+		case showdown && p.CanAct():
+			s.Cards, s.Shown = append([]Card{}, p.Cards...), len(p.Cards) > 0
+		case i == seat:
+			s.Cards = append([]Card{}, p.Cards...)
+		}
+		v.Players = append(v.Players, s)
+	}
+	if seat >= 0 && seat == g.CurrentPos && !v.HandOver {
+		v.Legal = g.LegalActions()
+	}
+	return v
+}
+
+// SpectatorView returns what someone watching the table may see
+func (g *GameState) SpectatorView() *View {
+	return g.ViewSeat(-1)
+}
@@ -0,0 +1,156 @@
+// Package history records played hands and reads and writes them in
+// standard hand history formats.
+package history
+
+import (
+	"time"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// UncalledBetPot is the Payout.Pot value for a returned uncalled bet
+const UncalledBetPot = game.UncalledBetPot
+
+// Hand is a complete record of one hand of no-limit hold'em
+type Hand struct {
+	ID         string
+	Site       string
+	Table      string
+	Time       time.Time
+	SmallBlind int
+	BigBlind   int
+	MaxSeats   int
+	ButtonSeat int    // seat number of the button
+	Hero       int    // seat the history was written for, 0 when every hole card is known
+	Currency   string // ISO code such as "USD" when amounts are cents, empty for chips
+	Rake       int    // taken from the pot, not included in Payouts
+	Seats      []Seat
+	Blinds     []Blind
+	Actions    []Action
+	Board      []game.Card
+	Payouts    []Payout
+}
+
+// Seat is a player dealt into the hand. Seat numbers start at 1.
+type Seat struct {
+	Number   int
+	PlayerID string
+	Name     string
+	Stack    int         // chips at the start of the hand
+	Cards    []game.Card // hole cards, empty when unknown
+	Shown    bool        // the cards were shown at showdown
+}
+
+// Blind is a forced bet posted before the cards are dealt
+type Blind struct {
+	Seat   int
+	Amount int
+	Big    bool
+}
+
+// Action is a player's action. Action is never game.AllIn: all-in moves are
+// recorded as the bet, raise or call they amount to, with AllIn set.
+type Action struct {
+	Street game.GamePhase
+	Seat   int
+	Action game.PlayerAction
+	Amount int  // chips put in by the action
+	To     int  // the player's bet on the street after the action
+	AllIn  bool // the action put the player all-in
+}
+
+// Payout is chips collected at the end of the hand. Pot is 0 for the main
+// pot, 1 and up for side pots and UncalledBetPot for a returned bet.
+type Payout struct {
+	Seat   int
+	Pot    int
+	Amount int
+}
+
+// Seat returns the seat with the given number, or nil
+func (h *Hand) Seat(number int) *Seat {
+	for i := range h.Seats {
+		if h.Seats[i].Number == number {
+			return &h.Seats[i]
+		}
+	}
+	return nil
+}
+
+// TotalPot returns the chips won from pots, not counting returned bets
+func (h *Hand) TotalPot() int {
+	total := 0
+	for _, p := range h.Payouts {
+		if p.Pot != UncalledBetPot {
+			total += p.Amount
+		}
+	}
+	return total
+}
+
+// FoldedOn returns the street a seat folded on, and false if it never folded
+func (h *Hand) FoldedOn(seat int) (game.GamePhase, bool) {
+	for _, a := range h.Actions {
+		if a.Seat == seat && a.Action == game.Fold {
+			return a.Street, true
+		}
+	}
+	return 0, false
+}
+
+// WentToShowdown returns whether more than one player was left at the end
+func (h *Hand) WentToShowdown() bool {
+	left := 0
+	for _, s := range h.Seats {
+		if _, folded := h.FoldedOn(s.Number); !folded {
+			left++
+		}
+	}
+	return left > 1
+}
+
+// Won returns the chips a seat collected from pots
+func (h *Hand) Won(seat int) int {
+	won := 0
+	for _, p := range h.Payouts {
+		if p.Seat == seat && p.Pot != UncalledBetPot {
+			won += p.Amount
+		}
+	}
+	return won
+}
+
+// Invested returns the chips a seat put into the pot, net of any bet that
+// was returned to it
+func (h *Hand) Invested(seat int) int {
+	total := 0
+	for _, b := range h.Blinds {
+		if b.Seat == seat {
+			total += b.Amount
+		}
+	}
+	for _, a := range h.Actions {
+		if a.Seat == seat {
+			total += a.Amount
+		}
+	}
+	for _, p := range h.Payouts {
+		if p.Seat == seat && p.Pot == UncalledBetPot {
+			total -= p.Amount
+		}
+	}
+	return total
+}
+
+// Evaluate returns the best hand a seat can make with the board, and false
+// when its cards are unknown
+func (h *Hand) Evaluate(seat int) (game.HandEvaluation, bool) {
+	s := h.Seat(seat)
+	if s == nil || len(s.Cards) == 0 {
+		return game.HandEvaluation{}, false
+	}
+	cards := make([]game.Card, 0, len(s.Cards)+len(h.Board))
+	cards = append(cards, s.Cards...)
+	cards = append(cards, h.Board...)
+	return game.EvaluateHand(cards), true
+}
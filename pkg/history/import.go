@@ -0,0 +1,98 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode"
+)
+
+// ImportResult is the outcome of importing a hand history file
+type ImportResult struct {
+	Hands    []*Hand // hands that parsed and replayed cleanly
+	Rejected []error // why each other hand was left out
+}
+
+// Import reads a file of PokerStars or OpenHH hand histories, telling the
+// formats apart by their content, and validates every hand by replaying it.
+// OpenHH hands are checked against the schema first.
+// Hands that fail to parse or replay are left out and reported in Rejected.
+// The error is for failing to read the file, or for an OpenHH file that
+// stops being valid JSON, which can't be read past; the hands before that
+// point are still returned.
+func Import(r io.Reader) (*ImportResult, error) {
+	br := bufio.NewReader(r)
+	first, err := firstRune(br)
+	if errors.Is(err, io.EOF) {
+		return &ImportResult{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ImportResult{}
+	add := func(h *Hand, err error) {
+		if err == nil {
+			if err = h.Validate(); err != nil {
+				err = fmt.Errorf("hand %s: %w", h.ID, err)
+			}
+		}
+		if err != nil {
+			res.Rejected = append(res.Rejected, err)
+			return
+		}
+		res.Hands = append(res.Hands, h)
+	}
+
+	if first == '{' {
+		dec := json.NewDecoder(br)
+		for n := 1; ; n++ {
+			var raw json.RawMessage
+			err := dec.Decode(&raw)
+			if errors.Is(err, io.EOF) {
+				return res, nil
+			}
+			if err != nil {
+				// The rest of the file can't be resynchronized
+				return res, err
+			}
+			var f ohhFile
+			if err := ValidateOpenHH(raw); err != nil {
+				add(nil, fmt.Errorf("object %d: %w", n, err))
+			} else if err := json.Unmarshal(raw, &f); err != nil {
+				add(nil, fmt.Errorf("object %d: %w", n, err))
+			} else {
+				add(f.OHH.hand())
+			}
+		}
+	}
+
+	texts, err := splitPokerStars(br)
+	if err != nil {
+		return res, err
+	}
+	for _, t := range texts {
+		h, err := ParsePokerStars(t.text)
+		if err != nil {
+			err = fmt.Errorf("line %d: %w", t.line, err)
+		}
+		add(h, err)
+	}
+	return res, nil
+}
+
+// firstRune returns the first character that isn't space or a byte order
+// mark, leaving it unread
+func firstRune(br *bufio.Reader) (rune, error) {
+	for {
+		c, _, err := br.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if c != '\ufeff' && !unicode.IsSpace(c) {
+			return c, br.UnreadRune()
+		}
+	}
+}
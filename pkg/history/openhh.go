@@ -0,0 +1,508 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// ohhFile is one hand in Open Hand History (OpenHH) JSON, see
+// https://hh-specs.handhistory.org
+type ohhFile struct {
+	OHH ohhHand `json:"ohh"`
+}
+
+type ohhHand struct {
+	SpecVersion      string      `json:"spec_version"`
+	SiteName         string      `json:"site_name"`
+	NetworkName      string      `json:"network_name"`
+	InternalVersion  string      `json:"internal_version"`
+	Tournament       bool        `json:"tournament"`
+	GameNumber       ohhString   `json:"game_number"`
+	StartDateUTC     string      `json:"start_date_utc"`
+	TableName        string      `json:"table_name"`
+	GameType         string      `json:"game_type"`
+	BetLimit         ohhBetLimit `json:"bet_limit"`
+	TableSize        int         `json:"table_size"`
+	Currency         string      `json:"currency,omitempty"`
+	DealerSeat       int         `json:"dealer_seat"`
+	SmallBlindAmount float64     `json:"small_blind_amount"`
+	BigBlindAmount   float64     `json:"big_blind_amount"`
+	AnteAmount       float64     `json:"ante_amount"`
+	HeroPlayerID     *int        `json:"hero_player_id,omitempty"`
+	Players          []ohhPlayer `json:"players"`
+	Rounds           []ohhRound  `json:"rounds"`
+	Pots             []ohhPot    `json:"pots"`
+}
+
+type ohhBetLimit struct {
+	BetType string  `json:"bet_type"`
+	BetCap  float64 `json:"bet_cap"`
+}
+
+type ohhPlayer struct {
+	ID            int     `json:"id"`
+	Seat          int     `json:"seat"`
+	Name          string  `json:"name"`
+	Display       string  `json:"display,omitempty"`
+	StartingStack float64 `json:"starting_stack"`
+}
+
+type ohhRound struct {
+	ID      int         `json:"id"`
+	Street  string      `json:"street"`
+	Cards   []string    `json:"cards,omitempty"`
+	Actions []ohhAction `json:"actions"`
+}
+
+// ohhAction is an action. Amount is the chips the action puts in, except
+// for a raise, where it is the amount raised to.
+type ohhAction struct {
+	ActionNumber int      `json:"action_number"`
+	PlayerID     int      `json:"player_id"`
+	Action       string   `json:"action"`
+	Amount       float64  `json:"amount,omitempty"`
+	IsAllIn      bool     `json:"is_allin,omitempty"`
+	Cards        []string `json:"cards,omitempty"`
+}
+
+type ohhPot struct {
+	Number     int      `json:"number"`
+	Amount     float64  `json:"amount"`
+	Rake       float64  `json:"rake"`
+	PlayerWins []ohhWin `json:"player_wins"`
+}
+
+type ohhWin struct {
+	PlayerID        int     `json:"player_id"`
+	WinAmount       float64 `json:"win_amount"`
+	ContributedRake float64 `json:"contributed_rake"`
+}
+
+// ohhString accepts a JSON string or number, since sites write game numbers
+// both ways
+type ohhString string
+
+func (s *ohhString) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = ohhString(str)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*s = ohhString(n)
+	return nil
+}
+
+var ohhStreets = map[string]game.GamePhase{
+	"Preflop":  game.PreFlop,
+	"Flop":     game.Flop,
+	"Turn":     game.Turn,
+	"River":    game.River,
+	"Showdown": game.Showdown,
+}
+
+// ReadOpenHH parses a file of OpenHH hands, one JSON object per hand. It
+// stops at the first hand that can't be parsed.
+func ReadOpenHH(r io.Reader) ([]*Hand, error) {
+	var hands []*Hand
+	dec := json.NewDecoder(r)
+	for {
+		var f ohhFile
+		err := dec.Decode(&f)
+		if errors.Is(err, io.EOF) {
+			return hands, nil
+		}
+		if err != nil {
+			return hands, err
+		}
+		h, err := f.OHH.hand()
+		if err != nil {
+			return hands, err
+		}
+		hands = append(hands, h)
+	}
+}
+
+// ohhReader holds the state of converting one OpenHH hand
+type ohhReader struct {
+	h     *Hand
+	scale float64
+	seats map[int]int // player id to seat number
+	bets  map[int]int // each seat's bet on the current street
+}
+
+// amount converts a decimal amount to chips, or to cents for money games
+func (o *ohhReader) amount(x float64) (int, error) {
+	v := x * o.scale
+	n := math.Round(v)
+	if math.Abs(v-n) > 1e-6 || n < 0 {
+		return 0, fmt.Errorf("invalid amount %v", x)
+	}
+	return int(n), nil
+}
+
+// seat returns the seat number of a player id
+func (o *ohhReader) seat(id int) (int, error) {
+	s, ok := o.seats[id]
+	if !ok {
+		return 0, fmt.Errorf("unknown player id %d", id)
+	}
+	return s, nil
+}
+
+// hand converts an OpenHH hand into a Hand
+func (oh *ohhHand) hand() (*Hand, error) {
+	id := string(oh.GameNumber)
+	if oh.GameType != "Holdem" || oh.BetLimit.BetType != "NL" {
+		return nil, fmt.Errorf("hand %s: %w: %s %s", id, ErrUnsupported, oh.BetLimit.BetType, oh.GameType)
+	}
+	if oh.AnteAmount > 0 {
+		return nil, fmt.Errorf("hand %s: %w: antes", id, ErrUnsupported)
+	}
+	h := &Hand{
+		ID:         id,
+		Site:       oh.SiteName,
+		Table:      oh.TableName,
+		MaxSeats:   oh.TableSize,
+		ButtonSeat: oh.DealerSeat,
+	}
+	o := &ohhReader{h: h, scale: 1, seats: map[int]int{}, bets: map[int]int{}}
+	if oh.Currency != "" && !oh.Tournament {
+		h.Currency = oh.Currency
+		o.scale = 100
+	}
+	h.Time, _ = time.Parse(time.RFC3339, oh.StartDateUTC)
+	if err := o.convert(oh); err != nil {
+		return nil, fmt.Errorf("hand %s: %w", id, err)
+	}
+	return h, nil
+}
+
+func (o *ohhReader) convert(oh *ohhHand) error {
+	h := o.h
+	var err error
+	if h.SmallBlind, err = o.amount(oh.SmallBlindAmount); err != nil {
+		return err
+	}
+	if h.BigBlind, err = o.amount(oh.BigBlindAmount); err != nil {
+		return err
+	}
+	for _, p := range oh.Players {
+		stack, err := o.amount(p.StartingStack)
+		if err != nil {
+			return err
+		}
+		h.Seats = append(h.Seats, Seat{Number: p.Seat, PlayerID: strconv.Itoa(p.ID), Name: p.Name, Stack: stack})
+		o.seats[p.ID] = p.Seat
+	}
+	sort.Slice(h.Seats, func(i, j int) bool { return h.Seats[i].Number < h.Seats[j].Number })
+	if oh.HeroPlayerID != nil {
+		h.Hero = o.seats[*oh.HeroPlayerID]
+	}
+
+	for _, round := range oh.Rounds {
+		street, ok := ohhStreets[round.Street]
+		if !ok {
+			return fmt.Errorf("unknown street %q", round.Street)
+		}
+		cards, err := parseCardCodes(round.Cards)
+		if err != nil {
+			return err
+		}
+		h.Board = append(h.Board, cards...)
+		if street != game.PreFlop {
+			o.bets = map[int]int{}
+		}
+		for _, a := range round.Actions {
+			if err := o.action(street, a); err != nil {
+				return fmt.Errorf("action %d: %w", a.ActionNumber, err)
+			}
+		}
+	}
+
+	for _, pot := range oh.Pots {
+		rake, err := o.amount(pot.Rake)
+		if err != nil {
+			return err
+		}
+		h.Rake += rake
+		for _, w := range pot.PlayerWins {
+			seat, err := o.seat(w.PlayerID)
+			if err != nil {
+				return err
+			}
+			amount, err := o.amount(w.WinAmount)
+			if err != nil {
+				return err
+			}
+			h.Payouts = append(h.Payouts, Payout{Seat: seat, Pot: pot.Number, Amount: amount})
+		}
+	}
+	// OpenHH has no uncalled bets, they are simply not part of any pot
+	if seat, amount := uncalledBet(h); amount > 0 {
+		h.Payouts = append([]Payout{{Seat: seat, Pot: UncalledBetPot, Amount: amount}}, h.Payouts...)
+	}
+	return nil
+}
+
+// action converts one OpenHH action
+func (o *ohhReader) action(street game.GamePhase, a ohhAction) error {
+	h := o.h
+	seat, err := o.seat(a.PlayerID)
+	if err != nil {
+		return err
+	}
+	amount, err := o.amount(a.Amount)
+	if err != nil {
+		return err
+	}
+	add := func(action game.PlayerAction, amount, to int) {
+		h.Actions = append(h.Actions, Action{
+			Street: street,
+			Seat:   seat,
+			Action: action,
+			Amount: amount,
+			To:     to,
+			AllIn:  a.IsAllIn,
+		})
+		o.bets[seat] = to
+	}
+
+	switch a.Action {
+	case "Dealt Card", "Dealt Cards", "Shows Cards", "Mucks Cards":
+		cards, err := parseCardCodes(a.Cards)
+		if err != nil {
+			return err
+		}
+		s := h.Seat(seat)
+		if len(cards) > 0 {
+			s.Cards = cards
+		}
+		s.Shown = s.Shown || a.Action == "Shows Cards"
+	case "Post SB", "Post BB":
+		h.Blinds = append(h.Blinds, Blind{Seat: seat, Amount: amount, Big: a.Action == "Post BB"})
+		o.bets[seat] += amount
+	case "Post Ante", "Post Dead", "Post Extra Blind", "Straddle", "Added To Pot":
+		return fmt.Errorf("%w: %s", ErrUnsupported, a.Action)
+	case "Fold":
+		add(game.Fold, 0, o.bets[seat])
+	case "Check":
+		add(game.Check, 0, o.bets[seat])
+	case "Call":
+		add(game.Call, amount, o.bets[seat]+amount)
+	case "Bet":
+		add(game.Bet, amount, amount)
+	case "Raise":
+		add(game.Raise, amount-o.bets[seat], amount)
+	}
+	return nil
+}
+
+// uncalledBet works out the bet returned to the player who put in the most,
+// which is whatever nobody else matched
+func uncalledBet(h *Hand) (int, int) {
+	seat, most, second := 0, 0, 0
+	for _, s := range h.Seats {
+		in := h.Invested(s.Number)
+		switch {
+		case in > most:
+			seat, most, second = s.Number, in, most
+		case in > second:
+			second = in
+		}
+	}
+	return seat, most - second
+}
+
+// parseCardCodes parses card codes, skipping hidden cards such as "??"
+func parseCardCodes(codes []string) ([]game.Card, error) {
+	var cards []game.Card
+	for _, code := range codes {
+		if code == "" || code[0] == '?' || code[0] == 'X' || code[0] == 'x' {
+			continue
+		}
+		c, err := game.ParseCard(code)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, c)
+	}
+	return cards, nil
+}
+
+// openHHVersion is the version of the OpenHH spec written
+const openHHVersion = "1.4.6"
+
+var ohhStreetNames = map[game.GamePhase]string{
+	game.PreFlop:  "Preflop",
+	game.Flop:     "Flop",
+	game.Turn:     "Turn",
+	game.River:    "River",
+	game.Showdown: "Showdown",
+}
+
+var ohhActionNames = map[game.PlayerAction]string{
+	game.Fold:  "Fold",
+	game.Check: "Check",
+	game.Call:  "Call",
+	game.Bet:   "Bet",
+	game.Raise: "Raise",
+}
+
+// WriteOpenHH writes a hand as an OpenHH JSON object on one line, followed
+// by the blank line that separates hands in an OpenHH file
+func WriteOpenHH(w io.Writer, h *Hand) error {
+	data, err := MarshalOpenHH(h)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n', '\n'))
+	return err
+}
+
+// MarshalOpenHH encodes a hand as an OpenHH JSON object and checks the
+// result against the OpenHH schema
+func MarshalOpenHH(h *Hand) ([]byte, error) {
+	data, err := json.Marshal(ohhFile{OHH: toOpenHH(h)})
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateOpenHH(data); err != nil {
+		return nil, fmt.Errorf("hand %s: %w", h.ID, err)
+	}
+	return data, nil
+}
+
+// toOpenHH converts a hand, numbering players by their place in Seats
+func toOpenHH(h *Hand) ohhHand {
+	scale := 1.0
+	if h.Currency != "" {
+		scale = 100
+	}
+	amount := func(n int) float64 { return float64(n) / scale }
+	ids := make(map[int]int, len(h.Seats))
+
+	oh := ohhHand{
+		SpecVersion:      openHHVersion,
+		SiteName:         h.Site,
+		NetworkName:      h.Site,
+		InternalVersion:  openHHVersion,
+		GameNumber:       ohhString(h.ID),
+		StartDateUTC:     h.Time.UTC().Format(time.RFC3339),
+		TableName:        h.Table,
+		GameType:         "Holdem",
+		BetLimit:         ohhBetLimit{BetType: "NL"},
+		TableSize:        h.MaxSeats,
+		Currency:         h.Currency,
+		DealerSeat:       h.ButtonSeat,
+		SmallBlindAmount: amount(h.SmallBlind),
+		BigBlindAmount:   amount(h.BigBlind),
+		Players:          []ohhPlayer{},
+		Rounds:           []ohhRound{},
+		Pots:             []ohhPot{},
+	}
+	for i, s := range h.Seats {
+		ids[s.Number] = i
+		oh.Players = append(oh.Players, ohhPlayer{
+			ID:            i,
+			Seat:          s.Number,
+			Name:          s.Name,
+			StartingStack: amount(s.Stack),
+		})
+	}
+	if id, ok := ids[h.Hero]; ok {
+		oh.HeroPlayerID = &id
+	}
+
+	number := 0
+	act := func(r *ohhRound, seat int, action string, amt int, allIn bool, cards []game.Card) {
+		number++
+		a := ohhAction{
+			ActionNumber: number,
+			PlayerID:     ids[seat],
+			Action:       action,
+			Amount:       amount(amt),
+			IsAllIn:      allIn,
+		}
+		for _, c := range cards {
+			a.Cards = append(a.Cards, c.Code())
+		}
+		r.Actions = append(r.Actions, a)
+	}
+
+	preflop := ohhRound{Street: "Preflop", Actions: []ohhAction{}}
+	for _, b := range h.Blinds {
+		kind := "Post SB"
+		if b.Big {
+			kind = "Post BB"
+		}
+		s := h.Seat(b.Seat)
+		act(&preflop, b.Seat, kind, b.Amount, s != nil && b.Amount == s.Stack, nil)
+	}
+	for _, s := range h.Seats {
+		if len(s.Cards) > 0 && (h.Hero == 0 || h.Hero == s.Number) {
+			act(&preflop, s.Number, "Dealt Cards", 0, false, s.Cards)
+		}
+	}
+	rounds := []*ohhRound{&preflop}
+	last := boardStreet(len(h.Board))
+	for street := game.Flop; street <= last; street++ {
+		r := &ohhRound{ID: len(rounds), Street: ohhStreetNames[street], Actions: []ohhAction{}}
+		lo, hi := 0, 3
+		if street > game.Flop {
+			lo, hi = int(street)+1, int(street)+2
+		}
+		for _, c := range h.Board[lo:hi] {
+			r.Cards = append(r.Cards, c.Code())
+		}
+		rounds = append(rounds, r)
+	}
+	for _, a := range h.Actions {
+		if int(a.Street) >= len(rounds) {
+			continue
+		}
+		amt := a.Amount
+		if a.Action == game.Raise {
+			amt = a.To
+		}
+		act(rounds[a.Street], a.Seat, ohhActionNames[a.Action], amt, a.AllIn, nil)
+	}
+	if h.WentToShowdown() {
+		r := &ohhRound{ID: len(rounds), Street: "Showdown", Actions: []ohhAction{}}
+		for _, s := range h.Seats {
+			if s.Shown {
+				act(r, s.Number, "Shows Cards", 0, false, s.Cards)
+			}
+		}
+		rounds = append(rounds, r)
+	}
+	for _, r := range rounds {
+		oh.Rounds = append(oh.Rounds, *r)
+	}
+
+	for i, total := range potTotals(h) {
+		pot := ohhPot{Number: i, Amount: amount(total), PlayerWins: []ohhWin{}}
+		if i == 0 {
+			// The rake is all taken from the main pot
+			pot.Amount, pot.Rake = amount(total+h.Rake), amount(h.Rake)
+		}
+		for _, p := range h.Payouts {
+			if p.Pot == i {
+				pot.PlayerWins = append(pot.PlayerWins, ohhWin{PlayerID: ids[p.Seat], WinAmount: amount(p.Amount)})
+			}
+		}
+		oh.Pots = append(oh.Pots, pot)
+	}
+	return oh
+}
@@ -0,0 +1,303 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// jsonType is a JSON Schema type
+type jsonType int
+
+const (
+	jsonString jsonType = iota
+	jsonNumber
+	jsonInteger
+	jsonBoolean
+	jsonObject
+	jsonArray
+)
+
+var jsonTypeNames = [...]string{"string", "number", "integer", "boolean", "object", "array"}
+
+// schema is the subset of JSON Schema the OpenHH schema uses
+type schema struct {
+	typ        jsonType
+	required   []string
+	properties map[string]*schema
+	items      *schema
+	enum       []string
+	pattern    *regexp.Regexp
+	dateTime   bool
+	minimum    *float64
+}
+
+func zero() *float64 {
+	z := 0.0
+	return &z
+}
+
+var (
+	ohhCardSchema   = &schema{typ: jsonString, pattern: regexp.MustCompile(`^([2-9TJQKA][cdhs]|\?\?)$`)}
+	ohhCardsSchema  = &schema{typ: jsonArray, items: ohhCardSchema}
+	ohhAmountSchema = &schema{typ: jsonNumber, minimum: zero()}
+)
+
+// ohhSchema is a hand copy of the parts of the published OpenHH JSON schema
+// this package reads and writes, not the schema itself. It checks types,
+// required fields, enums and card codes, but anything the spec adds or
+// changes has to be copied here by hand, and checking our own output
+// against it only catches mistakes the two don't share. The tests also
+// validate a hand laid out like the spec's examples.
+var ohhSchema = &schema{
+	typ:      jsonObject,
+	required: []string{"ohh"},
+	properties: map[string]*schema{
+		"ohh": {
+			typ: jsonObject,
+			required: []string{
+				"spec_version", "site_name", "network_name", "internal_version",
+				"tournament", "game_number", "start_date_utc", "table_name",
+				"game_type", "bet_limit", "table_size", "dealer_seat",
+				"small_blind_amount", "big_blind_amount", "ante_amount",
+				"players", "rounds", "pots",
+			},
+			properties: map[string]*schema{
+				"spec_version":     {typ: jsonString},
+				"site_name":        {typ: jsonString},
+				"network_name":     {typ: jsonString},
+				"internal_version": {typ: jsonString},
+				"tournament":       {typ: jsonBoolean},
+				"game_number":      {typ: jsonString},
+				"start_date_utc":   {typ: jsonString, dateTime: true},
+				"table_name":       {typ: jsonString},
+				"game_type":        {typ: jsonString, enum: []string{"Holdem", "Omaha", "OmahaHiLo", "Stud", "StudHiLo", "Draw"}},
+				"bet_limit": {
+					typ:      jsonObject,
+					required: []string{"bet_type"},
+					properties: map[string]*schema{
+						"bet_type": {typ: jsonString, enum: []string{"NL", "PL", "FL"}},
+						"bet_cap":  ohhAmountSchema,
+					},
+				},
+				"table_size":         {typ: jsonInteger, minimum: zero()},
+				"currency":           {typ: jsonString},
+				"dealer_seat":        {typ: jsonInteger, minimum: zero()},
+				"small_blind_amount": ohhAmountSchema,
+				"big_blind_amount":   ohhAmountSchema,
+				"ante_amount":        ohhAmountSchema,
+				"hero_player_id":     {typ: jsonInteger},
+				"players": {
+					typ: jsonArray,
+					items: &schema{
+						typ:      jsonObject,
+						required: []string{"id", "seat", "name", "starting_stack"},
+						properties: map[string]*schema{
+							"id":             {typ: jsonInteger},
+							"seat":           {typ: jsonInteger, minimum: zero()},
+							"name":           {typ: jsonString},
+							"display":        {typ: jsonString},
+							"starting_stack": ohhAmountSchema,
+						},
+					},
+				},
+				"rounds": {
+					typ: jsonArray,
+					items: &schema{
+						typ:      jsonObject,
+						required: []string{"id", "street", "actions"},
+						properties: map[string]*schema{
+							"id":     {typ: jsonInteger},
+							"street": {typ: jsonString, enum: []string{"Preflop", "Flop", "Turn", "River", "Showdown"}},
+							"cards":  ohhCardsSchema,
+							"actions": {
+								typ: jsonArray,
+								items: &schema{
+									typ:      jsonObject,
+									required: []string{"action_number", "player_id", "action"},
+									properties: map[string]*schema{
+										"action_number": {typ: jsonInteger, minimum: zero()},
+										"player_id":     {typ: jsonInteger},
+										"action": {typ: jsonString, enum: []string{
+											"Dealt Card", "Dealt Cards", "Mucks Cards", "Shows Cards",
+											"Post Ante", "Post SB", "Post BB", "Straddle", "Post Dead",
+											"Post Extra Blind", "Fold", "Check", "Bet", "Raise", "Call",
+											"Added Chips", "Sits Down", "Stands Up", "Added To Pot",
+										}},
+										"amount":   ohhAmountSchema,
+										"is_allin": {typ: jsonBoolean},
+										"cards":    ohhCardsSchema,
+									},
+								},
+							},
+						},
+					},
+				},
+				"pots": {
+					typ: jsonArray,
+					items: &schema{
+						typ:      jsonObject,
+						required: []string{"number", "amount", "player_wins"},
+						properties: map[string]*schema{
+							"number": {typ: jsonInteger, minimum: zero()},
+							"amount": ohhAmountSchema,
+							"rake":   ohhAmountSchema,
+							"player_wins": {
+								typ: jsonArray,
+								items: &schema{
+									typ:      jsonObject,
+									required: []string{"player_id", "win_amount"},
+									properties: map[string]*schema{
+										"player_id":        {typ: jsonInteger},
+										"win_amount":       ohhAmountSchema,
+										"contributed_rake": ohhAmountSchema,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+// ValidateOpenHH checks one OpenHH JSON object against the OpenHH schema,
+// and that every player id it refers to belongs to a player of the hand
+func ValidateOpenHH(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	if err := ohhSchema.validate(v, "$"); err != nil {
+		return err
+	}
+
+	var f ohhFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	ids := make(map[int]bool)
+	for _, p := range f.OHH.Players {
+		if ids[p.ID] {
+			return fmt.Errorf("duplicate player id %d", p.ID)
+		}
+		ids[p.ID] = true
+	}
+	check := func(id int, where string) error {
+		if !ids[id] {
+			return fmt.Errorf("%s: unknown player id %d", where, id)
+		}
+		return nil
+	}
+	if f.OHH.HeroPlayerID != nil {
+		if err := check(*f.OHH.HeroPlayerID, "hero_player_id"); err != nil {
+			return err
+		}
+	}
+	for _, r := range f.OHH.Rounds {
+		for _, a := range r.Actions {
+			if err := check(a.PlayerID, fmt.Sprintf("action %d", a.ActionNumber)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, p := range f.OHH.Pots {
+		for _, w := range p.PlayerWins {
+			if err := check(w.PlayerID, fmt.Sprintf("pot %d", p.Number)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks a value decoded with UseNumber against s
+func (s *schema) validate(v any, path string) error {
+	mismatch := func() error {
+		return fmt.Errorf("%s: expected %s", path, jsonTypeNames[s.typ])
+	}
+	switch s.typ {
+	case jsonString:
+		str, ok := v.(string)
+		if !ok {
+			return mismatch()
+		}
+		if s.enum != nil && !contains(s.enum, str) {
+			return fmt.Errorf("%s: %q is not one of %q", path, str, s.enum)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			return fmt.Errorf("%s: %q does not match %s", path, str, s.pattern)
+		}
+		if s.dateTime {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", path, str)
+			}
+		}
+	case jsonNumber, jsonInteger:
+		n, ok := v.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		f, err := n.Float64()
+		if err != nil || (s.typ == jsonInteger && f != math.Trunc(f)) {
+			return mismatch()
+		}
+		if s.minimum != nil && f < *s.minimum {
+			return fmt.Errorf("%s: %v is below %v", path, f, *s.minimum)
+		}
+	case jsonBoolean:
+		if _, ok := v.(bool); !ok {
+			return mismatch()
+		}
+	case jsonArray:
+		items, ok := v.([]any)
+		if !ok {
+			return mismatch()
+		}
+		for i, item := range items {
+			if err := s.items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case jsonObject:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return mismatch()
+		}
+		for _, name := range s.required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing %s", path, name)
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			// Properties the schema doesn't describe are allowed
+			if p, ok := s.properties[name]; ok {
+				if err := p.validate(obj[name], path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package history
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testdata/openhh_sample.json is a hand laid out like the examples in the
+// OpenHH specification, with fields such as table_handle, flags and
+// player_bounty that this package never writes. Checking it keeps
+// ValidateOpenHH from only accepting our own output.
+func readSample(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/openhh_sample.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestValidateOpenHHSample(t *testing.T) {
+	data := readSample(t)
+	if err := ValidateOpenHH(data); err != nil {
+		t.Fatalf("sample hand rejected: %v", err)
+	}
+	res, err := Import(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rejected) > 0 || len(res.Hands) != 1 {
+		t.Fatalf("imported %d hands, rejected %v", len(res.Hands), res.Rejected)
+	}
+	h := res.Hands[0]
+	if h.Currency != "USD" || h.BigBlind != 2 || h.Rake != 1 || len(h.Board) != 5 {
+		t.Errorf("hand read as %s bb %d rake %d with %d board cards", h.Currency, h.BigBlind, h.Rake, len(h.Board))
+	}
+
+	// Our own encoding of the hand must validate and read back the same
+	out, err := MarshalOpenHH(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hands, err := ReadOpenHH(bytes.NewReader(out))
+	if err != nil || len(hands) != 1 {
+		t.Fatalf("reading back: %d hands, %v", len(hands), err)
+	}
+	if got, want := len(hands[0].Actions), len(h.Actions); got != want {
+		t.Errorf("read back %d actions, want %d", got, want)
+	}
+}
+
+func TestValidateOpenHHRejects(t *testing.T) {
+	sample := string(readSample(t))
+	tests := []struct {
+		name, old, new, err string
+	}{
+		{"missing field", `"table_name": "Andromeda III",`, ``, "missing table_name"},
+		{"wrong type", `"tournament": false`, `"tournament": "no"`, "tournament: expected boolean"},
+		{"bad enum", `"bet_type": "NL"`, `"bet_type": "XL"`, "bet_type"},
+		{"bad card", `"Kh", "7s"`, `"Kh", "7x"`, "does not match"},
+		{"bad date", `2021-03-04T19:25:37Z`, `March 4th`, "not a date-time"},
+		{"negative amount", `"starting_stack": 1.50`, `"starting_stack": -1.50`, "below 0"},
+		{"fractional integer", `"dealer_seat": 1`, `"dealer_seat": 1.5`, "expected integer"},
+		{"unknown player", `"player_id": 0, "win_amount"`, `"player_id": 9, "win_amount"`, "unknown player id 9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(sample, tt.old) {
+				t.Fatalf("sample has no %q", tt.old)
+			}
+			err := ValidateOpenHH([]byte(strings.Replace(sample, tt.old, tt.new, 1)))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
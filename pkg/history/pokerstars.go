@@ -0,0 +1,345 @@
+package history
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// pokerStarsTime is the layout of the timestamp in a PokerStars hand header
+const pokerStarsTime = "2006/01/02 15:04:05"
+
+var streetNames = map[game.GamePhase]string{
+	game.PreFlop: "Pre-Flop",
+	game.Flop:    "Flop",
+	game.Turn:    "Turn",
+	game.River:   "River",
+}
+
+// easternTime returns the time zone PokerStars stamps hands in, falling back
+// to UTC where no time zone database is available, as in WASM builds
+func easternTime() (*time.Location, string) {
+	if loc, err := time.LoadLocation("America/New_York"); err == nil {
+		return loc, "ET"
+	}
+	return time.UTC, "UTC"
+}
+
+// WritePokerStars writes a hand in PokerStars hand history text format,
+// followed by the blank lines that separate hands in a history file
+func WritePokerStars(w io.Writer, h *Hand) error {
+	var b strings.Builder
+	name := func(seat int) string {
+		if s := h.Seat(seat); s != nil {
+			return s.Name
+		}
+		return fmt.Sprintf("Seat %d", seat)
+	}
+	allIn := func(a bool) string {
+		if a {
+			return " and is all-in"
+		}
+		return ""
+	}
+
+	loc, zone := easternTime()
+	m := h.formatAmount
+	stakes := m(h.SmallBlind) + "/" + m(h.BigBlind)
+	if h.Currency != "" {
+		stakes += " " + h.Currency
+	}
+	fmt.Fprintf(&b, "PokerStars Hand #%s:  Hold'em No Limit (%s) - %s %s\n",
+		h.ID, stakes, h.Time.In(loc).Format(pokerStarsTime), zone)
+	fmt.Fprintf(&b, "Table '%s' %d-max Seat #%d is the button\n", h.Table, h.MaxSeats, h.ButtonSeat)
+	for _, s := range h.Seats {
+		fmt.Fprintf(&b, "Seat %d: %s (%s in chips)\n", s.Number, s.Name, m(s.Stack))
+	}
+	for _, bl := range h.Blinds {
+		kind := "small"
+		if bl.Big {
+			kind = "big"
+		}
+		s := h.Seat(bl.Seat)
+		fmt.Fprintf(&b, "%s: posts %s blind %s%s\n", name(bl.Seat), kind, m(bl.Amount), allIn(s != nil && bl.Amount == s.Stack))
+	}
+
+	b.WriteString("*** HOLE CARDS ***\n")
+	for _, s := range h.Seats {
+		if len(s.Cards) > 0 && (h.Hero == 0 || h.Hero == s.Number) {
+			fmt.Fprintf(&b, "Dealt to %s [%s]\n", s.Name, cardList(s.Cards))
+		}
+	}
+
+	street := game.PreFlop
+	for i, a := range h.Actions {
+		for street < a.Street {
+			street++
+			writeStreet(&b, h.Board, street)
+		}
+		switch a.Action {
+		case game.Fold:
+			fmt.Fprintf(&b, "%s: folds\n", name(a.Seat))
+		case game.Check:
+			fmt.Fprintf(&b, "%s: checks\n", name(a.Seat))
+		case game.Call:
+			fmt.Fprintf(&b, "%s: calls %s%s\n", name(a.Seat), m(a.Amount), allIn(a.AllIn))
+		case game.Bet:
+			fmt.Fprintf(&b, "%s: bets %s%s\n", name(a.Seat), m(a.Amount), allIn(a.AllIn))
+		case game.Raise:
+			fmt.Fprintf(&b, "%s: raises %s to %s%s\n", name(a.Seat), m(a.To-raisedFrom(h, i)), m(a.To), allIn(a.AllIn))
+		}
+	}
+	for _, p := range h.Payouts {
+		if p.Pot == UncalledBetPot {
+			fmt.Fprintf(&b, "Uncalled bet (%s) returned to %s\n", m(p.Amount), name(p.Seat))
+		}
+	}
+	for street < boardStreet(len(h.Board)) {
+		street++
+		writeStreet(&b, h.Board, street)
+	}
+
+	pots := potTotals(h)
+	showdown := h.WentToShowdown()
+	if showdown {
+		b.WriteString("*** SHOW DOWN ***\n")
+		for _, s := range h.Seats {
+			if eval, ok := h.Evaluate(s.Number); ok && s.Shown {
+				fmt.Fprintf(&b, "%s: shows [%s] (%s)\n", s.Name, cardList(s.Cards), DescribeHand(eval))
+			}
+		}
+	}
+	// Side pots are awarded first
+	for pot := len(pots) - 1; pot >= 0; pot-- {
+		for _, p := range h.Payouts {
+			if p.Pot == pot {
+				fmt.Fprintf(&b, "%s collected %s from %s\n", name(p.Seat), m(p.Amount), potName(p.Pot, len(pots)))
+			}
+		}
+	}
+	if !showdown {
+		for _, s := range h.Seats {
+			if _, folded := h.FoldedOn(s.Number); !folded {
+				fmt.Fprintf(&b, "%s: doesn't show hand\n", s.Name)
+			}
+		}
+	}
+
+	b.WriteString("*** SUMMARY ***\n")
+	fmt.Fprintf(&b, "Total pot %s", m(h.TotalPot()+h.Rake))
+	if len(pots) > 1 {
+		fmt.Fprintf(&b, " Main pot %s.", m(pots[0]))
+		for i, amount := range pots[1:] {
+			if len(pots) == 2 {
+				fmt.Fprintf(&b, " Side pot %s.", m(amount))
+			} else {
+				fmt.Fprintf(&b, " Side pot-%d %s.", i+1, m(amount))
+			}
+		}
+	}
+	fmt.Fprintf(&b, " | Rake %s\n", m(h.Rake))
+	if len(h.Board) > 0 {
+		fmt.Fprintf(&b, "Board [%s]\n", cardList(h.Board))
+	}
+	for _, s := range h.Seats {
+		fmt.Fprintf(&b, "Seat %d: %s%s %s\n", s.Number, s.Name, positionTags(h, s.Number), seatSummary(h, s, showdown))
+	}
+	b.WriteString("\n\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeStreet(b *strings.Builder, board []game.Card, street game.GamePhase) {
+	switch street {
+	case game.Flop:
+		if len(board) >= 3 {
+			fmt.Fprintf(b, "*** FLOP *** [%s]\n", cardList(board[:3]))
+		}
+	case game.Turn:
+		if len(board) >= 4 {
+			fmt.Fprintf(b, "*** TURN *** [%s] [%s]\n", cardList(board[:3]), board[3].Code())
+		}
+	case game.River:
+		if len(board) >= 5 {
+			fmt.Fprintf(b, "*** RIVER *** [%s] [%s]\n", cardList(board[:4]), board[4].Code())
+		}
+	}
+}
+
+// boardStreet returns the last street dealt for a board of n cards
+func boardStreet(n int) game.GamePhase {
+	switch {
+	case n >= 5:
+		return game.River
+	case n == 4:
+		return game.Turn
+	case n >= 3:
+		return game.Flop
+	}
+	return game.PreFlop
+}
+
+// raisedFrom returns the bet the raise at index i was made over
+func raisedFrom(h *Hand, i int) int {
+	raise := h.Actions[i]
+	bet := 0
+	if raise.Street == game.PreFlop {
+		for _, bl := range h.Blinds {
+			if bl.Big {
+				bet = h.BigBlind
+			}
+		}
+	}
+	for _, a := range h.Actions[:i] {
+		if a.Street == raise.Street && a.To > bet {
+			bet = a.To
+		}
+	}
+	return bet
+}
+
+// potTotals returns the amount won from each pot, main pot first
+func potTotals(h *Hand) []int {
+	var pots []int
+	for _, p := range h.Payouts {
+		if p.Pot == UncalledBetPot {
+			continue
+		}
+		for len(pots) <= p.Pot {
+			pots = append(pots, 0)
+		}
+		pots[p.Pot] += p.Amount
+	}
+	return pots
+}
+
+func potName(pot, pots int) string {
+	switch {
+	case pots <= 1:
+		return "pot"
+	case pot == 0:
+		return "main pot"
+	case pots == 2:
+		return "side pot"
+	}
+	return fmt.Sprintf("side pot-%d", pot)
+}
+
+func positionTags(h *Hand, seat int) string {
+	var tags string
+	if seat == h.ButtonSeat {
+		tags += " (button)"
+	}
+	for _, bl := range h.Blinds {
+		if bl.Seat == seat && bl.Big {
+			tags += " (big blind)"
+		} else if bl.Seat == seat {
+			tags += " (small blind)"
+		}
+	}
+	return tags
+}
+
+func seatSummary(h *Hand, s Seat, showdown bool) string {
+	if street, folded := h.FoldedOn(s.Number); folded {
+		if street == game.PreFlop {
+			if h.Invested(s.Number) == 0 {
+				return "folded before Flop (didn't bet)"
+			}
+			return "folded before Flop"
+		}
+		return "folded on the " + streetNames[street]
+	}
+	won := h.Won(s.Number)
+	if !showdown {
+		return fmt.Sprintf("collected (%s)", h.formatAmount(won))
+	}
+	eval, _ := h.Evaluate(s.Number)
+	if won > 0 {
+		return fmt.Sprintf("showed [%s] and won (%s) with %s", cardList(s.Cards), h.formatAmount(won), DescribeHand(eval))
+	}
+	return fmt.Sprintf("showed [%s] and lost with %s", cardList(s.Cards), DescribeHand(eval))
+}
+
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+}
+
+// formatAmount formats chips, or cents as money when the hand has a currency
+func (h *Hand) formatAmount(n int) string {
+	if h.Currency == "" {
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("%s%d.%02d", currencySymbols[h.Currency], n/100, n%100)
+}
+
+func cardList(cards []game.Card) string {
+	codes := make([]string, len(cards))
+	for i, c := range cards {
+		codes[i] = c.Code()
+	}
+	return strings.Join(codes, " ")
+}
+
+var rankNames = map[game.Rank][2]string{
+	game.Two:   {"Deuce", "Deuces"},
+	game.Three: {"Three", "Threes"},
+	game.Four:  {"Four", "Fours"},
+	game.Five:  {"Five", "Fives"},
+	game.Six:   {"Six", "Sixes"},
+	game.Seven: {"Seven", "Sevens"},
+	game.Eight: {"Eight", "Eights"},
+	game.Nine:  {"Nine", "Nines"},
+	game.Ten:   {"Ten", "Tens"},
+	game.Jack:  {"Jack", "Jacks"},
+	game.Queen: {"Queen", "Queens"},
+	game.King:  {"King", "Kings"},
+	game.Ace:   {"Ace", "Aces"},
+}
+
+// DescribeHand describes a hand the way PokerStars does at showdown, such as
+// "two pair, Aces and Kings"
+func DescribeHand(e game.HandEvaluation) string {
+	if len(e.Cards) < 5 {
+		return "high card " + rankNames[highest(e.Cards)][0]
+	}
+	one := func(i int) string { return rankNames[e.Cards[i].Rank][0] }
+	many := func(i int) string { return rankNames[e.Cards[i].Rank][1] }
+	switch e.Rank {
+	case game.RoyalFlush:
+		return "a Royal Flush"
+	case game.StraightFlush:
+		return fmt.Sprintf("a straight flush, %s to %s", one(4), one(0))
+	case game.FourOfAKind:
+		return "four of a kind, " + many(0)
+	case game.FullHouse:
+		return fmt.Sprintf("a full house, %s full of %s", many(0), many(3))
+	case game.Flush:
+		return fmt.Sprintf("a flush, %s high", one(0))
+	case game.Straight:
+		return fmt.Sprintf("a straight, %s to %s", one(4), one(0))
+	case game.ThreeOfAKind:
+		return "three of a kind, " + many(0)
+	case game.TwoPair:
+		return fmt.Sprintf("two pair, %s and %s", many(0), many(2))
+	case game.Pair:
+		return "a pair of " + many(0)
+	}
+	return "high card " + one(0)
+}
+
+func highest(cards []game.Card) game.Rank {
+	high := game.Two
+	for _, c := range cards {
+		if c.Rank > high {
+			high = c.Rank
+		}
+	}
+	return high
+}
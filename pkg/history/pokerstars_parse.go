@@ -0,0 +1,437 @@
+package history
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// ErrUnsupported is returned for hands the engine can't play, such as other
+// games or hands with antes
+var ErrUnsupported = errors.New("unsupported hand")
+
+var (
+	psHeader  = regexp.MustCompile(`^PokerStars .*?Hand #(\d+):\s+(.*?)(Hold'em No Limit)?(?: - Level \S+)? \(([^/)]+)/([^/) ]+)(?: ([A-Z]{3}))?\) - (.*)$`)
+	psTable   = regexp.MustCompile(`^Table '(.*)' (\d+)-max (?:\(.*\) )?Seat #(\d+) is the button`)
+	psSeat    = regexp.MustCompile(`^Seat (\d+): (.+) \(([^ ]+) in chips(?:, .*)?\)(.*)$`)
+	psDate    = regexp.MustCompile(`(\d{4}/\d{2}/\d{2} \d{1,2}:\d{2}:\d{2}) ET`)
+	psDealt   = regexp.MustCompile(`^Dealt to (.+?) \[([^\]]+)\]$`)
+	psStreet  = regexp.MustCompile(`^\*\*\* (FLOP|TURN|RIVER) \*\*\* \[([^\]]+)\](?: \[([^\]]+)\])?$`)
+	psReturn  = regexp.MustCompile(`^Uncalled bet \(([^)]+)\) returned to (.+)$`)
+	psCollect = regexp.MustCompile(`^(.+) collected ([^ ]+) from (pot|main pot|side pot(?:-(\d+))?)$`)
+	psTotal   = regexp.MustCompile(`^Total pot ([^ ]+).*\| Rake ([^ ]+)`)
+	psShown   = regexp.MustCompile(`(showed|mucked) \[([^\]]+)\]`)
+	psRaise   = regexp.MustCompile(`^raises ([^ ]+) to ([^ ]+)( and is all-in)?$`)
+	psAmount  = regexp.MustCompile(`^(posts small blind|posts big blind|calls|bets) ([^ ]+)( and is all-in)?$`)
+)
+
+// ReadPokerStars parses a PokerStars hand history file. It stops at the
+// first hand that can't be parsed.
+func ReadPokerStars(r io.Reader) ([]*Hand, error) {
+	texts, err := splitPokerStars(r)
+	if err != nil {
+		return nil, err
+	}
+	hands := make([]*Hand, 0, len(texts))
+	for _, t := range texts {
+		h, err := ParsePokerStars(t.text)
+		if err != nil {
+			return hands, fmt.Errorf("line %d: %w", t.line, err)
+		}
+		hands = append(hands, h)
+	}
+	return hands, nil
+}
+
+// psText is the text of one hand and the line it starts on in its file
+type psText struct {
+	text string
+	line int
+}
+
+// splitPokerStars splits a history file into hands at their header lines
+func splitPokerStars(r io.Reader) ([]psText, error) {
+	var (
+		texts []psText
+		cur   strings.Builder
+		start int
+	)
+	flush := func() {
+		if strings.TrimSpace(cur.String()) != "" {
+			texts = append(texts, psText{cur.String(), start})
+		}
+		cur.Reset()
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimPrefix(sc.Text(), "\ufeff")
+		if strings.HasPrefix(line, "PokerStars ") {
+			flush()
+			start = n
+		}
+		cur.WriteString(line)
+		cur.WriteByte('\n')
+	}
+	flush()
+	return texts, sc.Err()
+}
+
+// psParser holds the state of parsing one hand
+type psParser struct {
+	h       *Hand
+	street  game.GamePhase
+	bets    map[int]int // each seat's bet on the current street
+	dealt   []int       // seats with a Dealt to line
+	summary bool
+}
+
+// ParsePokerStars parses the text of a single PokerStars hand
+func ParsePokerStars(text string) (*Hand, error) {
+	p := &psParser{
+		h:    &Hand{Site: "PokerStars"},
+		bets: map[int]int{},
+	}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if err := p.header(lines); err != nil {
+		return nil, err
+	}
+	for i, line := range lines[2:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := p.line(line); err != nil {
+			return nil, fmt.Errorf("hand %s line %d: %w", p.h.ID, i+3, err)
+		}
+	}
+	if len(p.h.Seats) < 2 {
+		return nil, fmt.Errorf("hand %s: fewer than two players", p.h.ID)
+	}
+	if len(p.dealt) == 1 {
+		p.h.Hero = p.dealt[0]
+	}
+	return p.h, nil
+}
+
+// header parses the hand and table lines
+func (p *psParser) header(lines []string) error {
+	if len(lines) < 2 {
+		return errors.New("missing header")
+	}
+	m := psHeader.FindStringSubmatch(strings.TrimSpace(lines[0]))
+	if m == nil {
+		return fmt.Errorf("invalid header %q", lines[0])
+	}
+	h := p.h
+	h.ID = m[1]
+	if m[3] == "" {
+		return fmt.Errorf("hand %s: %w: not no-limit hold'em", h.ID, ErrUnsupported)
+	}
+	if strings.HasPrefix(m[4], "$") || strings.HasPrefix(m[4], "€") || strings.HasPrefix(m[4], "£") {
+		h.Currency = m[6]
+		if h.Currency == "" {
+			for code, sym := range currencySymbols {
+				if strings.HasPrefix(m[4], sym) {
+					h.Currency = code
+				}
+			}
+		}
+	}
+	var err error
+	if h.SmallBlind, err = p.amount(m[4]); err != nil {
+		return err
+	}
+	if h.BigBlind, err = p.amount(m[5]); err != nil {
+		return err
+	}
+	// Hands are stamped in ET, sometimes after the local time
+	if d := psDate.FindStringSubmatch(m[7]); d != nil {
+		loc, _ := easternTime()
+		h.Time, _ = time.ParseInLocation(pokerStarsTime, d[1], loc)
+	} else if len(m[7]) >= 19 {
+		h.Time, _ = time.Parse(pokerStarsTime, m[7][:19])
+	}
+
+	t := psTable.FindStringSubmatch(strings.TrimSpace(lines[1]))
+	if t == nil {
+		return fmt.Errorf("hand %s: invalid table line %q", h.ID, lines[1])
+	}
+	h.Table = t[1]
+	h.MaxSeats, _ = strconv.Atoi(t[2])
+	h.ButtonSeat, _ = strconv.Atoi(t[3])
+	return nil
+}
+
+// amount parses chips, or money as cents when the hand has a currency
+func (p *psParser) amount(s string) (int, error) {
+	s = strings.TrimLeft(s, "$€£")
+	s = strings.ReplaceAll(s, ",", "")
+	whole, frac, dot := strings.Cut(s, ".")
+	n, err := strconv.Atoi(whole)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if p.h.Currency == "" {
+		if dot && strings.Trim(frac, "0") != "" {
+			return 0, fmt.Errorf("fractional chip amount %q", s)
+		}
+		return n, nil
+	}
+	frac = (frac + "00")[:2]
+	cents, err := strconv.Atoi(frac)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return n*100 + cents, nil
+}
+
+// line parses one line after the header
+func (p *psParser) line(line string) error {
+	h := p.h
+	switch {
+	case strings.HasPrefix(line, "*** HOLE CARDS"), strings.HasPrefix(line, "*** SHOW DOWN"):
+		return nil
+	case strings.HasPrefix(line, "*** SUMMARY"):
+		p.summary = true
+		return nil
+	case strings.HasPrefix(line, "*** FIRST"), strings.HasPrefix(line, "*** SECOND"):
+		return fmt.Errorf("%w: board run twice", ErrUnsupported)
+	}
+
+	if p.summary {
+		return p.summaryLine(line)
+	}
+	if m := psSeat.FindStringSubmatch(line); m != nil && len(h.Actions) == 0 && len(h.Blinds) == 0 {
+		if strings.Contains(m[4], "sitting out") || strings.Contains(m[4], "out of hand") {
+			return nil
+		}
+		number, _ := strconv.Atoi(m[1])
+		stack, err := p.amount(m[3])
+		if err != nil {
+			return err
+		}
+		h.Seats = append(h.Seats, Seat{Number: number, Name: m[2], Stack: stack})
+		return nil
+	}
+	if m := psDealt.FindStringSubmatch(line); m != nil {
+		s := p.seatByName(m[1])
+		if s == nil {
+			return fmt.Errorf("cards dealt to unknown player %q", m[1])
+		}
+		cards, err := parseCards(m[2])
+		if err != nil {
+			return err
+		}
+		s.Cards = cards
+		p.dealt = append(p.dealt, s.Number)
+		return nil
+	}
+	if m := psStreet.FindStringSubmatch(line); m != nil {
+		return p.newStreet(m[1], m[2], m[3])
+	}
+	if m := psReturn.FindStringSubmatch(line); m != nil {
+		return p.payout(m[2], m[1], UncalledBetPot)
+	}
+	if m := psCollect.FindStringSubmatch(line); m != nil {
+		pot := 0
+		switch {
+		case m[4] != "":
+			pot, _ = strconv.Atoi(m[4])
+		case m[3] == "side pot":
+			pot = 1
+		}
+		return p.payout(m[1], m[2], pot)
+	}
+
+	s, rest := p.splitName(line)
+	if s == nil {
+		return nil // chat and table messages
+	}
+	return p.action(s, rest)
+}
+
+// seatByName returns the seat of the named player, or nil
+func (p *psParser) seatByName(name string) *Seat {
+	for i := range p.h.Seats {
+		if p.h.Seats[i].Name == name {
+			return &p.h.Seats[i]
+		}
+	}
+	return nil
+}
+
+// splitName splits "name: rest" lines, trying the longest names first since
+// names may themselves contain ": "
+func (p *psParser) splitName(line string) (*Seat, string) {
+	seats := make([]*Seat, len(p.h.Seats))
+	for i := range p.h.Seats {
+		seats[i] = &p.h.Seats[i]
+	}
+	sort.Slice(seats, func(i, j int) bool { return len(seats[i].Name) > len(seats[j].Name) })
+	for _, s := range seats {
+		if strings.HasPrefix(line, s.Name+": ") {
+			return s, line[len(s.Name)+2:]
+		}
+	}
+	return nil, ""
+}
+
+// action parses what a player did
+func (p *psParser) action(s *Seat, rest string) error {
+	h := p.h
+	add := func(action game.PlayerAction, amount, to int, allIn bool) {
+		h.Actions = append(h.Actions, Action{
+			Street: p.street,
+			Seat:   s.Number,
+			Action: action,
+			Amount: amount,
+			To:     to,
+			AllIn:  allIn,
+		})
+		p.bets[s.Number] = to
+	}
+
+	switch {
+	case rest == "folds" || strings.HasPrefix(rest, "folds ["):
+		add(game.Fold, 0, p.bets[s.Number], false)
+		return nil
+	case rest == "checks":
+		add(game.Check, 0, p.bets[s.Number], false)
+		return nil
+	case strings.HasPrefix(rest, "shows ["):
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return fmt.Errorf("invalid show %q", rest)
+		}
+		cards, err := parseCards(rest[len("shows ["):end])
+		if err != nil {
+			return err
+		}
+		s.Cards, s.Shown = cards, true
+		return nil
+	case strings.HasPrefix(rest, "posts the ante"), strings.HasPrefix(rest, "posts small & big"):
+		return fmt.Errorf("%w: %s", ErrUnsupported, rest)
+	}
+
+	if m := psRaise.FindStringSubmatch(rest); m != nil {
+		to, err := p.amount(m[2])
+		if err != nil {
+			return err
+		}
+		add(game.Raise, to-p.bets[s.Number], to, m[3] != "")
+		return nil
+	}
+	m := psAmount.FindStringSubmatch(rest)
+	if m == nil {
+		return nil // mucks, sits out and other messages that don't change the hand
+	}
+	amount, err := p.amount(m[2])
+	if err != nil {
+		return err
+	}
+	allIn := m[3] != ""
+	switch m[1] {
+	case "posts small blind", "posts big blind":
+		if len(h.Actions) > 0 {
+			return fmt.Errorf("%w: blind posted after the action started", ErrUnsupported)
+		}
+		h.Blinds = append(h.Blinds, Blind{Seat: s.Number, Amount: amount, Big: m[1] == "posts big blind"})
+		p.bets[s.Number] += amount
+	case "calls":
+		add(game.Call, amount, p.bets[s.Number]+amount, allIn)
+	case "bets":
+		add(game.Bet, amount, amount, allIn)
+	}
+	return nil
+}
+
+// newStreet parses a street header and its new board cards
+func (p *psParser) newStreet(name, board, card string) error {
+	next := map[string]game.GamePhase{"FLOP": game.Flop, "TURN": game.Turn, "RIVER": game.River}[name]
+	if next != p.street+1 {
+		return fmt.Errorf("%s out of order", name)
+	}
+	cards, err := parseCards(strings.TrimSpace(board + " " + card))
+	if err != nil {
+		return err
+	}
+	if len(cards) != 2+int(next) {
+		return fmt.Errorf("%s has %d board cards", name, len(cards))
+	}
+	p.h.Board = cards
+	p.street = next
+	p.bets = map[int]int{}
+	return nil
+}
+
+// payout records an uncalled bet or chips collected from a pot
+func (p *psParser) payout(name, amount string, pot int) error {
+	s := p.seatByName(name)
+	if s == nil {
+		return fmt.Errorf("payout to unknown player %q", name)
+	}
+	n, err := p.amount(amount)
+	if err != nil {
+		return err
+	}
+	p.h.Payouts = append(p.h.Payouts, Payout{Seat: s.Number, Pot: pot, Amount: n})
+	return nil
+}
+
+// summaryLine picks the rake, board and mucked cards out of the summary
+func (p *psParser) summaryLine(line string) error {
+	h := p.h
+	if m := psTotal.FindStringSubmatch(line); m != nil {
+		rake, err := p.amount(m[2])
+		if err != nil {
+			return err
+		}
+		h.Rake = rake
+		return nil
+	}
+	if strings.HasPrefix(line, "Board [") {
+		cards, err := parseCards(strings.TrimSuffix(strings.TrimPrefix(line, "Board ["), "]"))
+		if err != nil {
+			return err
+		}
+		if len(cards) > len(h.Board) {
+			h.Board = cards
+		}
+		return nil
+	}
+	if strings.HasPrefix(line, "Seat ") {
+		number, _ := strconv.Atoi(strings.TrimSuffix(strings.Fields(line)[1], ":"))
+		s := h.Seat(number)
+		if c := psShown.FindStringSubmatch(line); c != nil && s != nil {
+			cards, err := parseCards(c[2])
+			if err != nil {
+				return err
+			}
+			s.Cards = cards
+			s.Shown = s.Shown || c[1] == "showed"
+		}
+	}
+	return nil
+}
+
+// parseCards parses space separated card codes
+func parseCards(s string) ([]game.Card, error) {
+	var cards []game.Card
+	for _, f := range strings.Fields(s) {
+		c, err := game.ParseCard(f)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, c)
+	}
+	return cards, nil
+}
@@ -0,0 +1,122 @@
+package history
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// recordHands plays a hand per script at a seeded table, the player to act
+// taking the script's action for their seat, and returns the recorded hands
+func recordHands(t *testing.T, stacks []int, scripts []map[int]game.PlayerAction) []*Hand {
+	t.Helper()
+	var hands []*Hand
+	for i, script := range scripts {
+		var players []*game.Player
+		for s, chips := range stacks {
+			players = append(players, game.NewPlayer(fmt.Sprintf("p%d", s), fmt.Sprintf("Player%d", s), chips, s))
+		}
+		g := game.NewGameState(players, 5, 10)
+		g.SetSeed(int64(i + 1))
+		rec := NewRecorder(nil, "Test", int64(i+1))
+		rec.OnHand = func(h *Hand) { hands = append(hands, h) }
+		g.Subscribe(rec.Observe)
+		g.StartNewHand()
+		for n := 0; !g.IsHandOver(); n++ {
+			if n > 100 {
+				t.Fatal("hand never ended")
+			}
+			action, ok := script[g.CurrentPos]
+			if !ok {
+				action = game.Call
+			}
+			amount := 0
+			for _, a := range g.LegalActions() {
+				if a.Action == action {
+					amount = a.Min
+				}
+			}
+			if !g.ProcessAction(action, amount) && !g.ProcessAction(game.Check, 0) {
+				t.Fatalf("seat %d couldn't %v or check", g.CurrentPos, action)
+			}
+		}
+	}
+	return hands
+}
+
+func sortPayouts(payouts []Payout) []Payout {
+	sorted := append([]Payout(nil), payouts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Pot < sorted[j].Pot })
+	return sorted
+}
+
+func TestPokerStarsRoundTrip(t *testing.T) {
+	hands := recordHands(t, []int{50, 100, 200}, []map[int]game.PlayerAction{
+		// Everyone all-in: a main pot, a side pot and the big stack's
+		// uncalled chips returned
+		{0: game.AllIn, 1: game.AllIn, 2: game.AllIn},
+		// A bet nobody calls is returned
+		{1: game.Raise, 2: game.Fold, 0: game.Fold},
+	})
+	if len(hands) != 2 {
+		t.Fatalf("recorded %d hands", len(hands))
+	}
+	pots := map[int]bool{}
+	for _, h := range hands {
+		for _, p := range h.Payouts {
+			pots[p.Pot] = true
+		}
+	}
+	if !pots[0] || !pots[1] || !pots[UncalledBetPot] {
+		t.Fatalf("hands pay out pots %v, want a main pot, a side pot and a returned bet", pots)
+	}
+
+	var buf bytes.Buffer
+	for _, h := range hands {
+		if err := WritePokerStars(&buf, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	text := buf.String()
+	parsed, err := ReadPokerStars(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(hands) {
+		t.Fatalf("parsed %d hands, want %d", len(parsed), len(hands))
+	}
+	for i, h := range hands {
+		got, want := *parsed[i], *h
+		if !got.Time.Equal(want.Time.Truncate(1e9)) {
+			t.Errorf("hand %s played at %v, want %v", h.ID, got.Time, want.Time)
+		}
+		// The text has names and no player IDs, and whole seconds
+		got.Time, want.Time = time.Time{}, time.Time{}
+		want.Seats = append([]Seat(nil), want.Seats...)
+		for s := range want.Seats {
+			want.Seats[s].PlayerID = ""
+		}
+		// A hand that ends before the flop may record an empty board
+		if len(want.Board) == 0 {
+			want.Board = nil
+		}
+		// PokerStars collects side pots before the main pot
+		got.Payouts, want.Payouts = sortPayouts(got.Payouts), sortPayouts(want.Payouts)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("hand %s parsed as\n%+v\nwant\n%+v\nfrom\n%s", h.ID, got, want, text)
+		}
+	}
+
+	res, err := Import(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hands) != len(hands) || len(res.Rejected) > 0 {
+		t.Errorf("imported %d hands, rejected %v", len(res.Hands), res.Rejected)
+	}
+}
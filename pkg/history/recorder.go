@@ -0,0 +1,143 @@
+package history
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// Recorder builds a Hand for every hand played at a GameState and writes it,
+// as PokerStars text unless Format says otherwise. Subscribe its Observe
+// method to the table.
+type Recorder struct {
+	Table string
+	// Hero, when set, is the ID of the only player whose hole cards are
+	// dealt face up, as in a real client's history. Otherwise all hole cards
+	// are recorded.
+	Hero string
+	// OnHand, when set, receives every finished hand
+	OnHand func(*Hand)
+	// Format writes each hand to the output, WritePokerStars when nil
+	Format func(io.Writer, *Hand) error
+
+	mu     sync.Mutex
+	w      io.Writer
+	nextID int64
+	hand   *Hand
+	err    error
+}
+
+// NewRecorder creates a recorder that writes to w, numbering hands from
+// firstID. w may be nil when only OnHand is wanted.
+func NewRecorder(w io.Writer, table string, firstID int64) *Recorder {
+	return &Recorder{
+		Table:  table,
+		w:      w,
+		nextID: firstID,
+	}
+}
+
+// Err returns the first error writing to the output, if any
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Observe builds the hand from a table's events. Register it with
+// GameState.Subscribe.
+func (r *Recorder) Observe(e game.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := e.(game.HandStarted); ok {
+		r.handStarted(e)
+		return
+	}
+	h := r.hand
+	if h == nil {
+		return
+	}
+	switch e := e.(type) {
+	case game.BlindPosted:
+		h.Blinds = append(h.Blinds, Blind{Seat: e.Seat + 1, Amount: e.Amount, Big: e.Big})
+	case game.CardsDealt:
+		if s := h.Seat(e.Seat + 1); s != nil {
+			s.Cards = append([]game.Card{}, e.Cards...)
+		}
+	case game.PlayerActed:
+		h.Actions = append(h.Actions, Action{
+			Street: e.Phase,
+			Seat:   e.Seat + 1,
+			Action: e.Action,
+			Amount: e.Amount,
+			To:     e.BetTo,
+			AllIn:  e.AllIn,
+		})
+	case game.StreetDealt:
+		h.Board = append([]game.Card{}, e.Board...)
+	case game.PotAwarded:
+		h.Payouts = append(h.Payouts, Payout{Seat: e.Seat + 1, Pot: e.Pot, Amount: e.Amount})
+	case game.HandEnded:
+		r.handEnded()
+	case game.StateRestored:
+		// The hand so far may never have happened
+		r.hand = nil
+	}
+}
+
+// handStarted records the seats and stacks
+func (r *Recorder) handStarted(e game.HandStarted) {
+	h := &Hand{
+		ID:         fmt.Sprint(r.nextID),
+		Site:       "PokerStars",
+		Table:      r.Table,
+		Time:       time.Now(),
+		SmallBlind: e.SmallBlind,
+		BigBlind:   e.BigBlind,
+		MaxSeats:   e.TableSize,
+		ButtonSeat: e.DealerPos + 1,
+	}
+	r.nextID++
+	for _, s := range e.Seats {
+		h.Seats = append(h.Seats, Seat{
+			Number:   s.Seat + 1,
+			PlayerID: s.PlayerID,
+			Name:     s.Name,
+			Stack:    s.Chips,
+		})
+	}
+	r.hand = h
+}
+
+// handEnded hides the cards nobody saw and writes the hand
+func (r *Recorder) handEnded() {
+	h := r.hand
+	r.hand = nil
+
+	showdown := h.WentToShowdown()
+	for i := range h.Seats {
+		s := &h.Seats[i]
+		_, folded := h.FoldedOn(s.Number)
+		s.Shown = showdown && !folded
+		if s.PlayerID == r.Hero {
+			h.Hero = s.Number
+		}
+		if r.Hero != "" && s.PlayerID != r.Hero && !s.Shown {
+			s.Cards = nil
+		}
+	}
+
+	if r.w != nil && r.err == nil {
+		format := r.Format
+		if format == nil {
+			format = WritePokerStars
+		}
+		r.err = format(r.w, h)
+	}
+	if r.OnHand != nil {
+		r.OnHand(h)
+	}
+}
@@ -0,0 +1,231 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// Replay plays a hand through game.GameState, checking that every action is
+// taken in turn and accepted, and that the engine ends the hand with the
+// recorded blinds, actions, board and payouts. It returns the table as the
+// hand left it.
+func Replay(h *Hand) (*game.GameState, error) {
+	seats := append([]Seat{}, h.Seats...)
+	sort.Slice(seats, func(i, j int) bool { return seats[i].Number < seats[j].Number })
+	n := len(seats)
+	if n < 2 {
+		return nil, fmt.Errorf("%d players", n)
+	}
+	index := make(map[int]int, n)
+	for i, s := range seats {
+		if s.Stack <= 0 {
+			return nil, fmt.Errorf("seat %d has no chips", s.Number)
+		}
+		index[s.Number] = i
+	}
+	if len(h.Blinds) != 2 || h.Blinds[0].Big || !h.Blinds[1].Big {
+		return nil, fmt.Errorf("%w: blinds other than one small and one big blind", ErrUnsupported)
+	}
+	sb, ok := index[h.Blinds[0].Seat]
+	if !ok {
+		return nil, fmt.Errorf("small blind posted by empty seat %d", h.Blinds[0].Seat)
+	}
+	dealer := sb
+	if n > 2 {
+		dealer = (sb + n - 1) % n
+	}
+	if b, ok := index[h.ButtonSeat]; ok && b != dealer {
+		return nil, fmt.Errorf("button is on seat %d but the blinds were posted for seat %d", h.ButtonSeat, seats[dealer].Number)
+	}
+
+	players := make([]*game.Player, n)
+	for i, s := range seats {
+		id := s.PlayerID
+		if id == "" {
+			id = fmt.Sprint(s.Number)
+		}
+		players[i] = game.NewPlayer(id, s.Name, s.Stack, i)
+	}
+	deck, err := replayDeck(h, seats, dealer)
+	if err != nil {
+		return nil, err
+	}
+	g := game.NewGameState(players, h.SmallBlind, h.BigBlind)
+	g.StackDeck(deck)
+	// StartNewHand moves the button on by one seat
+	g.DealerPos = (dealer + n - 1) % n
+	var got *Hand
+	rec := NewRecorder(nil, h.Table, 0)
+	rec.OnHand = func(r *Hand) { got = r }
+	g.Subscribe(rec.Observe)
+	g.StartNewHand()
+
+	for i, a := range h.Actions {
+		if g.IsHandOver() {
+			return g, fmt.Errorf("action %d: the hand is already over", i+1)
+		}
+		if a.Street != g.CurrentPhase {
+			return g, fmt.Errorf("action %d: taken on the %s but the hand is on the %s", i+1, a.Street, g.CurrentPhase)
+		}
+		if pos, ok := index[a.Seat]; !ok || pos != g.CurrentPos {
+			return g, fmt.Errorf("action %d: seat %d acted but seat %d was to act", i+1, a.Seat, seats[g.CurrentPos].Number)
+		}
+		action, amount := a.Action, 0
+		switch a.Action {
+		case game.Bet:
+			amount = a.To
+		case game.Raise:
+			amount = a.To - g.CurrentBet
+		}
+		if a.AllIn && a.Action != game.Fold && a.Action != game.Check {
+			action = game.AllIn
+		}
+		if !g.ProcessAction(action, amount) {
+			return g, fmt.Errorf("action %d: seat %d can't %s %d", i+1, a.Seat, a.Action, a.To)
+		}
+	}
+	if !g.IsHandOver() {
+		return g, fmt.Errorf("the history ends with seat %d to act", seats[g.CurrentPos].Number)
+	}
+	if got == nil {
+		return g, fmt.Errorf("the hand did not finish")
+	}
+	return g, compareReplay(h, got, seats)
+}
+
+// Validate checks a hand by replaying it, see Replay
+func (h *Hand) Validate() error {
+	_, err := Replay(h)
+	return err
+}
+
+// replayDeck stacks the known cards where the engine deals them, filling
+// unknown hole cards, burn cards and board cards from the rest of the deck
+func replayDeck(h *Hand, seats []Seat, dealer int) ([]game.Card, error) {
+	used := make(map[game.Card]bool)
+	known := append([]game.Card{}, h.Board...)
+	for _, s := range seats {
+		if len(s.Cards) != 0 && len(s.Cards) != 2 {
+			return nil, fmt.Errorf("seat %d has %d hole cards", s.Number, len(s.Cards))
+		}
+		known = append(known, s.Cards...)
+	}
+	if len(h.Board) > 5 {
+		return nil, fmt.Errorf("%d board cards", len(h.Board))
+	}
+	for _, c := range known {
+		if used[c] {
+			return nil, fmt.Errorf("%s appears twice", c.Code())
+		}
+		used[c] = true
+	}
+	var spare []game.Card
+	for _, c := range game.NewDeck().Cards {
+		if !used[c] {
+			spare = append(spare, c)
+		}
+	}
+	next := func() game.Card {
+		c := spare[0]
+		spare = spare[1:]
+		return c
+	}
+
+	n := len(seats)
+	deck := make([]game.Card, 0, 2*n+8)
+	for round := 0; round < 2; round++ {
+		for j := 1; j <= n; j++ {
+			if s := seats[(dealer+j)%n]; len(s.Cards) == 2 {
+				deck = append(deck, s.Cards[round])
+			} else {
+				deck = append(deck, next())
+			}
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if i == 0 || i >= 3 {
+			deck = append(deck, next()) // burn
+		}
+		if i < len(h.Board) {
+			deck = append(deck, h.Board[i])
+		} else {
+			deck = append(deck, next())
+		}
+	}
+	return deck, nil
+}
+
+// compareReplay checks the hand the engine played against the history
+func compareReplay(h, got *Hand, seats []Seat) error {
+	// The recorder numbers seats from 1 in table order
+	for i := range got.Blinds {
+		got.Blinds[i].Seat = seats[got.Blinds[i].Seat-1].Number
+	}
+	for i := range got.Actions {
+		got.Actions[i].Seat = seats[got.Actions[i].Seat-1].Number
+	}
+	for i := range got.Payouts {
+		got.Payouts[i].Seat = seats[got.Payouts[i].Seat-1].Number
+	}
+
+	for i, b := range h.Blinds {
+		if g := got.Blinds[i]; g.Seat != b.Seat || g.Amount != b.Amount {
+			return fmt.Errorf("seat %d posted %d but the engine had seat %d post %d", b.Seat, b.Amount, g.Seat, g.Amount)
+		}
+	}
+	for i, a := range h.Actions {
+		g := got.Actions[i]
+		if g.Action != a.Action || g.Amount != a.Amount || g.To != a.To {
+			return fmt.Errorf("action %d: seat %d %s %d to %d, but the engine made it %s %d to %d",
+				i+1, a.Seat, a.Action, a.Amount, a.To, g.Action, g.Amount, g.To)
+		}
+	}
+	if len(h.Board) != len(got.Board) {
+		return fmt.Errorf("the board has %d cards but the engine dealt %d", len(h.Board), len(got.Board))
+	}
+
+	for _, s := range seats {
+		if returned(h, s.Number) != returned(got, s.Number) {
+			return fmt.Errorf("seat %d had %d returned but the engine returned %d", s.Number, returned(h, s.Number), returned(got, s.Number))
+		}
+	}
+	if h.Rake > 0 || !showdownKnown(h) {
+		// Who won can't be checked, only that the pots add up
+		if got.TotalPot() != h.TotalPot()+h.Rake {
+			return fmt.Errorf("pots total %d but the engine's total %d", h.TotalPot()+h.Rake, got.TotalPot())
+		}
+		return nil
+	}
+	for _, s := range seats {
+		if h.Won(s.Number) != got.Won(s.Number) {
+			return fmt.Errorf("seat %d won %d but the engine awarded it %d", s.Number, h.Won(s.Number), got.Won(s.Number))
+		}
+	}
+	return nil
+}
+
+// returned returns the uncalled bet returned to a seat
+func returned(h *Hand, seat int) int {
+	total := 0
+	for _, p := range h.Payouts {
+		if p.Seat == seat && p.Pot == UncalledBetPot {
+			total += p.Amount
+		}
+	}
+	return total
+}
+
+// showdownKnown returns whether the cards of every player at showdown are known
+func showdownKnown(h *Hand) bool {
+	if !h.WentToShowdown() {
+		return true
+	}
+	for _, s := range h.Seats {
+		if _, folded := h.FoldedOn(s.Number); !folded && len(s.Cards) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,442 @@
+// Package league keeps leaderboards for seasons of play: net winnings from
+// cash hands, points from tournament finishes and hands played, ranked per
+// season, with a frozen snapshot of each season's standings once it ends.
+package league
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go-wasm-poker/pkg/history"
+	"go-wasm-poker/pkg/stats"
+)
+
+// DefaultPoints are the tournament points for first place, second place and
+// so on when a league isn't given its own
+var DefaultPoints = []int{10, 7, 5, 4, 3, 2, 1}
+
+// Metric is what a leaderboard ranks players by
+type Metric string
+
+const (
+	ByNet    Metric = "net"    // net chips won in cash hands
+	ByPoints Metric = "points" // tournament points
+	ByHands  Metric = "hands"  // hands played
+)
+
+// Standing is a player's record in a season. Rank is set in leaderboards,
+// with tied players sharing a rank.
+type Standing struct {
+	Rank        int    `json:"rank,omitempty"`
+	PlayerID    string `json:"player_id"`
+	Name        string `json:"name"`
+	Net         int    `json:"net"`
+	Points      int    `json:"points"`
+	Hands       int    `json:"hands"`
+	Tournaments int    `json:"tournaments"`
+}
+
+func (s *Standing) value(m Metric) int {
+	switch m {
+	case ByNet:
+		return s.Net
+	case ByPoints:
+		return s.Points
+	}
+	return s.Hands
+}
+
+// Snapshot is a season's final standings, by points
+type Snapshot struct {
+	Season     Season     `json:"season"`
+	ArchivedAt time.Time  `json:"archived_at"`
+	Standings  []Standing `json:"standings"`
+}
+
+// Tournament is a finished tournament. Finish lists the player IDs in
+// finishing order, the winner first.
+type Tournament struct {
+	ID     string            `json:"id"`
+	Time   time.Time         `json:"time"`
+	Finish []string          `json:"finish"`
+	Names  map[string]string `json:"names,omitempty"` // display names by player ID, optional
+}
+
+var (
+	// ErrUnknownSeason is returned for a season ID the league doesn't have
+	ErrUnknownSeason = errors.New("unknown season")
+	// ErrSeasonRunning is returned when archiving a season before it ends
+	ErrSeasonRunning = errors.New("season has not ended")
+	// ErrCounted is returned when adding a tournament that was already
+	// counted
+	ErrCounted = errors.New("already counted")
+)
+
+// League keeps the standings of every season. It is safe for concurrent
+// use. A hand or tournament counts toward every season its time falls in
+// that hasn't been archived yet, and only once.
+type League struct {
+	mu          sync.Mutex
+	saveMu      sync.Mutex // held while writing the file, so saves land in order
+	points      []int
+	seasons     []Season                        // by start
+	standings   map[string]map[string]*Standing // by season, then player
+	snapshots   map[string]*Snapshot
+	tournaments map[string]bool
+	hands       map[string]time.Time // by handKey, while a season they count in is open
+}
+
+// New creates a league that awards points[i] to the player finishing in
+// place i+1 of a tournament, and nothing below the last. DefaultPoints is
+// used when points is nil.
+func New(points []int) *League {
+	if points == nil {
+		points = DefaultPoints
+	}
+	return &League{
+		points:      append([]int{}, points...),
+		standings:   make(map[string]map[string]*Standing),
+		snapshots:   make(map[string]*Snapshot),
+		tournaments: make(map[string]bool),
+		hands:       make(map[string]time.Time),
+	}
+}
+
+// AddSeason adds a season. Seasons may overlap, but their IDs must differ.
+func (l *League) AddSeason(s Season) error {
+	if s.ID == "" {
+		return errors.New("season needs an ID")
+	}
+	if !s.End.After(s.Start) {
+		return fmt.Errorf("season %s ends before it starts", s.ID)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.standings[s.ID]; ok {
+		return fmt.Errorf("season %s already exists", s.ID)
+	}
+	l.seasons = append(l.seasons, s)
+	sort.SliceStable(l.seasons, func(i, j int) bool { return l.seasons[i].Start.Before(l.seasons[j].Start) })
+	l.standings[s.ID] = make(map[string]*Standing)
+	return nil
+}
+
+// Seasons returns every season, by start
+func (l *League) Seasons() []Season {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Season{}, l.seasons...)
+}
+
+// Season returns a season and whether it has been archived
+func (l *League) Season(id string) (Season, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range l.seasons {
+		if s.ID == id {
+			return s, l.snapshots[id] != nil, nil
+		}
+	}
+	return Season{}, false, ErrUnknownSeason
+}
+
+// open returns the standings of every unarchived season at t. The caller
+// holds mu.
+func (l *League) open(t time.Time) []map[string]*Standing {
+	var open []map[string]*Standing
+	for _, s := range l.seasons {
+		if s.Contains(t) && l.snapshots[s.ID] == nil {
+			open = append(open, l.standings[s.ID])
+		}
+	}
+	return open
+}
+
+func standing(players map[string]*Standing, id, name string) *Standing {
+	s := players[id]
+	if s == nil {
+		s = &Standing{PlayerID: id}
+		players[id] = s
+	}
+	if name != "" {
+		s.Name = name
+	}
+	return s
+}
+
+// handKey identifies a hand by its table and ID
+func handKey(h *history.Hand) string {
+	return h.Table + "#" + h.ID
+}
+
+// AddHand counts a finished cash hand, ignoring a hand with the table and
+// ID of one already counted. Set it as a history.Recorder's OnHand.
+func (l *League) AddHand(h *history.Hand) {
+	counters := stats.Hand(h)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.hands[handKey(h)]; ok {
+		return
+	}
+	open := l.open(h.Time)
+	if len(open) > 0 {
+		l.hands[handKey(h)] = h.Time
+	}
+	for _, players := range open {
+		for _, seat := range h.Seats {
+			id := stats.PlayerID(&seat)
+			s := standing(players, id, seat.Name)
+			s.Net += counters[id].Net
+			s.Hands++
+		}
+	}
+}
+
+// HasHand reports whether a hand with the table and ID of h has been
+// counted in a season that is still open
+func (l *League) HasHand(h *history.Hand) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.hands[handKey(h)]
+	return ok
+}
+
+// AddTournament awards points for a tournament's finishing places. Each
+// tournament is only counted once; adding it again fails with ErrCounted.
+func (l *League) AddTournament(t Tournament) error {
+	if t.ID == "" {
+		return errors.New("tournament needs an ID")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tournaments[t.ID] {
+		return fmt.Errorf("tournament %s: %w", t.ID, ErrCounted)
+	}
+	l.tournaments[t.ID] = true
+	for _, players := range l.open(t.Time) {
+		for place, id := range t.Finish {
+			s := standing(players, id, t.Names[id])
+			s.Tournaments++
+			if place < len(l.points) {
+				s.Points += l.points[place]
+			}
+		}
+	}
+	return nil
+}
+
+// Leaderboard returns the top limit players of a season by a metric, all of
+// them when limit is zero or less. Ties are broken by player ID. An archived
+// season is ranked from its snapshot.
+func (l *League) Leaderboard(seasonID string, by Metric, limit int) ([]Standing, error) {
+	switch by {
+	case ByNet, ByPoints, ByHands:
+	default:
+		return nil, fmt.Errorf("unknown metric %q", by)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var list []Standing
+	if snap := l.snapshots[seasonID]; snap != nil {
+		list = append(list, snap.Standings...)
+	} else if players, ok := l.standings[seasonID]; ok {
+		for _, s := range players {
+			list = append(list, *s)
+		}
+	} else {
+		return nil, ErrUnknownSeason
+	}
+	rank(list, by)
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+// rank sorts standings by a metric and numbers them, tied players sharing a
+// rank
+func rank(list []Standing, by Metric) {
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i].value(by), list[j].value(by)
+		if a != b {
+			return a > b
+		}
+		return list[i].PlayerID < list[j].PlayerID
+	})
+	for i := range list {
+		list[i].Rank = i + 1
+		if i > 0 && list[i].value(by) == list[i-1].value(by) {
+			list[i].Rank = list[i-1].Rank
+		}
+	}
+}
+
+// Archive freezes a season's standings once it has ended at now. Archiving
+// an archived season returns its snapshot.
+func (l *League) Archive(seasonID string, now time.Time) (*Snapshot, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if snap := l.snapshots[seasonID]; snap != nil {
+		return copySnapshot(snap), nil
+	}
+	for _, s := range l.seasons {
+		if s.ID != seasonID {
+			continue
+		}
+		if !s.Ended(now) {
+			return nil, ErrSeasonRunning
+		}
+		return copySnapshot(l.archive(s, now)), nil
+	}
+	return nil, ErrUnknownSeason
+}
+
+// ArchiveEnded archives every season that has ended at now and returns the
+// new snapshots. Run it periodically, as after each week of a weekly league.
+func (l *League) ArchiveEnded(now time.Time) []*Snapshot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var snaps []*Snapshot
+	for _, s := range l.seasons {
+		if s.Ended(now) && l.snapshots[s.ID] == nil {
+			snaps = append(snaps, copySnapshot(l.archive(s, now)))
+		}
+	}
+	return snaps
+}
+
+// archive snapshots a season. The caller holds mu.
+func (l *League) archive(s Season, now time.Time) *Snapshot {
+	snap := &Snapshot{Season: s, ArchivedAt: now}
+	for _, st := range l.standings[s.ID] {
+		snap.Standings = append(snap.Standings, *st)
+	}
+	rank(snap.Standings, ByPoints)
+	l.snapshots[s.ID] = snap
+	// A hand no open season counts can't count again, so forget it
+	for key, t := range l.hands {
+		if len(l.open(t)) == 0 {
+			delete(l.hands, key)
+		}
+	}
+	return snap
+}
+
+// Snapshot returns an archived season's snapshot
+func (l *League) Snapshot(seasonID string) (*Snapshot, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	snap := l.snapshots[seasonID]
+	if snap == nil {
+		if _, ok := l.standings[seasonID]; ok {
+			return nil, fmt.Errorf("season %s is not archived", seasonID)
+		}
+		return nil, ErrUnknownSeason
+	}
+	return copySnapshot(snap), nil
+}
+
+func copySnapshot(s *Snapshot) *Snapshot {
+	c := *s
+	c.Standings = append([]Standing{}, s.Standings...)
+	return &c
+}
+
+// leagueFile is the on-disk form of a league
+type leagueFile struct {
+	Points      []int                           `json:"points"`
+	Seasons     []Season                        `json:"seasons"`
+	Standings   map[string]map[string]*Standing `json:"standings"`
+	Snapshots   map[string]*Snapshot            `json:"snapshots"`
+	Tournaments []string                        `json:"tournaments"`
+	Hands       map[string]time.Time            `json:"hands,omitempty"`
+}
+
+// Save writes the league to path, replacing the file only once it is
+// completely written
+func (l *League) Save(path string) error {
+	l.saveMu.Lock()
+	defer l.saveMu.Unlock()
+	l.mu.Lock()
+	f := leagueFile{
+		Points:    l.points,
+		Seasons:   l.seasons,
+		Standings: l.standings,
+		Snapshots: l.snapshots,
+		Hands:     l.hands,
+	}
+	for id := range l.tournaments {
+		f.Tournaments = append(f.Tournaments, id)
+	}
+	sort.Strings(f.Tournaments)
+	data, err := json.MarshalIndent(f, "", "  ")
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads a league written by Save
+func Load(path string) (*League, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading league %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Read reads a league in the form Save writes
+func Read(r io.Reader) (*League, error) {
+	var f leagueFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, err
+	}
+	l := New(f.Points)
+	l.seasons = f.Seasons
+	for _, s := range l.seasons {
+		l.standings[s.ID] = f.Standings[s.ID]
+		if l.standings[s.ID] == nil {
+			l.standings[s.ID] = make(map[string]*Standing)
+		}
+		if snap := f.Snapshots[s.ID]; snap != nil {
+			l.snapshots[s.ID] = snap
+		}
+	}
+	for _, id := range f.Tournaments {
+		l.tournaments[id] = true
+	}
+	for key, t := range f.Hands {
+		l.hands[key] = t
+	}
+	return l, nil
+}
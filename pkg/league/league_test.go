@@ -0,0 +1,260 @@
+package league
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-wasm-poker/pkg/game"
+	"go-wasm-poker/pkg/history"
+)
+
+var monday = time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+// blindSteal is a heads-up hand at a table where the small blind folds and
+// the big blind wins their 5 chips
+func blindSteal(table, id string, at time.Time, sb, bb string) *history.Hand {
+	return &history.Hand{
+		ID:         id,
+		Table:      table,
+		Time:       at,
+		SmallBlind: 5,
+		BigBlind:   10,
+		Seats:      []history.Seat{{Number: 1, PlayerID: sb, Name: sb}, {Number: 2, PlayerID: bb, Name: bb}},
+		Blinds:     []history.Blind{{Seat: 1, Amount: 5}, {Seat: 2, Amount: 10, Big: true}},
+		Actions:    []history.Action{{Street: game.PreFlop, Seat: 1, Action: game.Fold}},
+		Payouts:    []history.Payout{{Seat: 2, Pot: history.UncalledBetPot, Amount: 5}, {Seat: 2, Amount: 10}},
+	}
+}
+
+func newLeague(t *testing.T) *League {
+	t.Helper()
+	l := New([]int{10, 5, 2})
+	for _, s := range []Season{Weekly(monday), Weekly(monday.AddDate(0, 0, 7)), {ID: "march", Start: monday.AddDate(0, 0, -1), End: monday.AddDate(0, 1, 0)}} {
+		if err := l.AddSeason(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l
+}
+
+// ids returns the player IDs of standings with their ranks
+func ids(list []Standing) map[string]int {
+	ranks := make(map[string]int)
+	for _, s := range list {
+		ranks[s.PlayerID] = s.Rank
+	}
+	return ranks
+}
+
+func TestWeekly(t *testing.T) {
+	wed := time.Date(2026, 1, 14, 15, 30, 0, 0, time.UTC)
+	s := Weekly(wed)
+	if s.ID != "2026-W03" || !s.Start.Equal(time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC)) || !s.End.Equal(s.Start.AddDate(0, 0, 7)) {
+		t.Errorf("week of %v is %+v", wed, s)
+	}
+	if !s.Contains(s.Start) || s.Contains(s.End) || !s.Ended(s.End) || s.Ended(wed) {
+		t.Errorf("season %+v has the wrong bounds", s)
+	}
+	// ISO weeks belong to the year of their Thursday
+	if s := Weekly(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)); s.ID != "2026-W53" {
+		t.Errorf("1 January 2027 is in %s", s.ID)
+	}
+}
+
+func TestStandings(t *testing.T) {
+	l := newLeague(t)
+	week := Weekly(monday).ID
+	l.AddHand(blindSteal("t1", "1", monday.Add(time.Hour), "alice", "bob"))
+	l.AddHand(blindSteal("t1", "2", monday.Add(2*time.Hour), "bob", "alice"))
+	l.AddHand(blindSteal("t1", "3", monday.Add(3*time.Hour), "carol", "alice"))
+	// Next week's hand counts in the month but not this week
+	l.AddHand(blindSteal("t2", "1", monday.AddDate(0, 0, 8), "alice", "carol"))
+	if err := l.AddTournament(Tournament{ID: "sunday", Time: monday.Add(time.Hour), Finish: []string{"carol", "bob", "alice", "dave"}, Names: map[string]string{"dave": "Dave"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	net, err := l.Leaderboard(week, ByNet, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Standing{
+		{Rank: 1, PlayerID: "alice", Name: "alice", Net: 5, Points: 2, Hands: 3, Tournaments: 1},
+		{Rank: 2, PlayerID: "bob", Name: "bob", Net: 0, Points: 5, Hands: 2, Tournaments: 1},
+		{Rank: 2, PlayerID: "dave", Name: "Dave", Net: 0, Points: 0, Hands: 0, Tournaments: 1},
+		{Rank: 4, PlayerID: "carol", Name: "carol", Net: -5, Points: 10, Hands: 1, Tournaments: 1},
+	}
+	if !reflect.DeepEqual(net, want) {
+		t.Errorf("by net\n%+v\nwant\n%+v", net, want)
+	}
+	points, err := l.Leaderboard(week, ByPoints, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := ids(points); len(points) != 2 || r["carol"] != 1 || r["bob"] != 2 {
+		t.Errorf("top 2 by points %+v", points)
+	}
+	month, err := l.Leaderboard("march", ByHands, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if month[0].PlayerID != "alice" || month[0].Hands != 4 || month[0].Net != 0 {
+		t.Errorf("month by hands %+v", month)
+	}
+
+	if _, err := l.Leaderboard("nope", ByNet, 0); !errors.Is(err, ErrUnknownSeason) {
+		t.Errorf("unknown season returned %v", err)
+	}
+	if _, err := l.Leaderboard(week, "chips", 0); err == nil {
+		t.Error("unknown metric succeeded")
+	}
+	if err := l.AddSeason(Weekly(monday)); err == nil {
+		t.Error("added a season twice")
+	}
+	if err := l.AddSeason(Season{ID: "backwards", Start: monday, End: monday}); err == nil {
+		t.Error("added an empty season")
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	l := newLeague(t)
+	week := Weekly(monday).ID
+	h := blindSteal("t1", "1", monday.Add(time.Hour), "alice", "bob")
+	if l.HasHand(h) {
+		t.Fatal("has a hand before it was added")
+	}
+	l.AddHand(h)
+	// The same table and ID is the same hand, however it was read
+	again := *h
+	l.AddHand(&again)
+	// while another table may reuse the ID
+	l.AddHand(blindSteal("t2", "1", monday.Add(time.Hour), "alice", "bob"))
+	if !l.HasHand(h) {
+		t.Error("doesn't have a hand it counted")
+	}
+	board, _ := l.Leaderboard(week, ByNet, 0)
+	if len(board) != 2 || board[0].PlayerID != "bob" || board[0].Hands != 2 || board[0].Net != 10 {
+		t.Errorf("standings %+v after adding a hand twice", board)
+	}
+
+	tour := Tournament{ID: "sunday", Time: monday.Add(time.Hour), Finish: []string{"alice", "bob"}}
+	if err := l.AddTournament(tour); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.AddTournament(tour); !errors.Is(err, ErrCounted) {
+		t.Errorf("adding a tournament twice returned %v", err)
+	}
+	if err := l.AddTournament(Tournament{Finish: []string{"alice"}}); err == nil {
+		t.Error("added a tournament without an ID")
+	}
+	board, _ = l.Leaderboard(week, ByPoints, 0)
+	if board[0].PlayerID != "alice" || board[0].Points != 10 || board[0].Tournaments != 1 {
+		t.Errorf("standings %+v after adding a tournament twice", board)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	l := newLeague(t)
+	week := Weekly(monday)
+	h := blindSteal("t1", "1", monday.Add(time.Hour), "alice", "bob")
+	l.AddHand(h)
+	if _, err := l.Archive(week.ID, monday.Add(time.Hour)); !errors.Is(err, ErrSeasonRunning) {
+		t.Fatalf("archiving a running season returned %v", err)
+	}
+	if _, err := l.Snapshot(week.ID); err == nil {
+		t.Error("running season has a snapshot")
+	}
+
+	snaps := l.ArchiveEnded(week.End)
+	if len(snaps) != 1 || snaps[0].Season != week || len(snaps[0].Standings) != 2 {
+		t.Fatalf("archived %+v", snaps)
+	}
+	if _, archived, _ := l.Season(week.ID); !archived {
+		t.Error("season not archived")
+	}
+	// The month is still open, so the hand is still remembered and still
+	// can't count twice
+	l.AddHand(h)
+	if !l.HasHand(h) {
+		t.Error("forgot a hand the month counts")
+	}
+	l.AddHand(blindSteal("t1", "2", monday.Add(2*time.Hour), "alice", "bob"))
+	snap, err := l.Snapshot(week.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(snap, snaps[0]) {
+		t.Errorf("late hand changed the snapshot to %+v", snap)
+	}
+	board, _ := l.Leaderboard(week.ID, ByHands, 0)
+	if board[0].Hands != 1 {
+		t.Errorf("archived leaderboard %+v", board)
+	}
+	month, _ := l.Leaderboard("march", ByHands, 0)
+	if month[0].Hands != 2 {
+		t.Errorf("month leaderboard %+v", month)
+	}
+
+	// Once nothing open counts a hand, it is forgotten
+	l.ArchiveEnded(monday.AddDate(0, 1, 0))
+	if l.HasHand(h) {
+		t.Error("remembered a hand after every season it counts in was archived")
+	}
+	if again, err := l.Archive(week.ID, time.Now()); err != nil || !reflect.DeepEqual(again, snaps[0]) {
+		t.Errorf("archiving again returned %+v, %v", again, err)
+	}
+	if _, err := l.Archive("nope", time.Now()); !errors.Is(err, ErrUnknownSeason) {
+		t.Errorf("archiving an unknown season returned %v", err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	l := newLeague(t)
+	h := blindSteal("t1", "1", monday.Add(time.Hour), "alice", "bob")
+	l.AddHand(h)
+	if err := l.AddTournament(Tournament{ID: "sunday", Time: monday.Add(time.Hour), Finish: []string{"bob", "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	l.ArchiveEnded(Weekly(monday).End)
+	path := filepath.Join(t.TempDir(), "league.json")
+	if err := l.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Seasons(), l.Seasons()) {
+		t.Errorf("seasons %+v, want %+v", loaded.Seasons(), l.Seasons())
+	}
+	for _, s := range l.Seasons() {
+		want, _ := l.Leaderboard(s.ID, ByPoints, 0)
+		got, _ := loaded.Leaderboard(s.ID, ByPoints, 0)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("season %s: %+v, want %+v", s.ID, got, want)
+		}
+	}
+	if _, err := loaded.Snapshot(Weekly(monday).ID); err != nil {
+		t.Errorf("snapshot lost: %v", err)
+	}
+	// What was counted before saving isn't counted again
+	loaded.AddHand(h)
+	if err := loaded.AddTournament(Tournament{ID: "sunday", Time: monday.Add(time.Hour)}); !errors.Is(err, ErrCounted) {
+		t.Errorf("adding a loaded tournament again returned %v", err)
+	}
+	month, _ := loaded.Leaderboard("march", ByHands, 0)
+	if month[0].Hands != 1 {
+		t.Errorf("month %+v after adding a loaded hand again", month)
+	}
+	// Points are kept too
+	if err := loaded.AddTournament(Tournament{ID: "monday", Time: monday.Add(time.Hour), Finish: []string{"carol"}}); err != nil {
+		t.Fatal(err)
+	}
+	month, _ = loaded.Leaderboard("march", ByPoints, 1)
+	if month[0].PlayerID != "bob" || month[0].Points != 10 {
+		t.Errorf("month %+v", month)
+	}
+}
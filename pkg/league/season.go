@@ -0,0 +1,41 @@
+package league
+
+import (
+	"fmt"
+	"time"
+)
+
+// Season is a stretch of time a leaderboard covers, from Start up to but not
+// including End
+type Season struct {
+	ID    string    `json:"id"`
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Contains reports whether t falls in the season
+func (s Season) Contains(t time.Time) bool {
+	return !t.Before(s.Start) && t.Before(s.End)
+}
+
+// Ended reports whether the season is over at now
+func (s Season) Ended(now time.Time) bool {
+	return !now.Before(s.End)
+}
+
+// Weekly returns the season of the ISO week containing t, from Monday
+// midnight to the next in t's location, with an ID such as 2026-W03
+func Weekly(t time.Time) Season {
+	year, week := t.ISOWeek()
+	y, m, d := t.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+	id := fmt.Sprintf("%d-W%02d", year, week)
+	return Season{
+		ID:    id,
+		Name:  fmt.Sprintf("Week %d of %d", week, year),
+		Start: start,
+		End:   start.AddDate(0, 0, 7),
+	}
+}
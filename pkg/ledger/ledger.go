@@ -0,0 +1,349 @@
+// Package ledger keeps players' chips in a double-entry ledger in a store.
+// Every buy-in, cash-out, pot, rake, tournament fee and admin adjustment is
+// an immutable db.Transaction, and balances are derived from them rather
+// than kept in a mutable field.
+//
+// Chips live in accounts: a player's bankroll, a seat at a table, a
+// tournament's prize pool or the house's rake and fees. New chips come from
+// the issued account, whose balance is minus the chips issued, so all
+// balances always add up to zero.
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/game"
+	"go-wasm-poker/pkg/history"
+)
+
+// Transaction kinds
+const (
+	KindAdjustment = "adjustment"
+	KindBuyIn      = "buy_in"
+	KindCashOut    = "cash_out"
+	KindPot        = "pot"
+	KindTournament = "tournament_entry"
+	KindPrize      = "tournament_prize"
+)
+
+// House accounts
+const (
+	AccountIssued = "house:issued"
+	AccountRake   = "house:rake"
+	AccountFees   = "house:fees"
+)
+
+// PlayerAccount is a player's bankroll
+func PlayerAccount(playerID string) string { return "player:" + playerID }
+
+// SeatAccount holds the chips a player has in front of them at a table
+func SeatAccount(table, playerID string) string { return "seat:" + table + "/" + playerID }
+
+// TournamentAccount holds a tournament's prize pool
+func TournamentAccount(id string) string { return "tournament:" + id }
+
+// ErrInsufficientFunds is returned when an account would go below zero
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// Ledger posts transactions to a store and keeps the balances they add up
+// to. It assumes it is the only writer of the store's ledger.
+type Ledger struct {
+	store db.Store
+	// Now returns the time transactions are posted at, time.Now when nil
+	Now func() time.Time
+
+	mu       sync.Mutex
+	balances map[string]int
+	last     int64 // ID of the last transaction counted in balances
+}
+
+// Open reads the store's ledger and returns a ledger that posts to it
+func Open(ctx context.Context, store db.Store) (*Ledger, error) {
+	l := &Ledger{store: store, balances: make(map[string]int)}
+	txs, err := store.Transactions(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range txs {
+		l.count(tx)
+	}
+	return l, nil
+}
+
+// count adds a transaction to the balances. The caller holds mu or has the
+// only reference to l.
+func (l *Ledger) count(tx *db.Transaction) {
+	for _, e := range tx.Entries {
+		l.balances[e.Account] += e.Amount
+	}
+	l.last = tx.ID
+}
+
+// Balance returns an account's balance
+func (l *Ledger) Balance(account string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.balances[account]
+}
+
+// Balances returns every account's balance
+func (l *Ledger) Balances() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	balances := make(map[string]int, len(l.balances))
+	for account, b := range l.balances {
+		balances[account] = b
+	}
+	return balances
+}
+
+// post appends a transaction, first checking that the accounts in debit
+// can cover it. Entries for zero chips are left out, and when that leaves
+// nothing to move no transaction is posted and post returns nil.
+func (l *Ledger) post(ctx context.Context, kind, memo string, entries []db.Entry, debit ...string) (*db.Transaction, error) {
+	now := time.Now
+	if l.Now != nil {
+		now = l.Now
+	}
+	tx := &db.Transaction{Time: now().UTC(), Kind: kind, Memo: memo}
+	for _, e := range entries {
+		if e.Amount != 0 {
+			tx.Entries = append(tx.Entries, e)
+		}
+	}
+	if len(tx.Entries) == 0 {
+		return nil, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, account := range debit {
+		after := l.balances[account]
+		for _, e := range tx.Entries {
+			if e.Account == account {
+				after += e.Amount
+			}
+		}
+		if after < 0 {
+			return nil, fmt.Errorf("%s %s: %w: %s has %d", kind, memo, ErrInsufficientFunds, account, l.balances[account])
+		}
+	}
+	id, err := l.store.AppendTransaction(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	tx.ID = id
+	l.count(tx)
+	return tx, nil
+}
+
+func positive(kind string, amount int) error {
+	if amount <= 0 {
+		return fmt.Errorf("%s of %d chips", kind, amount)
+	}
+	return nil
+}
+
+// Adjust is an admin adjustment: it issues chips to a player's bankroll, or
+// takes them back when amount is negative. reason is recorded as the memo.
+func (l *Ledger) Adjust(ctx context.Context, playerID string, amount int, reason string) (*db.Transaction, error) {
+	if amount == 0 {
+		return nil, errors.New("adjustment of 0 chips")
+	}
+	return l.post(ctx, KindAdjustment, reason, []db.Entry{
+		{Account: AccountIssued, Amount: -amount},
+		{Account: PlayerAccount(playerID), Amount: amount},
+	}, PlayerAccount(playerID))
+}
+
+// BuyIn moves chips from a player's bankroll to their seat at a table
+func (l *Ledger) BuyIn(ctx context.Context, playerID, table string, amount int) (*db.Transaction, error) {
+	if err := positive(KindBuyIn, amount); err != nil {
+		return nil, err
+	}
+	return l.post(ctx, KindBuyIn, table, []db.Entry{
+		{Account: PlayerAccount(playerID), Amount: -amount},
+		{Account: SeatAccount(table, playerID), Amount: amount},
+	}, PlayerAccount(playerID))
+}
+
+// CashOut moves chips from a player's seat at a table back to their
+// bankroll
+func (l *Ledger) CashOut(ctx context.Context, playerID, table string, amount int) (*db.Transaction, error) {
+	if err := positive(KindCashOut, amount); err != nil {
+		return nil, err
+	}
+	return l.post(ctx, KindCashOut, table, []db.Entry{
+		{Account: SeatAccount(table, playerID), Amount: -amount},
+		{Account: PlayerAccount(playerID), Amount: amount},
+	}, SeatAccount(table, playerID))
+}
+
+// Pot records a finished hand at a table: each seat gains what it won less
+// what it put in, and the rake goes to the house. Set a closure calling it
+// as a history.Recorder's OnHand. A hand where nobody won or lost chips
+// posts nothing.
+func (l *Ledger) Pot(ctx context.Context, table string, h *history.Hand) (*db.Transaction, error) {
+	var entries []db.Entry
+	var debit []string
+	for _, s := range h.Seats {
+		account := SeatAccount(table, s.PlayerID)
+		entries = append(entries, db.Entry{Account: account, Amount: h.Won(s.Number) - h.Invested(s.Number)})
+		debit = append(debit, account)
+	}
+	entries = append(entries, db.Entry{Account: AccountRake, Amount: h.Rake})
+	return l.post(ctx, KindPot, "hand "+h.ID, entries, debit...)
+}
+
+// EnterTournament takes a tournament's buy-in and fee from a player's
+// bankroll, adding the buy-in to the prize pool and the fee to the house
+func (l *Ledger) EnterTournament(ctx context.Context, playerID, tournament string, buyIn, fee int) (*db.Transaction, error) {
+	if err := positive(KindTournament, buyIn+fee); err != nil {
+		return nil, err
+	}
+	if buyIn < 0 || fee < 0 {
+		return nil, fmt.Errorf("%s with buy-in %d and fee %d", KindTournament, buyIn, fee)
+	}
+	return l.post(ctx, KindTournament, tournament, []db.Entry{
+		{Account: PlayerAccount(playerID), Amount: -buyIn - fee},
+		{Account: TournamentAccount(tournament), Amount: buyIn},
+		{Account: AccountFees, Amount: fee},
+	}, PlayerAccount(playerID))
+}
+
+// Prize pays a player from a tournament's prize pool
+func (l *Ledger) Prize(ctx context.Context, playerID, tournament string, amount int) (*db.Transaction, error) {
+	if err := positive(KindPrize, amount); err != nil {
+		return nil, err
+	}
+	return l.post(ctx, KindPrize, tournament, []db.Entry{
+		{Account: TournamentAccount(tournament), Amount: -amount},
+		{Account: PlayerAccount(playerID), Amount: amount},
+	}, TournamentAccount(tournament))
+}
+
+// Report is the outcome of a reconciliation. Issued is the chips issued
+// less any taken back; the other totals are where those chips are now.
+type Report struct {
+	Transactions int
+	Issued       int
+	Players      int // in bankrolls
+	Tables       int // in seats
+	Tournaments  int // in prize pools
+	House        int // rake and fees
+	Problems     []string
+}
+
+// OK reports whether the ledger reconciled
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Reconcile rebuilds every balance from the store's transactions and checks
+// that the chips in bankrolls, at tables, in prize pools and with the house
+// add up to the chips issued, and that the ledger's own balances agree.
+// Each table in tables, by ID, must also have exactly the chips its seat
+// accounts say. Any difference is listed in the report's Problems.
+func (l *Ledger) Reconcile(ctx context.Context, tables map[string]*game.GameState) (*Report, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	txs, err := l.store.Transactions(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{Transactions: len(txs)}
+	balances := make(map[string]int)
+	for i, tx := range txs {
+		if tx.ID != int64(i)+1 {
+			r.Problems = append(r.Problems, fmt.Sprintf("transaction %d is numbered %d", i+1, tx.ID))
+		}
+		if err := db.ValidateTransaction(tx); err != nil {
+			r.Problems = append(r.Problems, fmt.Sprintf("transaction %d: %v", tx.ID, err))
+		}
+		for _, e := range tx.Entries {
+			balances[e.Account] += e.Amount
+		}
+	}
+
+	accounts := make([]string, 0, len(balances))
+	for account := range balances {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	for _, account := range accounts {
+		b := balances[account]
+		kind, _, _ := strings.Cut(account, ":")
+		switch {
+		case account == AccountIssued:
+			r.Issued = -b
+			continue
+		case kind == "player":
+			r.Players += b
+		case kind == "seat":
+			r.Tables += b
+		case kind == "tournament":
+			r.Tournaments += b
+		case kind == "house":
+			r.House += b
+		default:
+			r.Problems = append(r.Problems, fmt.Sprintf("unknown account %s holds %d", account, b))
+		}
+		if b < 0 {
+			r.Problems = append(r.Problems, fmt.Sprintf("%s is overdrawn by %d", account, -b))
+		}
+	}
+	if held := r.Players + r.Tables + r.Tournaments + r.House; held != r.Issued {
+		r.Problems = append(r.Problems, fmt.Sprintf("accounts hold %d chips but %d were issued", held, r.Issued))
+	}
+	if len(txs) > 0 && txs[len(txs)-1].ID != l.last {
+		r.Problems = append(r.Problems, fmt.Sprintf("the store has %d transactions but the ledger counted %d", txs[len(txs)-1].ID, l.last))
+	}
+	for account, b := range l.balances {
+		if balances[account] != b {
+			r.Problems = append(r.Problems, fmt.Sprintf("%s has %d but the ledger counted %d", account, balances[account], b))
+		}
+	}
+
+	ids := make([]string, 0, len(tables))
+	for id := range tables {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		r.Problems = append(r.Problems, checkTable(id, tables[id], balances)...)
+	}
+	return r, nil
+}
+
+// checkTable compares the chips in front of each player at a table with
+// their seat account
+func checkTable(id string, g *game.GameState, balances map[string]int) []string {
+	var problems []string
+	seated := make(map[string]bool)
+	for _, p := range g.Players {
+		seated[SeatAccount(id, p.ID)] = true
+		chips := p.Chips
+		if !g.IsHandOver() {
+			// Bets stay in the seat's account until the hand is recorded
+			chips += p.TotalBet
+		}
+		if b := balances[SeatAccount(id, p.ID)]; chips != b {
+			problems = append(problems, fmt.Sprintf("table %s: %s has %d chips but the ledger says %d", id, p.ID, chips, b))
+		}
+	}
+	prefix := SeatAccount(id, "")
+	for account, b := range balances {
+		if strings.HasPrefix(account, prefix) && !seated[account] && b != 0 {
+			problems = append(problems, fmt.Sprintf("table %s: %s is not seated but the ledger holds %d for them", id, strings.TrimPrefix(account, prefix), b))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
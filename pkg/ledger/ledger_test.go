@@ -0,0 +1,201 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/game"
+	"go-wasm-poker/pkg/history"
+)
+
+// tampered is a store whose ledger can be changed behind the Ledger's back
+type tampered struct {
+	db.Store
+	extra []*db.Transaction
+}
+
+func (s *tampered) Transactions(ctx context.Context, after int64, limit int) ([]*db.Transaction, error) {
+	txs, err := s.Store.Transactions(ctx, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range s.extra {
+		tx.ID = int64(len(txs)) + 1
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+func TestRejectUnbalanced(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMockSpaceTimeDB()
+	l, err := Open(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unbalanced := &db.Transaction{Kind: KindAdjustment, Entries: []db.Entry{
+		{Account: AccountIssued, Amount: -100},
+		{Account: PlayerAccount("alice"), Amount: 90},
+	}}
+	if _, err := store.AppendTransaction(ctx, unbalanced); !errors.Is(err, db.ErrUnbalanced) {
+		t.Fatalf("appending an unbalanced transaction returned %v", err)
+	}
+	if _, err := l.BuyIn(ctx, "alice", "t1", 50); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("buying in with an empty bankroll returned %v", err)
+	}
+	if _, err := l.Adjust(ctx, "alice", 0, "nothing"); err == nil {
+		t.Error("adjusting by 0 chips succeeded")
+	}
+	if txs, _ := store.Transactions(ctx, 0, 0); len(txs) != 0 {
+		t.Errorf("rejected transactions left %d in the store", len(txs))
+	}
+
+	// A transaction that got into the store unbalanced fails reconciliation
+	s := &tampered{Store: store, extra: []*db.Transaction{unbalanced}}
+	l, err = Open(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := l.Reconcile(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.OK() || !hasProblem(r, "does not balance") || !hasProblem(r, "accounts hold 90 chips but 100 were issued") {
+		t.Errorf("unbalanced ledger reported %q", r.Problems)
+	}
+}
+
+func hasProblem(r *Report, text string) bool {
+	for _, p := range r.Problems {
+		if strings.Contains(p, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBalances(t *testing.T) {
+	ctx := context.Background()
+	l, err := Open(ctx, db.NewMockSpaceTimeDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []func() (*db.Transaction, error){
+		func() (*db.Transaction, error) { return l.Adjust(ctx, "alice", 1000, "signup") },
+		func() (*db.Transaction, error) { return l.Adjust(ctx, "bob", 500, "signup") },
+		func() (*db.Transaction, error) { return l.Adjust(ctx, "bob", -100, "refund") },
+		func() (*db.Transaction, error) { return l.BuyIn(ctx, "alice", "t1", 300) },
+		func() (*db.Transaction, error) { return l.CashOut(ctx, "alice", "t1", 120) },
+		func() (*db.Transaction, error) { return l.EnterTournament(ctx, "alice", "mtt", 100, 10) },
+		func() (*db.Transaction, error) { return l.EnterTournament(ctx, "bob", "mtt", 100, 10) },
+		func() (*db.Transaction, error) { return l.Prize(ctx, "bob", "mtt", 150) },
+	}
+	for i, step := range steps {
+		if _, err := step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+	if _, err := l.Prize(ctx, "alice", "mtt", 51); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("paying more than the prize pool returned %v", err)
+	}
+
+	want := map[string]int{
+		AccountIssued:              -1400,
+		AccountFees:                20,
+		PlayerAccount("alice"):     710,
+		PlayerAccount("bob"):       440,
+		SeatAccount("t1", "alice"): 180,
+		TournamentAccount("mtt"):   50,
+	}
+	got := l.Balances()
+	if len(got) != len(want) {
+		t.Errorf("balances %v, want %v", got, want)
+	}
+	total := 0
+	for account, b := range want {
+		if got[account] != b {
+			t.Errorf("%s has %d, want %d", account, got[account], b)
+		}
+		total += got[account]
+	}
+	if total != 0 {
+		t.Errorf("balances add up to %d", total)
+	}
+
+	r, err := l.Reconcile(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.OK() || r.Transactions != len(steps) || r.Issued != 1400 || r.Players != 1150 || r.Tables != 180 || r.Tournaments != 50 || r.House != 20 {
+		t.Errorf("report %+v", r)
+	}
+}
+
+func TestReconcileTable(t *testing.T) {
+	ctx := context.Background()
+	l, err := Open(ctx, db.NewMockSpaceTimeDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var players []*game.Player
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("p%d", i)
+		players = append(players, game.NewPlayer(id, id, 200, i))
+		if _, err := l.Adjust(ctx, id, 500, "signup"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.BuyIn(ctx, id, "t1", 200); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := game.NewGameState(players, 5, 10)
+	g.SetSeed(1)
+	rec := history.NewRecorder(nil, "t1", 1)
+	rec.OnHand = func(h *history.Hand) {
+		if _, err := l.Pot(ctx, "t1", h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.Subscribe(rec.Observe)
+	for i := 0; i < 2; i++ {
+		g.StartNewHand()
+		for !g.IsHandOver() {
+			legal := g.LegalActions()
+			g.ProcessAction(legal[1].Action, legal[1].Min)
+		}
+	}
+	tables := map[string]*game.GameState{"t1": g}
+
+	r, err := l.Reconcile(ctx, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.OK() || r.Tables != 600 || r.Players != 900 {
+		t.Fatalf("report %+v", r)
+	}
+	moved := false
+	for _, p := range g.Players {
+		if b := l.Balance(SeatAccount("t1", p.ID)); b != p.Chips {
+			t.Errorf("%s has %d chips but a seat balance of %d", p.ID, p.Chips, b)
+		}
+		moved = moved || p.Chips != 200
+	}
+	if !moved {
+		t.Error("no chips changed hands")
+	}
+
+	// Chips that appear at the table without going through the ledger
+	g.Players[1].Chips += 25
+	r, err = l.Reconcile(ctx, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("table t1: p1 has %d chips but the ledger says %d", g.Players[1].Chips, g.Players[1].Chips-25)
+	if len(r.Problems) != 1 || r.Problems[0] != want {
+		t.Errorf("problems %q, want %q", r.Problems, want)
+	}
+}
@@ -0,0 +1,38 @@
+package rating
+
+import (
+	"sort"
+
+	"go-wasm-poker/pkg/db"
+)
+
+// Tables seats players at tables of at most seats players each, grouping
+// players of similar rating. As few tables as possible are used and their
+// sizes differ by at most one. Tables are ordered from the highest rated
+// down.
+func Tables(players []*db.PlayerProfile, seats int) [][]*db.PlayerProfile {
+	if len(players) == 0 || seats < 1 {
+		return nil
+	}
+	sorted := append([]*db.PlayerProfile{}, players...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := Of(sorted[i]), Of(sorted[j])
+		if a != b {
+			return a > b
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	total := len(sorted)
+	n := (total + seats - 1) / seats
+	tables := make([][]*db.PlayerProfile, n)
+	for i := range tables {
+		// The first total % n tables take one extra player
+		size := total / n
+		if i < total%n {
+			size++
+		}
+		tables[i], sorted = sorted[:size:size], sorted[size:]
+	}
+	return tables
+}
@@ -0,0 +1,177 @@
+// Package rating keeps a multiplayer Elo skill rating on each player's
+// profile. A tournament or a cash session is scored as if every pair of
+// players in it had played a game, the better placed player winning, and
+// the rating changes of all the pairs are averaged.
+package rating
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/league"
+)
+
+const (
+	// Initial is the rating of a player with no rated events
+	Initial = 1500.0
+	// DefaultK is the most a rating moves in one event
+	DefaultK = 32.0
+	// MaxHistory is the number of rating changes kept on a profile
+	MaxHistory = 100
+)
+
+// Of returns a profile's rating, Initial while it is unrated
+func Of(p *db.PlayerProfile) float64 {
+	if p.RatedGames == 0 {
+		return Initial
+	}
+	return p.Rating
+}
+
+// Update returns the ratings of players after an event. places[i] is the
+// finishing place of the player rated ratings[i], 1 being best; tied
+// players share a place and split their games. Each rating moves by at most
+// k.
+func Update(ratings []float64, places []int, k float64) []float64 {
+	n := len(ratings)
+	updated := append([]float64{}, ratings...)
+	if n < 2 {
+		return updated
+	}
+	for i := range ratings {
+		score := 0.0
+		for j := range ratings {
+			if i == j {
+				continue
+			}
+			expected := 1 / (1 + math.Pow(10, (ratings[j]-ratings[i])/400))
+			actual := 0.5
+			if places[i] < places[j] {
+				actual = 1
+			} else if places[i] > places[j] {
+				actual = 0
+			}
+			score += actual - expected
+		}
+		updated[i] += k * score / float64(n-1)
+	}
+	return updated
+}
+
+// Rater updates the ratings on profiles in a store as events finish.
+// Profiles are created for players the store doesn't know yet.
+type Rater struct {
+	store db.Store
+	// K is the most a rating moves in one event, DefaultK when zero
+	K float64
+
+	mu sync.Mutex // rates one event at a time, each from the ratings the last left
+}
+
+// NewRater creates a rater for the profiles in store
+func NewRater(store db.Store) *Rater {
+	return &Rater{store: store}
+}
+
+// Tournament rates the players of a finished tournament by finishing place
+func (r *Rater) Tournament(ctx context.Context, t league.Tournament) error {
+	places := make(map[string]int, len(t.Finish))
+	for i, id := range t.Finish {
+		places[id] = i + 1
+	}
+	return r.rate(ctx, t.ID, t.Time, places, t.Names)
+}
+
+// Session rates the players of a finished cash session by their net
+// results, players who won the same amount tying
+func (r *Rater) Session(ctx context.Context, id string, t time.Time, net map[string]int) error {
+	ids := make([]string, 0, len(net))
+	for player := range net {
+		ids = append(ids, player)
+	}
+	sort.Slice(ids, func(i, j int) bool { return net[ids[i]] > net[ids[j]] })
+	places := make(map[string]int, len(ids))
+	for i, player := range ids {
+		places[player] = i + 1
+		if i > 0 && net[player] == net[ids[i-1]] {
+			places[player] = places[ids[i-1]]
+		}
+	}
+	return r.rate(ctx, id, t, places, nil)
+}
+
+// rate applies one event's places to the players' profiles
+func (r *Rater) rate(ctx context.Context, event string, t time.Time, places map[string]int, names map[string]string) error {
+	if len(places) < 2 {
+		return fmt.Errorf("event %s needs at least two players to be rated", event)
+	}
+	k := r.K
+	if k == 0 {
+		k = DefaultK
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(places))
+	for id := range places {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	ratings := make([]float64, len(ids))
+	order := make([]int, len(ids))
+	for i, id := range ids {
+		p, err := r.store.LoadPlayerProfile(ctx, id)
+		if errors.Is(err, db.ErrNotFound) {
+			p, err = &db.PlayerProfile{ID: id}, nil
+		}
+		if err != nil {
+			return err
+		}
+		ratings[i], order[i] = Of(p), places[id]
+	}
+
+	updated := Update(ratings, order, k)
+	for i, id := range ids {
+		change := db.RatingChange{
+			Event:   event,
+			Time:    t,
+			Place:   order[i],
+			Players: len(ids),
+			Before:  ratings[i],
+			After:   updated[i],
+		}
+		// The store applies the change to the profile as it is then, so
+		// updates from elsewhere, such as hand counts, aren't lost
+		_, err := r.store.UpdatePlayerProfile(ctx, id, func(p *db.PlayerProfile) error {
+			if p.Name == "" {
+				p.Name = names[id]
+			}
+			p.RatingHistory = append(p.RatingHistory, change)
+			if extra := len(p.RatingHistory) - MaxHistory; extra > 0 {
+				p.RatingHistory = append([]db.RatingChange(nil), p.RatingHistory[extra:]...)
+			}
+			p.Rating = updated[i]
+			p.RatedGames++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// History returns a player's latest rating changes, oldest first
+func (r *Rater) History(ctx context.Context, playerID string) ([]db.RatingChange, error) {
+	p, err := r.store.LoadPlayerProfile(ctx, playerID)
+	if err != nil {
+		return nil, err
+	}
+	return p.RatingHistory, nil
+}
@@ -0,0 +1,148 @@
+package rating
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/league"
+)
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+
+func TestUpdate(t *testing.T) {
+	// The favourite of a 400 point gap is expected to score 10/11
+	favourite := 10.0 / 11
+	tests := []struct {
+		name    string
+		ratings []float64
+		places  []int
+		k       float64
+		want    []float64
+	}{
+		{"even", []float64{1500, 1500}, []int{1, 2}, 32, []float64{1516, 1484}},
+		{"half K", []float64{1500, 1500}, []int{2, 1}, 16, []float64{1492, 1508}},
+		{"favourite wins", []float64{1600, 1200}, []int{1, 2}, 32, []float64{1600 + 32*(1-favourite), 1200 - 32*(1-favourite)}},
+		{"upset", []float64{1600, 1200}, []int{2, 1}, 32, []float64{1600 - 32*favourite, 1200 + 32*favourite}},
+		{"tie", []float64{1500, 1500}, []int{1, 1}, 32, []float64{1500, 1500}},
+		{"tie with favourite", []float64{1600, 1200}, []int{1, 1}, 32, []float64{1600 - 32*(favourite-0.5), 1200 + 32*(favourite-0.5)}},
+		// Each pair counts once and the changes are averaged over the
+		// other players
+		{"three placed", []float64{1500, 1500, 1500}, []int{3, 1, 2}, 32, []float64{1484, 1516, 1500}},
+		{"four with a tie", []float64{1500, 1500, 1500, 1500}, []int{1, 2, 2, 4}, 30, []float64{1515, 1500, 1500, 1485}},
+		{"alone", []float64{1700}, []int{1}, 32, []float64{1700}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Update(tt.ratings, tt.places, tt.k)
+			sum := 0.0
+			for i := range got {
+				if !near(got[i], tt.want[i]) {
+					t.Errorf("ratings %v, want %v", got, tt.want)
+					break
+				}
+				sum += got[i] - tt.ratings[i]
+			}
+			if !near(sum, 0) {
+				t.Errorf("ratings changed by %v in total", sum)
+			}
+			if math.Abs(got[0]-tt.ratings[0]) > tt.k {
+				t.Errorf("rating moved by more than K")
+			}
+		})
+	}
+}
+
+func TestRater(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMockSpaceTimeDB()
+	if err := store.SavePlayerProfile(ctx, &db.PlayerProfile{ID: "carol", Name: "Carol", Rating: 1600, RatedGames: 3}); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRater(store)
+	r.K = 20
+	at := time.Date(2024, 3, 1, 20, 0, 0, 0, time.UTC)
+	// carol beats two new players at 1500, expected to score 0.64 against
+	// each of them
+	err := r.Tournament(ctx, league.Tournament{ID: "t1", Time: at, Finish: []string{"carol", "alice", "bob"}, Names: map[string]string{"alice": "Alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := 1 / (1 + math.Pow(10, -100.0/400))
+	wantCarol := 1600 + 20*(1-expected)
+	// alice beat bob and lost to carol
+	wantAlice := 1500 + 20*((1-0.5)+(0-(1-expected)))/2
+	wantBob := 1500 + 20*((0-0.5)+(0-(1-expected)))/2
+	for _, tt := range []struct {
+		id            string
+		name          string
+		place         int
+		before, after float64
+	}{
+		{"carol", "Carol", 1, 1600, wantCarol},
+		{"alice", "Alice", 2, 1500, wantAlice},
+		{"bob", "", 3, 1500, wantBob},
+	} {
+		p, err := store.LoadPlayerProfile(ctx, tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Name != tt.name || !near(Of(p), tt.after) || len(p.RatingHistory) != 1 {
+			t.Errorf("%s: profile %+v, want rating %v", tt.id, p, tt.after)
+			continue
+		}
+		want := db.RatingChange{Event: "t1", Time: at, Place: tt.place, Players: 3, Before: tt.before, After: p.Rating}
+		if got := p.RatingHistory[0]; got != want {
+			t.Errorf("%s: change %+v, want %+v", tt.id, got, want)
+		}
+	}
+
+	// A session ranks by net winnings, equal results tying
+	if err := r.Session(ctx, "s1", at, map[string]int{"alice": 50, "bob": 50, "dave": -100}); err != nil {
+		t.Fatal(err)
+	}
+	h, err := r.History(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 2 || h[1].Place != 1 || h[1].Before != wantBob {
+		t.Errorf("bob's history %+v", h)
+	}
+	if h, _ := r.History(ctx, "dave"); len(h) != 1 || h[0].Place != 3 || h[0].After >= Initial {
+		t.Errorf("dave's history %+v", h)
+	}
+	if err := r.Session(ctx, "s2", at, map[string]int{"alice": 10}); err == nil {
+		t.Error("rated a session with one player")
+	}
+}
+
+func TestTables(t *testing.T) {
+	var players []*db.PlayerProfile
+	for i, rating := range []float64{1450, 1700, 0, 1620, 1580, 1300, 1510} {
+		p := &db.PlayerProfile{ID: fmt.Sprintf("p%d", i), Rating: rating, RatedGames: 1}
+		if rating == 0 {
+			p.RatedGames = 0 // unrated, so 1500
+		}
+		players = append(players, p)
+	}
+	tables := Tables(players, 3)
+	want := [][]string{{"p1", "p3", "p4"}, {"p6", "p2"}, {"p0", "p5"}}
+	if len(tables) != len(want) {
+		t.Fatalf("got %d tables, want %d", len(tables), len(want))
+	}
+	for i, table := range tables {
+		var ids []string
+		for _, p := range table {
+			ids = append(ids, p.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(want[i]) {
+			t.Errorf("table %d seats %v, want %v", i, ids, want[i])
+		}
+	}
+	if Tables(players, 0) != nil || Tables(nil, 6) != nil {
+		t.Error("seated players at tables with no seats")
+	}
+}
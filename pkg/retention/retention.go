@@ -0,0 +1,297 @@
+// Package retention keeps a store from growing forever. A Janitor expires
+// games nobody has saved for a while, moves old hands out of the history
+// into archive files in cold storage and purges hands past a maximum age.
+// The ledger is never touched: its transactions are kept for good.
+//
+// A store that keeps complete hands behind its history entries, as
+// sqlstore does, loses them with the entries, so they are archived as well,
+// in Open Hand History format.
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/history"
+)
+
+// Policy says how long records are kept. A zero duration keeps them for
+// good.
+type Policy struct {
+	// GameTTL expires games whose state hasn't been saved for this long
+	GameTTL time.Duration
+	// ArchiveAfter moves hands played longer ago than this to cold storage
+	ArchiveAfter time.Duration
+	// PurgeAfter deletes hands played longer ago than this. Hands are
+	// archived first, so with a longer ArchiveAfter only the hands between
+	// the two ages are lost.
+	PurgeAfter time.Duration
+}
+
+// Report is what one pass of a janitor removed
+type Report struct {
+	Time          time.Time `json:"time"`
+	ExpiredGames  []string  `json:"expired_games,omitempty"`
+	ArchivedHands int       `json:"archived_hands,omitempty"`
+	Archive       string    `json:"archive,omitempty"` // the file they were written to
+	Hands         string    `json:"hands,omitempty"`   // the file their complete hands were written to
+	PurgedHands   int       `json:"purged_hands,omitempty"`
+}
+
+// Empty reports whether the pass removed nothing
+func (r *Report) Empty() bool {
+	return len(r.ExpiredGames) == 0 && r.ArchivedHands == 0 && r.PurgedHands == 0
+}
+
+func (r *Report) String() string {
+	if r.Empty() {
+		return "nothing removed"
+	}
+	var parts []string
+	if n := len(r.ExpiredGames); n > 0 {
+		parts = append(parts, fmt.Sprintf("expired %d games (%s)", n, strings.Join(r.ExpiredGames, ", ")))
+	}
+	if r.ArchivedHands > 0 {
+		archived := fmt.Sprintf("archived %d hands to %s", r.ArchivedHands, r.Archive)
+		if r.Hands != "" {
+			archived += " and " + r.Hands
+		}
+		parts = append(parts, archived)
+	}
+	if r.PurgedHands > 0 {
+		parts = append(parts, fmt.Sprintf("purged %d hands", r.PurgedHands))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// HandLoader is implemented by stores that keep a complete hand behind a
+// history entry, such as sqlstore.Store. LoadHand returns a db.ErrNotFound
+// error for entries without one.
+type HandLoader interface {
+	LoadHand(ctx context.Context, id int64) (*history.Hand, error)
+}
+
+// Janitor applies a retention policy to a store
+type Janitor struct {
+	store   db.Store
+	policy  Policy
+	coldDir string
+	// Now returns the current time, time.Now when nil
+	Now func() time.Time
+	// OnReport, when set, is called with every pass that removed something
+	OnReport func(*Report)
+}
+
+// New returns a janitor that applies policy to store, writing archived
+// hands to files in coldDir. coldDir may be empty when the policy archives
+// nothing.
+func New(store db.Store, policy Policy, coldDir string) (*Janitor, error) {
+	if policy.GameTTL < 0 || policy.ArchiveAfter < 0 || policy.PurgeAfter < 0 {
+		return nil, errors.New("retention periods can't be negative")
+	}
+	if policy.ArchiveAfter > 0 && coldDir == "" {
+		return nil, errors.New("archiving hands needs a cold storage directory")
+	}
+	return &Janitor{store: store, policy: policy, coldDir: coldDir}, nil
+}
+
+// Run makes one pass over the store, returning what it removed. When it
+// fails part way the report still says what was removed before that.
+func (j *Janitor) Run(ctx context.Context) (*Report, error) {
+	now := time.Now
+	if j.Now != nil {
+		now = j.Now
+	}
+	r := &Report{Time: now().UTC()}
+	var err error
+	if j.policy.GameTTL > 0 {
+		if r.ExpiredGames, err = j.store.ExpireGameStates(ctx, r.Time.Add(-j.policy.GameTTL)); err != nil {
+			return r, fmt.Errorf("expiring games: %w", err)
+		}
+	}
+	if j.policy.ArchiveAfter > 0 {
+		if err := j.archive(ctx, r, r.Time.Add(-j.policy.ArchiveAfter)); err != nil {
+			return r, fmt.Errorf("archiving hands: %w", err)
+		}
+	}
+	if j.policy.PurgeAfter > 0 {
+		if err := j.purge(ctx, r, r.Time.Add(-j.policy.PurgeAfter)); err != nil {
+			return r, fmt.Errorf("purging hands: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// old returns every hand played before before, oldest first
+func (j *Janitor) old(ctx context.Context, before time.Time) ([]*db.GameHistoryEntry, error) {
+	q := db.HistoryQuery{HistoryFilter: db.HistoryFilter{To: before}, Order: db.OldestFirst, Limit: db.MaxHistoryLimit}
+	var entries []*db.GameHistoryEntry
+	for {
+		page, err := j.store.QueryHistory(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page.Entries...)
+		if page.Next == "" {
+			return entries, nil
+		}
+		q.Cursor = page.Next
+	}
+}
+
+// remove deletes entries from the store, a page at a time
+func (j *Janitor) remove(ctx context.Context, entries []*db.GameHistoryEntry) (int, error) {
+	removed := 0
+	for len(entries) > 0 {
+		batch := entries
+		if len(batch) > db.MaxHistoryLimit {
+			batch = batch[:db.MaxHistoryLimit]
+		}
+		entries = entries[len(batch):]
+		ids := make([]int64, len(batch))
+		for i, e := range batch {
+			ids[i] = e.ID
+		}
+		n, err := j.store.DeleteHistory(ctx, ids)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// archive writes the hands played before before to a file in cold storage
+// and only then removes them from the store. Archives are snapshots
+// holding only history, read with db.ReadSnapshot and named after the
+// first and last entry IDs they hold. When the store is a HandLoader, the
+// complete hands go next to them in a gzipped OpenHH file, in entry order,
+// which history.Import reads once unzipped.
+func (j *Janitor) archive(ctx context.Context, r *Report, before time.Time) error {
+	entries, err := j.old(ctx, before)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	first, last := entries[0].ID, entries[0].ID
+	for _, e := range entries {
+		if e.ID < first {
+			first = e.ID
+		}
+		if e.ID > last {
+			last = e.ID
+		}
+	}
+	name := filepath.Join(j.coldDir, fmt.Sprintf("hands-%d-%d", first, last))
+	if loader, ok := j.store.(HandLoader); ok {
+		var hands []*history.Hand
+		for _, e := range entries {
+			h, err := loader.LoadHand(ctx, e.ID)
+			if errors.Is(err, db.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("hand %d: %w", e.ID, err)
+			}
+			hands = append(hands, h)
+		}
+		if len(hands) > 0 {
+			err := writeArchive(name+".ohh.gz", func(w io.Writer) error {
+				zw := gzip.NewWriter(w)
+				for _, h := range hands {
+					if err := history.WriteOpenHH(zw, h); err != nil {
+						return err
+					}
+				}
+				return zw.Close()
+			})
+			if err != nil {
+				return err
+			}
+			r.Hands = name + ".ohh.gz"
+		}
+	}
+	snap := &db.Snapshot{Format: db.SnapshotFormat, TakenAt: r.Time, History: entries}
+	err = writeArchive(name+".json.gz", func(w io.Writer) error { return db.WriteSnapshot(w, snap) })
+	if err != nil {
+		return err
+	}
+	r.Archive = name + ".json.gz"
+	r.ArchivedHands, err = j.remove(ctx, entries)
+	return err
+}
+
+// writeArchive writes a file to path durably, under a temporary name until
+// it is complete
+func writeArchive(path string, write func(io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// purge deletes the hands played before before, a page at a time
+func (j *Janitor) purge(ctx context.Context, r *Report, before time.Time) error {
+	q := db.HistoryQuery{HistoryFilter: db.HistoryFilter{To: before}, Order: db.OldestFirst, Limit: db.MaxHistoryLimit}
+	for {
+		page, err := j.store.QueryHistory(ctx, q)
+		if err != nil || len(page.Entries) == 0 {
+			return err
+		}
+		n, err := j.remove(ctx, page.Entries)
+		r.PurgedHands += n
+		if err != nil || n == 0 {
+			// Nothing removed means someone else deleted the page first
+			return err
+		}
+	}
+}
+
+// Loop runs a pass every interval until ctx is done, logging what each
+// pass removed and any error. Run it in its own goroutine.
+func (j *Janitor) Loop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r, err := j.Run(ctx)
+		if !r.Empty() {
+			log.Printf("Janitor: %s", r)
+			if j.OnReport != nil {
+				j.OnReport(r)
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Janitor: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
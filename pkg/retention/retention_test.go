@@ -0,0 +1,105 @@
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/db/sqlstore"
+	"go-wasm-poker/pkg/game"
+	"go-wasm-poker/pkg/history"
+)
+
+func TestArchiveKeepsCompleteHands(t *testing.T) {
+	ctx := context.Background()
+	store, err := sqlstore.Open(ctx, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	var players []*game.Player
+	for i := 0; i < 3; i++ {
+		players = append(players, game.NewPlayer(fmt.Sprintf("p%d", i), fmt.Sprintf("Player %d", i), 500, i))
+	}
+	g := game.NewGameState(players, 5, 10)
+	g.SetSeed(1)
+	rec := history.NewRecorder(nil, "table", 1)
+	rec.OnHand = func(h *history.Hand) {
+		if err := store.AddHand(ctx, "table", h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.Subscribe(rec.Observe)
+	for i := 0; i < 4; i++ {
+		g.StartNewHand()
+		for !g.IsHandOver() {
+			legal := g.LegalActions()
+			g.ProcessAction(legal[1].Action, legal[1].Min)
+		}
+	}
+	// A summary without a hand behind it is archived only as a summary
+	if err := store.AddGameHistoryEntry(ctx, "table", &db.GameHistoryEntry{Winner: "p0", PotSize: 20, Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := New(store, Policy{ArchiveAfter: time.Hour}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	r, err := j.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ArchivedHands != 5 || r.Hands == "" {
+		t.Fatalf("report %s", r)
+	}
+
+	f, err := os.Open(r.Archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	snap, err := db.ReadSnapshot(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.History) != 5 {
+		t.Errorf("archive holds %d entries, want 5", len(snap.History))
+	}
+
+	hf, err := os.Open(r.Hands)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hf.Close()
+	zr, err := gzip.NewReader(hf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := history.Import(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hands) != 4 || len(res.Rejected) > 0 {
+		t.Errorf("archived hands import as %d hands, rejecting %v", len(res.Hands), res.Rejected)
+	}
+	for _, h := range res.Hands {
+		if len(h.Actions) == 0 || len(h.Payouts) == 0 {
+			t.Errorf("hand %s archived without its actions or payouts", h.ID)
+		}
+	}
+
+	page, err := store.QueryHistory(ctx, db.HistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 0 {
+		t.Errorf("%d entries left after archiving", len(page.Entries))
+	}
+}
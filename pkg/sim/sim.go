@@ -0,0 +1,272 @@
+// Package sim plays bot-vs-bot matches on GameState without any UI and
+// measures how much each bot wins.
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sync"
+
+	"go-wasm-poker/pkg/bot"
+	"go-wasm-poker/pkg/game"
+	"go-wasm-poker/pkg/history"
+)
+
+// maxActionsPerHand guards against a bot and the engine looping forever
+const maxActionsPerHand = 1000
+
+// Config describes a match
+type Config struct {
+	Hands      int   // hands to play in total, cutting the last duplicate deal short if needed
+	Seed       int64 // seed the deal of every hand is derived from
+	Duplicate  bool  // replay every deal with the bots rotated through the seats
+	Workers    int   // goroutines playing hands, all CPUs when zero
+	SmallBlind int
+	BigBlind   int
+	Stack      int // every hand starts with this many chips in front of each bot
+	// History, when set, receives every hand in HistoryFormat, PokerStars
+	// text when that is nil
+	History       io.Writer
+	HistoryFormat func(io.Writer, *history.Hand) error
+	// OnHand, when set, receives every finished hand. It is called from the
+	// workers concurrently.
+	OnHand func(*history.Hand)
+}
+
+// Entrant is a bot taking part in a match. New is called once per worker so
+// that bots never have to be safe for concurrent use.
+type Entrant struct {
+	Name string
+	New  func() (bot.Bot, error)
+}
+
+// Result summarizes one bot's outcome
+type Result struct {
+	Name     string  `json:"name"`
+	Hands    int     `json:"hands"`
+	Net      int64   `json:"net_chips"`
+	BBPer100 float64 `json:"bb_per_100"`
+	CILow    float64 `json:"ci95_low"`
+	CIHigh   float64 `json:"ci95_high"`
+}
+
+// stats accumulates a bot's result per deal. With duplicate play a deal is
+// all rotations of one set of cards, which is what makes it a low-variance
+// sample.
+type stats struct {
+	deals int
+	hands int
+	sum   float64
+	sumSq float64
+}
+
+func (s *stats) add(net float64, hands int) {
+	s.deals++
+	s.hands += hands
+	s.sum += net
+	s.sumSq += net * net
+}
+
+func (s *stats) merge(o stats) {
+	s.deals += o.deals
+	s.hands += o.hands
+	s.sum += o.sum
+	s.sumSq += o.sumSq
+}
+
+// Run plays the match and returns one result per entrant, in order
+func Run(cfg Config, entrants []Entrant) ([]Result, error) {
+	n := len(entrants)
+	if n < 2 {
+		return nil, errors.New("a match needs at least two bots")
+	}
+	if cfg.BigBlind <= 0 || cfg.Stack <= 0 {
+		return nil, errors.New("blinds and stack must be positive")
+	}
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	rotations := 1
+	if cfg.Duplicate {
+		rotations = n
+	}
+	deals := (cfg.Hands + rotations - 1) / rotations
+	if cfg.History != nil {
+		cfg.History = &lockedWriter{w: cfg.History}
+	}
+
+	jobs := make(chan int, workers*4)
+	go func() {
+		for d := 0; d < deals; d++ {
+			jobs <- d
+		}
+		close(jobs)
+	}()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		totals   = make([]stats, n)
+		firstErr error
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local, err := work(cfg, entrants, rotations, jobs)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			for i := range totals {
+				totals[i].merge(local[i])
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	results := make([]Result, n)
+	for i, e := range entrants {
+		results[i] = summarize(e.Name, totals[i], cfg.BigBlind)
+	}
+	return results, nil
+}
+
+// work plays deals from jobs until it is closed
+func work(cfg Config, entrants []Entrant, rotations int, jobs <-chan int) ([]stats, error) {
+	n := len(entrants)
+	local := make([]stats, n)
+	bots := make([]bot.Bot, n)
+	for i, e := range entrants {
+		b, err := e.New()
+		if err != nil {
+			// Drain the queue so the other workers finish
+			for range jobs {
+			}
+			return local, fmt.Errorf("creating bot %s: %w", e.Name, err)
+		}
+		if c, ok := b.(io.Closer); ok {
+			defer c.Close()
+		}
+		bots[i] = b
+	}
+
+	net := make([]int, n)
+	for deal := range jobs {
+		for i := range net {
+			net[i] = 0
+		}
+		// The last deal may be cut short to play exactly cfg.Hands
+		played := rotations
+		if left := cfg.Hands - deal*rotations; left < played {
+			played = left
+		}
+		for r := 0; r < played; r++ {
+			if err := playHand(cfg, entrants, bots, deal, r, net); err != nil {
+				for range jobs {
+				}
+				return local, err
+			}
+		}
+		for i := range net {
+			local[i].add(float64(net[i]), played)
+		}
+	}
+	return local, nil
+}
+
+// playHand plays one hand of deal with the bots rotated by rotation seats,
+// adding each bot's winnings to net
+func playHand(cfg Config, entrants []Entrant, bots []bot.Bot, deal, rotation int, net []int) error {
+	n := len(bots)
+	seats := make([]bot.Bot, n)
+	owners := make([]int, n)
+	players := make([]*game.Player, n)
+	for s := 0; s < n; s++ {
+		owners[s] = (s + rotation) % n
+		seats[s] = bots[owners[s]]
+		players[s] = game.NewPlayer(fmt.Sprint(owners[s]), entrants[owners[s]].Name, cfg.Stack, s)
+	}
+
+	g := game.NewGameState(players, cfg.SmallBlind, cfg.BigBlind)
+	g.SetSeed(dealSeed(cfg.Seed, deal))
+	if cfg.History != nil || cfg.OnHand != nil {
+		rec := history.NewRecorder(cfg.History, "Simulation", int64(deal*n+rotation+1))
+		rec.Format = cfg.HistoryFormat
+		rec.OnHand = cfg.OnHand
+		g.Subscribe(rec.Observe)
+	}
+	// StartNewHand moves the button one seat on, so this puts it on deal % n
+	g.DealerPos = (deal%n + n - 1) % n
+	g.StartNewHand()
+
+	for actions := 0; !g.IsHandOver(); actions++ {
+		if actions > maxActionsPerHand {
+			return fmt.Errorf("hand %d did not finish", deal)
+		}
+		seat := g.CurrentPos
+		action, amount := seats[seat].Act(g, seat)
+		if !g.ProcessAction(action, amount) {
+			// An illegal choice costs the bot its hand
+			g.ProcessAction(game.Fold, 0)
+		}
+	}
+
+	for s, p := range players {
+		net[owners[s]] += p.Chips - cfg.Stack
+	}
+	return nil
+}
+
+// lockedWriter lets the workers share the history output. Each hand is
+// written in a single call, so hands never interleave.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// dealSeed spreads deal numbers over the seed space (SplitMix64)
+func dealSeed(seed int64, deal int) int64 {
+	z := uint64(seed) + uint64(deal+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// summarize converts chip totals into big blinds per 100 hands with a 95%
+// confidence interval from the spread of per-deal results
+func summarize(name string, s stats, bigBlind int) Result {
+	r := Result{Name: name, Hands: s.hands, Net: int64(s.sum)}
+	if s.deals == 0 {
+		return r
+	}
+	handsPerDeal := float64(s.hands) / float64(s.deals)
+	scale := 100 / handsPerDeal / float64(bigBlind)
+	mean := s.sum / float64(s.deals)
+	r.BBPer100 = mean * scale
+	if s.deals > 1 {
+		variance := (s.sumSq - s.sum*mean) / float64(s.deals-1)
+		if variance < 0 {
+			variance = 0
+		}
+		margin := 1.96 * math.Sqrt(variance/float64(s.deals)) * scale
+		r.CILow, r.CIHigh = r.BBPer100-margin, r.BBPer100+margin
+	} else {
+		r.CILow, r.CIHigh = r.BBPer100, r.BBPer100
+	}
+	return r
+}
@@ -0,0 +1,456 @@
+package spacetime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coder/websocket"
+)
+
+// maxMessage is the largest message the client reads, which bounds the
+// rows one update can carry
+const maxMessage = 32 << 20
+
+// ErrClosed is returned by calls on a client whose connection has ended
+var ErrClosed = errors.New("spacetime: connection closed")
+
+// ReducerError is returned when a reducer fails. Nothing it did was kept.
+type ReducerError struct {
+	Reducer string
+	Message string
+}
+
+func (e *ReducerError) Error() string {
+	return fmt.Sprintf("spacetime: reducer %s failed: %s", e.Reducer, e.Message)
+}
+
+// Client is a connection to a SpacetimeDB database. It is safe for
+// concurrent use.
+type Client struct {
+	conn         *websocket.Conn
+	identity     Identity
+	token        string
+	connectionID string
+	done         chan struct{}
+
+	mu        sync.Mutex
+	err       error // why the connection ended
+	nextID    uint32
+	pending   map[uint32]chan *ServerMessage
+	tables    map[string]map[string]json.RawMessage // rows by their encoding
+	tableIDs  map[string]uint32
+	nextSubID int
+	handlers  []handler
+}
+
+type handler struct {
+	id int
+	fn func(TableUpdate)
+}
+
+// Connect connects to the database named module on host, which is an
+// http, https, ws or wss URL. With an empty token the database makes up a
+// new identity; pass the token of an earlier connection, from Token, to
+// connect as the same identity again.
+func Connect(ctx context.Context, host, module, token string) (*Client, error) {
+	u, err := subscribeURL(host, module)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dial(ctx, u, token)
+	if err != nil {
+		return nil, err
+	}
+	if conn.Subprotocol() != Subprotocol {
+		conn.Close(websocket.StatusPolicyViolation, "unsupported subprotocol")
+		return nil, fmt.Errorf("spacetime: server doesn't speak %s", Subprotocol)
+	}
+	conn.SetReadLimit(maxMessage)
+
+	msg, err := readMessage(ctx, conn)
+	if err == nil && msg.IdentityToken == nil {
+		err = errors.New("spacetime: first message isn't an identity token")
+	}
+	if err != nil {
+		conn.Close(websocket.StatusProtocolError, "")
+		return nil, err
+	}
+	c := &Client{
+		conn:         conn,
+		identity:     msg.IdentityToken.Identity,
+		token:        msg.IdentityToken.Token,
+		connectionID: msg.IdentityToken.ConnectionID,
+		done:         make(chan struct{}),
+		pending:      make(map[uint32]chan *ServerMessage),
+		tables:       make(map[string]map[string]json.RawMessage),
+		tableIDs:     make(map[string]uint32),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// subscribeURL returns the WebSocket URL of a database
+func subscribeURL(host, module string) (string, error) {
+	u, err := url.Parse(strings.TrimRight(host, "/"))
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("spacetime: unsupported URL scheme %q", u.Scheme)
+	}
+	u.Path += "/v1/database/" + url.PathEscape(module) + "/subscribe"
+	return u.String(), nil
+}
+
+func readMessage(ctx context.Context, conn *websocket.Conn) (*ServerMessage, error) {
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var msg ServerMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("spacetime: malformed message: %w", err)
+	}
+	return &msg, nil
+}
+
+// Identity returns the client's identity
+func (c *Client) Identity() Identity {
+	return c.identity
+}
+
+// Token returns the token that reconnects as the client's identity. Keep it
+// secret.
+func (c *Client) Token() string {
+	return c.token
+}
+
+// ConnectionID returns the ID of this connection
+func (c *Client) ConnectionID() string {
+	return c.connectionID
+}
+
+// Done is closed when the connection ends
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended, or nil while it is open
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	err := c.conn.Close(websocket.StatusNormalClosure, "")
+	<-c.done
+	return err
+}
+
+// OnUpdate registers fn to receive every change to the cached rows, after
+// the cache has been updated. It runs on the goroutine reading from the
+// connection, so it must not block; it may read the cache.
+func (c *Client) OnUpdate(fn func(TableUpdate)) (unregister func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextSubID++
+	id := c.nextSubID
+	c.handlers = append(c.handlers[:len(c.handlers):len(c.handlers)], handler{id, fn})
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		hs := make([]handler, 0, len(c.handlers))
+		for _, h := range c.handlers {
+			if h.id != id {
+				hs = append(hs, h)
+			}
+		}
+		c.handlers = hs
+	}
+}
+
+// CallReducer runs a reducer with the given arguments and waits for it to
+// finish. A failed reducer returns a *ReducerError. The cache holds the
+// reducer's changes by the time CallReducer returns.
+func (c *Client) CallReducer(ctx context.Context, reducer string, args ...any) error {
+	if args == nil {
+		args = []any{}
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	id, reply := c.register()
+	msg, err := c.request(ctx, id, reply, &ClientMessage{CallReducer: &CallReducer{Reducer: reducer, Args: data, RequestID: id}})
+	if err != nil {
+		return err
+	}
+	if msg.TransactionUpdate == nil {
+		return errors.New("spacetime: unexpected reply to a reducer call")
+	}
+	switch status := msg.TransactionUpdate.Status; {
+	case status.Failed != nil:
+		return &ReducerError{Reducer: reducer, Message: *status.Failed}
+	case status.OutOfEnergy != nil:
+		return &ReducerError{Reducer: reducer, Message: "out of energy"}
+	}
+	return nil
+}
+
+// Subscribe replaces the client's subscription with the given queries, such
+// as "SELECT * FROM players WHERE id = 'alice'", and waits for their rows.
+// Rows no longer selected are removed from the cache.
+func (c *Client) Subscribe(ctx context.Context, queries ...string) error {
+	id, reply := c.register()
+	msg, err := c.request(ctx, id, reply, &ClientMessage{Subscribe: &Subscribe{QueryStrings: queries, RequestID: id}})
+	if err != nil {
+		return err
+	}
+	if msg.SubscriptionError != nil {
+		return fmt.Errorf("spacetime: subscription rejected: %s", msg.SubscriptionError.Error)
+	}
+	return nil
+}
+
+// register sets up a reply for a new request ID
+func (c *Client) register() (uint32, chan *ServerMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	reply := make(chan *ServerMessage, 1)
+	c.pending[c.nextID] = reply
+	return c.nextID, reply
+}
+
+// request sends a message and waits for the reply with its ID
+func (c *Client) request(ctx context.Context, id uint32, reply chan *ServerMessage, msg *ClientMessage) (*ServerMessage, error) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.conn.Write(ctx, websocket.MessageText, data); err != nil {
+		if e := c.Err(); e != nil {
+			return nil, e
+		}
+		return nil, err
+	}
+	select {
+	case m := <-reply:
+		return m, nil
+	case <-c.done:
+		select {
+		case m := <-reply:
+			return m, nil
+		default:
+			return nil, c.Err()
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) readLoop() {
+	defer close(c.done)
+	for {
+		msg, err := readMessage(context.Background(), c.conn)
+		if err != nil {
+			c.mu.Lock()
+			c.err = fmt.Errorf("%w: %v", ErrClosed, err)
+			c.mu.Unlock()
+			c.conn.CloseNow()
+			return
+		}
+		c.handle(msg)
+	}
+}
+
+// handle applies a message to the cache and hands it to whoever is waiting
+// for it
+func (c *Client) handle(msg *ServerMessage) {
+	var id uint32
+	var updates []TableUpdate
+	c.mu.Lock()
+	switch {
+	case msg.InitialSubscription != nil:
+		id = msg.InitialSubscription.RequestID
+		updates = c.replace(msg.InitialSubscription.DatabaseUpdate.Tables)
+	case msg.TransactionUpdate != nil:
+		tu := msg.TransactionUpdate
+		if tu.Status.Committed != nil {
+			updates = c.apply(tu.Status.Committed.Tables)
+		}
+		if tu.CallerConnectionID == c.connectionID {
+			id = tu.ReducerCall.RequestID
+		}
+	case msg.SubscriptionError != nil:
+		id = msg.SubscriptionError.RequestID
+	}
+	reply := c.pending[id]
+	handlers := c.handlers
+	c.mu.Unlock()
+
+	for _, u := range updates {
+		for _, h := range handlers {
+			h.fn(u)
+		}
+	}
+	if reply != nil {
+		reply <- msg
+	}
+}
+
+// apply adds and removes the rows of a transaction. The caller holds mu.
+func (c *Client) apply(tables []TableUpdate) []TableUpdate {
+	var applied []TableUpdate
+	for _, t := range tables {
+		c.tableIDs[t.TableName] = t.TableID
+		rows := c.table(t.TableName)
+		u := TableUpdate{TableID: t.TableID, TableName: t.TableName}
+		for _, row := range t.Deletes {
+			row = compact(row)
+			if _, ok := rows[string(row)]; ok {
+				delete(rows, string(row))
+				u.Deletes = append(u.Deletes, row)
+			}
+		}
+		for _, row := range t.Inserts {
+			row = compact(row)
+			if _, ok := rows[string(row)]; !ok {
+				rows[string(row)] = row
+				u.Inserts = append(u.Inserts, row)
+			}
+		}
+		if len(u.Deletes)+len(u.Inserts) > 0 {
+			u.NumRows = uint64(len(rows))
+			applied = append(applied, u)
+		}
+	}
+	return applied
+}
+
+// replace makes the cache hold exactly the rows of a new subscription,
+// returning the differences. The caller holds mu.
+func (c *Client) replace(tables []TableUpdate) []TableUpdate {
+	next := make(map[string]map[string]json.RawMessage)
+	for _, t := range tables {
+		c.tableIDs[t.TableName] = t.TableID
+		rows := next[t.TableName]
+		if rows == nil {
+			rows = make(map[string]json.RawMessage)
+			next[t.TableName] = rows
+		}
+		for _, row := range t.Inserts {
+			row = compact(row)
+			rows[string(row)] = row
+		}
+	}
+	names := make([]string, 0, len(c.tables)+len(next))
+	for name := range c.tables {
+		names = append(names, name)
+	}
+	for name := range next {
+		if _, ok := c.tables[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changed []TableUpdate
+	for _, name := range names {
+		old, rows := c.tables[name], next[name]
+		u := TableUpdate{TableID: c.tableIDs[name], TableName: name}
+		for key, row := range old {
+			if _, ok := rows[key]; !ok {
+				u.Deletes = append(u.Deletes, row)
+			}
+		}
+		for key, row := range rows {
+			if _, ok := old[key]; !ok {
+				u.Inserts = append(u.Inserts, row)
+			}
+		}
+		if len(u.Deletes)+len(u.Inserts) > 0 {
+			u.NumRows = uint64(len(rows))
+			sortRows(u.Deletes)
+			sortRows(u.Inserts)
+			changed = append(changed, u)
+		}
+	}
+	c.tables = next
+	return changed
+}
+
+// table returns a table's cached rows, creating it if needed. The caller
+// holds mu.
+func (c *Client) table(name string) map[string]json.RawMessage {
+	rows := c.tables[name]
+	if rows == nil {
+		rows = make(map[string]json.RawMessage)
+		c.tables[name] = rows
+	}
+	return rows
+}
+
+// compact removes insignificant space from a row, so that the same row
+// always has the same encoding
+func compact(row json.RawMessage) json.RawMessage {
+	var b bytes.Buffer
+	if err := json.Compact(&b, row); err != nil {
+		return row
+	}
+	return b.Bytes()
+}
+
+func sortRows(rows []json.RawMessage) {
+	sort.Slice(rows, func(i, j int) bool { return bytes.Compare(rows[i], rows[j]) < 0 })
+}
+
+// Rows returns the cached rows of a table, in a stable order
+func (c *Client) Rows(table string) []json.RawMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rows := make([]json.RawMessage, 0, len(c.tables[table]))
+	for _, row := range c.tables[table] {
+		rows = append(rows, row)
+	}
+	sortRows(rows)
+	return rows
+}
+
+// Find returns the first cached row of a table whose column has the given
+// value, decoded into dst, and whether there was one
+func (c *Client) Find(table, column string, value any, dst any) (bool, error) {
+	want, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	for _, row := range c.Rows(table) {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(row, &fields); err != nil {
+			return false, err
+		}
+		if got, ok := fields[column]; ok && bytes.Equal(compact(got), want) {
+			return true, json.Unmarshal(row, dst)
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,206 @@
+package spacetime_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go-wasm-poker/pkg/spacetime"
+	"go-wasm-poker/pkg/spacetime/spacetimetest"
+)
+
+type player struct {
+	ID    string `json:"id"`
+	Table string `json:"table"`
+	Chips int    `json:"chips"`
+}
+
+// newServer returns a server with a players table, a set_player reducer
+// that stores its argument and a failing reducer that changes a row first
+func newServer(t *testing.T) *spacetimetest.Server {
+	srv := spacetimetest.NewServer("poker")
+	t.Cleanup(srv.Close)
+	srv.CreateTable("players", "id")
+	srv.Reducer("set_player", func(tx *spacetimetest.Tx, args []json.RawMessage) error {
+		var p player
+		if len(args) != 1 {
+			return errors.New("want one player")
+		}
+		if err := json.Unmarshal(args[0], &p); err != nil {
+			return err
+		}
+		if _, err := tx.Delete("players", p.ID); err != nil {
+			return err
+		}
+		return tx.Insert("players", p)
+	})
+	srv.Reducer("broke", func(tx *spacetimetest.Tx, args []json.RawMessage) error {
+		if err := tx.Insert("players", player{ID: "ghost"}); err != nil {
+			return err
+		}
+		return errors.New("out of chips")
+	})
+	return srv
+}
+
+func connect(t *testing.T, srv *spacetimetest.Server, token string) *spacetime.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := spacetime.Connect(ctx, srv.URL, srv.Module, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func players(t *testing.T, c *spacetime.Client) map[string]player {
+	t.Helper()
+	got := make(map[string]player)
+	for _, row := range c.Rows("players") {
+		var p player
+		if err := json.Unmarshal(row, &p); err != nil {
+			t.Fatal(err)
+		}
+		got[p.ID] = p
+	}
+	return got
+}
+
+func TestConnect(t *testing.T) {
+	srv := newServer(t)
+	c := connect(t, srv, "")
+	if c.Identity() == "" || c.Token() == "" || c.ConnectionID() == "" {
+		t.Fatalf("connected as %q with token %q on connection %q", c.Identity(), c.Token(), c.ConnectionID())
+	}
+	other := connect(t, srv, "")
+	if other.Identity() == c.Identity() {
+		t.Error("two new connections got the same identity")
+	}
+	if c.Err() != nil {
+		t.Errorf("open connection has error %v", c.Err())
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	srv := newServer(t)
+	ctx := context.Background()
+	c := connect(t, srv, "")
+	for _, p := range []player{{"alice", "t1", 100}, {"bob", "t1", 200}, {"carol", "t2", 300}} {
+		if err := c.CallReducer(ctx, "set_player", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.Rows("players")) != 0 {
+		t.Fatal("rows cached before subscribing")
+	}
+
+	if err := c.Subscribe(ctx, "SELECT * FROM players WHERE table = 't1'"); err != nil {
+		t.Fatal(err)
+	}
+	got := players(t, c)
+	if len(got) != 2 || got["alice"].Chips != 100 || got["bob"].Chips != 200 {
+		t.Errorf("subscribed to t1, cached %v", got)
+	}
+
+	// Changes to selected rows reach the cache, others don't
+	var updates []spacetime.TableUpdate
+	unregister := c.OnUpdate(func(u spacetime.TableUpdate) { updates = append(updates, u) })
+	if err := c.CallReducer(ctx, "set_player", player{"alice", "t1", 150}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CallReducer(ctx, "set_player", player{"carol", "t2", 50}); err != nil {
+		t.Fatal(err)
+	}
+	unregister()
+	if got := players(t, c); got["alice"].Chips != 150 || len(got) != 2 {
+		t.Errorf("after updates cached %v", got)
+	}
+	if len(updates) != 1 || len(updates[0].Deletes) != 1 || len(updates[0].Inserts) != 1 {
+		t.Errorf("got updates %+v, want alice's row replaced", updates)
+	}
+
+	// A new subscription replaces the rows no longer selected
+	if err := c.Subscribe(ctx, "SELECT * FROM players WHERE id = 'carol'"); err != nil {
+		t.Fatal(err)
+	}
+	var p player
+	if ok, err := c.Find("players", "id", "carol", &p); err != nil || !ok || p.Chips != 50 {
+		t.Errorf("Find carol = %v, %v, %+v", ok, err, p)
+	}
+	if got := players(t, c); len(got) != 1 {
+		t.Errorf("subscribed to carol, cached %v", got)
+	}
+
+	if err := c.Subscribe(ctx, "SELECT * FROM nowhere"); err == nil {
+		t.Error("subscribing to a missing table succeeded")
+	}
+}
+
+func TestCallReducer(t *testing.T) {
+	srv := newServer(t)
+	ctx := context.Background()
+	c := connect(t, srv, "")
+	if err := c.Subscribe(ctx, "SELECT * FROM players"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.CallReducer(ctx, "set_player", player{"alice", "t1", 100}); err != nil {
+		t.Fatal(err)
+	}
+	// The reducer's changes are cached by the time the call returns
+	if got := players(t, c); got["alice"].Chips != 100 {
+		t.Errorf("after set_player cached %v", got)
+	}
+
+	err := c.CallReducer(ctx, "broke")
+	var re *spacetime.ReducerError
+	if !errors.As(err, &re) || re.Reducer != "broke" || re.Message != "out of chips" {
+		t.Fatalf("failing reducer returned %v, want a ReducerError", err)
+	}
+	if len(srv.Rows("players")) != 1 {
+		t.Errorf("failed reducer left rows %s", srv.Rows("players"))
+	}
+	if got := players(t, c); len(got) != 1 {
+		t.Errorf("after failed reducer cached %v", got)
+	}
+
+	if err := c.CallReducer(ctx, "missing"); !errors.As(err, &re) {
+		t.Errorf("missing reducer returned %v, want a ReducerError", err)
+	}
+	if err := c.CallReducer(ctx, "set_player", "not a player"); !errors.As(err, &re) {
+		t.Errorf("bad arguments returned %v, want a ReducerError", err)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	srv := newServer(t)
+	c := connect(t, srv, "")
+	identity, token := c.Identity(), c.Token()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(c.Err(), spacetime.ErrClosed) {
+		t.Errorf("closed client has error %v", c.Err())
+	}
+	if err := c.CallReducer(context.Background(), "set_player", player{ID: "alice"}); err == nil {
+		t.Error("call on a closed client succeeded")
+	}
+
+	again := connect(t, srv, token)
+	if again.Identity() != identity {
+		t.Errorf("reconnected as %s, want %s", again.Identity(), identity)
+	}
+	if again.ConnectionID() == c.ConnectionID() {
+		t.Error("reconnection reused the connection ID")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := spacetime.Connect(ctx, srv.URL, srv.Module, "not-a-token"); err == nil {
+		t.Error("connected with an unknown token")
+	}
+}
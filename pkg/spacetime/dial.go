@@ -0,0 +1,20 @@
+//go:build !js
+
+package spacetime
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/coder/websocket"
+)
+
+// dial opens the WebSocket, sending the token as a bearer token
+func dial(ctx context.Context, u, token string) (*websocket.Conn, error) {
+	opts := &websocket.DialOptions{Subprotocols: []string{Subprotocol}}
+	if token != "" {
+		opts.HTTPHeader = http.Header{"Authorization": {"Bearer " + token}}
+	}
+	conn, _, err := websocket.Dial(ctx, u, opts)
+	return conn, err
+}
@@ -0,0 +1,20 @@
+//go:build js
+
+package spacetime
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/coder/websocket"
+)
+
+// dial opens the WebSocket through the browser. Browsers can't set headers
+// on a WebSocket, so the token goes in the query string.
+func dial(ctx context.Context, u, token string) (*websocket.Conn, error) {
+	if token != "" {
+		u += "?token=" + url.QueryEscape(token)
+	}
+	conn, _, err := websocket.Dial(ctx, u, &websocket.DialOptions{Subprotocols: []string{Subprotocol}})
+	return conn, err
+}
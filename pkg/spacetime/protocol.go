@@ -0,0 +1,118 @@
+// Package spacetime is a client for SpacetimeDB's WebSocket protocol. It
+// connects to a database, receives an identity and a token to reconnect as
+// the same identity, calls reducers and keeps a local cache of the rows its
+// subscription queries select. It speaks the JSON flavor of the protocol and
+// builds for the server and for the WASM client alike.
+//
+// Package spacetimetest has an in-process server that speaks the same
+// protocol, for trying the client without a database.
+package spacetime
+
+import "encoding/json"
+
+// Subprotocol is the WebSocket subprotocol of the JSON protocol
+const Subprotocol = "v1.json.spacetimedb"
+
+// Identity identifies a client across connections, as a hex string
+type Identity string
+
+// Messages are JSON objects with a single key naming the message, so each of
+// ClientMessage and ServerMessage has exactly one field set.
+
+// ClientMessage is a message from a client to the database
+type ClientMessage struct {
+	CallReducer *CallReducer `json:"CallReducer,omitempty"`
+	Subscribe   *Subscribe   `json:"Subscribe,omitempty"`
+}
+
+// CallReducer asks the database to run a reducer. Args is a JSON array of
+// the reducer's arguments.
+type CallReducer struct {
+	Reducer   string          `json:"reducer"`
+	Args      json.RawMessage `json:"args"`
+	RequestID uint32          `json:"request_id"`
+	Flags     uint8           `json:"flags"`
+}
+
+// Subscribe replaces the client's subscription with the rows selected by
+// the queries
+type Subscribe struct {
+	QueryStrings []string `json:"query_strings"`
+	RequestID    uint32   `json:"request_id"`
+}
+
+// ServerMessage is a message from the database to a client
+type ServerMessage struct {
+	IdentityToken       *IdentityToken       `json:"IdentityToken,omitempty"`
+	InitialSubscription *InitialSubscription `json:"InitialSubscription,omitempty"`
+	TransactionUpdate   *TransactionUpdate   `json:"TransactionUpdate,omitempty"`
+	SubscriptionError   *SubscriptionError   `json:"SubscriptionError,omitempty"`
+}
+
+// IdentityToken is the first message on every connection
+type IdentityToken struct {
+	Identity     Identity `json:"identity"`
+	Token        string   `json:"token"`
+	ConnectionID string   `json:"connection_id"`
+}
+
+// InitialSubscription holds every row a new subscription selects
+type InitialSubscription struct {
+	DatabaseUpdate DatabaseUpdate `json:"database_update"`
+	RequestID      uint32         `json:"request_id"`
+	// TotalHostExecutionDuration is in microseconds
+	TotalHostExecutionDuration int64 `json:"total_host_execution_duration"`
+}
+
+// SubscriptionError reports queries the database rejected
+type SubscriptionError struct {
+	RequestID uint32 `json:"request_id"`
+	Error     string `json:"error"`
+}
+
+// TransactionUpdate reports a reducer call. The caller always receives it;
+// other clients receive it only when rows they subscribe to changed.
+type TransactionUpdate struct {
+	Status UpdateStatus `json:"status"`
+	// Timestamp is in microseconds since the Unix epoch
+	Timestamp          int64           `json:"timestamp"`
+	CallerIdentity     Identity        `json:"caller_identity"`
+	CallerConnectionID string          `json:"caller_connection_id"`
+	ReducerCall        ReducerCallInfo `json:"reducer_call"`
+	EnergyQuantaUsed   int64           `json:"energy_quanta_used"`
+	// TotalHostExecutionDuration is in microseconds
+	TotalHostExecutionDuration int64 `json:"total_host_execution_duration"`
+}
+
+// UpdateStatus is how a reducer call ended. Exactly one field is set.
+type UpdateStatus struct {
+	// Committed holds the changes to rows the receiver subscribes to
+	Committed *DatabaseUpdate `json:"Committed,omitempty"`
+	// Failed is the reducer's error; nothing was changed
+	Failed *string `json:"Failed,omitempty"`
+	// OutOfEnergy means the caller couldn't pay for the call
+	OutOfEnergy *struct{} `json:"OutOfEnergy,omitempty"`
+}
+
+// ReducerCallInfo describes the reducer call behind a transaction
+type ReducerCallInfo struct {
+	ReducerName string          `json:"reducer_name"`
+	ReducerID   uint32          `json:"reducer_id"`
+	Args        json.RawMessage `json:"args"`
+	RequestID   uint32          `json:"request_id"`
+}
+
+// DatabaseUpdate is a set of row changes
+type DatabaseUpdate struct {
+	Tables []TableUpdate `json:"tables"`
+}
+
+// TableUpdate is the changes to one table. A changed row appears as the
+// deletion of its old value and the insertion of its new one.
+type TableUpdate struct {
+	TableID   uint32            `json:"table_id"`
+	TableName string            `json:"table_name"`
+	NumRows   uint64            `json:"num_rows"`
+	Deletes   []json.RawMessage `json:"deletes"`
+	Inserts   []json.RawMessage `json:"inserts"`
+}
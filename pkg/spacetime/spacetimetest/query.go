@@ -0,0 +1,124 @@
+package spacetimetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// query is a parsed subscription query. The server understands
+//
+//	SELECT * FROM table
+//	SELECT * FROM table WHERE column = literal
+//
+// where a literal is a 'quoted string', a number, true or false.
+type query struct {
+	table  string
+	column string // empty when every row is selected
+	value  any
+}
+
+func parseQuery(s string) (*query, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	keyword := func(i int, word string) bool {
+		return i < len(tokens) && strings.EqualFold(tokens[i], word)
+	}
+	if len(tokens) < 4 || !keyword(0, "select") || tokens[1] != "*" || !keyword(2, "from") || !isIdent(tokens[3]) {
+		return nil, fmt.Errorf("unsupported query %q", s)
+	}
+	q := &query{table: tokens[3]}
+	switch {
+	case len(tokens) == 4:
+		return q, nil
+	case len(tokens) == 8 && keyword(4, "where") && isIdent(tokens[5]) && tokens[6] == "=":
+		q.column = tokens[5]
+		if q.value, err = literal(tokens[7]); err != nil {
+			return nil, fmt.Errorf("query %q: %v", s, err)
+		}
+		return q, nil
+	}
+	return nil, fmt.Errorf("unsupported query %q", s)
+}
+
+// tokenize splits a query into words, symbols and quoted strings, which keep
+// their quotes
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c) || c == ';':
+			i++
+		case c == '\'':
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == '\'' {
+					if j+1 < len(s) && s[j+1] == '\'' {
+						j++ // an escaped quote
+						continue
+					}
+					break
+				}
+			}
+			if j == len(s) {
+				return nil, fmt.Errorf("unterminated string in %q", s)
+			}
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+		case c == '*' || c == '=':
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			j := i
+			for j < len(s) && !unicode.IsSpace(rune(s[j])) && !strings.ContainsRune("*=;'", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func isIdent(s string) bool {
+	for i, c := range s {
+		if !(c == '_' || unicode.IsLetter(c) || i > 0 && unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// literal returns a literal's value as encoding/json would decode it
+func literal(s string) (any, error) {
+	switch {
+	case strings.HasPrefix(s, "'"):
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.EqualFold(s, "true"):
+		return true, nil
+	case strings.EqualFold(s, "false"):
+		return false, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid literal %s", s)
+	}
+	return f, nil
+}
+
+// matches reports whether the query selects a row of its table
+func (q *query) matches(row json.RawMessage) bool {
+	if q.column == "" {
+		return true
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(row, &fields); err != nil {
+		return false
+	}
+	return fields[q.column] == q.value
+}
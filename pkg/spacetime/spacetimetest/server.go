@@ -0,0 +1,611 @@
+// Package spacetimetest provides an in-process stand-in for a SpacetimeDB
+// database. It speaks the same WebSocket protocol as a real one, so a
+// spacetime.Client can be used against it offline. Tables and reducers are
+// declared in Go instead of being loaded from a module.
+package spacetimetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+
+	"go-wasm-poker/pkg/spacetime"
+)
+
+// sendQueue is how many messages a connection may fall behind by before the
+// server drops it
+const sendQueue = 256
+
+// ReducerFunc is a reducer. It gets its arguments as the JSON values of the
+// call. When it returns an error or panics, every change it made is undone.
+type ReducerFunc func(tx *Tx, args []json.RawMessage) error
+
+// Server is a fake database serving one module
+type Server struct {
+	// URL is the base URL to pass to spacetime.Connect
+	URL    string
+	Module string
+	srv    *httptest.Server
+
+	mu        sync.Mutex
+	tables    map[string]*table
+	reducers  map[string]ReducerFunc
+	reducerID map[string]uint32
+	tokens    map[string]spacetime.Identity
+	conns     map[*conn]bool
+}
+
+type table struct {
+	id         uint32
+	primaryKey string
+	rows       map[string]json.RawMessage // by primary key encoding
+}
+
+type conn struct {
+	ws       *websocket.Conn
+	identity spacetime.Identity
+	id       string
+	queries  []*query // guarded by Server.mu
+	send     chan []byte
+}
+
+// NewServer starts a server for the named module. Close it when done.
+func NewServer(module string) *Server {
+	s := &Server{
+		Module:    module,
+		tables:    make(map[string]*table),
+		reducers:  make(map[string]ReducerFunc),
+		reducerID: make(map[string]uint32),
+		tokens:    make(map[string]spacetime.Identity),
+		conns:     make(map[*conn]bool),
+	}
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close disconnects every client and stops the server
+func (s *Server) Close() {
+	s.mu.Lock()
+	var conns []*conn
+	for c := range s.conns {
+		conns = append(conns, c)
+		s.drop(c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.ws.Close(websocket.StatusGoingAway, "server closing")
+	}
+	s.srv.Close()
+}
+
+// CreateTable declares a table whose rows are JSON objects, identified by
+// the primaryKey column
+func (s *Server) CreateTable(name, primaryKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tables[name]; !ok {
+		s.tables[name] = &table{id: uint32(len(s.tables) + 1), primaryKey: primaryKey, rows: make(map[string]json.RawMessage)}
+	}
+}
+
+// Reducer declares a reducer
+func (s *Server) Reducer(name string, fn ReducerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.reducerID[name]; !ok {
+		s.reducerID[name] = uint32(len(s.reducerID) + 1)
+	}
+	s.reducers[name] = fn
+}
+
+// Rows returns a table's rows in primary key order
+func (s *Server) Rows(name string) []json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.tables[name]
+	if t == nil {
+		return nil
+	}
+	return t.sorted(nil)
+}
+
+// sorted returns the rows a query selects, or every row when q is nil, in
+// primary key order
+func (t *table) sorted(q *query) []json.RawMessage {
+	keys := make([]string, 0, len(t.rows))
+	for k := range t.rows {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rows := make([]json.RawMessage, 0, len(keys))
+	for _, k := range keys {
+		if q == nil || q.matches(t.rows[k]) {
+			rows = append(rows, t.rows[k])
+		}
+	}
+	return rows
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// identify returns the identity of a token, making up a new identity and
+// token when it is empty
+func (s *Server) identify(token string) (spacetime.Identity, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token == "" {
+		token = "fake-" + randomHex(24)
+		s.tokens[token] = spacetime.Identity(randomHex(32))
+	}
+	id, ok := s.tokens[token]
+	if !ok {
+		return "", "", errors.New("unknown token")
+	}
+	return id, token, nil
+}
+
+// ServeHTTP accepts clients at /v1/database/{module}/subscribe, taking the
+// token from a bearer Authorization header or the token query parameter
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/database/"+s.Module+"/subscribe" {
+		http.NotFound(w, r)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	identity, token, err := s.identify(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	ws, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		Subprotocols:       []string{spacetime.Subprotocol},
+		InsecureSkipVerify: true, // let browser clients on any origin connect
+	})
+	if err != nil {
+		return
+	}
+	if ws.Subprotocol() != spacetime.Subprotocol {
+		ws.Close(websocket.StatusPolicyViolation, "expected subprotocol "+spacetime.Subprotocol)
+		return
+	}
+	ws.SetReadLimit(32 << 20)
+	c := &conn{ws: ws, identity: identity, id: randomHex(16), send: make(chan []byte, sendQueue)}
+	hello, _ := json.Marshal(&spacetime.ServerMessage{IdentityToken: &spacetime.IdentityToken{
+		Identity:     identity,
+		Token:        token,
+		ConnectionID: c.id,
+	}})
+	if err := ws.Write(r.Context(), websocket.MessageText, hello); err != nil {
+		ws.CloseNow()
+		return
+	}
+	s.mu.Lock()
+	s.conns[c] = true
+	s.mu.Unlock()
+	go c.writeLoop()
+	defer func() {
+		s.mu.Lock()
+		s.drop(c)
+		s.mu.Unlock()
+	}()
+
+	for {
+		_, data, err := ws.Read(context.Background())
+		if err != nil {
+			return
+		}
+		var msg spacetime.ClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			ws.Close(websocket.StatusProtocolError, "malformed message")
+			return
+		}
+		switch {
+		case msg.CallReducer != nil:
+			s.call(c, msg.CallReducer)
+		case msg.Subscribe != nil:
+			s.subscribe(c, msg.Subscribe)
+		}
+	}
+}
+
+// drop forgets a connection and stops its writer. The caller holds mu.
+func (s *Server) drop(c *conn) {
+	if s.conns[c] {
+		delete(s.conns, c)
+		close(c.send)
+	}
+}
+
+func (c *conn) writeLoop() {
+	for data := range c.send {
+		if err := c.ws.Write(context.Background(), websocket.MessageText, data); err != nil {
+			c.ws.CloseNow()
+			for range c.send {
+			}
+			return
+		}
+	}
+}
+
+// queue sends a message to a connection, dropping the connection if it has
+// fallen too far behind. The caller holds mu.
+func (s *Server) queue(c *conn, msg *spacetime.ServerMessage) {
+	if !s.conns[c] {
+		return
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	select {
+	case c.send <- data:
+	default:
+		s.drop(c)
+		go c.ws.Close(websocket.StatusPolicyViolation, "client too slow")
+	}
+}
+
+func (s *Server) subscribe(c *conn, m *spacetime.Subscribe) {
+	start := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var queries []*query
+	for _, text := range m.QueryStrings {
+		q, err := parseQuery(text)
+		if err == nil && s.tables[q.table] == nil {
+			err = fmt.Errorf("no such table %q", q.table)
+		}
+		if err != nil {
+			s.queue(c, &spacetime.ServerMessage{SubscriptionError: &spacetime.SubscriptionError{RequestID: m.RequestID, Error: err.Error()}})
+			return
+		}
+		queries = append(queries, q)
+	}
+	c.queries = queries
+
+	var update spacetime.DatabaseUpdate
+	for _, name := range s.tableNames() {
+		t := s.tables[name]
+		var rows []json.RawMessage
+		for _, row := range t.sorted(nil) {
+			if c.selects(name, row) {
+				rows = append(rows, row)
+			}
+		}
+		if len(rows) > 0 {
+			update.Tables = append(update.Tables, spacetime.TableUpdate{
+				TableID: t.id, TableName: name, NumRows: uint64(len(rows)), Deletes: []json.RawMessage{}, Inserts: rows,
+			})
+		}
+	}
+	s.queue(c, &spacetime.ServerMessage{InitialSubscription: &spacetime.InitialSubscription{
+		DatabaseUpdate:             update,
+		RequestID:                  m.RequestID,
+		TotalHostExecutionDuration: time.Since(start).Microseconds(),
+	}})
+}
+
+// selects reports whether any of the connection's queries selects a row.
+// The caller holds mu.
+func (c *conn) selects(table string, row json.RawMessage) bool {
+	for _, q := range c.queries {
+		if q.table == table && q.matches(row) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableNames returns the table names in order. The caller holds mu.
+func (s *Server) tableNames() []string {
+	names := make([]string, 0, len(s.tables))
+	for name := range s.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) call(c *conn, m *spacetime.CallReducer) {
+	start := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := &Tx{Sender: c.identity, Timestamp: start, s: s}
+	err := s.run(tx, m)
+	update := &spacetime.TransactionUpdate{
+		Timestamp:          start.UnixMicro(),
+		CallerIdentity:     c.identity,
+		CallerConnectionID: c.id,
+		ReducerCall: spacetime.ReducerCallInfo{
+			ReducerName: m.Reducer,
+			ReducerID:   s.reducerID[m.Reducer],
+			Args:        m.Args,
+			RequestID:   m.RequestID,
+		},
+	}
+	if err != nil {
+		tx.rollback()
+		msg := err.Error()
+		update.Status.Failed = &msg
+		update.TotalHostExecutionDuration = time.Since(start).Microseconds()
+		s.queue(c, &spacetime.ServerMessage{TransactionUpdate: update})
+		return
+	}
+	changes := tx.changes()
+	update.TotalHostExecutionDuration = time.Since(start).Microseconds()
+	for other := range s.conns {
+		tables := other.filter(changes)
+		if other != c && len(tables) == 0 {
+			continue
+		}
+		u := *update
+		u.Status.Committed = &spacetime.DatabaseUpdate{Tables: tables}
+		if other != c {
+			// Only the caller learns the arguments
+			u.ReducerCall.Args = json.RawMessage("[]")
+		}
+		s.queue(other, &spacetime.ServerMessage{TransactionUpdate: &u})
+	}
+}
+
+// run runs a reducer, turning a panic into an error. The caller holds mu.
+func (s *Server) run(tx *Tx, m *spacetime.CallReducer) (err error) {
+	fn := s.reducers[m.Reducer]
+	if fn == nil {
+		return fmt.Errorf("no such reducer %q", m.Reducer)
+	}
+	var args []json.RawMessage
+	if err := json.Unmarshal(m.Args, &args); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("reducer panicked: %v", r)
+		}
+	}()
+	return fn(tx, args)
+}
+
+// filter returns the changes to rows the connection subscribes to. The
+// caller holds mu.
+func (c *conn) filter(changes []change) []spacetime.TableUpdate {
+	var tables []spacetime.TableUpdate
+	index := make(map[string]int)
+	for _, ch := range changes {
+		oldSel := ch.old != nil && c.selects(ch.table.name, ch.old)
+		newSel := ch.new != nil && c.selects(ch.table.name, ch.new)
+		if !oldSel && !newSel {
+			continue
+		}
+		i, ok := index[ch.table.name]
+		if !ok {
+			i = len(tables)
+			index[ch.table.name] = i
+			tables = append(tables, spacetime.TableUpdate{
+				TableID: ch.table.id, TableName: ch.table.name, Deletes: []json.RawMessage{}, Inserts: []json.RawMessage{},
+			})
+		}
+		if oldSel {
+			tables[i].Deletes = append(tables[i].Deletes, ch.old)
+		}
+		if newSel {
+			tables[i].Inserts = append(tables[i].Inserts, ch.new)
+		}
+	}
+	for i := range tables {
+		tables[i].NumRows = uint64(len(tables[i].Deletes) + len(tables[i].Inserts))
+	}
+	return tables
+}
+
+// Tx is a reducer's view of the database. Its changes are kept only if the
+// reducer succeeds.
+type Tx struct {
+	Sender    spacetime.Identity
+	Timestamp time.Time
+	s         *Server
+	undo      []undoEntry
+}
+
+// undoEntry is the value a row had before a change
+type undoEntry struct {
+	table string
+	key   string
+	old   json.RawMessage // nil when the row didn't exist
+}
+
+// change is a row's value before and after a transaction
+type change struct {
+	table    namedTable
+	old, new json.RawMessage
+}
+
+type namedTable struct {
+	name string
+	id   uint32
+}
+
+func (tx *Tx) table(name string) (*table, error) {
+	t := tx.s.tables[name]
+	if t == nil {
+		return nil, fmt.Errorf("no such table %q", name)
+	}
+	return t, nil
+}
+
+// encode returns a row's encoding and primary key
+func (t *table) encode(row any) (json.RawMessage, string, error) {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return nil, "", err
+	}
+	var b bytes.Buffer
+	if err := json.Compact(&b, data); err != nil {
+		return nil, "", err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b.Bytes(), &fields); err != nil {
+		return nil, "", fmt.Errorf("row is not an object: %v", err)
+	}
+	key, ok := fields[t.primaryKey]
+	if !ok {
+		return nil, "", fmt.Errorf("row has no %s", t.primaryKey)
+	}
+	return b.Bytes(), string(key), nil
+}
+
+func keyOf(key any) (string, error) {
+	data, err := json.Marshal(key)
+	return string(data), err
+}
+
+func (tx *Tx) set(name string, t *table, key string, row json.RawMessage) {
+	tx.undo = append(tx.undo, undoEntry{table: name, key: key, old: t.rows[key]})
+	if row == nil {
+		delete(t.rows, key)
+	} else {
+		t.rows[key] = row
+	}
+}
+
+// Insert adds a row, failing if its primary key is taken
+func (tx *Tx) Insert(name string, row any) error {
+	t, err := tx.table(name)
+	if err != nil {
+		return err
+	}
+	data, key, err := t.encode(row)
+	if err != nil {
+		return err
+	}
+	if _, ok := t.rows[key]; ok {
+		return fmt.Errorf("duplicate %s %s in %s", t.primaryKey, key, name)
+	}
+	tx.set(name, t, key, data)
+	return nil
+}
+
+// Update replaces the row with the same primary key, failing if there is
+// none
+func (tx *Tx) Update(name string, row any) error {
+	t, err := tx.table(name)
+	if err != nil {
+		return err
+	}
+	data, key, err := t.encode(row)
+	if err != nil {
+		return err
+	}
+	if _, ok := t.rows[key]; !ok {
+		return fmt.Errorf("no %s %s in %s", t.primaryKey, key, name)
+	}
+	tx.set(name, t, key, data)
+	return nil
+}
+
+// Delete removes the row with a primary key and reports whether there was
+// one
+func (tx *Tx) Delete(name string, key any) (bool, error) {
+	t, err := tx.table(name)
+	if err != nil {
+		return false, err
+	}
+	k, err := keyOf(key)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := t.rows[k]; !ok {
+		return false, nil
+	}
+	tx.set(name, t, k, nil)
+	return true, nil
+}
+
+// Find decodes the row with a primary key into dst and reports whether
+// there was one
+func (tx *Tx) Find(name string, key any, dst any) (bool, error) {
+	t, err := tx.table(name)
+	if err != nil {
+		return false, err
+	}
+	k, err := keyOf(key)
+	if err != nil {
+		return false, err
+	}
+	row, ok := t.rows[k]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(row, dst)
+}
+
+// Scan calls fn with every row of a table in primary key order until it
+// returns false
+func (tx *Tx) Scan(name string, fn func(row json.RawMessage) bool) error {
+	t, err := tx.table(name)
+	if err != nil {
+		return err
+	}
+	for _, row := range t.sorted(nil) {
+		if !fn(row) {
+			break
+		}
+	}
+	return nil
+}
+
+// rollback undoes every change
+func (tx *Tx) rollback() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		u := tx.undo[i]
+		t := tx.s.tables[u.table]
+		if u.old == nil {
+			delete(t.rows, u.key)
+		} else {
+			t.rows[u.key] = u.old
+		}
+	}
+	tx.undo = nil
+}
+
+// changes returns each changed row's first and last value, in the order
+// the rows were first touched
+func (tx *Tx) changes() []change {
+	var changes []change
+	seen := make(map[[2]string]bool)
+	for _, u := range tx.undo {
+		id := [2]string{u.table, u.key}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		t := tx.s.tables[u.table]
+		now := t.rows[u.key]
+		if !bytes.Equal(u.old, now) {
+			changes = append(changes, change{table: namedTable{u.table, t.id}, old: u.old, new: now})
+		}
+	}
+	return changes
+}
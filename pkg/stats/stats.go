@@ -0,0 +1,161 @@
+// Package stats computes poker statistics from finished hands: the standard
+// VPIP, PFR, 3-bet, aggression factor, WTSD and W$SD figures and net
+// winnings, per player and over any window of time. A Tracker also keeps the
+// hand counters of player profiles in a store current.
+package stats
+
+import (
+	"go-wasm-poker/pkg/game"
+	"go-wasm-poker/pkg/history"
+)
+
+// Counters are the raw counts behind a player's statistics. They add up
+// across hands, and the statistics are ratios of them.
+type Counters struct {
+	Hands           int `json:"hands"`
+	Voluntary       int `json:"voluntary"`         // hands with a voluntary preflop call, bet or raise
+	PreflopRaised   int `json:"preflop_raised"`    // hands with a preflop raise
+	ThreeBetChances int `json:"three_bet_chances"` // hands the player acted facing a single preflop raise
+	ThreeBets       int `json:"three_bets"`        // and reraised
+	PostflopAggr    int `json:"postflop_aggr"`     // bets and raises after the flop
+	PostflopCalls   int `json:"postflop_calls"`    // calls after the flop
+	SawFlop         int `json:"saw_flop"`
+	Showdowns       int `json:"showdowns"`
+	ShowdownsWon    int `json:"showdowns_won"`
+	HandsWon        int `json:"hands_won"` // hands the player collected chips from a pot
+	Net             int `json:"net"`       // chips won less chips put in
+	BiggestPot      int `json:"biggest_pot"`
+}
+
+// Add adds o's counts to c
+func (c *Counters) Add(o Counters) {
+	c.Hands += o.Hands
+	c.Voluntary += o.Voluntary
+	c.PreflopRaised += o.PreflopRaised
+	c.ThreeBetChances += o.ThreeBetChances
+	c.ThreeBets += o.ThreeBets
+	c.PostflopAggr += o.PostflopAggr
+	c.PostflopCalls += o.PostflopCalls
+	c.SawFlop += o.SawFlop
+	c.Showdowns += o.Showdowns
+	c.ShowdownsWon += o.ShowdownsWon
+	c.HandsWon += o.HandsWon
+	c.Net += o.Net
+	if o.BiggestPot > c.BiggestPot {
+		c.BiggestPot = o.BiggestPot
+	}
+}
+
+func percent(n, of int) float64 {
+	if of == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(of)
+}
+
+// VPIP is the percentage of hands the player voluntarily put chips in
+// preflop
+func (c Counters) VPIP() float64 { return percent(c.Voluntary, c.Hands) }
+
+// PFR is the percentage of hands the player raised preflop
+func (c Counters) PFR() float64 { return percent(c.PreflopRaised, c.Hands) }
+
+// ThreeBet is the percentage of chances to reraise a single preflop raise
+// that the player took
+func (c Counters) ThreeBet() float64 { return percent(c.ThreeBets, c.ThreeBetChances) }
+
+// AF is the aggression factor, postflop bets and raises per postflop call.
+// It is undefined without calls and then 0, like the percentages with
+// nothing to count.
+func (c Counters) AF() float64 {
+	if c.PostflopCalls == 0 {
+		return 0
+	}
+	return float64(c.PostflopAggr) / float64(c.PostflopCalls)
+}
+
+// WTSD is the percentage of hands the player saw the flop in that they
+// went to showdown in
+func (c Counters) WTSD() float64 { return percent(c.Showdowns, c.SawFlop) }
+
+// WSD is the percentage of showdowns the player won chips at, W$SD
+func (c Counters) WSD() float64 { return percent(c.ShowdownsWon, c.Showdowns) }
+
+// PlayerID returns the ID a seat's statistics are kept under: its player ID,
+// or its name for hands imported without IDs
+func PlayerID(s *history.Seat) string {
+	if s.PlayerID != "" {
+		return s.PlayerID
+	}
+	return s.Name
+}
+
+// Hand returns the counters of every player dealt into a hand, by PlayerID
+func Hand(h *history.Hand) map[string]Counters {
+	counters := make(map[string]Counters, len(h.Seats))
+	for i := range h.Seats {
+		counters[PlayerID(&h.Seats[i])] = seatCounters(h, h.Seats[i].Number)
+	}
+	return counters
+}
+
+func seatCounters(h *history.Hand, seat int) Counters {
+	c := Counters{Hands: 1}
+	raises := 0 // preflop raises so far; the big blind doesn't count
+	chance := false
+	for _, a := range h.Actions {
+		if a.Street != game.PreFlop {
+			if a.Seat == seat {
+				switch a.Action {
+				case game.Bet, game.Raise:
+					c.PostflopAggr++
+				case game.Call:
+					c.PostflopCalls++
+				}
+			}
+			continue
+		}
+		aggressive := a.Action == game.Bet || a.Action == game.Raise
+		if a.Seat == seat {
+			if raises == 1 {
+				chance = true
+				if aggressive {
+					c.ThreeBets++
+				}
+			}
+			switch a.Action {
+			case game.Call:
+				c.Voluntary = 1
+			case game.Bet, game.Raise:
+				c.Voluntary, c.PreflopRaised = 1, 1
+			}
+		}
+		if aggressive {
+			raises++
+		}
+	}
+	if chance {
+		c.ThreeBetChances = 1
+	}
+	if c.ThreeBets > 1 {
+		c.ThreeBets = 1
+	}
+
+	street, folded := h.FoldedOn(seat)
+	if len(h.Board) >= 3 && (!folded || street != game.PreFlop) {
+		c.SawFlop = 1
+	}
+	won := h.Won(seat)
+	if !folded && h.WentToShowdown() {
+		c.Showdowns = 1
+		if won > 0 {
+			c.ShowdownsWon = 1
+		}
+	}
+	if won > 0 {
+		c.HandsWon = 1
+	}
+	c.Net = won - h.Invested(seat)
+	c.BiggestPot = won
+	return c
+}
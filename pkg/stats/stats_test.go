@@ -0,0 +1,152 @@
+package stats
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"go-wasm-poker/pkg/game"
+	"go-wasm-poker/pkg/history"
+)
+
+// Every hand is three-handed at 5/10: alice on the button in seat 1, bob
+// in the small blind and carol in the big blind
+func newHand(id string, board int, actions []history.Action, payouts ...history.Payout) *history.Hand {
+	return &history.Hand{
+		ID:         id,
+		Time:       time.Date(2024, 1, 1, 0, 0, len(id), 0, time.UTC),
+		SmallBlind: 5,
+		BigBlind:   10,
+		ButtonSeat: 1,
+		Seats: []history.Seat{
+			{Number: 1, PlayerID: "alice", Stack: 1000},
+			{Number: 2, PlayerID: "bob", Stack: 1000},
+			{Number: 3, PlayerID: "carol", Stack: 1000},
+		},
+		Blinds:  []history.Blind{{Seat: 2, Amount: 5}, {Seat: 3, Amount: 10, Big: true}},
+		Actions: actions,
+		Board:   make([]game.Card, board),
+		Payouts: payouts,
+	}
+}
+
+func act(street game.GamePhase, seat int, action game.PlayerAction, amount, to int) history.Action {
+	return history.Action{Street: street, Seat: seat, Action: action, Amount: amount, To: to}
+}
+
+var (
+	// Folded to the big blind, who gets the small blind's chips
+	walk = newHand("1", 0, []history.Action{
+		act(game.PreFlop, 1, game.Fold, 0, 0),
+		act(game.PreFlop, 2, game.Fold, 0, 5),
+	}, history.Payout{Seat: 3, Pot: history.UncalledBetPot, Amount: 5}, history.Payout{Seat: 3, Amount: 10})
+
+	// alice opens, bob 3-bets, carol folds and alice calls, then takes the
+	// pot with a raise on the flop
+	threeBet = newHand("22", 3, []history.Action{
+		act(game.PreFlop, 1, game.Raise, 30, 30),
+		act(game.PreFlop, 2, game.Raise, 85, 90),
+		act(game.PreFlop, 3, game.Fold, 0, 10),
+		act(game.PreFlop, 1, game.Call, 60, 90),
+		act(game.Flop, 2, game.Bet, 100, 100),
+		act(game.Flop, 1, game.Raise, 300, 300),
+		act(game.Flop, 2, game.Fold, 0, 100),
+	}, history.Payout{Seat: 1, Pot: history.UncalledBetPot, Amount: 200}, history.Payout{Seat: 1, Amount: 390})
+
+	// A limped pot that carol folds on the river and alice wins at showdown
+	showdown = newHand("333", 5, []history.Action{
+		act(game.PreFlop, 1, game.Call, 10, 10),
+		act(game.PreFlop, 2, game.Call, 5, 10),
+		act(game.PreFlop, 3, game.Check, 0, 10),
+		act(game.Flop, 2, game.Check, 0, 0),
+		act(game.Flop, 3, game.Bet, 20, 20),
+		act(game.Flop, 1, game.Call, 20, 20),
+		act(game.Flop, 2, game.Call, 20, 20),
+		act(game.Turn, 2, game.Check, 0, 0),
+		act(game.Turn, 3, game.Check, 0, 0),
+		act(game.Turn, 1, game.Check, 0, 0),
+		act(game.River, 2, game.Bet, 50, 50),
+		act(game.River, 3, game.Fold, 0, 0),
+		act(game.River, 1, game.Call, 50, 50),
+	}, history.Payout{Seat: 1, Amount: 190})
+)
+
+func TestHand(t *testing.T) {
+	tests := []struct {
+		name   string
+		hand   *history.Hand
+		player string
+		want   Counters
+	}{
+		{"walk folder", walk, "alice", Counters{Hands: 1}},
+		{"walk small blind", walk, "bob", Counters{Hands: 1, Net: -5}},
+		{"walk big blind", walk, "carol", Counters{Hands: 1, HandsWon: 1, Net: 5, BiggestPot: 10}},
+		{"opener", threeBet, "alice", Counters{Hands: 1, Voluntary: 1, PreflopRaised: 1, PostflopAggr: 1, SawFlop: 1, HandsWon: 1, Net: 200, BiggestPot: 390}},
+		{"3-bettor", threeBet, "bob", Counters{Hands: 1, Voluntary: 1, PreflopRaised: 1, ThreeBetChances: 1, ThreeBets: 1, PostflopAggr: 1, SawFlop: 1, Net: -190}},
+		{"folds to a 3-bet", threeBet, "carol", Counters{Hands: 1, Net: -10}},
+		{"showdown winner", showdown, "alice", Counters{Hands: 1, Voluntary: 1, PostflopCalls: 2, SawFlop: 1, Showdowns: 1, ShowdownsWon: 1, HandsWon: 1, Net: 110, BiggestPot: 190}},
+		{"showdown loser", showdown, "bob", Counters{Hands: 1, Voluntary: 1, PostflopAggr: 1, PostflopCalls: 1, SawFlop: 1, Showdowns: 1, Net: -80}},
+		{"river folder", showdown, "carol", Counters{Hands: 1, PostflopAggr: 1, SawFlop: 1, Net: -30}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Hand(tt.hand)[tt.player]; got != tt.want {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	tr := NewTracker(nil)
+	for _, h := range []*history.Hand{showdown, walk, threeBet} {
+		if err := tr.Add(context.Background(), h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		player                             string
+		vpip, pfr, threeBet, af, wtsd, wsd float64
+	}{
+		// 2 of 3 hands voluntary, 1 raised, no 3-bet chance, 1 raise to 2
+		// calls postflop, 1 showdown of 2 flops and won it
+		{"alice", 200.0 / 3, 100.0 / 3, 0, 0.5, 50, 100},
+		// 3-bet the 1 chance, 2 bets to 1 call, lost the 1 showdown
+		{"bob", 200.0 / 3, 100.0 / 3, 100, 2, 50, 0},
+		// No calls to divide by, and saw a flop but no showdown
+		{"carol", 0, 0, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.player, func(t *testing.T) {
+			c := tr.Player(tt.player)
+			if c.Hands != 3 {
+				t.Errorf("%d hands", c.Hands)
+			}
+			for _, s := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"VPIP", c.VPIP(), tt.vpip},
+				{"PFR", c.PFR(), tt.pfr},
+				{"3-bet", c.ThreeBet(), tt.threeBet},
+				{"AF", c.AF(), tt.af},
+				{"WTSD", c.WTSD(), tt.wtsd},
+				{"W$SD", c.WSD(), tt.wsd},
+			} {
+				if math.Abs(s.got-s.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", s.name, s.got, s.want)
+				}
+			}
+		})
+	}
+
+	// The window holds only the hands played in it
+	from, to := walk.Time.Add(time.Second), showdown.Time
+	if c := tr.Window("carol", from, to); c.Hands != 1 || c.Net != -10 {
+		t.Errorf("window from %v to %v has %+v", from, to, c)
+	}
+	if got := tr.Player("carol").Net + tr.Player("alice").Net + tr.Player("bob").Net; got != 0 {
+		t.Errorf("net winnings add up to %d", got)
+	}
+}
@@ -0,0 +1,132 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go-wasm-poker/pkg/db"
+	"go-wasm-poker/pkg/history"
+)
+
+// result is one player's counters for one hand
+type result struct {
+	time     time.Time
+	counters Counters
+}
+
+// Tracker consumes finished hands and answers statistics queries about the
+// players in them. With a store it also keeps each player's profile
+// counters, GamesPlayed, GamesWon and BiggestPot, current.
+type Tracker struct {
+	store db.Store
+
+	mu      sync.Mutex
+	players map[string][]result // sorted by time
+}
+
+// NewTracker creates a tracker that updates profiles in store, which may be
+// nil
+func NewTracker(store db.Store) *Tracker {
+	return &Tracker{
+		store:   store,
+		players: make(map[string][]result),
+	}
+}
+
+// Add records a finished hand. Hands may arrive in any order. The hand's
+// statistics are kept even when updating a profile fails.
+func (t *Tracker) Add(ctx context.Context, h *history.Hand) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var errs []error
+	for _, s := range h.Seats {
+		id := PlayerID(&s)
+		c := seatCounters(h, s.Number)
+		t.insert(id, result{time: h.Time, counters: c})
+		if t.store != nil {
+			if err := t.updateProfile(ctx, id, s.Name, c); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Observe records a hand, logging any error. Set it as a history.Recorder's
+// OnHand.
+func (t *Tracker) Observe(h *history.Hand) {
+	if err := t.Add(context.Background(), h); err != nil {
+		log.Printf("Error updating stats for hand %s: %v", h.ID, err)
+	}
+}
+
+func (t *Tracker) insert(id string, r result) {
+	results := t.players[id]
+	i := sort.Search(len(results), func(i int) bool { return results[i].time.After(r.time) })
+	results = append(results, result{})
+	copy(results[i+1:], results[i:])
+	results[i] = r
+	t.players[id] = results
+}
+
+// updateProfile adds a hand to a player's profile, creating it if needed.
+// The store applies it in one step, so updates from elsewhere, such as
+// ratings, aren't lost.
+func (t *Tracker) updateProfile(ctx context.Context, id, name string, c Counters) error {
+	_, err := t.store.UpdatePlayerProfile(ctx, id, func(p *db.PlayerProfile) error {
+		if p.Name == "" {
+			p.Name = name
+		}
+		p.GamesPlayed++
+		if c.HandsWon > 0 {
+			p.GamesWon++
+		}
+		if c.BiggestPot > p.BiggestPot {
+			p.BiggestPot = c.BiggestPot
+		}
+		return nil
+	})
+	return err
+}
+
+// Player returns a player's counters over every hand recorded
+func (t *Tracker) Player(id string) Counters {
+	return t.Window(id, time.Time{}, time.Time{})
+}
+
+// Window returns a player's counters over the hands played at or after from
+// and before to. A zero from or to leaves that end of the window open.
+func (t *Tracker) Window(id string, from, to time.Time) Counters {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	results := t.players[id]
+	i := 0
+	if !from.IsZero() {
+		i = sort.Search(len(results), func(i int) bool { return !results[i].time.Before(from) })
+	}
+	j := len(results)
+	if !to.IsZero() {
+		j = sort.Search(len(results), func(i int) bool { return !results[i].time.Before(to) })
+	}
+	var c Counters
+	for ; i < j; i++ {
+		c.Add(results[i].counters)
+	}
+	return c
+}
+
+// Players returns the IDs of every player recorded, sorted
+func (t *Tracker) Players() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]string, 0, len(t.players))
+	for id := range t.players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -1,8 +1,10 @@
 package ui
 
 import (
+	"fmt"
 	"image"
 	"image/color"
+	"strings"
 
 	"gioui.org/layout"
 	"gioui.org/op"
@@ -53,16 +55,89 @@ type GameUI struct {
 	betAmount    int
 	windowSize   image.Point
 	cardImages   map[string]image.Image // For future card images
+	names        map[string]string      // of the players in the hand, by ID
+	status       string                 // what last happened at the table
+
+	// Invalidate, when set, is called whenever the game changes so the
+	// window can redraw
+	Invalidate func()
 }
 
 // NewGameUI creates a new game UI
 func NewGameUI(theme *Theme, gameState *game.GameState) *GameUI {
-	return &GameUI{
+	ui := &GameUI{
 		theme:      theme,
 		gameState:  gameState,
 		betAmount:  gameState.BigBlind,
 		cardImages: make(map[string]image.Image),
+		names:      make(map[string]string),
+	}
+	gameState.Subscribe(ui.handleEvent)
+	return ui
+}
+
+// handleEvent updates the table from what happens at it and redraws it
+func (ui *GameUI) handleEvent(e game.Event) {
+	switch e := e.(type) {
+	case game.HandStarted:
+		ui.names = make(map[string]string, len(e.Seats))
+		for _, s := range e.Seats {
+			ui.names[s.PlayerID] = s.Name
+		}
+		ui.resetBet(e.BigBlind)
+		ui.status = "New hand"
+	case game.PlayerActed:
+		ui.status = ui.describe(e)
+	case game.StreetDealt:
+		ui.resetBet(ui.gameState.BigBlind)
+		ui.status = e.Phase.String()
+	case game.PotAwarded:
+		if e.Pot == game.UncalledBetPot {
+			break
+		}
+		won := fmt.Sprintf("%s wins %d", ui.names[e.PlayerID], e.Amount)
+		if e.Pot > 0 {
+			won += " from a side pot"
+		}
+		if strings.Contains(ui.status, " wins ") {
+			won = ui.status + ", " + won
+		}
+		ui.status = won
+	case game.StateRestored:
+		ui.resetBet(ui.gameState.BigBlind)
+		ui.status = ""
+	}
+	if ui.Invalidate != nil {
+		ui.Invalidate()
+	}
+}
+
+// resetBet moves the bet slider back to the smallest bet
+func (ui *GameUI) resetBet(bigBlind int) {
+	ui.betSlider.Value = 0
+	ui.betAmount = bigBlind
+}
+
+// describe says what a player did
+func (ui *GameUI) describe(e game.PlayerActed) string {
+	name := ui.names[e.PlayerID]
+	var did string
+	switch e.Action {
+	case game.Fold:
+		did = "folds"
+	case game.Check:
+		did = "checks"
+	case game.Call:
+		did = fmt.Sprintf("calls %d", e.Amount)
+	case game.Bet:
+		did = fmt.Sprintf("bets %d", e.BetTo)
+	default:
+		did = fmt.Sprintf("raises to %d", e.BetTo)
+	}
+	if e.AllIn {
+		did += " and is all-in"
 	}
+	return name + " " + did
 }
 
 // SetWindowSize sets the window size
@@ -206,6 +281,10 @@ func (ui *GameUI) layoutPlayerInfo(gtx layout.Context) layout.Dimensions {
 				label := material.Body1(ui.theme.Theme, "Pot: "+string(rune(ui.gameState.Pot)))
 				return label.Layout(gtx)
 			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				label := material.Body1(ui.theme.Theme, ui.status)
+				return label.Layout(gtx)
+			}),
 		)
 	})
 }
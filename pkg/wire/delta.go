@@ -0,0 +1,294 @@
+package wire
+
+import (
+	"fmt"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// Field is a bit set of the parts of a view a delta changes
+type Field uint16
+
+const (
+	FieldViewer     Field = 1 << iota // Viewer and Seat
+	FieldPhase                        // Phase
+	FieldBoard                        // Board
+	FieldPot                          // Pot
+	FieldCurrentBet                   // CurrentBet
+	FieldMinRaise                     // MinRaise
+	FieldBlinds                       // SmallBlind and BigBlind
+	FieldDealer                       // DealerPos
+	FieldCurrentPos                   // CurrentPos
+	FieldHandOver                     // HandOver
+	FieldPlayers                      // some of Players
+	FieldLegal                        // Legal
+	FieldPayouts                      // Payouts
+
+	allFields = FieldPayouts<<1 - 1
+)
+
+// Delta is the difference between two views of the same table. The fields
+// named in Fields are set in View to their new values; players are sent one
+// by one in Players.
+type Delta struct {
+	Fields      Field          `json:"fields"`
+	View        game.View      `json:"view"`
+	PlayerCount int            `json:"player_count,omitempty"` // the number of players, when FieldPlayers is set
+	Players     []PlayerChange `json:"players,omitempty"`      // the players that changed, or all of them if the count did
+}
+
+// PlayerChange is a player whose seat view changed
+type PlayerChange struct {
+	Index  int           `json:"index"`
+	Player game.SeatView `json:"player"`
+}
+
+// Diff returns the delta that turns prev into next
+func Diff(prev, next *game.View) *Delta {
+	d := &Delta{}
+	set := func(f Field, changed bool) {
+		if changed {
+			d.Fields |= f
+		}
+	}
+	set(FieldViewer, prev.Viewer != next.Viewer || prev.Seat != next.Seat)
+	set(FieldPhase, prev.Phase != next.Phase)
+	set(FieldBoard, !sameCards(prev.Board, next.Board))
+	set(FieldPot, prev.Pot != next.Pot)
+	set(FieldCurrentBet, prev.CurrentBet != next.CurrentBet)
+	set(FieldMinRaise, prev.MinRaise != next.MinRaise)
+	set(FieldBlinds, prev.SmallBlind != next.SmallBlind || prev.BigBlind != next.BigBlind)
+	set(FieldDealer, prev.DealerPos != next.DealerPos)
+	set(FieldCurrentPos, prev.CurrentPos != next.CurrentPos)
+	set(FieldHandOver, prev.HandOver != next.HandOver)
+	set(FieldLegal, !sameLegal(prev.Legal, next.Legal))
+	set(FieldPayouts, !samePayouts(prev.Payouts, next.Payouts))
+	for i, p := range next.Players {
+		if len(prev.Players) != len(next.Players) || !sameSeat(prev.Players[i], p) {
+			d.Players = append(d.Players, PlayerChange{Index: i, Player: p})
+		}
+	}
+	if len(d.Players) > 0 || len(prev.Players) != len(next.Players) {
+		d.Fields |= FieldPlayers
+		d.PlayerCount = len(next.Players)
+	}
+	d.View = *next
+	d.View.Players = nil
+	return d
+}
+
+// Apply returns the view that results from applying the delta to prev,
+// which is left unchanged
+func (d *Delta) Apply(prev *game.View) (*game.View, error) {
+	v := *prev
+	has := func(f Field) bool { return d.Fields&f != 0 }
+	if has(FieldViewer) {
+		v.Viewer, v.Seat = d.View.Viewer, d.View.Seat
+	}
+	if has(FieldPhase) {
+		v.Phase = d.View.Phase
+	}
+	if has(FieldBoard) {
+		v.Board = d.View.Board
+	}
+	if has(FieldPot) {
+		v.Pot = d.View.Pot
+	}
+	if has(FieldCurrentBet) {
+		v.CurrentBet = d.View.CurrentBet
+	}
+	if has(FieldMinRaise) {
+		v.MinRaise = d.View.MinRaise
+	}
+	if has(FieldBlinds) {
+		v.SmallBlind, v.BigBlind = d.View.SmallBlind, d.View.BigBlind
+	}
+	if has(FieldDealer) {
+		v.DealerPos = d.View.DealerPos
+	}
+	if has(FieldCurrentPos) {
+		v.CurrentPos = d.View.CurrentPos
+	}
+	if has(FieldHandOver) {
+		v.HandOver = d.View.HandOver
+	}
+	if has(FieldLegal) {
+		v.Legal = d.View.Legal
+	}
+	if has(FieldPayouts) {
+		v.Payouts = d.View.Payouts
+	}
+	if has(FieldPlayers) {
+		players := make([]game.SeatView, d.PlayerCount)
+		copy(players, prev.Players)
+		sent := make([]bool, d.PlayerCount)
+		for _, c := range d.Players {
+			if c.Index < 0 || c.Index >= d.PlayerCount {
+				return nil, fmt.Errorf("%w: player %d of %d", ErrMalformed, c.Index, d.PlayerCount)
+			}
+			players[c.Index], sent[c.Index] = c.Player, true
+		}
+		for i := len(prev.Players); i < d.PlayerCount; i++ {
+			if !sent[i] {
+				return nil, fmt.Errorf("%w: new player %d not sent", ErrMalformed, i)
+			}
+		}
+		v.Players = players
+	}
+	return &v, nil
+}
+
+func (w *writer) delta(d *Delta) {
+	w.uvarint(int(d.Fields))
+	v := &d.View
+	has := func(f Field) bool { return d.Fields&f != 0 }
+	if has(FieldViewer) {
+		w.string(v.Viewer)
+		w.varint(v.Seat)
+	}
+	if has(FieldPhase) {
+		w.byte(byte(v.Phase))
+	}
+	if has(FieldBoard) {
+		w.cards(v.Board)
+	}
+	for _, f := range []struct {
+		field Field
+		value int
+	}{
+		{FieldPot, v.Pot},
+		{FieldCurrentBet, v.CurrentBet},
+		{FieldMinRaise, v.MinRaise},
+	} {
+		if has(f.field) {
+			w.uvarint(f.value)
+		}
+	}
+	if has(FieldBlinds) {
+		w.uvarint(v.SmallBlind)
+		w.uvarint(v.BigBlind)
+	}
+	if has(FieldDealer) {
+		w.uvarint(v.DealerPos)
+	}
+	if has(FieldCurrentPos) {
+		w.uvarint(v.CurrentPos)
+	}
+	if has(FieldHandOver) {
+		w.bool(v.HandOver)
+	}
+	if has(FieldPlayers) {
+		w.uvarint(d.PlayerCount)
+		w.uvarint(len(d.Players))
+		for _, c := range d.Players {
+			w.uvarint(c.Index)
+			w.player(c.Player)
+		}
+	}
+	if has(FieldLegal) {
+		w.legal(v.Legal)
+	}
+	if has(FieldPayouts) {
+		w.payouts(v.Payouts)
+	}
+}
+
+func (r *reader) delta() *Delta {
+	d := &Delta{Fields: Field(r.uvarint())}
+	if d.Fields&^allFields != 0 {
+		r.fail("invalid fields %#x", d.Fields)
+		return d
+	}
+	v := &d.View
+	has := func(f Field) bool { return d.Fields&f != 0 }
+	if has(FieldViewer) {
+		v.Viewer = r.string()
+		v.Seat = r.varint()
+	}
+	if has(FieldPhase) {
+		v.Phase = r.phase()
+	}
+	if has(FieldBoard) {
+		if v.Board = r.cards(5); v.Board == nil {
+			v.Board = []game.Card{}
+		}
+	}
+	if has(FieldPot) {
+		v.Pot = r.uvarint()
+	}
+	if has(FieldCurrentBet) {
+		v.CurrentBet = r.uvarint()
+	}
+	if has(FieldMinRaise) {
+		v.MinRaise = r.uvarint()
+	}
+	if has(FieldBlinds) {
+		v.SmallBlind = r.uvarint()
+		v.BigBlind = r.uvarint()
+	}
+	if has(FieldDealer) {
+		v.DealerPos = r.uvarint()
+	}
+	if has(FieldCurrentPos) {
+		v.CurrentPos = r.uvarint()
+	}
+	if has(FieldHandOver) {
+		v.HandOver = r.bool()
+	}
+	if has(FieldPlayers) {
+		d.PlayerCount = r.count(maxPlayers, "players")
+		n := r.count(d.PlayerCount, "changed players")
+		for i := 0; i < n && r.err == nil; i++ {
+			d.Players = append(d.Players, PlayerChange{Index: r.uvarint(), Player: r.player()})
+		}
+	}
+	if has(FieldLegal) {
+		v.Legal = r.legal()
+	}
+	if has(FieldPayouts) {
+		v.Payouts = r.payouts()
+	}
+	return d
+}
+
+func sameCards(a, b []game.Card) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameSeat(a, b game.SeatView) bool {
+	return a.ID == b.ID && a.Name == b.Name && a.Chips == b.Chips && a.Bet == b.Bet &&
+		a.TotalBet == b.TotalBet && a.Status == b.Status && a.HasCards == b.HasCards &&
+		a.Shown == b.Shown && sameCards(a.Cards, b.Cards)
+}
+
+func sameLegal(a, b []game.LegalAction) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func samePayouts(a, b []game.Payout) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
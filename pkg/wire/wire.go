@@ -0,0 +1,410 @@
+// Package wire implements a compact binary encoding of table views and
+// actions for sending to browser clients many times a second. Cards are one
+// byte, amounts are varints, and every message starts with a version byte
+// and a tag saying whether it holds a snapshot, a delta or an action. The
+// package has no dependencies outside the standard library and the game, so
+// it builds for the server and for the WASM client alike.
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// Version is the first byte of every message
+const Version = 1
+
+// ContentType is the media type of an encoded message
+const ContentType = "application/x-poker-wire"
+
+// Tag identifies the kind of message
+type Tag byte
+
+const (
+	TagSnapshot Tag = 1 // a whole view
+	TagDelta    Tag = 2 // the changes to the previous view
+	TagAction   Tag = 3 // an action taken by a seat
+)
+
+// Limits on what a decoder accepts, so that a malformed message can't make
+// it allocate much
+const (
+	maxPlayers = 64
+	maxCards   = 7
+	maxString  = 256
+	maxLegal   = 8
+	maxPayouts = 2 * maxPlayers
+)
+
+// ErrMalformed is returned for input that isn't a valid message
+var ErrMalformed = errors.New("malformed wire message")
+
+// Message is one decoded message. Exactly one of Snapshot, Delta and Action
+// is set, matching Tag.
+type Message struct {
+	Tag      Tag        `json:"tag"`
+	Snapshot *game.View `json:"snapshot,omitempty"`
+	Delta    *Delta     `json:"delta,omitempty"`
+	Action   *Action    `json:"action,omitempty"`
+}
+
+// Action is a seat's action, with the amount ProcessAction takes
+type Action struct {
+	Seat   int               `json:"seat"`
+	Action game.PlayerAction `json:"action"`
+	Amount int               `json:"amount"`
+}
+
+// EncodeSnapshot encodes a whole view
+func EncodeSnapshot(v *game.View) []byte {
+	w := &writer{buf: []byte{Version, byte(TagSnapshot)}}
+	w.view(v)
+	return w.buf
+}
+
+// EncodeDelta encodes the changes from one view to the next
+func EncodeDelta(prev, next *game.View) []byte {
+	w := &writer{buf: []byte{Version, byte(TagDelta)}}
+	w.delta(Diff(prev, next))
+	return w.buf
+}
+
+// EncodeAction encodes an action
+func EncodeAction(a Action) []byte {
+	w := &writer{buf: []byte{Version, byte(TagAction)}}
+	w.varint(a.Seat)
+	w.byte(byte(a.Action))
+	w.uvarint(a.Amount)
+	return w.buf
+}
+
+// Decode decodes one message. It never panics, whatever the input.
+func Decode(data []byte) (*Message, error) {
+	r := &reader{buf: data}
+	if v := r.byte(); r.err == nil && v != Version {
+		return nil, fmt.Errorf("%w: version %d", ErrMalformed, v)
+	}
+	m := &Message{Tag: Tag(r.byte())}
+	if r.err != nil {
+		return nil, r.err
+	}
+	switch m.Tag {
+	case TagSnapshot:
+		m.Snapshot = r.view()
+	case TagDelta:
+		m.Delta = r.delta()
+	case TagAction:
+		m.Action = &Action{Seat: r.varint(), Action: r.action(), Amount: r.uvarint()}
+	default:
+		return nil, fmt.Errorf("%w: tag %d", ErrMalformed, m.Tag)
+	}
+	if r.err == nil && len(r.buf) > 0 {
+		r.fail("%d trailing bytes", len(r.buf))
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// cardByte packs a card into a byte: rank from 0 for a two, times four, plus
+// the suit
+func cardByte(c game.Card) byte {
+	return byte(c.Rank-game.Two)*4 + byte(c.Suit)
+}
+
+// writer appends encoded values to buf
+type writer struct {
+	buf []byte
+}
+
+func (w *writer) byte(b byte) {
+	w.buf = append(w.buf, b)
+}
+
+func (w *writer) bool(b bool) {
+	if b {
+		w.byte(1)
+	} else {
+		w.byte(0)
+	}
+}
+
+// uvarint encodes an amount that can't be negative
+func (w *writer) uvarint(n int) {
+	if n < 0 {
+		n = 0
+	}
+	w.buf = binary.AppendUvarint(w.buf, uint64(n))
+}
+
+// varint encodes a number that can be negative, such as a seat that may be -1
+func (w *writer) varint(n int) {
+	w.buf = binary.AppendVarint(w.buf, int64(n))
+}
+
+func (w *writer) string(s string) {
+	w.uvarint(len(s))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *writer) cards(cards []game.Card) {
+	w.uvarint(len(cards))
+	for _, c := range cards {
+		w.byte(cardByte(c))
+	}
+}
+
+func (w *writer) view(v *game.View) {
+	w.string(v.Viewer)
+	w.varint(v.Seat)
+	w.byte(byte(v.Phase))
+	w.cards(v.Board)
+	w.uvarint(v.Pot)
+	w.uvarint(v.CurrentBet)
+	w.uvarint(v.MinRaise)
+	w.uvarint(v.SmallBlind)
+	w.uvarint(v.BigBlind)
+	w.uvarint(v.DealerPos)
+	w.uvarint(v.CurrentPos)
+	w.bool(v.HandOver)
+	w.uvarint(len(v.Players))
+	for _, p := range v.Players {
+		w.player(p)
+	}
+	w.legal(v.Legal)
+	w.payouts(v.Payouts)
+}
+
+func (w *writer) player(p game.SeatView) {
+	w.string(p.ID)
+	w.string(p.Name)
+	w.uvarint(p.Chips)
+	w.uvarint(p.Bet)
+	w.uvarint(p.TotalBet)
+	w.byte(byte(p.Status))
+	var flags byte
+	if p.HasCards {
+		flags |= 1
+	}
+	if p.Shown {
+		flags |= 2
+	}
+	w.byte(flags)
+	w.cards(p.Cards)
+}
+
+func (w *writer) legal(legal []game.LegalAction) {
+	w.uvarint(len(legal))
+	for _, a := range legal {
+		w.byte(byte(a.Action))
+		w.uvarint(a.Min)
+		w.uvarint(a.Max)
+	}
+}
+
+func (w *writer) payouts(payouts []game.Payout) {
+	w.uvarint(len(payouts))
+	for _, p := range payouts {
+		w.string(p.PlayerID)
+		w.varint(p.Pot)
+		w.uvarint(p.Amount)
+	}
+}
+
+// reader decodes values from buf. The first error sticks and every later
+// read returns a zero value, so callers check err once at the end.
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) fail(format string, args ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s", ErrMalformed, fmt.Sprintf(format, args...))
+	}
+	r.buf = nil
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.buf) == 0 {
+		r.fail("unexpected end of message")
+		return 0
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *reader) bool() bool {
+	switch r.byte() {
+	case 0:
+		return false
+	case 1:
+		return true
+	}
+	r.fail("invalid boolean")
+	return false
+}
+
+func (r *reader) uvarint() int {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 || v > 1<<62 {
+		r.fail("invalid varint")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return int(v)
+}
+
+func (r *reader) varint() int {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 || v > 1<<62 || v < -1<<62 {
+		r.fail("invalid varint")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return int(v)
+}
+
+// count reads a length, failing if it is above max
+func (r *reader) count(max int, what string) int {
+	n := r.uvarint()
+	if n > max {
+		r.fail("%d %s", n, what)
+		return 0
+	}
+	return n
+}
+
+func (r *reader) string() string {
+	n := r.count(maxString, "byte string")
+	if n > len(r.buf) {
+		r.fail("unexpected end of message")
+		return ""
+	}
+	s := string(r.buf[:n])
+	r.buf = r.buf[n:]
+	return s
+}
+
+func (r *reader) card() game.Card {
+	b := r.byte()
+	if b >= 52 {
+		r.fail("invalid card %d", b)
+		return game.Card{}
+	}
+	return game.Card{Rank: game.Two + game.Rank(b/4), Suit: game.Suit(b % 4)}
+}
+
+// cards reads a list of cards, which is nil when empty
+func (r *reader) cards(max int) []game.Card {
+	n := r.count(max, "cards")
+	if n == 0 {
+		return nil
+	}
+	cards := make([]game.Card, n)
+	for i := range cards {
+		cards[i] = r.card()
+	}
+	return cards
+}
+
+func (r *reader) phase() game.GamePhase {
+	p := r.byte()
+	if p > byte(game.Showdown) {
+		r.fail("invalid phase %d", p)
+	}
+	return game.GamePhase(p)
+}
+
+func (r *reader) status() game.PlayerStatus {
+	s := r.byte()
+	if s > byte(game.Out) {
+		r.fail("invalid status %d", s)
+	}
+	return game.PlayerStatus(s)
+}
+
+func (r *reader) action() game.PlayerAction {
+	a := r.byte()
+	if a > byte(game.AllIn) {
+		r.fail("invalid action %d", a)
+	}
+	return game.PlayerAction(a)
+}
+
+func (r *reader) view() *game.View {
+	v := &game.View{
+		Viewer: r.string(),
+		Seat:   r.varint(),
+		Phase:  r.phase(),
+	}
+	v.Board = r.cards(5)
+	if v.Board == nil {
+		v.Board = []game.Card{}
+	}
+	v.Pot = r.uvarint()
+	v.CurrentBet = r.uvarint()
+	v.MinRaise = r.uvarint()
+	v.SmallBlind = r.uvarint()
+	v.BigBlind = r.uvarint()
+	v.DealerPos = r.uvarint()
+	v.CurrentPos = r.uvarint()
+	v.HandOver = r.bool()
+	n := r.count(maxPlayers, "players")
+	for i := 0; i < n && r.err == nil; i++ {
+		v.Players = append(v.Players, r.player())
+	}
+	v.Legal = r.legal()
+	v.Payouts = r.payouts()
+	return v
+}
+
+func (r *reader) player() game.SeatView {
+	p := game.SeatView{
+		ID:       r.string(),
+		Name:     r.string(),
+		Chips:    r.uvarint(),
+		Bet:      r.uvarint(),
+		TotalBet: r.uvarint(),
+		Status:   r.status(),
+	}
+	flags := r.byte()
+	if flags > 3 {
+		r.fail("invalid player flags %d", flags)
+	}
+	p.HasCards, p.Shown = flags&1 != 0, flags&2 != 0
+	p.Cards = r.cards(maxCards)
+	return p
+}
+
+func (r *reader) legal() []game.LegalAction {
+	n := r.count(maxLegal, "legal actions")
+	var legal []game.LegalAction
+	for i := 0; i < n && r.err == nil; i++ {
+		legal = append(legal, game.LegalAction{Action: r.action(), Min: r.uvarint(), Max: r.uvarint()})
+	}
+	return legal
+}
+
+func (r *reader) payouts() []game.Payout {
+	n := r.count(maxPayouts, "payouts")
+	var payouts []game.Payout
+	for i := 0; i < n && r.err == nil; i++ {
+		payouts = append(payouts, game.Payout{PlayerID: r.string(), Pot: r.varint(), Amount: r.uvarint()})
+	}
+	return payouts
+}
@@ -0,0 +1,142 @@
+package wire
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"go-wasm-poker/pkg/game"
+)
+
+// playViews plays a few seeded hands, calling and checking down with a raise
+// now and then, and returns every seat's view and the spectator view after
+// each action, in order per viewer
+func playViews(t testing.TB) map[int][]*game.View {
+	t.Helper()
+	var players []*game.Player
+	for i := 0; i < 4; i++ {
+		players = append(players, game.NewPlayer(fmt.Sprintf("p%d", i), fmt.Sprintf("Player %d", i), 200+50*i, i))
+	}
+	g := game.NewGameState(players, 5, 10)
+	g.SetSeed(7)
+	views := map[int][]*game.View{}
+	record := func() {
+		for seat := -1; seat < len(g.Players); seat++ {
+			views[seat] = append(views[seat], g.ViewSeat(seat))
+		}
+	}
+	for hand := 0; hand < 6; hand++ {
+		g.StartNewHand()
+		record()
+		for n := 0; !g.IsHandOver(); n++ {
+			if n > 200 {
+				t.Fatal("hand never ended")
+			}
+			legal := g.LegalActions()
+			a := legal[1]
+			for _, l := range legal {
+				if l.Action == game.Raise && n%5 == 0 {
+					a = l
+				}
+			}
+			if !g.ProcessAction(a.Action, a.Min) {
+				t.Fatalf("%v %d rejected", a.Action, a.Min)
+			}
+			record()
+		}
+	}
+	return views
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	for seat, views := range playViews(t) {
+		for i, v := range views {
+			m, err := Decode(EncodeSnapshot(v))
+			if err != nil {
+				t.Fatalf("seat %d view %d: %v", seat, i, err)
+			}
+			if m.Tag != TagSnapshot || !reflect.DeepEqual(m.Snapshot, v) {
+				t.Fatalf("seat %d view %d decoded as\n%+v\nwant\n%+v", seat, i, m.Snapshot, v)
+			}
+		}
+	}
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	for seat, views := range playViews(t) {
+		// A client starts from a snapshot and applies deltas to it
+		m, err := Decode(EncodeSnapshot(views[0]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev := m.Snapshot
+		for i := 1; i < len(views); i++ {
+			v := views[i]
+			m, err := Decode(EncodeDelta(prev, v))
+			if err != nil {
+				t.Fatalf("seat %d view %d: %v", seat, i, err)
+			}
+			got, err := m.Delta.Apply(prev)
+			if err != nil {
+				t.Fatalf("seat %d view %d: %v", seat, i, err)
+			}
+			if !reflect.DeepEqual(got, v) {
+				t.Fatalf("seat %d view %d applied as\n%+v\nwant\n%+v", seat, i, got, v)
+			}
+			prev = got
+		}
+	}
+}
+
+func TestDeltaRejectsMissingPlayers(t *testing.T) {
+	d := &Delta{Fields: FieldPlayers, PlayerCount: 2, Players: []PlayerChange{{Index: 0}}}
+	if _, err := d.Apply(&game.View{}); err == nil {
+		t.Error("applied a delta that adds a player without sending it")
+	}
+	d = &Delta{Fields: FieldPlayers, PlayerCount: 1, Players: []PlayerChange{{Index: 3}}}
+	if _, err := d.Apply(&game.View{}); err == nil {
+		t.Error("applied a delta with a player index out of range")
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	views := playViews(f)
+	for _, seat := range []int{-1, 0} {
+		prev := &game.View{}
+		for _, v := range views[seat] {
+			f.Add(EncodeSnapshot(v))
+			f.Add(EncodeDelta(prev, v))
+			prev = v
+		}
+	}
+	f.Add(EncodeAction(Action{Seat: 2, Action: game.Raise, Amount: 40}))
+	f.Add(EncodeAction(Action{Seat: -1, Action: game.Fold}))
+	f.Add([]byte{Version})
+	f.Add([]byte{Version, 9})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := Decode(data)
+		if err != nil {
+			return
+		}
+		// Whatever decodes must encode again to the same message
+		var again []byte
+		switch m.Tag {
+		case TagSnapshot:
+			again = EncodeSnapshot(m.Snapshot)
+		case TagAction:
+			again = EncodeAction(*m.Action)
+		case TagDelta:
+			// A delta only means something against the view before it
+			m.Delta.Apply(&game.View{})
+			return
+		}
+		m2, err := Decode(again)
+		if err != nil {
+			t.Fatalf("re-encoding %+v: %v", m, err)
+		}
+		if !reflect.DeepEqual(m, m2) {
+			t.Fatalf("decoded %+v, re-encoded as %+v", m, m2)
+		}
+	})
+}